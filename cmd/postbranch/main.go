@@ -5,8 +5,10 @@ import (
 	"github.com/jamius19/postbranch/internal/db"
 	"github.com/jamius19/postbranch/internal/logger"
 	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/pg/adapter/host"
 	"github.com/jamius19/postbranch/internal/service/zfs"
 	"github.com/jamius19/postbranch/web"
+	"github.com/jamius19/postbranch/web/route"
 	"os"
 	"os/signal"
 	"sync"
@@ -27,13 +29,16 @@ func main() {
 	}
 	log.Info("Config loaded")
 
-	version, compatible := zfs.Version()
-
-	if !compatible {
-		log.Fatal("ZFS version is not compatible.")
+	version, err := zfs.CheckVersion()
+	if err != nil {
+		log.Fatalf("ZFS version is not compatible: %s", err)
 	}
 
-	log.Infof("Compatible ZFS version found (%s). Continuing...", *version)
+	log.Infof(
+		"Compatible ZFS version found (userland %s, kernel module %s). Continuing...",
+		version.Userland,
+		version.Kmod,
+	)
 
 	// Channel to listen for interrupt signal
 	stop := make(chan os.Signal, 1)
@@ -47,7 +52,9 @@ func main() {
 	var webWg = sync.WaitGroup{}
 	webWg.Add(1)
 
-	go web.Initialize(rootCtx, &webWg)
+	services := route.NewServices(zfs.CliBackend{}, zfs.LoopDevices{}, host.PgSource{})
+
+	go web.Initialize(rootCtx, services, &webWg)
 
 	<-stop
 	rootCancel()
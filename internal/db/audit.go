@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type AuditOutcome string
+
+const (
+	AuditSucceeded AuditOutcome = "SUCCEEDED"
+	AuditFailed    AuditOutcome = "FAILED"
+)
+
+type AuditFilter struct {
+	Actor   string
+	Action  string
+	Outcome string
+
+	// Target matches the events of the target and of everything under it
+	Target string
+	Since  *time.Time
+	Until  *time.Time
+
+	// AfterID pages through the log, only the events recorded after it are returned
+	AfterID     int32
+	OldestFirst bool
+	Limit       int64
+}
+
+func CreateAuditEvent(ctx context.Context, auditEvent model.AuditEvent) (model.AuditEvent, error) {
+	var newEvent model.AuditEvent
+
+	auditEvent.CreatedAt = time.Now().UTC()
+
+	stmt := table.AuditEvent.
+		INSERT(table.AuditEvent.AllColumns).
+		MODEL(auditEvent).
+		RETURNING(table.AuditEvent.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newEvent)
+	if err != nil {
+		log.Errorf("Can't create audit event: %s", err)
+		return model.AuditEvent{}, err
+	}
+
+	return newEvent, nil
+}
+
+// ListAuditEvents returns the matching events, newest first unless the filter asks otherwise
+func ListAuditEvents(ctx context.Context, filter AuditFilter) ([]model.AuditEvent, error) {
+	var auditEvents []model.AuditEvent
+
+	condition := sqlite.Bool(true)
+
+	if filter.Actor != "" {
+		condition = condition.AND(table.AuditEvent.Actor.EQ(sqlite.String(filter.Actor)))
+	}
+
+	if filter.Action != "" {
+		condition = condition.AND(table.AuditEvent.Action.EQ(sqlite.String(filter.Action)))
+	}
+
+	if filter.Outcome != "" {
+		condition = condition.AND(table.AuditEvent.Outcome.EQ(sqlite.String(filter.Outcome)))
+	}
+
+	if filter.Target != "" {
+		condition = condition.AND(
+			table.AuditEvent.Target.EQ(sqlite.String(filter.Target)).
+				OR(table.AuditEvent.Target.LIKE(sqlite.String(filter.Target + "/%"))),
+		)
+	}
+
+	if filter.Since != nil {
+		condition = condition.AND(table.AuditEvent.CreatedAt.GT_EQ(sqlite.DATETIME(filter.Since.UTC())))
+	}
+
+	if filter.Until != nil {
+		condition = condition.AND(table.AuditEvent.CreatedAt.LT(sqlite.DATETIME(filter.Until.UTC())))
+	}
+
+	if filter.AfterID > 0 {
+		condition = condition.AND(table.AuditEvent.ID.GT(sqlite.Int32(filter.AfterID)))
+	}
+
+	order := table.AuditEvent.ID.DESC()
+	if filter.OldestFirst {
+		order = table.AuditEvent.ID.ASC()
+	}
+
+	stmt := table.AuditEvent.
+		SELECT(table.AuditEvent.AllColumns).
+		WHERE(condition).
+		ORDER_BY(order).
+		LIMIT(filter.Limit)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &auditEvents)
+	if err != nil {
+		log.Errorf("Can't query audit events: %s", err)
+		return nil, err
+	}
+
+	return auditEvents, nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/go-jet/jet/v2/sqlite"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"github.com/jamius19/postbranch/internal/event"
 	"time"
 )
 
@@ -15,6 +16,7 @@ const (
 	BranchOpen   BranchStatus = "OPEN"
 	BranchMerged BranchStatus = "MERGED"
 	BranchClosed BranchStatus = "CLOSED"
+	BranchPurged BranchStatus = "PURGED"
 
 	BranchPgStarting BranchPgStatus = "STARTING"
 	BranchPgStopped  BranchPgStatus = "STOPPED"
@@ -44,6 +46,56 @@ func CreateBranch(ctx context.Context, branch model.Branch) (model.Branch, error
 	return newBranch, nil
 }
 
+// ReplacePurgedBranch creates the branch in place of the purged branch with the same name, the
+// record of the purged branch is kept if the branch can't be created
+func ReplacePurgedBranch(ctx context.Context, purgedBranchId int32, branch model.Branch) (model.Branch, error) {
+	var newBranch model.Branch
+
+	tx, err := Db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorf("Can't start transaction: %s", err)
+		return model.Branch{}, err
+	}
+	defer tx.Rollback()
+
+	deleteStmt := table.Branch.
+		DELETE().
+		WHERE(
+			table.Branch.ID.EQ(sqlite.Int32(purgedBranchId)).
+				AND(table.Branch.Status.EQ(sqlite.String(string(BranchPurged)))),
+		)
+
+	log.Tracef("Query: %s", deleteStmt.DebugSql())
+	_, err = deleteStmt.ExecContext(ctx, tx)
+	if err != nil {
+		log.Errorf("Can't delete purged branch: %s", err)
+		return model.Branch{}, err
+	}
+
+	branch.CreatedAt = time.Now().UTC()
+	branch.UpdatedAt = time.Now().UTC()
+
+	insertStmt := table.Branch.
+		INSERT(table.Branch.AllColumns).
+		MODEL(branch).
+		RETURNING(table.Branch.AllColumns)
+
+	log.Tracef("Query: %s", insertStmt.DebugSql())
+
+	err = insertStmt.QueryContext(ctx, tx, &newBranch)
+	if err != nil {
+		log.Errorf("Can't create branch: %s", err)
+		return model.Branch{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Can't commit branch: %s", err)
+		return model.Branch{}, err
+	}
+
+	return newBranch, nil
+}
+
 func UpdateBranchStatus(ctx context.Context, branchId int32, status BranchStatus) error {
 	stmt := table.Branch.
 		UPDATE(table.Branch.Status, table.Branch.UpdatedAt).
@@ -61,26 +113,193 @@ func UpdateBranchStatus(ctx context.Context, branchId int32, status BranchStatus
 }
 
 func UpdateBranchPgStatus(ctx context.Context, branchId int32, status BranchPgStatus) error {
+	var branch model.Branch
+
 	stmt := table.Branch.
 		UPDATE(table.Branch.PgStatus, table.Branch.UpdatedAt).
 		SET(table.Branch.PgStatus.SET(sqlite.String(string(status))), table.Branch.UpdatedAt.SET(sqlite.CURRENT_TIMESTAMP())).
-		WHERE(table.Branch.ID.EQ(sqlite.Int(int64(branchId))))
+		WHERE(table.Branch.ID.EQ(sqlite.Int(int64(branchId)))).
+		RETURNING(table.Branch.AllColumns)
 
 	log.Tracef("Query: %s", stmt.DebugSql())
-	_, err := stmt.ExecContext(ctx, Db)
+	err := stmt.QueryContext(ctx, Db, &branch)
 	if err != nil {
 		log.Errorf("Can't update branch pg status: %s", err)
 		return err
 	}
 
+	publishBranchPgStatus(ctx, branch)
 	return nil
 }
 
-func GetBranch(ctx context.Context, branchId int32) (model.Branch, error) {
+// CloseBranch marks the branch closed. The dataset of a closed branch is kept until the retention
+// period is over so that the branch can be reopened.
+func CloseBranch(ctx context.Context, branchId int32) error {
+	var branch model.Branch
+
+	stmt := table.Branch.
+		UPDATE(table.Branch.Status, table.Branch.PgStatus, table.Branch.ClosedAt, table.Branch.UpdatedAt).
+		SET(
+			sqlite.String(string(BranchClosed)),
+			sqlite.String(string(BranchPgStopped)),
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId))).
+		RETURNING(table.Branch.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	err := stmt.QueryContext(ctx, Db, &branch)
+	if err != nil {
+		log.Errorf("Can't close branch: %s", err)
+		return err
+	}
+
+	publishBranchPgStatus(ctx, branch)
+	return nil
+}
+
+// CloseBranches closes the branches and moves the dependents to their new parents in one transaction
+func CloseBranches(ctx context.Context, branchIds []int32, parents map[int32]*int32) error {
+	var closed []model.Branch
+
+	tx, err := Db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorf("Can't start transaction: %s", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for branchId, parentId := range parents {
+		parent := sqlite.Expression(sqlite.NULL)
+		if parentId != nil {
+			parent = sqlite.Int32(*parentId)
+		}
+
+		stmt := table.Branch.
+			UPDATE(table.Branch.ParentID, table.Branch.UpdatedAt).
+			SET(parent, sqlite.CURRENT_TIMESTAMP()).
+			WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId)))
+
+		log.Tracef("Query: %s", stmt.DebugSql())
+		if _, err := stmt.ExecContext(ctx, tx); err != nil {
+			log.Errorf("Can't update branch parent: %s", err)
+			return err
+		}
+	}
+
+	for _, branchId := range branchIds {
+		var branch model.Branch
+
+		stmt := table.Branch.
+			UPDATE(table.Branch.Status, table.Branch.PgStatus, table.Branch.ClosedAt, table.Branch.UpdatedAt).
+			SET(
+				sqlite.String(string(BranchClosed)),
+				sqlite.String(string(BranchPgStopped)),
+				sqlite.CURRENT_TIMESTAMP(),
+				sqlite.CURRENT_TIMESTAMP(),
+			).
+			WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId))).
+			RETURNING(table.Branch.AllColumns)
+
+		log.Tracef("Query: %s", stmt.DebugSql())
+		if err := stmt.QueryContext(ctx, tx, &branch); err != nil {
+			log.Errorf("Can't close branch: %s", err)
+			return err
+		}
+
+		closed = append(closed, branch)
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Errorf("Can't commit closed branches: %s", err)
+		return err
+	}
+
+	for _, branch := range closed {
+		publishBranchPgStatus(ctx, branch)
+	}
+
+	return nil
+}
+
+func ReopenBranch(ctx context.Context, branchId int32, port int32) (model.Branch, error) {
+	var branch model.Branch
+
+	stmt := table.Branch.
+		UPDATE(
+			table.Branch.Status,
+			table.Branch.PgStatus,
+			table.Branch.PgPort,
+			table.Branch.ClosedAt,
+			table.Branch.UpdatedAt,
+		).
+		SET(
+			sqlite.String(string(BranchOpen)),
+			sqlite.String(string(BranchPgStarting)),
+			sqlite.Int32(port),
+			sqlite.NULL,
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId))).
+		RETURNING(table.Branch.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &branch)
+	if err != nil {
+		log.Errorf("Can't reopen branch: %s", err)
+		return model.Branch{}, err
+	}
+
+	publishBranchPgStatus(ctx, branch)
+	return branch, nil
+}
+
+func DeleteBranch(ctx context.Context, branchId int32) error {
+	stmt := table.Branch.
+		DELETE().
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't delete branch: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateBranchParent(ctx context.Context, branchId int32, parentId *int32) error {
+	parent := sqlite.Expression(sqlite.NULL)
+	if parentId != nil {
+		parent = sqlite.Int32(*parentId)
+	}
+
+	stmt := table.Branch.
+		UPDATE(table.Branch.ParentID, table.Branch.UpdatedAt).
+		SET(parent, sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update branch parent: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func GetBranch(ctx context.Context, repoId int32, branchId int32) (model.Branch, error) {
 	var branch model.Branch
 	stmt := table.Branch.
 		SELECT(table.Branch.AllColumns).
-		WHERE(table.Branch.ID.EQ(sqlite.Int(int64(branchId))))
+		WHERE(
+			table.Branch.RepoID.EQ(sqlite.Int32(repoId)).
+				AND(table.Branch.ID.EQ(sqlite.Int32(branchId))),
+		)
 
 	log.Tracef("Query: %s", stmt.DebugSql())
 
@@ -93,11 +312,14 @@ func GetBranch(ctx context.Context, branchId int32) (model.Branch, error) {
 	return branch, nil
 }
 
-func GetBranchByName(ctx context.Context, branchName string) (model.Branch, error) {
+func GetBranchByName(ctx context.Context, repoId int32, branchName string) (model.Branch, error) {
 	var branch model.Branch
 	stmt := table.Branch.
 		SELECT(table.Branch.AllColumns).
-		WHERE(table.Branch.Name.EQ(sqlite.String(branchName)))
+		WHERE(
+			table.Branch.RepoID.EQ(sqlite.Int32(repoId)).
+				AND(table.Branch.Name.EQ(sqlite.String(branchName))),
+		)
 
 	log.Tracef("Query: %s", stmt.DebugSql())
 
@@ -115,7 +337,7 @@ func GetBranchPorts(ctx context.Context) ([]int32, error) {
 
 	stmt := table.Branch.SELECT(table.Branch.PgPort).
 		FROM(table.Branch).
-		WHERE(table.Branch.PgStatus.EQ(sqlite.String(string(BranchOpen))))
+		WHERE(table.Branch.Status.EQ(sqlite.String(string(BranchOpen))))
 
 	log.Tracef("Query: %s", stmt.DebugSql())
 
@@ -127,3 +349,105 @@ func GetBranchPorts(ctx context.Context) ([]int32, error) {
 
 	return ports, nil
 }
+
+// UpdateBranchQuota saves the storage limits of the branch, a nil limit is saved as no limit
+func UpdateBranchQuota(ctx context.Context, branch model.Branch) (model.Branch, error) {
+	var updatedBranch model.Branch
+
+	branch.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Branch.
+		UPDATE(
+			table.Branch.QuotaInMb,
+			table.Branch.RefquotaInMb,
+			table.Branch.ReservationInMb,
+			table.Branch.UpdatedAt,
+		).
+		MODEL(branch).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(*branch.ID))).
+		RETURNING(table.Branch.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedBranch)
+	if err != nil {
+		log.Errorf("Can't update branch quota: %s", err)
+		return model.Branch{}, err
+	}
+
+	return updatedBranch, nil
+}
+
+// UpdateBranchMetadata saves the owner, description and labels of the branch
+func UpdateBranchMetadata(ctx context.Context, branch model.Branch) (model.Branch, error) {
+	var updatedBranch model.Branch
+
+	branch.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Branch.
+		UPDATE(
+			table.Branch.Owner,
+			table.Branch.Description,
+			table.Branch.Labels,
+			table.Branch.UpdatedAt,
+		).
+		MODEL(branch).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(*branch.ID))).
+		RETURNING(table.Branch.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedBranch)
+	if err != nil {
+		log.Errorf("Can't update branch metadata: %s", err)
+		return model.Branch{}, err
+	}
+
+	return updatedBranch, nil
+}
+
+func UpdateBranchStorageError(ctx context.Context, branchId int32, storageError *string) error {
+	value := sqlite.Expression(sqlite.NULL)
+	if storageError != nil {
+		value = sqlite.String(*storageError)
+	}
+
+	stmt := table.Branch.
+		UPDATE(table.Branch.StorageError, table.Branch.UpdatedAt).
+		SET(value, sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.Branch.ID.EQ(sqlite.Int32(branchId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update branch storage error: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// publishBranchPgStatus sends the pg status of the branch to the event subscribers of its repo
+func publishBranchPgStatus(ctx context.Context, branch model.Branch) {
+	var repo model.Repo
+
+	stmt := table.Repo.
+		SELECT(table.Repo.Name).
+		WHERE(table.Repo.ID.EQ(sqlite.Int32(branch.RepoID)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &repo)
+	if err != nil {
+		log.Errorf("Can't query repo of branch %s: %s", branch.Name, err)
+		return
+	}
+
+	event.Publish(event.BranchPgStatus, repo.Name, branch.Name, event.BranchPgStatusData{
+		BranchID: *branch.ID,
+		Status:   branch.Status,
+		PgStatus: branch.PgStatus,
+		PgPort:   branch.PgPort,
+	})
+}
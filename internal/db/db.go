@@ -1,13 +1,20 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
+	"os"
+	"path/filepath"
+	"time"
 )
 
-const dbPath = "/var/lib/postbranch/postbranch.db"
+// busyTimeout is how long a query waits for the lock of another connection before it fails
+const busyTimeout = 5 * time.Second
 
 var log = logger.Logger
 var Db *sql.DB
@@ -15,18 +22,29 @@ var Db *sql.DB
 func Initialize() func() {
 	var err error
 
-	Db, err = sql.Open("sqlite3", "/home/jamius19/.postbranch/main.db")
+	dbPath := opts.Config.Database.Path
+
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+		log.Fatalf("Can't create database directory: %s", err)
+	}
+
+	// The pragmas are set through the DSN so that every connection of the pool gets them, WAL lets
+	// the background jobs write while the API is reading
+	Db, err = sql.Open("sqlite3", fmt.Sprintf(
+		"%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d",
+		dbPath,
+		busyTimeout.Milliseconds(),
+	))
+
 	if err != nil {
 		logger.Logger.Fatal(err)
 	}
 
-	_, err = Db.Exec("PRAGMA foreign_keys=ON")
-	if err != nil {
-		log.Errorf("Can't set PRAGMA foreign_keys: %s", err)
-		return nil
+	if err := Migrate(context.Background()); err != nil {
+		log.Fatalf("Can't migrate database: %s", err)
 	}
 
-	log.Info("Initialized database")
+	log.Infof("Initialized database at %s", dbPath)
 	return func() {
 		err := Db.Close()
 		if err != nil {
@@ -12,13 +12,22 @@ import (
 )
 
 type Branch struct {
-	ID        *int32 `sql:"primary_key"`
-	Name      string
-	Status    string
-	PgStatus  string
-	PgPort    int32
-	RepoID    int32
-	ParentID  *int32
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID              *int32 `sql:"primary_key"`
+	Name            string
+	Status          string
+	PgStatus        string
+	PgPort          int32
+	RepoID          int32
+	ParentID        *int32
+	QuotaInMb       *int64
+	RefquotaInMb    *int64
+	ReservationInMb *int64
+	StorageError    *string
+	OwnerTokenID    *int32
+	Owner           *string
+	Description     *string
+	Labels          *string
+	ClosedAt        *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
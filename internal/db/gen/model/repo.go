@@ -12,14 +12,20 @@ import (
 )
 
 type Repo struct {
-	ID        *int32 `sql:"primary_key"`
-	Name      string
-	PgPath    string
-	Version   int32
-	Status    string
-	Output    *string
-	Adapter   string
-	PoolID    int32
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                     *int32 `sql:"primary_key"`
+	Name                   string
+	PgPath                 string
+	Version                int32
+	Status                 string
+	Output                 *string
+	Adapter                string
+	PoolID                 int32
+	DefaultQuotaInMb       *int64
+	DefaultRefquotaInMb    *int64
+	DefaultReservationInMb *int64
+	Owner                  *string
+	Description            *string
+	Labels                 *string
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
 }
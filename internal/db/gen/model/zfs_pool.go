@@ -12,12 +12,14 @@ import (
 )
 
 type ZfsPool struct {
-	ID        *int32 `sql:"primary_key"`
-	Path      string
-	SizeInMb  int64
-	Name      string
-	MountPath string
-	PoolType  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          *int32 `sql:"primary_key"`
+	Path        string
+	SizeInMb    int64
+	Name        string
+	MountPath   string
+	PoolType    string
+	Encryption  *string
+	KeyLocation *string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
 }
@@ -17,15 +17,24 @@ type branchTable struct {
 	sqlite.Table
 
 	// Columns
-	ID        sqlite.ColumnInteger
-	Name      sqlite.ColumnString
-	Status    sqlite.ColumnString
-	PgStatus  sqlite.ColumnString
-	PgPort    sqlite.ColumnInteger
-	RepoID    sqlite.ColumnInteger
-	ParentID  sqlite.ColumnInteger
-	CreatedAt sqlite.ColumnTimestamp
-	UpdatedAt sqlite.ColumnTimestamp
+	ID              sqlite.ColumnInteger
+	Name            sqlite.ColumnString
+	Status          sqlite.ColumnString
+	PgStatus        sqlite.ColumnString
+	PgPort          sqlite.ColumnInteger
+	RepoID          sqlite.ColumnInteger
+	ParentID        sqlite.ColumnInteger
+	QuotaInMb       sqlite.ColumnInteger
+	RefquotaInMb    sqlite.ColumnInteger
+	ReservationInMb sqlite.ColumnInteger
+	StorageError    sqlite.ColumnString
+	OwnerTokenID    sqlite.ColumnInteger
+	Owner           sqlite.ColumnString
+	Description     sqlite.ColumnString
+	Labels          sqlite.ColumnString
+	ClosedAt        sqlite.ColumnTimestamp
+	CreatedAt       sqlite.ColumnTimestamp
+	UpdatedAt       sqlite.ColumnTimestamp
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -66,32 +75,50 @@ func newBranchTable(schemaName, tableName, alias string) *BranchTable {
 
 func newBranchTableImpl(schemaName, tableName, alias string) branchTable {
 	var (
-		IDColumn        = sqlite.IntegerColumn("id")
-		NameColumn      = sqlite.StringColumn("name")
-		StatusColumn    = sqlite.StringColumn("status")
-		PgStatusColumn  = sqlite.StringColumn("pg_status")
-		PgPortColumn    = sqlite.IntegerColumn("pg_port")
-		RepoIDColumn    = sqlite.IntegerColumn("repo_id")
-		ParentIDColumn  = sqlite.IntegerColumn("parent_id")
-		CreatedAtColumn = sqlite.TimestampColumn("created_at")
-		UpdatedAtColumn = sqlite.TimestampColumn("updated_at")
-		allColumns      = sqlite.ColumnList{IDColumn, NameColumn, StatusColumn, PgStatusColumn, PgPortColumn, RepoIDColumn, ParentIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns  = sqlite.ColumnList{NameColumn, StatusColumn, PgStatusColumn, PgPortColumn, RepoIDColumn, ParentIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		IDColumn              = sqlite.IntegerColumn("id")
+		NameColumn            = sqlite.StringColumn("name")
+		StatusColumn          = sqlite.StringColumn("status")
+		PgStatusColumn        = sqlite.StringColumn("pg_status")
+		PgPortColumn          = sqlite.IntegerColumn("pg_port")
+		RepoIDColumn          = sqlite.IntegerColumn("repo_id")
+		ParentIDColumn        = sqlite.IntegerColumn("parent_id")
+		QuotaInMbColumn       = sqlite.IntegerColumn("quota_in_mb")
+		RefquotaInMbColumn    = sqlite.IntegerColumn("refquota_in_mb")
+		ReservationInMbColumn = sqlite.IntegerColumn("reservation_in_mb")
+		StorageErrorColumn    = sqlite.StringColumn("storage_error")
+		OwnerTokenIDColumn    = sqlite.IntegerColumn("owner_token_id")
+		OwnerColumn           = sqlite.StringColumn("owner")
+		DescriptionColumn     = sqlite.StringColumn("description")
+		LabelsColumn          = sqlite.StringColumn("labels")
+		ClosedAtColumn        = sqlite.TimestampColumn("closed_at")
+		CreatedAtColumn       = sqlite.TimestampColumn("created_at")
+		UpdatedAtColumn       = sqlite.TimestampColumn("updated_at")
+		allColumns            = sqlite.ColumnList{IDColumn, NameColumn, StatusColumn, PgStatusColumn, PgPortColumn, RepoIDColumn, ParentIDColumn, QuotaInMbColumn, RefquotaInMbColumn, ReservationInMbColumn, StorageErrorColumn, OwnerTokenIDColumn, OwnerColumn, DescriptionColumn, LabelsColumn, ClosedAtColumn, CreatedAtColumn, UpdatedAtColumn}
+		mutableColumns        = sqlite.ColumnList{NameColumn, StatusColumn, PgStatusColumn, PgPortColumn, RepoIDColumn, ParentIDColumn, QuotaInMbColumn, RefquotaInMbColumn, ReservationInMbColumn, StorageErrorColumn, OwnerTokenIDColumn, OwnerColumn, DescriptionColumn, LabelsColumn, ClosedAtColumn, CreatedAtColumn, UpdatedAtColumn}
 	)
 
 	return branchTable{
 		Table: sqlite.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
-		ID:        IDColumn,
-		Name:      NameColumn,
-		Status:    StatusColumn,
-		PgStatus:  PgStatusColumn,
-		PgPort:    PgPortColumn,
-		RepoID:    RepoIDColumn,
-		ParentID:  ParentIDColumn,
-		CreatedAt: CreatedAtColumn,
-		UpdatedAt: UpdatedAtColumn,
+		ID:              IDColumn,
+		Name:            NameColumn,
+		Status:          StatusColumn,
+		PgStatus:        PgStatusColumn,
+		PgPort:          PgPortColumn,
+		RepoID:          RepoIDColumn,
+		ParentID:        ParentIDColumn,
+		QuotaInMb:       QuotaInMbColumn,
+		RefquotaInMb:    RefquotaInMbColumn,
+		ReservationInMb: ReservationInMbColumn,
+		StorageError:    StorageErrorColumn,
+		OwnerTokenID:    OwnerTokenIDColumn,
+		Owner:           OwnerColumn,
+		Description:     DescriptionColumn,
+		Labels:          LabelsColumn,
+		ClosedAt:        ClosedAtColumn,
+		CreatedAt:       CreatedAtColumn,
+		UpdatedAt:       UpdatedAtColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
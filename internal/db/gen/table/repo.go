@@ -17,16 +17,22 @@ type repoTable struct {
 	sqlite.Table
 
 	// Columns
-	ID        sqlite.ColumnInteger
-	Name      sqlite.ColumnString
-	PgPath    sqlite.ColumnString
-	Version   sqlite.ColumnInteger
-	Status    sqlite.ColumnString
-	Output    sqlite.ColumnString
-	Adapter   sqlite.ColumnString
-	PoolID    sqlite.ColumnInteger
-	CreatedAt sqlite.ColumnTimestamp
-	UpdatedAt sqlite.ColumnTimestamp
+	ID                     sqlite.ColumnInteger
+	Name                   sqlite.ColumnString
+	PgPath                 sqlite.ColumnString
+	Version                sqlite.ColumnInteger
+	Status                 sqlite.ColumnString
+	Output                 sqlite.ColumnString
+	Adapter                sqlite.ColumnString
+	PoolID                 sqlite.ColumnInteger
+	DefaultQuotaInMb       sqlite.ColumnInteger
+	DefaultRefquotaInMb    sqlite.ColumnInteger
+	DefaultReservationInMb sqlite.ColumnInteger
+	Owner                  sqlite.ColumnString
+	Description            sqlite.ColumnString
+	Labels                 sqlite.ColumnString
+	CreatedAt              sqlite.ColumnTimestamp
+	UpdatedAt              sqlite.ColumnTimestamp
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -67,34 +73,46 @@ func newRepoTable(schemaName, tableName, alias string) *RepoTable {
 
 func newRepoTableImpl(schemaName, tableName, alias string) repoTable {
 	var (
-		IDColumn        = sqlite.IntegerColumn("id")
-		NameColumn      = sqlite.StringColumn("name")
-		PgPathColumn    = sqlite.StringColumn("pg_path")
-		VersionColumn   = sqlite.IntegerColumn("version")
-		StatusColumn    = sqlite.StringColumn("status")
-		OutputColumn    = sqlite.StringColumn("output")
-		AdapterColumn   = sqlite.StringColumn("adapter")
-		PoolIDColumn    = sqlite.IntegerColumn("pool_id")
-		CreatedAtColumn = sqlite.TimestampColumn("created_at")
-		UpdatedAtColumn = sqlite.TimestampColumn("updated_at")
-		allColumns      = sqlite.ColumnList{IDColumn, NameColumn, PgPathColumn, VersionColumn, StatusColumn, OutputColumn, AdapterColumn, PoolIDColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns  = sqlite.ColumnList{NameColumn, PgPathColumn, VersionColumn, StatusColumn, OutputColumn, AdapterColumn, PoolIDColumn, CreatedAtColumn, UpdatedAtColumn}
+		IDColumn                     = sqlite.IntegerColumn("id")
+		NameColumn                   = sqlite.StringColumn("name")
+		PgPathColumn                 = sqlite.StringColumn("pg_path")
+		VersionColumn                = sqlite.IntegerColumn("version")
+		StatusColumn                 = sqlite.StringColumn("status")
+		OutputColumn                 = sqlite.StringColumn("output")
+		AdapterColumn                = sqlite.StringColumn("adapter")
+		PoolIDColumn                 = sqlite.IntegerColumn("pool_id")
+		DefaultQuotaInMbColumn       = sqlite.IntegerColumn("default_quota_in_mb")
+		DefaultRefquotaInMbColumn    = sqlite.IntegerColumn("default_refquota_in_mb")
+		DefaultReservationInMbColumn = sqlite.IntegerColumn("default_reservation_in_mb")
+		OwnerColumn                  = sqlite.StringColumn("owner")
+		DescriptionColumn            = sqlite.StringColumn("description")
+		LabelsColumn                 = sqlite.StringColumn("labels")
+		CreatedAtColumn              = sqlite.TimestampColumn("created_at")
+		UpdatedAtColumn              = sqlite.TimestampColumn("updated_at")
+		allColumns                   = sqlite.ColumnList{IDColumn, NameColumn, PgPathColumn, VersionColumn, StatusColumn, OutputColumn, AdapterColumn, PoolIDColumn, DefaultQuotaInMbColumn, DefaultRefquotaInMbColumn, DefaultReservationInMbColumn, OwnerColumn, DescriptionColumn, LabelsColumn, CreatedAtColumn, UpdatedAtColumn}
+		mutableColumns               = sqlite.ColumnList{NameColumn, PgPathColumn, VersionColumn, StatusColumn, OutputColumn, AdapterColumn, PoolIDColumn, DefaultQuotaInMbColumn, DefaultRefquotaInMbColumn, DefaultReservationInMbColumn, OwnerColumn, DescriptionColumn, LabelsColumn, CreatedAtColumn, UpdatedAtColumn}
 	)
 
 	return repoTable{
 		Table: sqlite.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
-		ID:        IDColumn,
-		Name:      NameColumn,
-		PgPath:    PgPathColumn,
-		Version:   VersionColumn,
-		Status:    StatusColumn,
-		Output:    OutputColumn,
-		Adapter:   AdapterColumn,
-		PoolID:    PoolIDColumn,
-		CreatedAt: CreatedAtColumn,
-		UpdatedAt: UpdatedAtColumn,
+		ID:                     IDColumn,
+		Name:                   NameColumn,
+		PgPath:                 PgPathColumn,
+		Version:                VersionColumn,
+		Status:                 StatusColumn,
+		Output:                 OutputColumn,
+		Adapter:                AdapterColumn,
+		PoolID:                 PoolIDColumn,
+		DefaultQuotaInMb:       DefaultQuotaInMbColumn,
+		DefaultRefquotaInMb:    DefaultRefquotaInMbColumn,
+		DefaultReservationInMb: DefaultReservationInMbColumn,
+		Owner:                  OwnerColumn,
+		Description:            DescriptionColumn,
+		Labels:                 LabelsColumn,
+		CreatedAt:              CreatedAtColumn,
+		UpdatedAt:              UpdatedAtColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
@@ -10,7 +10,16 @@ package table
 // UseSchema sets a new schema name for all generated table SQL builder types. It is recommended to invoke
 // this method only once at the beginning of the program.
 func UseSchema(schema string) {
+	APIToken = APIToken.FromSchema(schema)
+	APITokenRepo = APITokenRepo.FromSchema(schema)
+	AuditEvent = AuditEvent.FromSchema(schema)
 	Branch = Branch.FromSchema(schema)
+	Job = Job.FromSchema(schema)
+	PoolScrub = PoolScrub.FromSchema(schema)
+	PrPreview = PrPreview.FromSchema(schema)
+	ReplicationTarget = ReplicationTarget.FromSchema(schema)
 	Repo = Repo.FromSchema(schema)
+	Webhook = Webhook.FromSchema(schema)
+	WebhookDelivery = WebhookDelivery.FromSchema(schema)
 	ZfsPool = ZfsPool.FromSchema(schema)
 }
@@ -17,14 +17,16 @@ type zfsPoolTable struct {
 	sqlite.Table
 
 	// Columns
-	ID        sqlite.ColumnInteger
-	Path      sqlite.ColumnString
-	SizeInMb  sqlite.ColumnInteger
-	Name      sqlite.ColumnString
-	MountPath sqlite.ColumnString
-	PoolType  sqlite.ColumnString
-	CreatedAt sqlite.ColumnTimestamp
-	UpdatedAt sqlite.ColumnTimestamp
+	ID          sqlite.ColumnInteger
+	Path        sqlite.ColumnString
+	SizeInMb    sqlite.ColumnInteger
+	Name        sqlite.ColumnString
+	MountPath   sqlite.ColumnString
+	PoolType    sqlite.ColumnString
+	Encryption  sqlite.ColumnString
+	KeyLocation sqlite.ColumnString
+	CreatedAt   sqlite.ColumnTimestamp
+	UpdatedAt   sqlite.ColumnTimestamp
 
 	AllColumns     sqlite.ColumnList
 	MutableColumns sqlite.ColumnList
@@ -65,30 +67,34 @@ func newZfsPoolTable(schemaName, tableName, alias string) *ZfsPoolTable {
 
 func newZfsPoolTableImpl(schemaName, tableName, alias string) zfsPoolTable {
 	var (
-		IDColumn        = sqlite.IntegerColumn("id")
-		PathColumn      = sqlite.StringColumn("path")
-		SizeInMbColumn  = sqlite.IntegerColumn("size_in_mb")
-		NameColumn      = sqlite.StringColumn("name")
-		MountPathColumn = sqlite.StringColumn("mount_path")
-		PoolTypeColumn  = sqlite.StringColumn("pool_type")
-		CreatedAtColumn = sqlite.TimestampColumn("created_at")
-		UpdatedAtColumn = sqlite.TimestampColumn("updated_at")
-		allColumns      = sqlite.ColumnList{IDColumn, PathColumn, SizeInMbColumn, NameColumn, MountPathColumn, PoolTypeColumn, CreatedAtColumn, UpdatedAtColumn}
-		mutableColumns  = sqlite.ColumnList{PathColumn, SizeInMbColumn, NameColumn, MountPathColumn, PoolTypeColumn, CreatedAtColumn, UpdatedAtColumn}
+		IDColumn          = sqlite.IntegerColumn("id")
+		PathColumn        = sqlite.StringColumn("path")
+		SizeInMbColumn    = sqlite.IntegerColumn("size_in_mb")
+		NameColumn        = sqlite.StringColumn("name")
+		MountPathColumn   = sqlite.StringColumn("mount_path")
+		PoolTypeColumn    = sqlite.StringColumn("pool_type")
+		EncryptionColumn  = sqlite.StringColumn("encryption")
+		KeyLocationColumn = sqlite.StringColumn("key_location")
+		CreatedAtColumn   = sqlite.TimestampColumn("created_at")
+		UpdatedAtColumn   = sqlite.TimestampColumn("updated_at")
+		allColumns        = sqlite.ColumnList{IDColumn, PathColumn, SizeInMbColumn, NameColumn, MountPathColumn, PoolTypeColumn, EncryptionColumn, KeyLocationColumn, CreatedAtColumn, UpdatedAtColumn}
+		mutableColumns    = sqlite.ColumnList{PathColumn, SizeInMbColumn, NameColumn, MountPathColumn, PoolTypeColumn, EncryptionColumn, KeyLocationColumn, CreatedAtColumn, UpdatedAtColumn}
 	)
 
 	return zfsPoolTable{
 		Table: sqlite.NewTable(schemaName, tableName, alias, allColumns...),
 
 		//Columns
-		ID:        IDColumn,
-		Path:      PathColumn,
-		SizeInMb:  SizeInMbColumn,
-		Name:      NameColumn,
-		MountPath: MountPathColumn,
-		PoolType:  PoolTypeColumn,
-		CreatedAt: CreatedAtColumn,
-		UpdatedAt: UpdatedAtColumn,
+		ID:          IDColumn,
+		Path:        PathColumn,
+		SizeInMb:    SizeInMbColumn,
+		Name:        NameColumn,
+		MountPath:   MountPathColumn,
+		PoolType:    PoolTypeColumn,
+		Encryption:  EncryptionColumn,
+		KeyLocation: KeyLocationColumn,
+		CreatedAt:   CreatedAtColumn,
+		UpdatedAt:   UpdatedAtColumn,
 
 		AllColumns:     allColumns,
 		MutableColumns: mutableColumns,
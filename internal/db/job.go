@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type JobType string
+
+const (
+	JobImport          JobType = "IMPORT"
+	JobStartBranch     JobType = "START_BRANCH"
+	JobUnlock          JobType = "UNLOCK"
+	JobReplicationSync JobType = "REPLICATION_SYNC"
+	JobExportBranch    JobType = "EXPORT_BRANCH"
+	JobImportBranch    JobType = "IMPORT_BRANCH"
+	JobResizePool      JobType = "RESIZE_POOL"
+	JobScrub           JobType = "SCRUB"
+)
+
+type JobState string
+
+const (
+	JobRunning   JobState = "RUNNING"
+	JobSucceeded JobState = "SUCCEEDED"
+	JobFailed    JobState = "FAILED"
+	JobCanceled  JobState = "CANCELED"
+)
+
+// JobFilter narrows down ListJobs, empty fields match every job
+type JobFilter struct {
+	Type  string
+	State string
+
+	// Repo matches the jobs of the repo and of its branches and targets
+	Repo string
+
+	// Repos limits the jobs to the ones of the given repos, nil doesn't limit them
+	Repos []string
+	Limit int64
+}
+
+func CreateJob(ctx context.Context, jobType JobType, target string) (model.Job, error) {
+	var newJob model.Job
+
+	job := model.Job{
+		Type:      string(jobType),
+		Target:    target,
+		State:     string(JobRunning),
+		StartedAt: time.Now().UTC(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	stmt := table.Job.
+		INSERT(table.Job.AllColumns).
+		MODEL(job).
+		RETURNING(table.Job.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newJob)
+	if err != nil {
+		log.Errorf("Can't insert job: %s", err)
+		return model.Job{}, err
+	}
+
+	return newJob, nil
+}
+
+func GetJob(ctx context.Context, jobId int32) (model.Job, error) {
+	var job model.Job
+
+	stmt := table.Job.
+		SELECT(table.Job.AllColumns).
+		WHERE(table.Job.ID.EQ(sqlite.Int32(jobId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &job)
+	if err != nil {
+		log.Errorf("Can't query job: %s", err)
+		return model.Job{}, err
+	}
+
+	return job, nil
+}
+
+// ListJobs returns the jobs matching the filter, newest first
+func ListJobs(ctx context.Context, filter JobFilter) ([]model.Job, error) {
+	var jobs []model.Job
+
+	condition := sqlite.Bool(true)
+
+	if filter.Type != "" {
+		condition = condition.AND(table.Job.Type.EQ(sqlite.String(filter.Type)))
+	}
+
+	if filter.State != "" {
+		condition = condition.AND(table.Job.State.EQ(sqlite.String(filter.State)))
+	}
+
+	if filter.Repo != "" {
+		condition = condition.AND(jobOfRepo(filter.Repo))
+	}
+
+	// The repos are filtered before the limit, so a limited caller still gets up to limit jobs
+	if filter.Repos != nil {
+		reposCondition := sqlite.Bool(false)
+		for _, repo := range filter.Repos {
+			reposCondition = reposCondition.OR(jobOfRepo(repo))
+		}
+
+		condition = condition.AND(reposCondition)
+	}
+
+	stmt := table.Job.
+		SELECT(table.Job.AllColumns).
+		WHERE(condition).
+		ORDER_BY(table.Job.ID.DESC()).
+		LIMIT(filter.Limit)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &jobs)
+	if err != nil {
+		log.Errorf("Can't query jobs: %s", err)
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// jobOfRepo matches the jobs targeting the repo or anything in it. The prefix is compared as is,
+// repo names can contain LIKE wildcards.
+func jobOfRepo(repo string) sqlite.BoolExpression {
+	prefix := repo + "/"
+
+	return table.Job.Target.EQ(sqlite.String(repo)).
+		OR(sqlite.SUBSTR(table.Job.Target, sqlite.Int(1), sqlite.Int(int64(len(prefix)))).EQ(sqlite.String(prefix)))
+}
+
+func UpdateJobProgress(ctx context.Context, jobId int32, progress int64, step string) error {
+	stmt := table.Job.
+		UPDATE(table.Job.Progress, table.Job.Step, table.Job.UpdatedAt).
+		SET(sqlite.Int(progress), sqlite.String(step), sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.Job.ID.EQ(sqlite.Int32(jobId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update job progress: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func FinishJob(ctx context.Context, jobId int32, state JobState, output string, jobError *string) error {
+	errorMessage := sqlite.Expression(sqlite.NULL)
+	if jobError != nil {
+		errorMessage = sqlite.String(*jobError)
+	}
+
+	progress := sqlite.Expression(table.Job.Progress)
+	if state == JobSucceeded {
+		progress = sqlite.Int(100)
+	}
+
+	stmt := table.Job.
+		UPDATE(
+			table.Job.State,
+			table.Job.Progress,
+			table.Job.Output,
+			table.Job.Error,
+			table.Job.FinishedAt,
+			table.Job.UpdatedAt,
+		).
+		SET(
+			sqlite.String(string(state)),
+			progress,
+			sqlite.String(output),
+			errorMessage,
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.Job.ID.EQ(sqlite.Int32(jobId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't finish job: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// FailRunningJobs fails the jobs that were still running when PostBranch stopped
+func FailRunningJobs(ctx context.Context, reason string) (int64, error) {
+	stmt := table.Job.
+		UPDATE(table.Job.State, table.Job.Error, table.Job.FinishedAt, table.Job.UpdatedAt).
+		SET(
+			sqlite.String(string(JobFailed)),
+			sqlite.String(reason),
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.Job.State.EQ(sqlite.String(string(JobRunning))))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	result, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't fail running jobs: %s", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/schema"
+)
+
+const migrationTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migration
+	(
+		version    INTEGER PRIMARY KEY,
+		name       VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);`
+
+// Migrate applies the migrations that haven't been applied to the database yet and records them
+func Migrate(ctx context.Context) error {
+	if _, err := Db.ExecContext(ctx, migrationTableQuery); err != nil {
+		log.Errorf("Can't create migration table: %s", err)
+		return err
+	}
+
+	applied, err := appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		if err := adoptInitialSchema(ctx, applied); err != nil {
+			return err
+		}
+	}
+
+	latest := schema.Migrations[len(schema.Migrations)-1].Version
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database is at version %d, newer than the latest known version %d", version, latest)
+		}
+	}
+
+	for _, migration := range schema.Migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		if err := applyMigration(ctx, migration); err != nil {
+			return err
+		}
+
+		log.Infof("Applied database migration %d: %s", migration.Version, migration.Name)
+	}
+
+	return nil
+}
+
+func appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	rows, err := Db.QueryContext(ctx, "SELECT version FROM schema_migration")
+	if err != nil {
+		log.Errorf("Can't query applied migrations: %s", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// adoptInitialSchema records the first migration as applied to databases that were created from the
+// schema files before migrations existed, their tables can't be created again
+func adoptInitialSchema(ctx context.Context, applied map[int]bool) error {
+	var tables int
+	err := Db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'repo'").
+		Scan(&tables)
+
+	if err != nil {
+		log.Errorf("Can't check for an existing schema: %s", err)
+		return err
+	}
+
+	if tables == 0 {
+		return nil
+	}
+
+	initial := schema.Migrations[0]
+	_, err = Db.ExecContext(
+		ctx,
+		"INSERT INTO schema_migration (version, name) VALUES (?, ?)",
+		initial.Version,
+		initial.Name,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", initial.Version, err)
+	}
+
+	applied[initial.Version] = true
+	log.Infof("Adopted existing database as migration %d: %s", initial.Version, initial.Name)
+
+	return nil
+}
+
+// applyMigration runs the migration in a transaction with the foreign keys turned off, so tables can
+// be rebuilt without their rows cascading. The foreign keys are checked before it's committed.
+func applyMigration(ctx context.Context, migration schema.Migration) error {
+	conn, err := Db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The pragma can't be changed inside a transaction, so it's set on the connection instead
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "PRAGMA foreign_keys = ON"); err != nil {
+			log.Errorf("Can't turn foreign keys back on: %s", err)
+		}
+	}()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, file := range migration.Files {
+		query, err := schema.Files.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+
+		if _, err := tx.ExecContext(ctx, string(query)); err != nil {
+			log.Errorf("Can't apply %s of migration %d: %s", file, migration.Version, err)
+			return fmt.Errorf("migration %d, %s: %w", migration.Version, file, err)
+		}
+	}
+
+	violations, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return fmt.Errorf("migration %d: failed to check foreign keys: %w", migration.Version, err)
+	}
+
+	broken := violations.Next()
+	if err := violations.Close(); err != nil {
+		return err
+	}
+
+	if broken {
+		return fmt.Errorf("migration %d leaves rows with broken foreign keys", migration.Version)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO schema_migration (version, name) VALUES (?, ?)",
+		migration.Version,
+		migration.Name,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+	}
+
+	return tx.Commit()
+}
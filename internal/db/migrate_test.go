@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/schema"
+)
+
+func openDatabase(t *testing.T, dbPath string) {
+	t.Helper()
+
+	opts.Config = &opts.Opts{}
+	opts.Config.Database.Path = dbPath
+
+	t.Cleanup(Initialize())
+}
+
+func requireAllMigrations(t *testing.T) {
+	t.Helper()
+
+	var versions int
+	if err := Db.QueryRow("SELECT COUNT(*) FROM schema_migration").Scan(&versions); err != nil {
+		t.Fatalf("can't count migrations: %s", err)
+	}
+
+	if versions != len(schema.Migrations) {
+		t.Fatalf("%d migrations recorded, want %d", versions, len(schema.Migrations))
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	openDatabase(t, filepath.Join(t.TempDir(), "postbranch.db"))
+	requireAllMigrations(t)
+
+	// A second start has nothing left to apply
+	if err := Migrate(context.Background()); err != nil {
+		t.Fatalf("migrating again failed: %s", err)
+	}
+
+	requireAllMigrations(t)
+}
+
+// TestMigratePreSeriesDatabase upgrades a database that was created from the schema files before
+// migrations existed
+func TestMigratePreSeriesDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "postbranch.db")
+
+	legacy, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatalf("can't open database: %s", err)
+	}
+
+	for _, file := range schema.Migrations[0].Files {
+		query, _ := schema.Files.ReadFile(file)
+		if _, err := legacy.Exec(string(query)); err != nil {
+			t.Fatalf("can't create %s: %s", file, err)
+		}
+	}
+
+	rows := []string{
+		`INSERT INTO zfs_pool (id, path, size_in_mb, name, mount_path, pool_type)
+		 VALUES (1, '/images/shop.img', 1024, 'shop', '/mnt/pb-shop', 'virtual')`,
+		`INSERT INTO repo (id, name, pg_path, version, status, adapter, pool_id)
+		 VALUES (1, 'shop', '/usr/lib/postgresql/16', 16, 'COMPLETED', 'host', 1)`,
+		`INSERT INTO branch (id, name, status, pg_status, pg_port, repo_id, parent_id)
+		 VALUES (1, 'main', 'OPEN', 'RUNNING', 5450, 1, NULL)`,
+		`INSERT INTO branch (id, name, status, pg_status, pg_port, repo_id, parent_id)
+		 VALUES (2, 'feature', 'OPEN', 'RUNNING', 5451, 1, 1)`,
+	}
+
+	for _, row := range rows {
+		if _, err := legacy.Exec(row); err != nil {
+			t.Fatalf("can't insert row: %s", err)
+		}
+	}
+
+	if err := legacy.Close(); err != nil {
+		t.Fatalf("can't close database: %s", err)
+	}
+
+	openDatabase(t, dbPath)
+	requireAllMigrations(t)
+
+	var branches int
+	if err := Db.QueryRow("SELECT COUNT(*) FROM branch WHERE quota_in_mb IS NULL AND closed_at IS NULL").Scan(&branches); err != nil {
+		t.Fatalf("branch wasn't upgraded: %s", err)
+	}
+
+	if branches != 2 {
+		t.Fatalf("%d branches kept, want 2", branches)
+	}
+
+	// The rebuilt table keeps the children of a deleted parent
+	if _, err := Db.Exec("DELETE FROM branch WHERE id = 1"); err != nil {
+		t.Fatalf("can't delete parent branch: %s", err)
+	}
+
+	var parentId sql.NullInt32
+	if err := Db.QueryRow("SELECT parent_id FROM branch WHERE id = 2").Scan(&parentId); err != nil {
+		t.Fatalf("child branch was deleted with its parent: %s", err)
+	}
+
+	if parentId.Valid {
+		t.Fatalf("child branch still points to parent %d", parentId.Int32)
+	}
+
+	// The foreign keys are back on once the migrations are done
+	if _, err := Db.Exec("INSERT INTO branch (name, status, pg_status, pg_port, repo_id) VALUES ('x', 'OPEN', 'RUNNING', 1, 99)"); err == nil {
+		t.Fatal("branch of a missing repo was inserted")
+	}
+}
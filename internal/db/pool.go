@@ -75,3 +75,23 @@ func DeletePool(ctx context.Context, poolId int32) error {
 
 	return nil
 }
+
+func UpdatePoolSize(ctx context.Context, poolId int32, sizeInMb int64) (model.ZfsPool, error) {
+	var pool model.ZfsPool
+
+	stmt := table.ZfsPool.
+		UPDATE(table.ZfsPool.SizeInMb, table.ZfsPool.UpdatedAt).
+		SET(sqlite.Int(sizeInMb), sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.ZfsPool.ID.EQ(sqlite.Int32(poolId))).
+		RETURNING(table.ZfsPool.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &pool)
+	if err != nil {
+		log.Errorf("Can't update pool size: %s", err)
+		return model.ZfsPool{}, err
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type GitProvider string
+
+const (
+	GitHub GitProvider = "github"
+	GitLab GitProvider = "gitlab"
+)
+
+func CreatePrPreview(ctx context.Context, preview model.PrPreview) (model.PrPreview, error) {
+	var newPreview model.PrPreview
+
+	preview.CreatedAt = time.Now().UTC()
+	preview.UpdatedAt = time.Now().UTC()
+
+	stmt := table.PrPreview.
+		INSERT(table.PrPreview.AllColumns).
+		MODEL(preview).
+		RETURNING(table.PrPreview.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newPreview)
+	if err != nil {
+		log.Errorf("Can't create pr preview: %s", err)
+		return model.PrPreview{}, err
+	}
+
+	return newPreview, nil
+}
+
+func ListRepoPrPreviews(ctx context.Context, repoId int32) ([]model.PrPreview, error) {
+	var previews []model.PrPreview
+
+	stmt := table.PrPreview.
+		SELECT(table.PrPreview.AllColumns).
+		WHERE(table.PrPreview.RepoID.EQ(sqlite.Int32(repoId))).
+		ORDER_BY(table.PrPreview.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &previews)
+	if err != nil {
+		log.Errorf("Can't list pr previews: %s", err)
+		return nil, err
+	}
+
+	return previews, nil
+}
+
+// ListProjectPrPreviews returns the previews of a git project, one for every repo it's mapped to
+func ListProjectPrPreviews(ctx context.Context, provider GitProvider, project string) ([]model.PrPreview, error) {
+	var previews []model.PrPreview
+
+	stmt := table.PrPreview.
+		SELECT(table.PrPreview.AllColumns).
+		WHERE(
+			table.PrPreview.Provider.EQ(sqlite.String(string(provider))).
+				AND(table.PrPreview.Project.EQ(sqlite.String(project))),
+		).
+		ORDER_BY(table.PrPreview.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &previews)
+	if err != nil {
+		log.Errorf("Can't list pr previews of project: %s", err)
+		return nil, err
+	}
+
+	return previews, nil
+}
+
+func GetPrPreview(ctx context.Context, repoId int32, previewId int32) (model.PrPreview, error) {
+	var preview model.PrPreview
+
+	stmt := table.PrPreview.
+		SELECT(table.PrPreview.AllColumns).
+		WHERE(
+			table.PrPreview.ID.EQ(sqlite.Int32(previewId)).
+				AND(table.PrPreview.RepoID.EQ(sqlite.Int32(repoId))),
+		)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &preview)
+	if err != nil {
+		log.Errorf("Can't query pr preview: %s", err)
+		return model.PrPreview{}, err
+	}
+
+	return preview, nil
+}
+
+func DeletePrPreview(ctx context.Context, previewId int32) error {
+	stmt := table.PrPreview.
+		DELETE().
+		WHERE(table.PrPreview.ID.EQ(sqlite.Int32(previewId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't delete pr preview: %s", err)
+		return err
+	}
+
+	return nil
+}
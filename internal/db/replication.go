@@ -0,0 +1,191 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type ReplicationSink string
+type ReplicationStatus string
+
+const (
+	FileSink ReplicationSink = "file"
+	PoolSink ReplicationSink = "pool"
+	SshSink  ReplicationSink = "ssh"
+
+	ReplicationIdle    ReplicationStatus = "IDLE"
+	ReplicationSyncing ReplicationStatus = "SYNCING"
+	ReplicationFailed  ReplicationStatus = "FAILED"
+)
+
+func CreateReplicationTarget(ctx context.Context, target model.ReplicationTarget) (model.ReplicationTarget, error) {
+	var newTarget model.ReplicationTarget
+
+	target.CreatedAt = time.Now().UTC()
+	target.UpdatedAt = time.Now().UTC()
+
+	stmt := table.ReplicationTarget.
+		INSERT(table.ReplicationTarget.AllColumns).
+		MODEL(target).
+		RETURNING(table.ReplicationTarget.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newTarget)
+	if err != nil {
+		log.Errorf("Can't create replication target: %s", err)
+		return model.ReplicationTarget{}, err
+	}
+
+	return newTarget, nil
+}
+
+func ListReplicationTargets(ctx context.Context) ([]model.ReplicationTarget, error) {
+	var targets []model.ReplicationTarget
+
+	stmt := table.ReplicationTarget.
+		SELECT(table.ReplicationTarget.AllColumns).
+		ORDER_BY(table.ReplicationTarget.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &targets)
+	if err != nil {
+		log.Errorf("Can't list replication targets: %s", err)
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+func ListRepoReplicationTargets(ctx context.Context, repoId int32) ([]model.ReplicationTarget, error) {
+	var targets []model.ReplicationTarget
+
+	stmt := table.ReplicationTarget.
+		SELECT(table.ReplicationTarget.AllColumns).
+		WHERE(table.ReplicationTarget.RepoID.EQ(sqlite.Int32(repoId))).
+		ORDER_BY(table.ReplicationTarget.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &targets)
+	if err != nil {
+		log.Errorf("Can't list replication targets: %s", err)
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+func GetReplicationTarget(ctx context.Context, repoId int32, targetId int32) (model.ReplicationTarget, error) {
+	var target model.ReplicationTarget
+
+	stmt := table.ReplicationTarget.
+		SELECT(table.ReplicationTarget.AllColumns).
+		WHERE(
+			table.ReplicationTarget.RepoID.EQ(sqlite.Int32(repoId)).
+				AND(table.ReplicationTarget.ID.EQ(sqlite.Int32(targetId))),
+		)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &target)
+	if err != nil {
+		log.Errorf("Can't get replication target: %s", err)
+		return model.ReplicationTarget{}, err
+	}
+
+	return target, nil
+}
+
+func UpdateReplicationStatus(ctx context.Context, targetId int32, status ReplicationStatus) error {
+	stmt := table.ReplicationTarget.
+		UPDATE(table.ReplicationTarget.Status, table.ReplicationTarget.UpdatedAt).
+		SET(sqlite.String(string(status)), sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.ReplicationTarget.ID.EQ(sqlite.Int32(targetId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update replication status: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// UpdateReplicationSent records the snapshot which is now on the target. It's used as the base of
+// the next incremental send.
+func UpdateReplicationSent(ctx context.Context, targetId int32, snapshot string, snapshotAt time.Time) error {
+	stmt := table.ReplicationTarget.
+		UPDATE(
+			table.ReplicationTarget.Status,
+			table.ReplicationTarget.LastSnapshot,
+			table.ReplicationTarget.LastSnapshotAt,
+			table.ReplicationTarget.LastSentAt,
+			table.ReplicationTarget.LastError,
+			table.ReplicationTarget.UpdatedAt,
+		).
+		SET(
+			sqlite.String(string(ReplicationIdle)),
+			sqlite.String(snapshot),
+			sqlite.DATETIME(snapshotAt),
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.NULL,
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.ReplicationTarget.ID.EQ(sqlite.Int32(targetId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update replication target: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func UpdateReplicationFailed(ctx context.Context, targetId int32, output string) error {
+	stmt := table.ReplicationTarget.
+		UPDATE(
+			table.ReplicationTarget.Status,
+			table.ReplicationTarget.LastSentAt,
+			table.ReplicationTarget.LastError,
+			table.ReplicationTarget.UpdatedAt,
+		).
+		SET(
+			sqlite.String(string(ReplicationFailed)),
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.String(output),
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.ReplicationTarget.ID.EQ(sqlite.Int32(targetId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update replication target: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteReplicationTarget(ctx context.Context, targetId int32) error {
+	stmt := table.ReplicationTarget.
+		DELETE().
+		WHERE(table.ReplicationTarget.ID.EQ(sqlite.Int32(targetId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't delete replication target: %s", err)
+		return err
+	}
+
+	return nil
+}
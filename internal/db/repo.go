@@ -5,6 +5,8 @@ import (
 	"github.com/go-jet/jet/v2/sqlite"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"github.com/jamius19/postbranch/internal/event"
+	"slices"
 	"strings"
 	"time"
 )
@@ -17,9 +19,22 @@ const (
 	RepoCompleted RepoStatus = "READY"
 	RepoFailed    RepoStatus = "FAILED"
 
+	// RepoLocked is an encrypted repo whose key hasn't been loaded yet
+	RepoLocked RepoStatus = "LOCKED"
+
+	// RepoWarning is a working repo whose pool is degraded or has reported data errors
+	RepoWarning RepoStatus = "WARNING"
+
 	HostAdapter RepoPgAdapter = "HOST"
 )
 
+// ActiveRepoStatuses are the statuses of repos whose pool is mounted and whose branches are running
+var ActiveRepoStatuses = []RepoStatus{RepoCompleted, RepoWarning}
+
+func IsRepoActive(status string) bool {
+	return slices.Contains(ActiveRepoStatuses, RepoStatus(status))
+}
+
 type RepoDetail struct {
 	Repo     model.Repo
 	Pool     model.ZfsPool  `alias:"pool"`
@@ -206,6 +221,11 @@ func UpdateRepoStatus(ctx context.Context, repoId int32, status RepoStatus, outp
 		return model.Repo{}, err
 	}
 
+	event.Publish(event.RepoStatus, repo.Name, "", event.RepoStatusData{
+		RepoID: *repo.ID,
+		Status: repo.Status,
+	})
+
 	return repo, nil
 }
 
@@ -246,3 +266,59 @@ func CountRepoByNameOrPath(ctx context.Context, repoName, repoPath string) (int6
 
 	return count.Count, nil
 }
+
+// UpdateRepoDefaultQuota saves the storage limits that new branches of the repo get by default
+func UpdateRepoDefaultQuota(ctx context.Context, repo model.Repo) (model.Repo, error) {
+	var updatedRepo model.Repo
+
+	repo.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Repo.
+		UPDATE(
+			table.Repo.DefaultQuotaInMb,
+			table.Repo.DefaultRefquotaInMb,
+			table.Repo.DefaultReservationInMb,
+			table.Repo.UpdatedAt,
+		).
+		MODEL(repo).
+		WHERE(table.Repo.ID.EQ(sqlite.Int32(*repo.ID))).
+		RETURNING(table.Repo.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedRepo)
+	if err != nil {
+		log.Errorf("Can't update repo default quota: %s", err)
+		return model.Repo{}, err
+	}
+
+	return updatedRepo, nil
+}
+
+// UpdateRepoMetadata saves the owner, description and labels of the repo
+func UpdateRepoMetadata(ctx context.Context, repo model.Repo) (model.Repo, error) {
+	var updatedRepo model.Repo
+
+	repo.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Repo.
+		UPDATE(
+			table.Repo.Owner,
+			table.Repo.Description,
+			table.Repo.Labels,
+			table.Repo.UpdatedAt,
+		).
+		MODEL(repo).
+		WHERE(table.Repo.ID.EQ(sqlite.Int32(*repo.ID))).
+		RETURNING(table.Repo.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedRepo)
+	if err != nil {
+		log.Errorf("Can't update repo metadata: %s", err)
+		return model.Repo{}, err
+	}
+
+	return updatedRepo, nil
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type ScrubStatus string
+
+const (
+	ScrubRunning  ScrubStatus = "RUNNING"
+	ScrubFinished ScrubStatus = "FINISHED"
+	ScrubCanceled ScrubStatus = "CANCELED"
+)
+
+func CreateScrub(ctx context.Context, poolId int32, startedAt time.Time) (model.PoolScrub, error) {
+	var newScrub model.PoolScrub
+
+	scrub := model.PoolScrub{
+		PoolID:    poolId,
+		Status:    string(ScrubRunning),
+		StartedAt: startedAt,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+
+	stmt := table.PoolScrub.
+		INSERT(table.PoolScrub.AllColumns).
+		MODEL(scrub).
+		RETURNING(table.PoolScrub.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newScrub)
+	if err != nil {
+		log.Errorf("Can't insert scrub: %s", err)
+		return model.PoolScrub{}, err
+	}
+
+	return newScrub, nil
+}
+
+// ListScrubs returns the latest scrubs of the pool, newest first
+func ListScrubs(ctx context.Context, poolId int32, limit int64) ([]model.PoolScrub, error) {
+	var scrubs []model.PoolScrub
+
+	stmt := table.PoolScrub.
+		SELECT(table.PoolScrub.AllColumns).
+		WHERE(table.PoolScrub.PoolID.EQ(sqlite.Int32(poolId))).
+		ORDER_BY(table.PoolScrub.StartedAt.DESC(), table.PoolScrub.ID.DESC()).
+		LIMIT(limit)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &scrubs)
+	if err != nil {
+		log.Errorf("Can't query scrubs: %s", err)
+		return nil, err
+	}
+
+	return scrubs, nil
+}
+
+func FinishScrub(
+	ctx context.Context,
+	scrubId int32,
+	status ScrubStatus,
+	errors *int64,
+	repaired *string,
+) error {
+
+	errorCount := sqlite.Expression(sqlite.NULL)
+	if errors != nil {
+		errorCount = sqlite.Int(*errors)
+	}
+
+	repairedSize := sqlite.Expression(sqlite.NULL)
+	if repaired != nil {
+		repairedSize = sqlite.String(*repaired)
+	}
+
+	stmt := table.PoolScrub.
+		UPDATE(
+			table.PoolScrub.Status,
+			table.PoolScrub.Errors,
+			table.PoolScrub.Repaired,
+			table.PoolScrub.FinishedAt,
+			table.PoolScrub.UpdatedAt,
+		).
+		SET(
+			sqlite.String(string(status)),
+			errorCount,
+			repairedSize,
+			sqlite.CURRENT_TIMESTAMP(),
+			sqlite.CURRENT_TIMESTAMP(),
+		).
+		WHERE(table.PoolScrub.ID.EQ(sqlite.Int32(scrubId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update scrub: %s", err)
+		return err
+	}
+
+	return nil
+}
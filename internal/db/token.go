@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type Role string
+
+const (
+	RoleAdmin      Role = "admin"
+	RoleMaintainer Role = "maintainer"
+	RoleDeveloper  Role = "developer"
+	RoleReadOnly   Role = "read-only"
+)
+
+var roleRanks = map[Role]int{
+	RoleReadOnly:   1,
+	RoleDeveloper:  2,
+	RoleMaintainer: 3,
+	RoleAdmin:      4,
+}
+
+// Includes tells whether the role grants everything the other one does
+func (role Role) Includes(other Role) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[other]
+}
+
+// APITokenGrant is a repo the token is limited to, with the role it has on it
+type APITokenGrant struct {
+	model.APITokenRepo
+
+	Repo model.Repo
+}
+
+func CreateAPIToken(ctx context.Context, token model.APIToken) (model.APIToken, error) {
+	var newToken model.APIToken
+
+	token.CreatedAt = time.Now().UTC()
+	token.UpdatedAt = time.Now().UTC()
+
+	stmt := table.APIToken.
+		INSERT(table.APIToken.AllColumns).
+		MODEL(token).
+		RETURNING(table.APIToken.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newToken)
+	if err != nil {
+		log.Errorf("Can't create api token: %s", err)
+		return model.APIToken{}, err
+	}
+
+	return newToken, nil
+}
+
+func ListAPITokens(ctx context.Context) ([]model.APIToken, error) {
+	var tokens []model.APIToken
+
+	stmt := table.APIToken.
+		SELECT(table.APIToken.AllColumns).
+		ORDER_BY(table.APIToken.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &tokens)
+	if err != nil {
+		log.Errorf("Can't list api tokens: %s", err)
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func GetAPIToken(ctx context.Context, tokenId int32) (model.APIToken, error) {
+	var token model.APIToken
+
+	stmt := table.APIToken.
+		SELECT(table.APIToken.AllColumns).
+		WHERE(table.APIToken.ID.EQ(sqlite.Int32(tokenId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &token)
+	if err != nil {
+		log.Errorf("Can't query api token: %s", err)
+		return model.APIToken{}, err
+	}
+
+	return token, nil
+}
+
+// GetAPITokenByHash looks up a token by the hash of its secret, plain secrets are never stored
+func GetAPITokenByHash(ctx context.Context, tokenHash string) (model.APIToken, error) {
+	var token model.APIToken
+
+	stmt := table.APIToken.
+		SELECT(table.APIToken.AllColumns).
+		WHERE(table.APIToken.TokenHash.EQ(sqlite.String(tokenHash)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &token)
+	if err != nil {
+		return model.APIToken{}, err
+	}
+
+	return token, nil
+}
+
+func CountAPITokens(ctx context.Context) (int64, error) {
+	var count struct {
+		Count int64
+	}
+
+	stmt := sqlite.SELECT(sqlite.COUNT(table.APIToken.ID).AS("count")).
+		FROM(table.APIToken)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &count)
+	if err != nil {
+		log.Errorf("Can't query api token count: %s", err)
+		return -1, err
+	}
+
+	return count.Count, nil
+}
+
+func UpdateAPITokenLastUsed(ctx context.Context, tokenId int32) error {
+	stmt := table.APIToken.
+		UPDATE(table.APIToken.LastUsedAt).
+		SET(table.APIToken.LastUsedAt.SET(sqlite.CURRENT_TIMESTAMP())).
+		WHERE(table.APIToken.ID.EQ(sqlite.Int32(tokenId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't update last use of api token: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func DeleteAPIToken(ctx context.Context, tokenId int32) error {
+	stmt := table.APIToken.
+		DELETE().
+		WHERE(table.APIToken.ID.EQ(sqlite.Int32(tokenId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't delete api token: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListAPITokenGrants returns the repos the token is limited to, a scoped token without any grants
+// can't access a repo
+func ListAPITokenGrants(ctx context.Context, tokenId int32) ([]APITokenGrant, error) {
+	var grants []APITokenGrant
+
+	stmt := sqlite.SELECT(
+		table.APITokenRepo.AllColumns,
+		table.Repo.ID,
+		table.Repo.Name,
+	).
+		FROM(table.APITokenRepo.
+			INNER_JOIN(table.Repo, table.APITokenRepo.RepoID.EQ(table.Repo.ID))).
+		WHERE(table.APITokenRepo.TokenID.EQ(sqlite.Int32(tokenId))).
+		ORDER_BY(table.Repo.Name)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &grants)
+	if err != nil {
+		log.Errorf("Can't list api token grants: %s", err)
+		return nil, err
+	}
+
+	return grants, nil
+}
+
+// ReplaceAPITokenGrants sets whether the token is limited to repos and the repos it's limited to,
+// the previous grants are removed. Grants are ignored for tokens that aren't scoped.
+func ReplaceAPITokenGrants(ctx context.Context, tokenId int32, scoped bool, grants []model.APITokenRepo) error {
+	tx, err := Db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Errorf("Can't start transaction: %s", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	scopeStmt := table.APIToken.
+		UPDATE(table.APIToken.Scoped, table.APIToken.UpdatedAt).
+		SET(sqlite.Bool(scoped), sqlite.CURRENT_TIMESTAMP()).
+		WHERE(table.APIToken.ID.EQ(sqlite.Int32(tokenId)))
+
+	log.Tracef("Query: %s", scopeStmt.DebugSql())
+	_, err = scopeStmt.ExecContext(ctx, tx)
+	if err != nil {
+		log.Errorf("Can't update scope of api token: %s", err)
+		return err
+	}
+
+	deleteStmt := table.APITokenRepo.
+		DELETE().
+		WHERE(table.APITokenRepo.TokenID.EQ(sqlite.Int32(tokenId)))
+
+	log.Tracef("Query: %s", deleteStmt.DebugSql())
+	_, err = deleteStmt.ExecContext(ctx, tx)
+	if err != nil {
+		log.Errorf("Can't delete api token grants: %s", err)
+		return err
+	}
+
+	if scoped && len(grants) > 0 {
+		for i := range grants {
+			grants[i].TokenID = tokenId
+			grants[i].CreatedAt = time.Now().UTC()
+			grants[i].UpdatedAt = time.Now().UTC()
+		}
+
+		insertStmt := table.APITokenRepo.
+			INSERT(table.APITokenRepo.AllColumns).
+			MODELS(grants)
+
+		log.Tracef("Query: %s", insertStmt.DebugSql())
+		_, err = insertStmt.ExecContext(ctx, tx)
+		if err != nil {
+			log.Errorf("Can't create api token grants: %s", err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
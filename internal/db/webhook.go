@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"github.com/go-jet/jet/v2/sqlite"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/db/gen/table"
+	"time"
+)
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "PENDING"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "SUCCEEDED"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "FAILED"
+)
+
+func CreateWebhook(ctx context.Context, webhook model.Webhook) (model.Webhook, error) {
+	var newWebhook model.Webhook
+
+	webhook.CreatedAt = time.Now().UTC()
+	webhook.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Webhook.
+		INSERT(table.Webhook.AllColumns).
+		MODEL(webhook).
+		RETURNING(table.Webhook.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newWebhook)
+	if err != nil {
+		log.Errorf("Can't create webhook: %s", err)
+		return model.Webhook{}, err
+	}
+
+	return newWebhook, nil
+}
+
+func ListWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+
+	stmt := table.Webhook.
+		SELECT(table.Webhook.AllColumns).
+		ORDER_BY(table.Webhook.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &webhooks)
+	if err != nil {
+		log.Errorf("Can't list webhooks: %s", err)
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func GetWebhook(ctx context.Context, webhookId int32) (model.Webhook, error) {
+	var webhook model.Webhook
+
+	stmt := table.Webhook.
+		SELECT(table.Webhook.AllColumns).
+		WHERE(table.Webhook.ID.EQ(sqlite.Int32(webhookId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &webhook)
+	if err != nil {
+		log.Errorf("Can't query webhook: %s", err)
+		return model.Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+func UpdateWebhook(ctx context.Context, webhook model.Webhook) (model.Webhook, error) {
+	var updatedWebhook model.Webhook
+
+	webhook.UpdatedAt = time.Now().UTC()
+
+	stmt := table.Webhook.
+		UPDATE(
+			table.Webhook.URL,
+			table.Webhook.Secret,
+			table.Webhook.Events,
+			table.Webhook.Repo,
+			table.Webhook.Enabled,
+			table.Webhook.UpdatedAt,
+		).
+		MODEL(webhook).
+		WHERE(table.Webhook.ID.EQ(sqlite.Int32(*webhook.ID))).
+		RETURNING(table.Webhook.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedWebhook)
+	if err != nil {
+		log.Errorf("Can't update webhook: %s", err)
+		return model.Webhook{}, err
+	}
+
+	return updatedWebhook, nil
+}
+
+func DeleteWebhook(ctx context.Context, webhookId int32) error {
+	stmt := table.Webhook.
+		DELETE().
+		WHERE(table.Webhook.ID.EQ(sqlite.Int32(webhookId)))
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+	_, err := stmt.ExecContext(ctx, Db)
+	if err != nil {
+		log.Errorf("Can't delete webhook: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func CreateWebhookDelivery(ctx context.Context, delivery model.WebhookDelivery) (model.WebhookDelivery, error) {
+	var newDelivery model.WebhookDelivery
+
+	delivery.CreatedAt = time.Now().UTC()
+	delivery.UpdatedAt = time.Now().UTC()
+
+	stmt := table.WebhookDelivery.
+		INSERT(table.WebhookDelivery.AllColumns).
+		MODEL(delivery).
+		RETURNING(table.WebhookDelivery.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &newDelivery)
+	if err != nil {
+		log.Errorf("Can't create webhook delivery: %s", err)
+		return model.WebhookDelivery{}, err
+	}
+
+	return newDelivery, nil
+}
+
+func GetWebhookDelivery(ctx context.Context, webhookId int32, deliveryId int32) (model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+
+	stmt := table.WebhookDelivery.
+		SELECT(table.WebhookDelivery.AllColumns).
+		WHERE(
+			table.WebhookDelivery.ID.EQ(sqlite.Int32(deliveryId)).
+				AND(table.WebhookDelivery.WebhookID.EQ(sqlite.Int32(webhookId))),
+		)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &delivery)
+	if err != nil {
+		log.Errorf("Can't query webhook delivery: %s", err)
+		return model.WebhookDelivery{}, err
+	}
+
+	return delivery, nil
+}
+
+// ListWebhookDeliveries returns the delivery log of the webhook, newest first
+func ListWebhookDeliveries(ctx context.Context, webhookId int32, limit int64) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+
+	stmt := table.WebhookDelivery.
+		SELECT(table.WebhookDelivery.AllColumns).
+		WHERE(table.WebhookDelivery.WebhookID.EQ(sqlite.Int32(webhookId))).
+		ORDER_BY(table.WebhookDelivery.ID.DESC()).
+		LIMIT(limit)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &deliveries)
+	if err != nil {
+		log.Errorf("Can't list webhook deliveries: %s", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ListPendingWebhookDeliveries returns the deliveries that are waiting for a retry
+func ListPendingWebhookDeliveries(ctx context.Context) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+
+	stmt := table.WebhookDelivery.
+		SELECT(table.WebhookDelivery.AllColumns).
+		WHERE(table.WebhookDelivery.Status.EQ(sqlite.String(string(WebhookDeliveryPending)))).
+		ORDER_BY(table.WebhookDelivery.ID)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &deliveries)
+	if err != nil {
+		log.Errorf("Can't list pending webhook deliveries: %s", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateWebhookDelivery records the result of a delivery attempt
+func UpdateWebhookDelivery(ctx context.Context, delivery model.WebhookDelivery) (model.WebhookDelivery, error) {
+	var updatedDelivery model.WebhookDelivery
+
+	delivery.UpdatedAt = time.Now().UTC()
+
+	stmt := table.WebhookDelivery.
+		UPDATE(
+			table.WebhookDelivery.Status,
+			table.WebhookDelivery.Attempts,
+			table.WebhookDelivery.ResponseCode,
+			table.WebhookDelivery.ResponseBody,
+			table.WebhookDelivery.Error,
+			table.WebhookDelivery.NextAttemptAt,
+			table.WebhookDelivery.DeliveredAt,
+			table.WebhookDelivery.UpdatedAt,
+		).
+		MODEL(delivery).
+		WHERE(table.WebhookDelivery.ID.EQ(sqlite.Int32(*delivery.ID))).
+		RETURNING(table.WebhookDelivery.AllColumns)
+
+	log.Tracef("Query: %s", stmt.DebugSql())
+
+	err := stmt.QueryContext(ctx, Db, &updatedDelivery)
+	if err != nil {
+		log.Errorf("Can't update webhook delivery: %s", err)
+		return model.WebhookDelivery{}, err
+	}
+
+	return updatedDelivery, nil
+}
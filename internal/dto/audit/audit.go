@@ -0,0 +1,20 @@
+package audit
+
+import (
+	"encoding/json"
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Response struct {
+	ID           *int32          `json:"id"`
+	Actor        string          `json:"actor"`
+	ActorTokenID *int32          `json:"actorTokenId"`
+	Action       string          `json:"action"`
+	Target       string          `json:"target"`
+	Params       json.RawMessage `json:"params"`
+	Outcome      db.AuditOutcome `json:"outcome"`
+	StatusCode   *int32          `json:"statusCode"`
+	Error        *string         `json:"error"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
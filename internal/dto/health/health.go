@@ -0,0 +1,35 @@
+package health
+
+import (
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Response struct {
+	State      string   `json:"state"`
+	Healthy    bool     `json:"healthy"`
+	Problems   []string `json:"problems"`
+	Scan       string   `json:"scan"`
+	ScrubState string   `json:"scrubState"`
+	Vdevs      []Vdev   `json:"vdevs"`
+	DataErrors string   `json:"dataErrors"`
+	Scrubs     []Scrub  `json:"scrubs"`
+}
+
+type Vdev struct {
+	Name           string `json:"name"`
+	State          string `json:"state"`
+	ReadErrors     int64  `json:"readErrors"`
+	WriteErrors    int64  `json:"writeErrors"`
+	ChecksumErrors int64  `json:"checksumErrors"`
+	Depth          int    `json:"depth"`
+}
+
+type Scrub struct {
+	ID         *int32         `json:"id"`
+	Status     db.ScrubStatus `json:"status"`
+	Errors     *int64         `json:"errors"`
+	Repaired   *string        `json:"repaired"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt *time.Time     `json:"finishedAt"`
+}
@@ -0,0 +1,19 @@
+package job
+
+import (
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Response struct {
+	ID         *int32      `json:"id"`
+	Type       db.JobType  `json:"type"`
+	Target     string      `json:"target"`
+	State      db.JobState `json:"state"`
+	Progress   int64       `json:"progress"`
+	Step       *string     `json:"step"`
+	Error      *string     `json:"error"`
+	Output     *string     `json:"output,omitempty"`
+	StartedAt  time.Time   `json:"startedAt"`
+	FinishedAt *time.Time  `json:"finishedAt"`
+}
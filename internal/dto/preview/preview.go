@@ -0,0 +1,39 @@
+package preview
+
+import (
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Init struct {
+	Provider string `json:"provider" validate:"required,oneof=github gitlab"`
+
+	// Project is the full name of the git project, like org/app
+	Project string `json:"project" validate:"required,min=1,max=255,excludesall= "`
+
+	// Secret is the webhook secret on GitHub and the secret token on GitLab
+	Secret       string `json:"secret" validate:"required,min=16,max=255"`
+	ParentBranch string `json:"parentBranch" validate:"omitempty,min=1,max=100,dataset"`
+
+	// BranchPrefix is put in front of the pull request number to name the branch
+	BranchPrefix string `json:"branchPrefix" validate:"omitempty,max=50,dataset"`
+}
+
+type Response struct {
+	ID           *int32         `json:"id"`
+	Provider     db.GitProvider `json:"provider"`
+	Project      string         `json:"project"`
+	ParentBranch string         `json:"parentBranch"`
+	BranchPrefix string         `json:"branchPrefix"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	UpdatedAt    time.Time      `json:"updatedAt"`
+}
+
+// Result is what a pull request event did to the branch of a repo
+type Result struct {
+	Repo   string  `json:"repo"`
+	Branch string  `json:"branch"`
+	Action string  `json:"action"`
+	JobID  *int32  `json:"jobId"`
+	Error  *string `json:"error"`
+}
@@ -0,0 +1,75 @@
+package reconcile
+
+type DriftKind string
+
+const (
+	// OrphanDataset is a dataset in a pool without a branch
+	OrphanDataset DriftKind = "ORPHAN_DATASET"
+
+	// MissingDataset is a branch whose dataset doesn't exist
+	MissingDataset DriftKind = "MISSING_DATASET"
+
+	// MissingPool is a repo whose pool isn't imported
+	MissingPool DriftKind = "MISSING_POOL"
+
+	// OrphanSnapshot is a snapshot PostBranch took that nothing needs anymore
+	OrphanSnapshot DriftKind = "ORPHAN_SNAPSHOT"
+
+	// StrayLoopDevice is a loop device attached to the image of a pool that the pool doesn't use
+	StrayLoopDevice DriftKind = "STRAY_LOOP_DEVICE"
+
+	// PostgresStopped is an open branch recorded as running whose postmaster isn't
+	PostgresStopped DriftKind = "POSTGRES_STOPPED"
+
+	// PostgresRunning is a postmaster still running on a branch that isn't open
+	PostgresRunning DriftKind = "POSTGRES_RUNNING"
+)
+
+type Action string
+
+const (
+	// Adopt registers an orphan dataset as a closed branch, reopening it starts Postgres on it
+	Adopt Action = "adopt"
+
+	// Cleanup destroys the dataset or snapshot, releases the loop device or stops the postmaster
+	Cleanup Action = "cleanup"
+
+	// MarkFailed records the repo or the Postgres of the branch as failed
+	MarkFailed Action = "mark-failed"
+
+	// MarkPurged records the branch as purged as its data is gone
+	MarkPurged Action = "mark-purged"
+)
+
+type Fix struct {
+	Kind   DriftKind `json:"kind" validate:"required"`
+	Name   string    `json:"name" validate:"required"`
+	Action Action    `json:"action" validate:"required,oneof=adopt cleanup mark-failed mark-purged"`
+}
+
+type Request struct {
+	// Fixes are applied to the drift they match, the drift is only reported without them
+	Fixes []Fix `json:"fixes" validate:"dive"`
+}
+
+type Drift struct {
+	Kind   DriftKind `json:"kind"`
+	Repo   string    `json:"repo"`
+	Branch *string   `json:"branch"`
+
+	// Name is the dataset, snapshot, pool or loop device that drifted
+	Name    string   `json:"name"`
+	Detail  string   `json:"detail"`
+	Actions []Action `json:"actions"`
+
+	// Applied is the fix applied in this run, FixError is set when it failed
+	Applied  *Action `json:"applied"`
+	FixError *string `json:"fixError"`
+}
+
+type Response struct {
+	Drift []Drift `json:"drift"`
+
+	// Skipped are the repos that weren't checked, with the reason
+	Skipped map[string]string `json:"skipped"`
+}
@@ -0,0 +1,44 @@
+package replication
+
+import (
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type TargetInit struct {
+	Name   string `json:"name" validate:"required,min=1,max=100,excludesall= "`
+	Branch string `json:"branch" validate:"required,min=1,max=100,dataset"`
+	Sink   string `json:"sink" validate:"required,oneof=file pool ssh"`
+
+	// Destination is the directory for file sinks, relative to the replication directory, and the
+	// full target dataset name for pool and ssh sinks
+	Destination string `json:"destination" validate:"required,min=1,excludesall= ,startsnotwith=-"`
+
+	SshHost         string `json:"sshHost" validate:"required_if=Sink ssh,omitempty,hostname_rfc1123|ip"`
+	SshUser         string `json:"sshUser" validate:"omitempty,username"`
+	SshPort         int32  `json:"sshPort" validate:"omitempty,min=1,max=65535"`
+	IntervalSeconds int32  `json:"intervalSeconds" validate:"required,min=60"`
+}
+
+type TargetResponse struct {
+	ID              *int32               `json:"id"`
+	Name            string               `json:"name"`
+	Branch          string               `json:"branch"`
+	Sink            db.ReplicationSink   `json:"sink"`
+	Destination     string               `json:"destination"`
+	SshHost         *string              `json:"sshHost"`
+	SshUser         *string              `json:"sshUser"`
+	SshPort         *int32               `json:"sshPort"`
+	IntervalSeconds int32                `json:"intervalSeconds"`
+	Status          db.ReplicationStatus `json:"status"`
+	LastSnapshot    *string              `json:"lastSnapshot"`
+	LastSnapshotAt  *time.Time           `json:"lastSnapshotAt"`
+	LastSentAt      *time.Time           `json:"lastSentAt"`
+	LastError       *string              `json:"lastError"`
+
+	// LagSeconds is how old the newest data on the target is, nil until the first send
+	LagSeconds *int64 `json:"lagSeconds"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,54 @@
+package repo
+
+import "time"
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+
+	ManifestVersion = 1
+	ManifestSuffix  = ".manifest.json"
+)
+
+type BranchExport struct {
+	// Path is relative to the archive directory, an absolute path has to be inside it
+	Path        string `json:"path" validate:"required,min=1,filepath"`
+	Compression string `json:"compression" validate:"omitempty,oneof=none gzip"`
+}
+
+func (branchExport *BranchExport) GetCompression() string {
+	if branchExport.Compression == "" {
+		return CompressionNone
+	}
+
+	return branchExport.Compression
+}
+
+type BranchImport struct {
+	// Path is relative to the archive directory, an absolute path has to be inside it
+	Path string `json:"path" validate:"required,min=1,filepath"`
+	Name string `json:"name" validate:"required,min=1,max=100,dataset"`
+
+	Metadata
+
+	// OwnerTokenID is the token the branch is imported with, it's taken from the request
+	OwnerTokenID *int32 `json:"-"`
+}
+
+// Manifest is written next to an exported stream, it has everything needed to check whether the
+// stream can be imported into a repo.
+type Manifest struct {
+	FormatVersion int    `json:"formatVersion"`
+	Repo          string `json:"repo"`
+	Branch        string `json:"branch"`
+	PgVersion     int32  `json:"pgVersion"`
+
+	// Lineage is the chain of parent branches, starting with the direct parent
+	Lineage []string `json:"lineage"`
+
+	Snapshot    string    `json:"snapshot"`
+	Compression string    `json:"compression"`
+	SizeInBytes int64     `json:"sizeInBytes"`
+	Sha256      string    `json:"sha256"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -1,10 +1,58 @@
 package repo
 
+import "time"
+
+const (
+	// CloseRefuse fails the close if any branch is cloned from the branch being closed
+	CloseRefuse = "refuse"
+
+	// CloseCascade closes the branch along with every branch cloned from it, deepest first
+	CloseCascade = "cascade"
+
+	// CloseReparent promotes the dependent branches so that they survive the close
+	CloseReparent = "reparent"
+)
+
 type BranchInit struct {
-	Name     string `json:"name" validate:"required,min=1,max=100,excludesall= "`
+	Name     string `json:"name" validate:"required,min=1,max=100,dataset"`
 	ParentId int32  `json:"parentId" validate:"required,numeric"`
+
+	// Limits that aren't set fall back to the repo defaults
+	Quota
+
+	Metadata
+
+	// OwnerTokenID is the token the branch is created with, it's taken from the request
+	OwnerTokenID *int32 `json:"-"`
 }
 
 type BranchClose struct {
-	Name string `json:"name" validate:"required,min=1,max=100,excludesall= "`
+	Name   string `json:"name" validate:"required,min=1,max=100,dataset"`
+	Mode   string `json:"mode" validate:"omitempty,oneof=refuse cascade reparent"`
+	DryRun bool   `json:"dryRun"`
+}
+
+func (branchClose *BranchClose) GetMode() string {
+	if branchClose.Mode == "" {
+		return CloseRefuse
+	}
+
+	return branchClose.Mode
+}
+
+// BranchCloseResponse lists what the close changes. Closed branches keep their datasets until the
+// retention period is over, Destroyed lists what the purge will destroy at PurgeAt.
+type BranchCloseResponse struct {
+	Mode       string           `json:"mode"`
+	DryRun     bool             `json:"dryRun"`
+	Closed     []string         `json:"closed"`
+	Promoted   []string         `json:"promoted"`
+	Reparented []BranchReparent `json:"reparented"`
+	Destroyed  []string         `json:"destroyed"`
+	PurgeAt    *time.Time       `json:"purgeAt"`
+}
+
+type BranchReparent struct {
+	Branch string  `json:"branch"`
+	Parent *string `json:"parent"`
 }
@@ -0,0 +1,38 @@
+package repo
+
+const (
+	EncryptionAlgorithm = "aes-256-gcm"
+
+	KeyFormatRaw        = "raw"
+	KeyFormatHex        = "hex"
+	KeyFormatPassphrase = "passphrase"
+)
+
+// Encryption encrypts the whole pool, so every branch dataset is encrypted with the same key. With a
+// key file the key is loaded on startup, otherwise the repo stays locked until it's unlocked with
+// the passphrase.
+type Encryption struct {
+	KeyFile    string `json:"keyFile" validate:"omitempty,filepath"`
+	KeyFormat  string `json:"keyFormat" validate:"omitempty,oneof=raw hex passphrase"`
+	Passphrase string `json:"passphrase" validate:"omitempty,min=8,max=512"`
+}
+
+func (encryption *Encryption) GetKeyFormat() string {
+	if encryption.KeyFile == "" || encryption.KeyFormat == "" {
+		return KeyFormatPassphrase
+	}
+
+	return encryption.KeyFormat
+}
+
+func (encryption *Encryption) GetKeyLocation() string {
+	if encryption.KeyFile == "" {
+		return "prompt"
+	}
+
+	return "file://" + encryption.KeyFile
+}
+
+type Unlock struct {
+	Passphrase string `json:"passphrase" validate:"omitempty,min=8,max=512"`
+}
@@ -7,10 +7,21 @@ import (
 const MinSizeInMb = 300
 
 type Config struct {
-	Name     string `json:"name" validate:"required,min=1,excludesall= "`
+	// Name is the name of the repo pool as well, so it follows the pool naming rules
+	Name     string `json:"name" validate:"required,min=1,max=100,pool"`
 	Path     string `json:"path" validate:"required,min=1,excludesall= "`
 	RepoType string `json:"repoType" validate:"oneof=block virtual,excludesall= "`
 	SizeInMb int64  `json:"sizeInMb" validate:"required_if=RepoType virtual"`
+
+	// DefaultQuota is applied to new branches that don't set their own limits
+	DefaultQuota Quota `json:"defaultQuota"`
+
+	DatasetProperties DatasetProperties `json:"datasetProperties"`
+
+	// Encryption is nil for unencrypted repos
+	Encryption *Encryption `json:"encryption"`
+
+	Metadata
 }
 
 type InitDto[T pg.HostImportReqDto] struct {
@@ -34,10 +45,30 @@ func (initDto *InitDto[T]) GetSizeInMb() int64 {
 	return initDto.RepoConfig.SizeInMb
 }
 
+func (initDto *InitDto[T]) GetDefaultQuota() Quota {
+	return initDto.RepoConfig.DefaultQuota
+}
+
+func (initDto *InitDto[T]) GetEncryption() *Encryption {
+	return initDto.RepoConfig.Encryption
+}
+
+func (initDto *InitDto[T]) GetMetadata() Metadata {
+	return initDto.RepoConfig.Metadata
+}
+
+func (initDto *InitDto[T]) GetDatasetProperties() DatasetProperties {
+	return initDto.RepoConfig.DatasetProperties.WithDefaults()
+}
+
 // Info needs to be replaced with the Config type TODO
 type Info interface {
 	GetName() string
 	GetPath() string
 	GetRepoType() string
 	GetSizeInMb() int64
+	GetDefaultQuota() Quota
+	GetDatasetProperties() DatasetProperties
+	GetEncryption() *Encryption
+	GetMetadata() Metadata
 }
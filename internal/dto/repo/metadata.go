@@ -0,0 +1,38 @@
+package repo
+
+// Metadata tells who a repo or branch belongs to and what it's for. Fields left out of an update
+// are kept, empty values clear them.
+type Metadata struct {
+	Owner       *string `json:"owner" validate:"omitempty,max=100"`
+	Description *string `json:"description" validate:"omitempty,max=1000"`
+
+	// Labels are replaced as a whole when they're set
+	Labels map[string]string `json:"labels" validate:"max=32,dive,keys,required,max=63,label,endkeys,max=255"`
+}
+
+type BranchBulkClose struct {
+	// Selector picks the branches by their labels, e.g. "ci=true,team!=core"
+	Selector string `json:"selector" validate:"required,min=1,max=1000"`
+	Owner    string `json:"owner" validate:"omitempty,max=100"`
+
+	// OlderThanHours only picks branches created at least this long ago
+	OlderThanHours int    `json:"olderThanHours" validate:"min=0"`
+	Mode           string `json:"mode" validate:"omitempty,oneof=refuse cascade reparent"`
+	DryRun         bool   `json:"dryRun"`
+
+	// OwnerTokenID limits the operation to the branches created with the token, it's set for
+	// developers who can only close their own branches
+	OwnerTokenID *int32 `json:"-"`
+}
+
+type BranchBulkCloseResponse struct {
+	DryRun  bool              `json:"dryRun"`
+	Matched []string          `json:"matched"`
+	Closed  []string          `json:"closed"`
+	Failed  []BranchBulkError `json:"failed"`
+}
+
+type BranchBulkError struct {
+	Branch string `json:"branch"`
+	Error  string `json:"error"`
+}
@@ -0,0 +1,5 @@
+package repo
+
+type PoolResize struct {
+	SizeInMb int64 `json:"sizeInMb" validate:"required,min=1"`
+}
@@ -0,0 +1,65 @@
+package repo
+
+const (
+	// WalDataset is the child dataset that holds the WAL of a branch when the WAL is kept separately
+	WalDataset = "pg_wal"
+)
+
+// DatasetProperties are the ZFS properties of the repo datasets. The data properties are set on the
+// pool root, so every branch dataset inherits them. The WAL gets its own record size, as it's
+// written sequentially in large blocks unlike the 8K pages of the data files.
+type DatasetProperties struct {
+	Compression   string `json:"compression" validate:"omitempty,oneof=off lz4 zstd gzip"`
+	RecordSize    string `json:"recordSize" validate:"omitempty,oneof=8K 16K 32K 64K 128K"`
+	WalRecordSize string `json:"walRecordSize" validate:"omitempty,oneof=8K 16K 32K 64K 128K 256K 512K 1M"`
+	Atime         string `json:"atime" validate:"omitempty,oneof=on off"`
+	Logbias       string `json:"logbias" validate:"omitempty,oneof=latency throughput"`
+	PrimaryCache  string `json:"primaryCache" validate:"omitempty,oneof=all metadata none"`
+	SeparateWal   *bool  `json:"separateWal"`
+}
+
+// WithDefaults fills the properties that aren't set with defaults suited to Postgres
+func (properties DatasetProperties) WithDefaults() DatasetProperties {
+	if properties.Compression == "" {
+		properties.Compression = "lz4"
+	}
+
+	if properties.RecordSize == "" {
+		properties.RecordSize = "16K"
+	}
+
+	if properties.WalRecordSize == "" {
+		properties.WalRecordSize = "128K"
+	}
+
+	if properties.Atime == "" {
+		properties.Atime = "off"
+	}
+
+	// Postgres already syncs the data files on checkpoints, the WAL dataset always uses latency
+	if properties.Logbias == "" {
+		properties.Logbias = "throughput"
+	}
+
+	if properties.PrimaryCache == "" {
+		properties.PrimaryCache = "all"
+	}
+
+	if properties.SeparateWal == nil {
+		separateWal := true
+		properties.SeparateWal = &separateWal
+	}
+
+	return properties
+}
+
+type DatasetPropertiesResponse struct {
+	Dataset    string                     `json:"dataset"`
+	Branch     *string                    `json:"branch"`
+	Properties map[string]DatasetProperty `json:"properties"`
+}
+
+type DatasetProperty struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
@@ -0,0 +1,28 @@
+package repo
+
+// Quota has the storage limits of a branch in MB. A nil limit means the branch has no limit.
+//
+// QuotaInMb limits the branch including its snapshots, RefquotaInMb only limits the data the
+// branch references and ReservationInMb guarantees the branch space in the pool.
+type Quota struct {
+	QuotaInMb       *int64 `json:"quotaInMb" validate:"omitempty,min=1"`
+	RefquotaInMb    *int64 `json:"refquotaInMb" validate:"omitempty,min=1"`
+	ReservationInMb *int64 `json:"reservationInMb" validate:"omitempty,min=1"`
+}
+
+// Or fills the limits that aren't set with the ones from defaults
+func (quota Quota) Or(defaults Quota) Quota {
+	if quota.QuotaInMb == nil {
+		quota.QuotaInMb = defaults.QuotaInMb
+	}
+
+	if quota.RefquotaInMb == nil {
+		quota.RefquotaInMb = defaults.RefquotaInMb
+	}
+
+	if quota.ReservationInMb == nil {
+		quota.ReservationInMb = defaults.ReservationInMb
+	}
+
+	return quota
+}
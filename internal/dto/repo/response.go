@@ -6,32 +6,98 @@ import (
 )
 
 type Response struct {
-	ID        *int32        `json:"id"`
-	Name      string        `json:"name"`
-	PgVersion int32         `json:"pgVersion"`
-	Status    db.RepoStatus `json:"status"`
-	Output    *string       `json:"output"`
-	Pool      Pool          `json:"pool"`
-	Branches  []Branch      `json:"branches"`
-	CreatedAt time.Time     `json:"createdAt"`
-	UpdatedAt time.Time     `json:"updatedAt"`
+	ID           *int32        `json:"id"`
+	Name         string        `json:"name"`
+	PgVersion    int32         `json:"pgVersion"`
+	Status       db.RepoStatus `json:"status"`
+	Output       *string       `json:"output"`
+	Pool         Pool          `json:"pool"`
+	Branches     []Branch      `json:"branches"`
+	DefaultQuota Quota         `json:"defaultQuota"`
+	Usage        *Usage        `json:"usage,omitempty"`
+
+	Owner       *string           `json:"owner"`
+	Description *string           `json:"description"`
+	Labels      map[string]string `json:"labels"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
 }
 
 type Branch struct {
-	ID        *int32            `json:"id"`
-	Name      string            `json:"name"`
-	Status    db.BranchStatus   `json:"status"`
-	PgStatus  db.BranchPgStatus `json:"pgStatus"`
-	Port      int32             `json:"port"`
-	ParentID  *int32            `json:"parentId"`
-	CreatedAt time.Time         `json:"createdAt"`
-	UpdatedAt time.Time         `json:"updatedAt"`
+	ID       *int32            `json:"id"`
+	Name     string            `json:"name"`
+	Status   db.BranchStatus   `json:"status"`
+	PgStatus db.BranchPgStatus `json:"pgStatus"`
+	Port     int32             `json:"port"`
+	ParentID *int32            `json:"parentId"`
+	ClosedAt *time.Time        `json:"closedAt"`
+	PurgeAt  *time.Time        `json:"purgeAt"`
+	Quota    Quota             `json:"quota"`
+
+	// StorageError is set while the branch is out of space
+	StorageError *string `json:"storageError"`
+
+	// OwnerTokenID is the token that created the branch, developers can only modify their own
+	OwnerTokenID *int32            `json:"ownerTokenId"`
+	Owner        *string           `json:"owner"`
+	Description  *string           `json:"description"`
+	Labels       map[string]string `json:"labels"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
 }
 
 type Pool struct {
-	ID        *int32 `json:"id"`
-	Type      string `json:"type"`
-	SizeInMb  int64  `json:"sizeInMb"`
-	Path      string `json:"path"`
-	MountPath string `json:"mountPath"`
+	ID          *int32  `json:"id"`
+	Type        string  `json:"type"`
+	SizeInMb    int64   `json:"sizeInMb"`
+	Path        string  `json:"path"`
+	MountPath   string  `json:"mountPath"`
+	Encryption  *string `json:"encryption"`
+	KeyLocation *string `json:"keyLocation"`
+}
+
+// BranchNode is a branch in the repo branch hierarchy. ForkSnapshot and DependsOn are read from the
+// ZFS origin of the branch dataset, so they reflect the actual clone dependency rather than the
+// recorded parent.
+type BranchNode struct {
+	Branch
+	Dataset      string       `json:"dataset"`
+	ForkSnapshot *string      `json:"forkSnapshot"`
+	DependsOn    *string      `json:"dependsOn"`
+	Dependents   []string     `json:"dependents"`
+	Children     []BranchNode `json:"children"`
+}
+
+// Usage is the live space accounting of a repo. Branch usage shows how much unique data each branch
+// holds, snapshot usage shows how much space is only kept alive by the snapshot.
+type Usage struct {
+	Pool      PoolUsage       `json:"pool"`
+	Branches  []BranchUsage   `json:"branches"`
+	Snapshots []SnapshotUsage `json:"snapshots"`
+}
+
+type PoolUsage struct {
+	SizeInBytes          int64  `json:"sizeInBytes"`
+	AllocatedInBytes     int64  `json:"allocatedInBytes"`
+	FreeInBytes          int64  `json:"freeInBytes"`
+	FragmentationPercent *int64 `json:"fragmentationPercent"`
+}
+
+type BranchUsage struct {
+	Branch                 string  `json:"branch"`
+	Dataset                string  `json:"dataset"`
+	UsedInBytes            int64   `json:"usedInBytes"`
+	ReferencedInBytes      int64   `json:"referencedInBytes"`
+	WrittenInBytes         int64   `json:"writtenInBytes"`
+	UsedBySnapshotsInBytes int64   `json:"usedBySnapshotsInBytes"`
+	AvailableInBytes       int64   `json:"availableInBytes"`
+	CompressRatio          float64 `json:"compressRatio"`
+}
+
+type SnapshotUsage struct {
+	Name              string   `json:"name"`
+	Dataset           string   `json:"dataset"`
+	UsedInBytes       int64    `json:"usedInBytes"`
+	ReferencedInBytes int64    `json:"referencedInBytes"`
+	Clones            []string `json:"clones"`
 }
@@ -9,6 +9,9 @@ type Response[T any] struct {
 	Data   *T
 	Error  *[]string
 	IsList bool
+
+	// JobID is set when the request started a background job, its progress is at /api/jobs/{id}
+	JobID *int32
 }
 
 func (r Response[T]) MarshalJSON() ([]byte, error) {
@@ -36,8 +39,10 @@ func (r Response[T]) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		Data  any       `json:"data"`
 		Error *[]string `json:"errors"`
+		JobID *int32    `json:"jobId,omitempty"`
 	}{
 		Data:  data,
 		Error: r.Error,
+		JobID: r.JobID,
 	})
 }
@@ -0,0 +1,13 @@
+package system
+
+type ZfsVersion struct {
+	Userland     string          `json:"userland"`
+	Kmod         string          `json:"kmod"`
+	MinVersion   string          `json:"minVersion"`
+	Capabilities ZfsCapabilities `json:"capabilities"`
+}
+
+type ZfsCapabilities struct {
+	JsonOutput   bool `json:"jsonOutput"`
+	BlockCloning bool `json:"blockCloning"`
+}
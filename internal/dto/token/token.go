@@ -0,0 +1,39 @@
+package token
+
+import (
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Grant struct {
+	Repo string `json:"repo" validate:"required,min=1,max=100"`
+
+	// Role on the repo, the role of the token is used when it's empty
+	Role db.Role `json:"role" validate:"omitempty,oneof=maintainer developer read-only"`
+}
+
+type Init struct {
+	Name string  `json:"name" validate:"required,min=1,max=100"`
+	Role db.Role `json:"role" validate:"required,oneof=admin maintainer developer read-only"`
+
+	// Repos limits the token to the given repos, it can access every repo when it's empty
+	Repos []Grant `json:"repos" validate:"dive"`
+
+	// ExpiresInDays makes the token stop working after the given number of days
+	ExpiresInDays *int `json:"expiresInDays" validate:"omitempty,min=1,max=3650"`
+}
+
+type Response struct {
+	ID         *int32     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Role       db.Role    `json:"role"`
+	Scoped     bool       `json:"scoped"`
+	Repos      []Grant    `json:"repos"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+
+	// Token is only returned when the token is created
+	Token *string `json:"token,omitempty"`
+}
@@ -0,0 +1,51 @@
+package webhook
+
+import (
+	"encoding/json"
+	"github.com/jamius19/postbranch/internal/db"
+	"time"
+)
+
+type Init struct {
+	URL string `json:"url" validate:"required,http_url,max=2048"`
+
+	// Secret signs the payloads, one is generated when it's left empty
+	Secret string `json:"secret" validate:"omitempty,min=16,max=255"`
+
+	// Events limits the webhook to the given lifecycle events, all of them are sent when it's empty
+	Events []string `json:"events" validate:"dive,oneof=branch.ready branch.failed branch.expired import.succeeded import.failed"`
+
+	// Repo limits the webhook to the events of a single repo
+	Repo    *string `json:"repo" validate:"omitempty,min=1,max=100"`
+	Enabled *bool   `json:"enabled"`
+}
+
+type Response struct {
+	ID      *int32   `json:"id"`
+	URL     string   `json:"url"`
+	Events  []string `json:"events"`
+	Repo    *string  `json:"repo"`
+	Enabled bool     `json:"enabled"`
+
+	// Secret is only returned when the webhook is created
+	Secret *string `json:"secret,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type DeliveryResponse struct {
+	ID            *int32                   `json:"id"`
+	WebhookID     int32                    `json:"webhookId"`
+	Event         string                   `json:"event"`
+	Payload       json.RawMessage          `json:"payload"`
+	Status        db.WebhookDeliveryStatus `json:"status"`
+	Attempts      int32                    `json:"attempts"`
+	ResponseCode  *int32                   `json:"responseCode"`
+	ResponseBody  *string                  `json:"responseBody"`
+	Error         *string                  `json:"error"`
+	NextAttemptAt *time.Time               `json:"nextAttemptAt"`
+	DeliveredAt   *time.Time               `json:"deliveredAt"`
+	ReplayOf      *int32                   `json:"replayOf"`
+	CreatedAt     time.Time                `json:"createdAt"`
+}
@@ -0,0 +1,184 @@
+package event
+
+import (
+	"github.com/jamius19/postbranch/internal/logger"
+	"slices"
+	"sync"
+	"time"
+)
+
+// bufferSize is how many past events are kept for clients resuming with a Last-Event-ID
+const bufferSize = 1024
+
+// subscriberBuffer is how far a client can fall behind before it's dropped. It can reconnect and
+// resume from the buffer.
+const subscriberBuffer = 256
+
+var log = logger.Logger
+
+type Type string
+
+const (
+	RepoStatus     Type = "repo.status"
+	BranchPgStatus Type = "branch.pg_status"
+	BranchExpired  Type = "branch.expired"
+	JobProgress    Type = "job.progress"
+	JobLog         Type = "job.log"
+)
+
+type Event struct {
+	ID     int64     `json:"id"`
+	Type   Type      `json:"type"`
+	Repo   string    `json:"repo"`
+	Branch string    `json:"branch,omitempty"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+type RepoStatusData struct {
+	RepoID int32  `json:"repoId"`
+	Status string `json:"status"`
+}
+
+type BranchPgStatusData struct {
+	BranchID int32  `json:"branchId"`
+	Status   string `json:"status"`
+	PgStatus string `json:"pgStatus"`
+	PgPort   int32  `json:"pgPort"`
+}
+
+type BranchExpiredData struct {
+	BranchID int32      `json:"branchId"`
+	ClosedAt *time.Time `json:"closedAt"`
+}
+
+type JobProgressData struct {
+	JobID    int32  `json:"jobId"`
+	Type     string `json:"type"`
+	State    string `json:"state"`
+	Progress int64  `json:"progress"`
+	Step     string `json:"step"`
+	Error    string `json:"error,omitempty"`
+}
+
+type JobLogData struct {
+	JobID int32  `json:"jobId"`
+	Line  string `json:"line"`
+}
+
+// Filter narrows down the events of a subscription, empty fields match every event
+type Filter struct {
+	Repo string
+
+	// Branch matches the events of the branch along with the ones of its whole repo
+	Branch string
+	Types  []Type
+
+	// Repos limits the events to the given repos, every repo is matched when it's nil
+	Repos []string
+}
+
+type Subscription struct {
+	Events <-chan Event
+
+	events chan Event
+	filter Filter
+}
+
+var (
+	mu          sync.Mutex
+	lastId      int64
+	buffer      = make([]Event, 0, bufferSize)
+	subscribers = map[*Subscription]struct{}{}
+)
+
+// Publish records the event and sends it to the matching subscribers. It never blocks, subscribers
+// that can't keep up are dropped.
+func Publish(eventType Type, repo, branch string, data any) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	lastId++
+
+	newEvent := Event{
+		ID:     lastId,
+		Type:   eventType,
+		Repo:   repo,
+		Branch: branch,
+		Time:   time.Now().UTC(),
+		Data:   data,
+	}
+
+	if len(buffer) == bufferSize {
+		buffer = append(buffer[:0], buffer[1:]...)
+	}
+
+	buffer = append(buffer, newEvent)
+
+	for subscription := range subscribers {
+		if !subscription.filter.matches(newEvent) {
+			continue
+		}
+
+		select {
+		case subscription.events <- newEvent:
+		default:
+			log.Warnf("Dropping slow event subscriber after event %d", newEvent.ID)
+			delete(subscribers, subscription)
+			close(subscription.events)
+		}
+	}
+}
+
+// Subscribe returns a subscription along with the buffered events after lastEventId. complete is
+// false when some of the events after lastEventId are no longer buffered, or are from before a
+// restart, and the client has to reload its state.
+func Subscribe(filter Filter, lastEventId int64) (subscription *Subscription, missed []Event, complete bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	events := make(chan Event, subscriberBuffer)
+	subscription = &Subscription{Events: events, events: events, filter: filter}
+	subscribers[subscription] = struct{}{}
+
+	if lastEventId <= 0 {
+		return subscription, nil, true
+	}
+
+	complete = lastEventId <= lastId && (len(buffer) == 0 || lastEventId >= buffer[0].ID-1)
+
+	for _, bufferedEvent := range buffer {
+		if bufferedEvent.ID > lastEventId && filter.matches(bufferedEvent) {
+			missed = append(missed, bufferedEvent)
+		}
+	}
+
+	return subscription, missed, complete
+}
+
+// Unsubscribe stops the subscription, it's safe to call after the subscription has been dropped
+func Unsubscribe(subscription *Subscription) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := subscribers[subscription]; ok {
+		delete(subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+func (filter Filter) matches(event Event) bool {
+	if filter.Repo != "" && filter.Repo != event.Repo {
+		return false
+	}
+
+	if filter.Repos != nil && !slices.Contains(filter.Repos, event.Repo) {
+		return false
+	}
+
+	if filter.Branch != "" && event.Branch != "" && filter.Branch != event.Branch {
+		return false
+	}
+
+	return len(filter.Types) == 0 || slices.Contains(filter.Types, event.Type)
+}
@@ -9,10 +9,83 @@ import (
 type Opts struct {
 	Server struct {
 		Port int `yaml:"port" validate:"required,min=1,max=65535"`
+
+		// AllowedOrigins are the origins other than the server's own that can call the API from a browser
+		AllowedOrigins []string `yaml:"allowedOrigins" validate:"dive,required"`
+
+		// TLS serves the API over HTTPS with the given certificate, it's served over HTTP without one
+		TLS struct {
+			CertFile string `yaml:"certFile" validate:"required_with=KeyFile,omitempty,file"`
+			KeyFile  string `yaml:"keyFile" validate:"required_with=CertFile,omitempty,file"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
+
+	Database struct {
+		// Path of the SQLite database PostBranch keeps its metadata in, it's created on the first start
+		Path string `yaml:"path" validate:"required"`
+	} `yaml:"database"`
+
+	Pool struct {
+		// MountDir is where the pools are mounted, each under pb-<repo name>
+		MountDir string `yaml:"mountDir" validate:"required"`
+	} `yaml:"pool"`
+
+	Branch struct {
+		// User is the OS user that owns the data of the branches and runs their Postgres
+		User string `yaml:"user" validate:"required"`
+
+		// RetentionHours is how long the dataset of a closed branch is kept before it's purged
+		RetentionHours int `yaml:"retentionHours" validate:"min=0"`
+
+		// PurgeIntervalMinutes is how often closed branches are checked for expired retention
+		PurgeIntervalMinutes int `yaml:"purgeIntervalMinutes" validate:"min=0"`
+
+		// ArchiveDir is where branches are exported to and imported from, paths outside it are refused
+		ArchiveDir string `yaml:"archiveDir" validate:"required"`
+
+		TLS struct {
+			// CADir holds the CA that signs the certificate of every branch, it's created on the first start
+			CADir string `yaml:"caDir" validate:"required"`
+
+			// CertDir holds the certificate and key of every branch. It's kept out of the datasets so that
+			// exports and replicas don't carry the keys.
+			CertDir string `yaml:"certDir" validate:"required"`
+
+			// Hosts are the names and addresses clients connect to the branches with
+			Hosts []string `yaml:"hosts" validate:"dive,required"`
+		} `yaml:"tls"`
+	} `yaml:"branch"`
+
+	Replication struct {
+		// Dir is the only place file sinks can write replication streams to
+		Dir string `yaml:"dir" validate:"required"`
+	} `yaml:"replication"`
+
+	Health struct {
+		// CheckIntervalMinutes is how often the status of every pool is checked
+		CheckIntervalMinutes int `yaml:"checkIntervalMinutes" validate:"min=0"`
+
+		// ScrubIntervalHours is how long after the last scrub a new one is started
+		ScrubIntervalHours int `yaml:"scrubIntervalHours" validate:"min=0"`
+	} `yaml:"health"`
 }
 
-const defaultConfigPath = "/etc/postbranch/config.yml"
+const (
+	defaultConfigPath   = "/etc/postbranch/config.yml"
+	defaultDatabasePath = "/var/lib/postbranch/postbranch.db"
+	defaultPoolMountDir = "/mnt"
+	defaultBranchUser   = "postbranch"
+
+	defaultRetentionHours       = 7 * 24
+	defaultPurgeIntervalMinutes = 15
+	defaultCADir                = "/var/lib/postbranch/ca"
+	defaultCertDir              = "/var/lib/postbranch/certs"
+	defaultArchiveDir           = "/var/lib/postbranch/archives"
+	defaultReplicationDir       = "/var/lib/postbranch/replicas"
+
+	defaultHealthCheckIntervalMinutes = 5
+	defaultScrubIntervalHours         = 7 * 24
+)
 
 var Config *Opts
 
@@ -37,6 +110,11 @@ func Load() error {
 	config := &Opts{}
 
 	err = yaml.Unmarshal(buf, config)
+	if err != nil {
+		return err
+	}
+
+	setDefaults(config)
 
 	validate := validator.New()
 	err = validate.Struct(config)
@@ -48,3 +126,64 @@ func Load() error {
 
 	return nil
 }
+
+func setDefaults(config *Opts) {
+	if config.Database.Path == "" {
+		config.Database.Path = defaultDatabasePath
+	}
+
+	if config.Pool.MountDir == "" {
+		config.Pool.MountDir = defaultPoolMountDir
+	}
+
+	if config.Branch.User == "" {
+		config.Branch.User = defaultBranchUser
+	}
+
+	if config.Branch.RetentionHours == 0 {
+		config.Branch.RetentionHours = defaultRetentionHours
+	}
+
+	if config.Branch.PurgeIntervalMinutes == 0 {
+		config.Branch.PurgeIntervalMinutes = defaultPurgeIntervalMinutes
+	}
+
+	if config.Branch.ArchiveDir == "" {
+		config.Branch.ArchiveDir = defaultArchiveDir
+	}
+
+	if config.Branch.TLS.CADir == "" {
+		config.Branch.TLS.CADir = defaultCADir
+	}
+
+	if config.Branch.TLS.CertDir == "" {
+		config.Branch.TLS.CertDir = defaultCertDir
+	}
+
+	if len(config.Branch.TLS.Hosts) == 0 {
+		config.Branch.TLS.Hosts = defaultHosts()
+	}
+
+	if config.Replication.Dir == "" {
+		config.Replication.Dir = defaultReplicationDir
+	}
+
+	if config.Health.CheckIntervalMinutes == 0 {
+		config.Health.CheckIntervalMinutes = defaultHealthCheckIntervalMinutes
+	}
+
+	if config.Health.ScrubIntervalHours == 0 {
+		config.Health.ScrubIntervalHours = defaultScrubIntervalHours
+	}
+}
+
+// defaultHosts lets clients verify the branches through the host name of the server and locally
+func defaultHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append([]string{hostname}, hosts...)
+	}
+
+	return hosts
+}
@@ -1,9 +1,13 @@
 package runner
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/elliotchance/orderedmap/v2"
 	"github.com/jamius19/postbranch/internal/logger"
 	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
 	"os/exec"
 	"strings"
 	"syscall"
@@ -26,57 +30,115 @@ const EmptyOutput = ""
 
 var log = logger.Logger
 
-func Single(key string, skipLog bool, sensitive bool, name string, args ...string) (string, error) {
-	if !skipLog {
-		if !sensitive {
-			log.Debugf("[s] Executing %s command: %s %v", key, name, args)
+// Single runs a command until it exits or the context is done and returns its combined output.
+func Single(ctx context.Context, key string, skipLog bool, sensitive bool, name string, args ...string) (string, error) {
+	return run(ctx, "s", Options{Key: key, SkipLog: skipLog, Sensitive: sensitive}, name, args...)
+}
+
+// Pipe runs a command with its stdin and stdout connected to the given reader and writer, which is
+// needed for streaming commands like zfs send/receive. Only stderr is returned as the output.
+func Pipe(ctx context.Context, key string, stdin io.Reader, stdout io.Writer, name string, args ...string) (string, error) {
+	return run(ctx, "p", Options{Key: key, Stdin: stdin, Stdout: stdout}, name, args...)
+}
+
+// Run runs a command until it exits, the context is done or the timeout passes. The whole process
+// group is killed when it's stopped early, so children like pg_basebackup's WAL streamer don't
+// outlive it.
+func Run(ctx context.Context, options Options, name string, args ...string) (string, error) {
+	return run(ctx, "r", options, name, args...)
+}
+
+func run(ctx context.Context, prefix string, options Options, name string, args ...string) (string, error) {
+	key := options.Key
+
+	if !options.SkipLog {
+		if !options.Sensitive {
+			log.Debugf("[%s] Executing %s command: %s %v", prefix, key, name, args)
 		} else {
-			log.Debugf("[s] Executing %s command: %s *****", key, name)
+			log.Debugf("[%s] Executing %s command: %s *****", prefix, key, name)
 		}
 	}
 
-	cmd := exec.Command(name, args...)
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 	}
 
-	out, err := cmd.CombinedOutput()
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = killWaitDelay
+
+	output := &outputBuffer{}
+	stdout := &lineWriter{stream: Stdout, output: output, onLine: options.OnLine}
+	stderr := &lineWriter{stream: Stderr, output: output, onLine: options.OnLine}
+
+	cmd.Stdin = options.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if options.Stdout != nil {
+		cmd.Stdout = options.Stdout
+	}
+
+	err := cmd.Run()
+
+	stdout.flush()
+	stderr.flush()
+
+	out := output.String()
 
 	if err != nil {
-		if !skipLog {
-			if !sensitive {
-				log.Errorf("[s] Error executing %s command: %s %v error: %s, output: %s", key, name, args, err, out)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("timed out after %s: %w", options.Timeout, err)
+		case errors.Is(ctx.Err(), context.Canceled):
+			err = fmt.Errorf("cancelled: %w", err)
+		}
+
+		if !options.SkipLog {
+			if !options.Sensitive {
+				log.Errorf("[%s] Error executing %s command: %s %v error: %s, output: %s", prefix, key, name, args, err, out)
 			} else {
-				log.Errorf("[s] Error executing %s command: %s ***** error: %s", key, name, err)
+				log.Errorf("[%s] Error executing %s command: %s ***** error: %s", prefix, key, name, err)
 			}
 		}
 
-		outputStr := string(out)
-		return outputStr, responseerror.From("Error executing command")
+		if ctx.Err() != nil {
+			return out, responseerror.From("Command was stopped before it finished")
+		}
+
+		return out, responseerror.From("Error executing command")
 	}
 
-	output := strings.TrimSpace(string(out))
-	if !skipLog {
-		if !sensitive {
-			log.Debugf("[s] Output for %s command: %s, output: %s",
-				key, name, strings.Replace(output, "\n", "\\\\", -1))
+	out = strings.TrimSpace(out)
+	if !options.SkipLog {
+		if !options.Sensitive {
+			log.Debugf("[%s] Output for %s command: %s, output: %s",
+				prefix, key, name, strings.Replace(out, "\n", "\\\\", -1))
 		} else {
-			log.Debugf("[s] Output for %s command: %s, output: *****", key, name)
+			log.Debugf("[%s] Output for %s command: %s, output: *****", prefix, key, name)
 		}
 	}
 
-	return output, nil
+	return out, nil
 }
 
 // Multi should be avoided as much as possible. Try to use go apis for the same.
-func Multi(cmds *orderedmap.OrderedMap[string, Command]) (*orderedmap.OrderedMap[string, CommandOutput], error) {
+func Multi(ctx context.Context, cmds *orderedmap.OrderedMap[string, Command]) (*orderedmap.OrderedMap[string, CommandOutput], error) {
 	LogCmds(cmds)
 
 	outputs := orderedmap.NewOrderedMap[string, CommandOutput]()
 
 	for el := cmds.Front(); el != nil; el = el.Next() {
 		command := el.Value
-		output, err := Single(el.Key, true, el.Value.Sensitive, command.Name, command.Args...)
+		output, err := Single(ctx, el.Key, true, el.Value.Sensitive, command.Name, command.Args...)
 
 		if err != nil {
 			log.Errorf(
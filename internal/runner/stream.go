@@ -0,0 +1,108 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+
+	// killWaitDelay is how long a killed command gets to close its output before Run gives up on it
+	killWaitDelay = 5 * time.Second
+)
+
+type Options struct {
+	Key       string
+	SkipLog   bool
+	Sensitive bool
+
+	// Timeout stops the command if it's still running after it, there's no timeout when it's zero
+	Timeout time.Duration
+
+	Stdin io.Reader
+
+	// Stdout receives the standard output when it's set, then only stderr is returned and streamed
+	Stdout io.Writer
+
+	// OnLine is called with every line of output as soon as the command writes it
+	OnLine func(line Line)
+}
+
+type Line struct {
+	Stream string
+	Text   string
+}
+
+// outputBuffer collects stdout and stderr in the order they're written
+type outputBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (output *outputBuffer) Write(p []byte) (int, error) {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+
+	return output.buffer.Write(p)
+}
+
+func (output *outputBuffer) String() string {
+	output.mu.Lock()
+	defer output.mu.Unlock()
+
+	return output.buffer.String()
+}
+
+// lineWriter passes the output through to the buffer and splits it into lines for the callback.
+// Progress output ending with a carriage return counts as a line too.
+type lineWriter struct {
+	stream  string
+	output  *outputBuffer
+	onLine  func(line Line)
+	partial []byte
+}
+
+func (writer *lineWriter) Write(p []byte) (int, error) {
+	if _, err := writer.output.Write(p); err != nil {
+		return 0, err
+	}
+
+	if writer.onLine == nil {
+		return len(p), nil
+	}
+
+	writer.partial = append(writer.partial, p...)
+
+	for {
+		end := bytes.IndexAny(writer.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+
+		writer.emit(string(writer.partial[:end]))
+		writer.partial = writer.partial[end+1:]
+	}
+
+	return len(p), nil
+}
+
+func (writer *lineWriter) flush() {
+	if writer.onLine != nil && len(writer.partial) > 0 {
+		writer.emit(string(writer.partial))
+		writer.partial = nil
+	}
+}
+
+func (writer *lineWriter) emit(text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	writer.onLine(Line{Stream: writer.stream, Text: text})
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/logger"
+	"strings"
+)
+
+// SystemActor records what PostBranch does on its own, background jobs and scheduled cleanups
+const SystemActor = "system"
+
+// redactedValue is the same mask HostImportReqDto.String() puts in place of the password
+const redactedValue = "*****"
+
+var log = logger.Logger
+
+// credentialKeys are the request fields that are never written to the audit log
+var credentialKeys = map[string]bool{
+	"password":   true,
+	"passphrase": true,
+	"secret":     true,
+	"token":      true,
+}
+
+// Record appends an event to the audit log. A failure is logged, it doesn't fail the operation that
+// was audited.
+func Record(ctx context.Context, auditEvent model.AuditEvent) {
+	if _, err := db.CreateAuditEvent(context.WithoutCancel(ctx), auditEvent); err != nil {
+		log.Errorf("Failed to record audit event %s on %s: %s", auditEvent.Action, auditEvent.Target, err)
+	}
+}
+
+// RecordSystem appends an event of something PostBranch did on its own
+func RecordSystem(ctx context.Context, action, target string, params any, err error) {
+	auditEvent := model.AuditEvent{
+		Actor:   SystemActor,
+		Action:  action,
+		Target:  target,
+		Outcome: string(db.AuditSucceeded),
+	}
+
+	if params != nil {
+		if encoded, err := json.Marshal(params); err == nil {
+			auditEvent.Params = Redact(encoded)
+		}
+	}
+
+	if err != nil {
+		message := err.Error()
+		auditEvent.Outcome = string(db.AuditFailed)
+		auditEvent.Error = &message
+	}
+
+	Record(ctx, auditEvent)
+}
+
+// Redact returns the JSON request body with the credentials masked. Bodies that aren't JSON are
+// left out of the log, nil is returned for them.
+func Redact(body []byte) *string {
+	var params any
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil
+	}
+
+	redacted, err := json.Marshal(redact(params))
+	if err != nil {
+		return nil
+	}
+
+	value := string(redacted)
+	return &value
+}
+
+func redact(value any) any {
+	switch typed := value.(type) {
+	case map[string]any:
+		for key, nested := range typed {
+			if credentialKeys[strings.ToLower(key)] {
+				typed[key] = redactedValue
+				continue
+			}
+
+			typed[key] = redact(nested)
+		}
+	case []any:
+		for i, nested := range typed {
+			typed[i] = redact(nested)
+		}
+	}
+
+	return value
+}
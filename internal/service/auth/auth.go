@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-jet/jet/v2/qrm"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	tokenPrefix = "pb_"
+
+	// prefixLength is the part of the token that's stored in plain text to tell tokens apart
+	prefixLength = 8
+
+	// lastUsedResolution limits how often the last use of a token is written
+	lastUsedResolution = time.Minute
+
+	bootstrapTokenName = "bootstrap"
+
+	// bootstrapTokenFile is created next to the database with the first admin token
+	bootstrapTokenFile = "admin-token"
+)
+
+var log = logger.Logger
+
+var ErrUnauthorized = errors.New("invalid or expired api token")
+
+type callerKey struct{}
+
+// Caller is the token a request was made with
+type Caller struct {
+	Token model.APIToken
+
+	// Repos maps the repos the token is limited to to its role on them, it's nil when the token
+	// can access every repo and empty when it's scoped without any grants left
+	Repos map[string]db.Role
+}
+
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, caller)
+}
+
+func CallerFrom(ctx context.Context) (Caller, bool) {
+	caller, ok := ctx.Value(callerKey{}).(Caller)
+	return caller, ok
+}
+
+func (caller Caller) Role() db.Role {
+	return db.Role(caller.Token.Role)
+}
+
+// RepoRole returns the role of the caller on the repo, false if it can't access the repo at all
+func (caller Caller) RepoRole(repoName string) (db.Role, bool) {
+	if caller.Repos == nil {
+		return caller.Role(), true
+	}
+
+	role, ok := caller.Repos[repoName]
+	return role, ok
+}
+
+func (caller Caller) CanAccessRepo(repoName string, role db.Role) bool {
+	repoRole, ok := caller.RepoRole(repoName)
+	return ok && repoRole.Includes(role)
+}
+
+// CanModifyBranch tells whether the caller can close or change the branch. Developers can only
+// modify the branches they created.
+func (caller Caller) CanModifyBranch(repoName string, branch model.Branch) bool {
+	if caller.CanAccessRepo(repoName, db.RoleMaintainer) {
+		return true
+	}
+
+	return caller.CanAccessRepo(repoName, db.RoleDeveloper) &&
+		branch.OwnerTokenID != nil &&
+		*branch.OwnerTokenID == *caller.Token.ID
+}
+
+// Authenticate resolves the caller of a plain token, ErrUnauthorized is returned for unknown and
+// expired tokens
+func Authenticate(ctx context.Context, plainToken string) (Caller, error) {
+	if !strings.HasPrefix(plainToken, tokenPrefix) {
+		return Caller{}, ErrUnauthorized
+	}
+
+	apiToken, err := db.GetAPITokenByHash(ctx, Hash(plainToken))
+	if errors.Is(err, qrm.ErrNoRows) {
+		return Caller{}, ErrUnauthorized
+	} else if err != nil {
+		log.Errorf("Can't query api token: %s", err)
+		return Caller{}, err
+	}
+
+	now := time.Now().UTC()
+	if apiToken.ExpiresAt != nil && apiToken.ExpiresAt.Before(now) {
+		return Caller{}, ErrUnauthorized
+	}
+
+	caller := Caller{Token: apiToken}
+
+	grants, err := db.ListAPITokenGrants(ctx, *apiToken.ID)
+	if err != nil {
+		return Caller{}, err
+	}
+
+	if apiToken.Scoped {
+		caller.Repos = make(map[string]db.Role, len(grants))
+		for _, grant := range grants {
+			caller.Repos[grant.Repo.Name] = db.Role(grant.Role)
+		}
+	}
+
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > lastUsedResolution {
+		// A failed write doesn't stop the request, it's only informational
+		_ = db.UpdateAPITokenLastUsed(ctx, *apiToken.ID)
+	}
+
+	return caller, nil
+}
+
+// CreateToken stores a new token, the plain token is returned only here
+func CreateToken(ctx context.Context, tokenInit token.Init) (model.APIToken, string, error) {
+	if tokenInit.Role == db.RoleAdmin && len(tokenInit.Repos) > 0 {
+		return model.APIToken{}, "", responseerror.From("Admin tokens can't be limited to repositories")
+	}
+
+	grants, err := resolveGrants(ctx, tokenInit.Role, tokenInit.Repos)
+	if err != nil {
+		return model.APIToken{}, "", err
+	}
+
+	plainToken, err := generateToken()
+	if err != nil {
+		return model.APIToken{}, "", err
+	}
+
+	newToken := model.APIToken{
+		Name:      tokenInit.Name,
+		TokenHash: Hash(plainToken),
+		Prefix:    plainToken[:len(tokenPrefix)+prefixLength],
+		Role:      string(tokenInit.Role),
+		Scoped:    len(tokenInit.Repos) > 0,
+	}
+
+	if tokenInit.ExpiresInDays != nil {
+		expiresAt := time.Now().UTC().AddDate(0, 0, *tokenInit.ExpiresInDays)
+		newToken.ExpiresAt = &expiresAt
+	}
+
+	newToken, err = db.CreateAPIToken(ctx, newToken)
+	if err != nil {
+		return model.APIToken{}, "", err
+	}
+
+	if err := db.ReplaceAPITokenGrants(ctx, *newToken.ID, newToken.Scoped, grants); err != nil {
+		if err := db.DeleteAPIToken(ctx, *newToken.ID); err != nil {
+			log.Errorf("Can't delete api token %d: %s", *newToken.ID, err)
+		}
+
+		return model.APIToken{}, "", err
+	}
+
+	log.Infof("Created %s api token %s (%s)", newToken.Role, newToken.Name, newToken.Prefix)
+	return newToken, plainToken, nil
+}
+
+// SetTokenRepos limits the token to the given repos, with an empty list it can't access any repo
+func SetTokenRepos(ctx context.Context, apiToken model.APIToken, repos []token.Grant) error {
+	if db.Role(apiToken.Role) == db.RoleAdmin {
+		return responseerror.From("Admin tokens can't be limited to repositories")
+	}
+
+	grants, err := resolveGrants(ctx, db.Role(apiToken.Role), repos)
+	if err != nil {
+		return err
+	}
+
+	return db.ReplaceAPITokenGrants(ctx, *apiToken.ID, true, grants)
+}
+
+// ClearTokenRepos removes the limit of the token, it can access every repo afterwards
+func ClearTokenRepos(ctx context.Context, apiToken model.APIToken) error {
+	return db.ReplaceAPITokenGrants(ctx, *apiToken.ID, false, nil)
+}
+
+// TokenRepos returns the repos the token is limited to
+func TokenRepos(ctx context.Context, tokenId int32) ([]token.Grant, error) {
+	grants, err := db.ListAPITokenGrants(ctx, tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	repos := make([]token.Grant, 0, len(grants))
+	for _, grant := range grants {
+		repos = append(repos, token.Grant{Repo: grant.Repo.Name, Role: db.Role(grant.Role)})
+	}
+
+	return repos, nil
+}
+
+// Bootstrap creates an admin token when there's none, otherwise nobody could use the API
+func Bootstrap(ctx context.Context) error {
+	count, err := db.CountAPITokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	tokenInit := token.Init{
+		Name: bootstrapTokenName,
+		Role: db.RoleAdmin,
+	}
+
+	newToken, plainToken, err := CreateToken(ctx, tokenInit)
+	if err != nil {
+		return err
+	}
+
+	// The token is only written to a file the service user can read, the log might be shipped elsewhere
+	tokenPath := filepath.Join(filepath.Dir(opts.Config.Database.Path), bootstrapTokenFile)
+	if err := writeBootstrapToken(tokenPath, plainToken); err != nil {
+		log.Errorf("Can't write admin token to %s: %s", tokenPath, err)
+
+		// Without the file nobody knows the token, the next start creates a new one
+		if err := db.DeleteAPIToken(ctx, *newToken.ID); err != nil {
+			log.Errorf("Can't delete admin token: %s", err)
+		}
+
+		return err
+	}
+
+	log.Warnf("No API tokens found, created an admin token in %s. Delete the file once it's stored elsewhere", tokenPath)
+	return nil
+}
+
+func writeBootstrapToken(tokenPath, plainToken string) error {
+	file, err := os.OpenFile(tokenPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	// The mode is only applied to new files, a file left from an earlier bootstrap is fixed up too
+	if err := file.Chmod(0600); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if _, err := file.WriteString(plainToken + "\n"); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Hash returns the stored form of a token
+func Hash(plainToken string) string {
+	sum := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString(sum[:])
+}
+
+func resolveGrants(ctx context.Context, tokenRole db.Role, repos []token.Grant) ([]model.APITokenRepo, error) {
+	grants := make([]model.APITokenRepo, 0, len(repos))
+
+	for _, grant := range repos {
+		repoDetail, err := db.GetRepoByName(ctx, grant.Repo)
+		if err != nil {
+			return nil, responseerror.From(fmt.Sprintf("Repository %s not found", grant.Repo))
+		}
+
+		role := grant.Role
+		if role == "" {
+			role = tokenRole
+		}
+
+		grants = append(grants, model.APITokenRepo{
+			RepoID: *repoDetail.Repo.ID,
+			Role:   string(role),
+		})
+	}
+
+	return grants, nil
+}
+
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		log.Errorf("Can't generate api token: %s", err)
+		return "", err
+	}
+
+	return tokenPrefix + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,238 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	caCertFile = "ca.crt"
+	caKeyFile  = "ca.key"
+
+	caValidity         = 10 * 365 * 24 * time.Hour
+	serverCertValidity = 397 * 24 * time.Hour
+)
+
+var log = logger.Logger
+
+// The CA is loaded once and kept in memory, every branch certificate is signed with it
+var (
+	mu        sync.Mutex
+	caCert    *x509.Certificate
+	caCertPEM []byte
+	caKey     *ecdsa.PrivateKey
+)
+
+// Initialize loads the CA from the CA directory and creates it on the first start
+func Initialize() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return load()
+}
+
+// Certificate returns the PEM encoded CA certificate that clients verify the branches with
+func Certificate() ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := load(); err != nil {
+		return nil, err
+	}
+
+	return caCertPEM, nil
+}
+
+// IssueServerCert signs a server certificate valid for the given host names and IP addresses. The
+// certificate and its key are returned PEM encoded.
+func IssueServerCert(commonName string, hosts []string) ([]byte, []byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := load(); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate server key: %w", err)
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{Organization: []string{"PostBranch"}, CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(serverCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign server certificate: %w", err)
+	}
+
+	keyPem, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), keyPem, nil
+}
+
+func load() error {
+	if caCert != nil {
+		return nil
+	}
+
+	caDir := opts.Config.Branch.TLS.CADir
+
+	certPem, certErr := os.ReadFile(filepath.Join(caDir, caCertFile))
+	keyPem, keyErr := os.ReadFile(filepath.Join(caDir, caKeyFile))
+
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		return create(caDir)
+	}
+
+	if certErr != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+
+	if keyErr != nil {
+		return fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil {
+		return fmt.Errorf("CA certificate in %s isn't PEM encoded", caDir)
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPem)
+	if keyBlock == nil {
+		return fmt.Errorf("CA key in %s isn't PEM encoded", caDir)
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	key, ok := parsedKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("CA key in %s isn't an ECDSA key", caDir)
+	}
+
+	if time.Now().After(cert.NotAfter) {
+		log.Warnf("CA certificate in %s expired on %s, branch certificates won't verify", caDir, cert.NotAfter)
+	}
+
+	caCert, caCertPEM, caKey = cert, certPem, key
+	return nil
+}
+
+func create(caDir string) error {
+	log.Infof("Creating CA in %s", caDir)
+
+	if err := os.MkdirAll(caDir, 0700); err != nil {
+		return fmt.Errorf("failed to create CA directory: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serialNumber, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"PostBranch"}, CommonName: "PostBranch CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDer)
+	if err != nil {
+		return fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	keyPem, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer})
+
+	if err := os.WriteFile(filepath.Join(caDir, caKeyFile), keyPem, 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(caDir, caCertFile), certPem, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+
+	caCert, caCertPEM, caKey = cert, certPem, key
+	return nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	return serialNumber, nil
+}
@@ -0,0 +1,306 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/health"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/audit"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"strings"
+	"time"
+)
+
+// scrubHistory is how many of the latest scrubs are returned with the pool health
+const scrubHistory = 10
+
+// scrubPollInterval is how often a scrub job checks whether the scrub has ended
+const scrubPollInterval = 10 * time.Second
+
+var log = logger.Logger
+
+// Service checks and scrubs the pools of every repo
+type Service struct {
+	zfs *zfs.Zfs
+}
+
+func NewService(zfs *zfs.Zfs) *Service {
+	return &Service{zfs: zfs}
+}
+
+// Start checks the health of every pool and schedules scrubs until the context is cancelled. It
+// SHOULD always be called as a goroutine.
+func (s *Service) Start(ctx context.Context) {
+	interval := time.Duration(opts.Config.Health.CheckIntervalMinutes) * time.Minute
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("Started pool health check, interval: %s, scrub interval: %s", interval, scrubInterval())
+
+	for {
+		s.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info("Root context cancelled. Stopping pool health check")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) CheckAll(ctx context.Context) {
+	repoDetails, err := db.ListRepoWithStatus(ctx, db.ActiveRepoStatuses...)
+	if err != nil {
+		log.Errorf("Failed to list repos for health check: %s", err)
+		return
+	}
+
+	for _, repoDetail := range repoDetails {
+		if err := s.check(ctx, repoDetail); err != nil {
+			log.Errorf("Failed to check health of repo %s: %s", repoDetail.Repo.Name, err)
+		}
+	}
+}
+
+func (s *Service) check(ctx context.Context, repoDetail db.RepoDetail) error {
+	status, err := s.zfs.GetPoolStatus(ctx, repoDetail.Pool.Name)
+	if err != nil {
+		return err
+	}
+
+	scrubs, err := db.ListScrubs(ctx, *repoDetail.Pool.ID, 1)
+	if err != nil {
+		return err
+	}
+
+	var lastScrub *model.PoolScrub
+	if len(scrubs) > 0 {
+		lastScrub = &scrubs[0]
+	}
+
+	if lastScrub != nil && lastScrub.Status == string(db.ScrubRunning) {
+		if err := recordScrub(ctx, *lastScrub, status); err != nil {
+			return err
+		}
+	}
+
+	if err := updateRepoStatus(ctx, repoDetail, status); err != nil {
+		return err
+	}
+
+	scrubDue := lastScrub == nil || lastScrub.StartedAt.Add(scrubInterval()).Before(time.Now().UTC())
+	if scrubDue && status.ScrubState != zfs.ScrubInProgress {
+		log.Infof("Starting scheduled scrub of pool %s", repoDetail.Pool.Name)
+
+		_, err := s.startScrub(ctx, repoDetail.Pool)
+		audit.RecordSystem(ctx, "pool.scrub", repoDetail.Repo.Name, nil, err)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordScrub saves the result of a running scrub once zpool status shows it has ended
+func recordScrub(ctx context.Context, scrub model.PoolScrub, status zfs.PoolStatus) error {
+	switch status.ScrubState {
+	case zfs.ScrubInProgress:
+		return nil
+	case zfs.ScrubFinished:
+		return db.FinishScrub(ctx, *scrub.ID, db.ScrubFinished, status.ScrubErrors, status.ScrubRepaired)
+	default:
+		// A canceled scrub, or one that disappeared because the pool was re-imported
+		return db.FinishScrub(ctx, *scrub.ID, db.ScrubCanceled, nil, nil)
+	}
+}
+
+// updateRepoStatus flips a repo to WARNING when the pool has problems and back once they're gone
+func updateRepoStatus(ctx context.Context, repoDetail db.RepoDetail, status zfs.PoolStatus) error {
+	repoInfo := repoDetail.Repo
+
+	repoStatus, output := RepoStatus(status)
+	if repoStatus == db.RepoCompleted {
+		if repoInfo.Status != string(db.RepoWarning) {
+			return nil
+		}
+
+		log.Infof("Pool of repo %s is healthy again", repoInfo.Name)
+
+		_, err := db.UpdateRepoStatus(ctx, *repoInfo.ID, db.RepoCompleted, "")
+		return err
+	}
+
+	if repoInfo.Status == string(db.RepoWarning) && repoInfo.Output != nil && *repoInfo.Output == output {
+		return nil
+	}
+
+	log.Warnf("Pool of repo %s is unhealthy: %s", repoInfo.Name, output)
+
+	_, err := db.UpdateRepoStatus(ctx, *repoInfo.ID, db.RepoWarning, output)
+	return err
+}
+
+// RepoStatus returns the status of a working repo with the pool status, WARNING with the problems
+// as output when the pool has any
+func RepoStatus(status zfs.PoolStatus) (db.RepoStatus, string) {
+	if status.Healthy() {
+		return db.RepoCompleted, ""
+	}
+
+	return db.RepoWarning, "Pool health: " + strings.Join(status.Problems(), "; ")
+}
+
+// StartScrub starts a scrub right away, outside the schedule. The scrub job follows it until
+// zpool status shows it has ended.
+func (s *Service) StartScrub(ctx context.Context, repoDetail db.RepoDetail) (model.Job, error) {
+	if !db.IsRepoActive(repoDetail.Repo.Status) {
+		return model.Job{}, responseerror.From("Repository is not ready")
+	}
+
+	status, err := s.zfs.GetPoolStatus(ctx, repoDetail.Pool.Name)
+	if err != nil {
+		return model.Job{}, responseerror.From("Failed to get pool status")
+	}
+
+	if status.ScrubState == zfs.ScrubInProgress {
+		return model.Job{}, responseerror.From("A scrub is already in progress")
+	}
+
+	return job.Run(db.JobScrub, repoDetail.Repo.Name, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		tracker.Step("Starting scrub", 0)
+
+		scrub, err := s.startScrub(ctx, repoDetail.Pool)
+		if err != nil {
+			return "", err
+		}
+
+		tracker.Step("Scrubbing pool", 10)
+
+		status, err := s.waitForScrub(ctx, repoDetail.Pool)
+		if err != nil {
+			return "", err
+		}
+
+		if err := recordScrub(ctx, scrub, status); err != nil {
+			return "", err
+		}
+
+		if status.ScrubState != zfs.ScrubFinished {
+			return status.Scan, fmt.Errorf("scrub of pool %s was canceled", repoDetail.Pool.Name)
+		}
+
+		return status.Scan, nil
+	})
+}
+
+// waitForScrub polls the pool until the scrub isn't in progress anymore
+func (s *Service) waitForScrub(ctx context.Context, pool model.ZfsPool) (zfs.PoolStatus, error) {
+	for {
+		status, err := s.zfs.GetPoolStatus(ctx, pool.Name)
+		if err != nil {
+			return zfs.PoolStatus{}, err
+		}
+
+		if status.ScrubState != zfs.ScrubInProgress {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return zfs.PoolStatus{}, ctx.Err()
+		case <-time.After(scrubPollInterval):
+		}
+	}
+}
+
+func (s *Service) startScrub(ctx context.Context, pool model.ZfsPool) (model.PoolScrub, error) {
+	// A scrub that was recorded as running but never showed up as ended is superseded
+	scrubs, err := db.ListScrubs(ctx, *pool.ID, 1)
+	if err != nil {
+		return model.PoolScrub{}, err
+	}
+
+	if len(scrubs) > 0 && scrubs[0].Status == string(db.ScrubRunning) {
+		if err := db.FinishScrub(ctx, *scrubs[0].ID, db.ScrubCanceled, nil, nil); err != nil {
+			return model.PoolScrub{}, err
+		}
+	}
+
+	if err := s.zfs.Scrub(ctx, pool.Name); err != nil {
+		return model.PoolScrub{}, responseerror.From("Failed to start scrub")
+	}
+
+	return db.CreateScrub(ctx, *pool.ID, time.Now().UTC())
+}
+
+// Health reads the live status of the repo pool along with the latest scrubs
+func (s *Service) Health(ctx context.Context, repoDetail db.RepoDetail) (health.Response, error) {
+	if !db.IsRepoActive(repoDetail.Repo.Status) {
+		return health.Response{}, responseerror.From("Repository is not ready")
+	}
+
+	status, err := s.zfs.GetPoolStatus(ctx, repoDetail.Pool.Name)
+	if err != nil {
+		return health.Response{}, responseerror.From("Failed to get pool status")
+	}
+
+	scrubs, err := db.ListScrubs(ctx, *repoDetail.Pool.ID, scrubHistory)
+	if err != nil {
+		return health.Response{}, responseerror.From("Failed to list scrubs")
+	}
+
+	response := health.Response{
+		State:      status.State,
+		Healthy:    status.Healthy(),
+		Problems:   status.Problems(),
+		Scan:       status.Scan,
+		ScrubState: status.ScrubState,
+		Vdevs:      []health.Vdev{},
+		DataErrors: status.DataErrors,
+		Scrubs:     []health.Scrub{},
+	}
+
+	if response.Problems == nil {
+		response.Problems = []string{}
+	}
+
+	for _, vdev := range status.Vdevs {
+		response.Vdevs = append(response.Vdevs, health.Vdev{
+			Name:           vdev.Name,
+			State:          vdev.State,
+			ReadErrors:     vdev.ReadErrors,
+			WriteErrors:    vdev.WriteErrors,
+			ChecksumErrors: vdev.ChecksumErrors,
+			Depth:          vdev.Depth,
+		})
+	}
+
+	for _, scrub := range scrubs {
+		response.Scrubs = append(response.Scrubs, ScrubResponse(scrub))
+	}
+
+	return response, nil
+}
+
+func ScrubResponse(scrub model.PoolScrub) health.Scrub {
+	return health.Scrub{
+		ID:         scrub.ID,
+		Status:     db.ScrubStatus(scrub.Status),
+		Errors:     scrub.Errors,
+		Repaired:   scrub.Repaired,
+		StartedAt:  scrub.StartedAt,
+		FinishedAt: scrub.FinishedAt,
+	}
+}
+
+func scrubInterval() time.Duration {
+	return time.Duration(opts.Config.Health.ScrubIntervalHours) * time.Hour
+}
@@ -0,0 +1,173 @@
+package job
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/event"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/service/audit"
+	"strings"
+	"sync"
+)
+
+// maxOutputSize keeps the stored output of chatty commands in check, the end is kept since that's
+// where the errors are
+const maxOutputSize = 64 * 1024
+
+var log = logger.Logger
+
+// rootCtx is cancelled on shutdown, which stops every running job
+var rootCtx = context.Background()
+
+// Func is the work of a job. The returned output is stored with the job, whether it failed or not.
+type Func func(ctx context.Context, tracker *Tracker) (string, error)
+
+// Tracker records the progress of a running job
+type Tracker struct {
+	job model.Job
+
+	mu       sync.Mutex
+	progress int64
+	step     string
+}
+
+// Initialize sets the context jobs run with and fails the jobs left running by the last shutdown
+func Initialize(ctx context.Context) {
+	rootCtx = ctx
+
+	interrupted, err := db.FailRunningJobs(context.Background(), "Interrupted by a restart")
+	if err != nil {
+		log.Errorf("Failed to fail interrupted jobs: %s", err)
+		return
+	}
+
+	if interrupted > 0 {
+		log.Warnf("%d job(s) were interrupted by the last shutdown", interrupted)
+	}
+}
+
+// Run starts the job in the background and returns it right away. The job is stopped when
+// PostBranch shuts down.
+func Run(jobType db.JobType, target string, fn Func) (model.Job, error) {
+	newJob, err := db.CreateJob(context.Background(), jobType, target)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	log.Infof("Started %s job %d for %s", jobType, *newJob.ID, target)
+
+	go run(newJob, fn)
+
+	return newJob, nil
+}
+
+func run(job model.Job, fn Func) {
+	tracker := &Tracker{job: job}
+
+	output, err := fn(rootCtx, tracker)
+	if len(output) > maxOutputSize {
+		output = output[len(output)-maxOutputSize:]
+	}
+
+	state := db.JobSucceeded
+	var message string
+	var jobError *string
+
+	if err != nil {
+		state = db.JobFailed
+		if rootCtx.Err() != nil {
+			state = db.JobCanceled
+		}
+
+		message = err.Error()
+		jobError = &message
+
+		log.Errorf("%s job %d for %s failed: %s", job.Type, *job.ID, job.Target, err)
+	} else {
+		log.Infof("%s job %d for %s finished", job.Type, *job.ID, job.Target)
+	}
+
+	if err := db.FinishJob(context.Background(), *job.ID, state, output, jobError); err != nil {
+		log.Errorf("Failed to record the result of job %d: %s", *job.ID, err)
+	}
+
+	audit.RecordSystem(context.Background(), "job."+job.Type, job.Target, map[string]any{"jobId": *job.ID}, err)
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if state == db.JobSucceeded {
+		tracker.progress = 100
+	}
+
+	tracker.publish(state, message)
+}
+
+// Step records the step the job is on along with its overall progress in percent
+func (tracker *Tracker) Step(step string, progress int64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	tracker.step = step
+	tracker.update(progress)
+}
+
+// Progress updates the progress of the current step. It's only stored when it changes, so it can be
+// called for every line of command output.
+func (tracker *Tracker) Progress(progress int64) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if progress == tracker.progress {
+		return
+	}
+
+	tracker.update(progress)
+}
+
+// Log sends a line of command output to the event subscribers. The full output is only stored when
+// the job is done.
+func (tracker *Tracker) Log(line string) {
+	repo, branch := eventScope(tracker.job)
+
+	event.Publish(event.JobLog, repo, branch, event.JobLogData{
+		JobID: *tracker.job.ID,
+		Line:  line,
+	})
+}
+
+func (tracker *Tracker) update(progress int64) {
+	tracker.progress = min(max(progress, 0), 100)
+
+	err := db.UpdateJobProgress(context.Background(), *tracker.job.ID, tracker.progress, tracker.step)
+	if err != nil {
+		log.Errorf("Failed to update progress of job %d: %s", *tracker.job.ID, err)
+	}
+
+	tracker.publish(db.JobRunning, "")
+}
+
+func (tracker *Tracker) publish(state db.JobState, jobError string) {
+	repo, branch := eventScope(tracker.job)
+
+	event.Publish(event.JobProgress, repo, branch, event.JobProgressData{
+		JobID:    *tracker.job.ID,
+		Type:     tracker.job.Type,
+		State:    string(state),
+		Progress: tracker.progress,
+		Step:     tracker.step,
+		Error:    jobError,
+	})
+}
+
+// eventScope splits the job target into the repo and branch its events belong to. Only start branch
+// jobs target a branch, the targets of other jobs are scoped to the repo.
+func eventScope(job model.Job) (repo string, branch string) {
+	repo, rest, _ := strings.Cut(job.Target, "/")
+	if db.JobType(job.Type) == db.JobStartBranch {
+		branch = rest
+	}
+
+	return repo, branch
+}
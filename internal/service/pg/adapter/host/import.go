@@ -2,238 +2,175 @@ package host
 
 import (
 	"context"
-	"fmt"
 	"github.com/jamius19/postbranch/internal/db"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/dto/pg"
+	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
 	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
 	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/service/job"
 	pgSvc "github.com/jamius19/postbranch/internal/service/pg"
 	"github.com/jamius19/postbranch/internal/service/zfs"
 	"github.com/jamius19/postbranch/internal/util"
-	"github.com/jamius19/postbranch/web/responseerror"
+	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
-	"strings"
 )
 
-const errMsg = "Can't connect to PostgreSQL. Is it running and is the provided configuration correct?"
-
-var log = logger.Logger
-
-func Validate(pgInit pg.HostImportReqDto) error {
-	if err := pgSvc.ValidatePgPath(pgInit.PostgresPath); err != nil {
-		return err
-	}
+// The copy takes up most of an import, so it gets most of the job progress
+const (
+	backupProgressStart = 5
+	backupProgressEnd   = 85
+)
 
-	if err := checkPgVersion(pgInit); err != nil {
-		return err
-	}
+// backupProgressRegex matches the percentage in lines like "1024/4096 kB (25%), 0/1 tablespace"
+var backupProgressRegex = regexp.MustCompile(`\((\d+)%\)`)
 
-	//if err := checkPgSuperuser(pgInit); err != nil {
-	//	return err
-	//}
-	//
-	//if err := checkPgReplication(pgInit); err != nil {
-	//	return err
-	//}
+var log = logger.Logger
 
-	return nil
+// Importer copies a Postgres cluster running on this host into the dataset of a repo
+type Importer struct {
+	zfs    *zfs.Zfs
+	source Source
 }
 
-func Import(pgConfig pg.HostImportReqDto, repoInfo model.Repo, pool model.ZfsPool) {
-	go copyPostgresData(pgConfig, repoInfo, pool)
+func NewImporter(zfs *zfs.Zfs, source Source) *Importer {
+	return &Importer{zfs: zfs, source: source}
 }
 
-func GetClusterSize(pgInit pg.HostImportReqDto) (int64, error) {
-	var sizeInMb int64
-
-	output, err := pgSvc.Single(&pgInit, pgSvc.ClusterSizeQuery)
-	if err != nil {
-		log.Errorf("Failed to query Postgres Cluster size: %v", err)
-		return 0, responseerror.From(errMsg)
-	}
-
-	sizeInMb, err = strconv.ParseInt(output, 10, 64)
-	if err != nil {
-		log.Errorf("Failed to convert size to int: %v", err)
-		return -1, responseerror.From(errMsg)
-	}
-
-	return sizeInMb, nil
+// Validate checks that the cluster can be imported with the given configuration
+func (im *Importer) Validate(ctx context.Context, pgInit pg.HostImportReqDto) error {
+	return im.source.Validate(ctx, pgInit)
 }
 
-func checkPgVersion(pgInit pg.HostImportReqDto) error {
-	output, err := runner.Single(
-		"local-postgres-version",
-		false,
-		false,
-		filepath.Join(pgInit.PostgresPath, "bin", "postgres"),
-		"-V",
-	)
-
-	if err != nil {
-		log.Errorf("Failed to query Postgres version: %v", err)
-		return responseerror.From(errMsg)
-	}
-
-	if !strings.Contains(output, util.StringVal(pgInit.Version)) {
-		log.Error("Postgres version mismatch")
-		return responseerror.From("Postgres installation version mismatch")
-	}
-
-	output, err = pgSvc.Single(&pgInit, pgSvc.VersionQuery)
-	if err != nil {
-		log.Errorf("Failed to query Postgres version: %v", err)
-		return responseerror.From(errMsg)
-	}
-
-	if !strings.Contains(output, util.StringVal(pgInit.Version)) {
-		log.Error("Postgres version mismatch")
-		return responseerror.From("Database cluster postgres version mismatch")
-	}
-
-	return nil
+// ClusterSize returns the size of the cluster in MB
+func (im *Importer) ClusterSize(pgInit pg.HostImportReqDto) (int64, error) {
+	return im.source.ClusterSize(pgInit)
 }
 
-func checkPgSuperuser(pgInit pg.HostImportReqDto) error {
-	output, err := pgSvc.Single(&pgInit, pgSvc.SuperUserCheckQuery)
-	if err != nil {
-		log.Errorf("Failed to query Postgres superuser: %v", err)
-		return responseerror.From(errMsg)
-	}
-
-	if !strings.Contains(output, "t") {
-		errMsg := fmt.Sprintf(
-			"%s is not a superuser. Please connect using a superuser credentials.",
-			pgInit.DbUsername,
-		)
-
-		log.Error(errMsg)
-		return responseerror.From(errMsg)
-	}
+// Import copies the host cluster in an import job. The repo is marked as failed if the job fails.
+func (im *Importer) Import(pgConfig pg.HostImportReqDto, repoInfo model.Repo, pool model.ZfsPool) (model.Job, error) {
+	return job.Run(db.JobImport, repoInfo.Name, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		output, err := im.copyPostgresData(ctx, tracker, pgConfig, repoInfo, pool)
+		if err != nil {
+			failImport(repoInfo, output, err)
+		}
 
-	return nil
+		return output, err
+	})
 }
 
-func checkPgReplication(pgInit pg.HostImportReqDto) error {
-	var replicationQuery = fmt.Sprintf(pgSvc.ReplicationCheckQuery, pgInit.DbUsername)
-
-	output, err := pgSvc.Single(&pgInit, replicationQuery)
-	if err != nil {
-		log.Errorf("Failed to query Postgres replication: %v", err)
-		return responseerror.From(errMsg)
+// failImport keeps the output of the failed step on the repo, so it can be shown without the job
+func failImport(repoInfo model.Repo, output string, err error) {
+	if output == "" {
+		output = err.Error()
 	}
 
-	if "REPLICATION_NOT_ALLOWED" == output {
-		errMsg := fmt.Sprintf(
-			"Replication is not enabled for user %s on host connection.",
-			pgInit.DbUsername,
-		)
-
-		log.Error(errMsg)
-		return responseerror.From(errMsg)
+	_, err = db.UpdateRepoStatus(context.Background(), *repoInfo.ID, db.RepoFailed, output)
+	if err != nil {
+		log.Errorf("Failed to update import status of repo pg: %v", err)
 	}
-
-	return nil
 }
 
-func copyPostgresData(
+func (im *Importer) copyPostgresData(
+	ctx context.Context,
+	tracker *job.Tracker,
 	pgInit pg.HostImportReqDto,
 	repo model.Repo,
 	pool model.ZfsPool,
-) {
+) (string, error) {
 
 	log.Info("Started copying host Postgres data to main branch")
 	log.Infof("Repo: %v", repo)
 	log.Infof("Pool: %v", pool)
 
-	ctx := context.Background()
+	// Only the copy is stopped on shutdown, the repo status is still recorded
+	dbCtx := context.WithoutCancel(ctx)
 	branchName := "main"
-	pgBaseBackupPath := filepath.Join(pgInit.PostgresPath, "bin", "pg_basebackup")
 	mainDatasetPath := filepath.Join(pool.MountPath, branchName, "data")
 	logPath := filepath.Join(pool.MountPath, branchName, "logs")
 
-	err := zfs.EmptyDataset(pool, branchName)
+	tracker.Step("Preparing main branch", 0)
+
+	err := im.zfs.EmptyDataset(ctx, pool, branchName)
 	if err != nil {
-		return
+		return "", err
 	}
 
-	port, err := pgSvc.GetPgPort(ctx)
+	walPath, err := im.zfs.WalDatasetPath(ctx, pool, branchName)
 	if err != nil {
-		return
+		return "", err
 	}
 
-	if err := util.CreateDirectories(mainDatasetPath, pgSvc.PostBranchUser, 0700); err != nil {
-		log.Errorf("Failed to create main dataset directory: %v", err)
-		return
+	port, err := pgSvc.GetPgPort(dbCtx)
+	if err != nil {
+		return "", err
 	}
 
-	if err := util.CreateDirectories(logPath, pgSvc.PostBranchUser, 0700); err != nil {
-		log.Errorf("Failed to create log directory: %v", err)
-		return
+	if err := util.CreateDirectories(mainDatasetPath, opts.Config.Branch.User, 0700); err != nil {
+		log.Errorf("Failed to create main dataset directory: %v", err)
+		return "", err
 	}
 
-	if err := pgSvc.CreatePgPassFile(&pgInit); err != nil {
-		log.Error(err)
-		return
+	if err := util.CreateDirectories(logPath, opts.Config.Branch.User, 0700); err != nil {
+		log.Errorf("Failed to create log directory: %v", err)
+		return "", err
 	}
 
-	// Backing up postgres
-	output, err := runner.Single(
-		"pg-base-backup-host",
-		false,
-		false,
-		pgBaseBackupPath,
-		"-w",
-		"-U", pgInit.GetDbUsername(),
-		"-h", pgInit.GetHost(),
-		"-p", fmt.Sprintf("%d", pgInit.GetPort()),
-		"-D", mainDatasetPath,
-	)
-
-	_ = pgSvc.RemovePgPassFile()
+	tracker.Step("Copying data", backupProgressStart)
 
+	output, err := im.source.Backup(ctx, pgInit, mainDatasetPath, walPath, backupProgress(tracker))
 	if err != nil {
 		log.Errorf("Failed to copy pg instance. output: %s data: %v", output, err)
+		return output, err
+	}
 
-		updatedPg, err := db.UpdateRepoStatus(ctx, *repo.ID, db.RepoFailed, output)
-		if err != nil {
-			log.Errorf("Failed to update import status of repo pg: %v", err)
-		}
+	tracker.Step("Configuring main branch", backupProgressEnd)
 
-		log.Infof("Updated import status of repo pg: %v", updatedPg)
+	if walPath != "" {
+		// pg_basebackup links the WAL with an absolute path, which would point every clone back to
+		// the WAL of main
+		if err := relinkWal(mainDatasetPath); err != nil {
+			log.Errorf("Failed to link WAL directory: %v", err)
+			return output, err
+		}
 
-		return
+		err = util.SetPermissionsRecursive(walPath, opts.Config.Branch.User)
+		if err != nil {
+			log.Errorf("Failed to change WAL dataset permissions: %v", err)
+			return output, err
+		}
 	}
 
 	if err := pgSvc.CleanupConfig(mainDatasetPath); err != nil {
-		return
+		return output, err
 	}
 
 	if err := pgSvc.WritePostgresConfig(port, repo.Name, branchName, logPath, mainDatasetPath); err != nil {
-		return
+		return output, err
 	}
 
-	hbaConfigs, err := getHbaFileConfig(&pgInit)
+	hbaConfigs, err := im.source.HbaConfig(pgInit)
 	if err != nil {
-		return
+		return output, err
 	}
 
 	if err := pgSvc.WritePgHbaConfig(hbaConfigs, mainDatasetPath); err != nil {
-		return
+		return output, err
 	}
 
 	// Set the permissions for the main dataset directory to PostBranch user
 	// as after the backup, the permissions are set to root
-	err = util.SetPermissionsRecursive(mainDatasetPath, pgSvc.PostBranchUser, pgSvc.PostBranchUser)
+	err = util.SetPermissionsRecursive(mainDatasetPath, opts.Config.Branch.User)
 	if err != nil {
 		log.Errorf("Failed to change dataset permissions. output: %s data: %v", output, err)
-		return
+		return output, err
 	}
 
 	// Updating DB
-	updatedPg, err := db.UpdateRepoStatus(ctx, *repo.ID, db.RepoCompleted, output)
+	updatedPg, err := db.UpdateRepoStatus(dbCtx, *repo.ID, db.RepoCompleted, output)
 	if err != nil {
 		log.Errorf("Failed to update status of pgInfo: %v", err)
 	}
@@ -250,20 +187,52 @@ func copyPostgresData(
 		Status:   string(db.BranchOpen),
 	}
 
-	branch, err = db.CreateBranch(ctx, branch)
+	branch, err = db.CreateBranch(dbCtx, branch)
 	if err != nil {
 		log.Errorf("Failed to create main branch: %v", err)
-		return
+		return output, err
 	}
 
-	status, err := pgSvc.StartPg(pgInit.PostgresPath, pool.MountPath, branchName)
-	if err != nil {
-		return
+	tracker.Step("Starting main branch", 90)
+
+	if err := pgSvc.StartPg(ctx, pgInit.PostgresPath, pool.MountPath, branchName, *branch.ID); err != nil {
+		return output, err
 	}
 
-	err = db.UpdateBranchPgStatus(ctx, *branch.ID, status)
-	if err != nil {
-		log.Errorf("Failed to update branch status: %v", err)
-		return
+	return output, nil
+}
+
+func relinkWal(dataPath string) error {
+	linkPath := filepath.Join(dataPath, "pg_wal")
+
+	if err := os.Remove(linkPath); err != nil {
+		return err
+	}
+
+	return os.Symlink(filepath.Join("..", repoDto.WalDataset), linkPath)
+}
+
+// backupProgress records the progress lines pg_basebackup writes while copying in the job and maps
+// the percentage onto the copy step
+func backupProgress(tracker *job.Tracker) func(line runner.Line) {
+	return func(line runner.Line) {
+		if line.Stream != runner.Stderr {
+			return
+		}
+
+		log.Debugf("pg_basebackup: %s", line.Text)
+		tracker.Log(line.Text)
+
+		match := backupProgressRegex.FindStringSubmatch(line.Text)
+		if match == nil {
+			return
+		}
+
+		percent, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return
+		}
+
+		tracker.Progress(backupProgressStart + percent*(backupProgressEnd-backupProgressStart)/100)
 	}
 }
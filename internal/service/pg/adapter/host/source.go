@@ -0,0 +1,197 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/dto/pg"
+	"github.com/jamius19/postbranch/internal/runner"
+	pgSvc "github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const errMsg = "Can't connect to PostgreSQL. Is it running and is the provided configuration correct?"
+
+// Source is the Postgres cluster running on the host. The importer only reaches the cluster through
+// it, which lets an import run against a cluster that isn't there.
+type Source interface {
+	// Validate checks that the installation and the running cluster match the requested version
+	Validate(ctx context.Context, pgInit pg.HostImportReqDto) error
+
+	// ClusterSize returns the size of every database of the cluster in MB
+	ClusterSize(pgInit pg.HostImportReqDto) (int64, error)
+
+	// HbaConfig returns the client authentication rules of the cluster
+	HbaConfig(pgInit pg.HostImportReqDto) ([]pgSvc.HbaConfig, error)
+
+	// Backup copies the cluster into the data directory, with the WAL in walPath unless it's empty.
+	// Every line of output is passed to onLine.
+	Backup(
+		ctx context.Context,
+		pgInit pg.HostImportReqDto,
+		dataPath, walPath string,
+		onLine func(runner.Line),
+	) (string, error)
+}
+
+// PgSource reaches the cluster with the Postgres installation of the host and copies it with
+// pg_basebackup
+type PgSource struct{}
+
+func (PgSource) Validate(ctx context.Context, pgInit pg.HostImportReqDto) error {
+	if err := pgSvc.ValidatePgPath(pgInit.PostgresPath); err != nil {
+		return err
+	}
+
+	if err := checkPgVersion(ctx, pgInit); err != nil {
+		return err
+	}
+
+	//if err := checkPgSuperuser(pgInit); err != nil {
+	//	return err
+	//}
+	//
+	//if err := checkPgReplication(pgInit); err != nil {
+	//	return err
+	//}
+
+	return nil
+}
+
+func (PgSource) ClusterSize(pgInit pg.HostImportReqDto) (int64, error) {
+	var sizeInMb int64
+
+	output, err := pgSvc.Single(&pgInit, pgSvc.ClusterSizeQuery)
+	if err != nil {
+		log.Errorf("Failed to query Postgres Cluster size: %v", err)
+		return 0, responseerror.From(errMsg)
+	}
+
+	sizeInMb, err = strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		log.Errorf("Failed to convert size to int: %v", err)
+		return -1, responseerror.From(errMsg)
+	}
+
+	return sizeInMb, nil
+}
+
+func checkPgVersion(ctx context.Context, pgInit pg.HostImportReqDto) error {
+	output, err := runner.Single(
+		ctx,
+		"local-postgres-version",
+		false,
+		false,
+		filepath.Join(pgInit.PostgresPath, "bin", "postgres"),
+		"-V",
+	)
+
+	if err != nil {
+		log.Errorf("Failed to query Postgres version: %v", err)
+		return responseerror.From(errMsg)
+	}
+
+	if !strings.Contains(output, util.StringVal(pgInit.Version)) {
+		log.Error("Postgres version mismatch")
+		return responseerror.From("Postgres installation version mismatch")
+	}
+
+	output, err = pgSvc.Single(&pgInit, pgSvc.VersionQuery)
+	if err != nil {
+		log.Errorf("Failed to query Postgres version: %v", err)
+		return responseerror.From(errMsg)
+	}
+
+	if !strings.Contains(output, util.StringVal(pgInit.Version)) {
+		log.Error("Postgres version mismatch")
+		return responseerror.From("Database cluster postgres version mismatch")
+	}
+
+	return nil
+}
+
+func checkPgSuperuser(pgInit pg.HostImportReqDto) error {
+	output, err := pgSvc.Single(&pgInit, pgSvc.SuperUserCheckQuery)
+	if err != nil {
+		log.Errorf("Failed to query Postgres superuser: %v", err)
+		return responseerror.From(errMsg)
+	}
+
+	if !strings.Contains(output, "t") {
+		errMsg := fmt.Sprintf(
+			"%s is not a superuser. Please connect using a superuser credentials.",
+			pgInit.DbUsername,
+		)
+
+		log.Error(errMsg)
+		return responseerror.From(errMsg)
+	}
+
+	return nil
+}
+
+func checkPgReplication(pgInit pg.HostImportReqDto) error {
+	var replicationQuery = fmt.Sprintf(pgSvc.ReplicationCheckQuery, pgInit.DbUsername)
+
+	output, err := pgSvc.Single(&pgInit, replicationQuery)
+	if err != nil {
+		log.Errorf("Failed to query Postgres replication: %v", err)
+		return responseerror.From(errMsg)
+	}
+
+	if "REPLICATION_NOT_ALLOWED" == output {
+		errMsg := fmt.Sprintf(
+			"Replication is not enabled for user %s on host connection.",
+			pgInit.DbUsername,
+		)
+
+		log.Error(errMsg)
+		return responseerror.From(errMsg)
+	}
+
+	return nil
+}
+
+func (PgSource) HbaConfig(pgInit pg.HostImportReqDto) ([]pgSvc.HbaConfig, error) {
+	return getHbaFileConfig(&pgInit)
+}
+
+func (PgSource) Backup(
+	ctx context.Context,
+	pgInit pg.HostImportReqDto,
+	dataPath, walPath string,
+	onLine func(runner.Line),
+) (string, error) {
+
+	if err := pgSvc.CreatePgPassFile(&pgInit); err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	defer func() {
+		_ = pgSvc.RemovePgPassFile()
+	}()
+
+	backupArgs := []string{
+		"-w",
+		"-U", pgInit.GetDbUsername(),
+		"-h", pgInit.GetHost(),
+		"-p", fmt.Sprintf("%d", pgInit.GetPort()),
+		"-D", dataPath,
+		"--progress",
+	}
+
+	if walPath != "" {
+		backupArgs = append(backupArgs, "--waldir", walPath)
+	}
+
+	return runner.Run(
+		ctx,
+		runner.Options{Key: "pg-base-backup-host", OnLine: onLine},
+		filepath.Join(pgInit.PostgresPath, "bin", "pg_basebackup"),
+		backupArgs...,
+	)
+}
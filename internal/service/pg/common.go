@@ -11,16 +11,12 @@ import (
 	"github.com/jamius19/postbranch/internal/util"
 	"github.com/jamius19/postbranch/web/responseerror"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strings"
 	"sync"
-	"syscall"
 )
 
 const (
-	PostBranchUser = "postbranch"
-	MaxConnection  = 20
+	MaxConnection = 20
 
 	ClusterSizeQuery    = "SELECT CEIL(SUM(pg_database_size(datname)) / (1024 * 1024)) AS total_db_size_mb FROM pg_database;"
 	VersionQuery        = "SELECT split_part(current_setting('server_version'), '.', 1) AS major_version;"
@@ -148,8 +144,9 @@ func RemovePgPassFile() error {
 	return nil
 }
 
-func GetPsqlCommand(pgOsUser, pgPath, query string, port int32) (string, error) {
+func GetPsqlCommand(ctx context.Context, pgOsUser, pgPath, query string, port int32) (string, error) {
 	return runner.Single(
+		ctx,
 		"pg-version-check",
 		false,
 		false,
@@ -177,18 +174,12 @@ func StartPgAndUpdateBranch(
 
 	defer wg.Done()
 
-	status, err := StartPg(pgPath, mountPath, branchName)
-	if err != nil || status == db.BranchPgStopped {
+	if err := StartPg(ctx, pgPath, mountPath, branchName, branchId); err != nil {
 		log.Errorf("Failed to start postgres for branch: %s, error: %v", branchName, err)
 		return
 	}
 
 	log.Infof("Started Postgres for branch: %s", branchName)
-
-	if err := db.UpdateBranchPgStatus(ctx, branchId, status); err != nil {
-		log.Errorf("Failed to update postgres info for branch: %s, error: %v", branchName, err)
-		return
-	}
 }
 
 // StopPgAndUpdateBranch is potentially expensive. It SHOULD always be called as/inside a goroutine.
@@ -203,7 +194,7 @@ func StopPgAndUpdateBranch(
 
 	defer wg.Done()
 
-	err := StopPg(pgPath, mountPath, branchName, false)
+	err := StopPg(ctx, pgPath, mountPath, branchName, false)
 	if err != nil {
 		log.Errorf("Failed to start postgres for branch: %s, error: %v", branchName, err)
 		return
@@ -217,14 +208,35 @@ func StopPgAndUpdateBranch(
 	}
 }
 
-func StopDangingPg(pgPath, mountPath, branchName string, wg *sync.WaitGroup) {
+func StopDangingPg(ctx context.Context, pgPath, mountPath, branchName string, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	_ = StopPg(pgPath, mountPath, branchName, true)
+	_ = StopPg(ctx, pgPath, mountPath, branchName, true)
 }
 
-// StartPg is potentially expensive. It SHOULD always be called as/inside a goroutine.
-func StartPg(pgPath, mountPath, branchName string) (db.BranchPgStatus, error) {
+// StartPg is potentially expensive. It SHOULD always be called as/inside a goroutine. The outcome is
+// recorded on the branch, it's marked as FAILED whenever Postgres doesn't come up.
+func StartPg(ctx context.Context, pgPath, mountPath, branchName string, branchId int32) error {
+	status := db.BranchPgRunning
+
+	err := startPg(ctx, pgPath, mountPath, branchName, branchId)
+	if err != nil {
+		status = db.BranchPgFailed
+	}
+
+	// The outcome is recorded even when the start was stopped by a shutdown
+	if updateErr := db.UpdateBranchPgStatus(context.WithoutCancel(ctx), branchId, status); updateErr != nil {
+		log.Errorf("Failed to update postgres status of branch: %s, error: %v", branchName, updateErr)
+
+		if err == nil {
+			err = updateErr
+		}
+	}
+
+	return err
+}
+
+func startPg(ctx context.Context, pgPath, mountPath, branchName string, branchId int32) error {
 	log.Infof("Starting Postgres for dataset: %v with postgres path: %v and mount path: %v", branchName, pgPath, mountPath)
 
 	datasetPath := filepath.Join(mountPath, branchName, "data")
@@ -233,46 +245,33 @@ func StartPg(pgPath, mountPath, branchName string) (db.BranchPgStatus, error) {
 		log.Warnf("postmaster.pid file exists in the db cluster. deleting it")
 
 		if err := CleanupConfig(datasetPath); err != nil {
-			return "", err
+			return err
 		}
 	}
 
-	logPath := filepath.Join(mountPath, branchName, "logs", "postgres_start.log")
-	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
-
-	output, err := runner.Single(
-		"starting-postgres",
-		false,
-		false,
-		"sudo",
-		"-u", PostBranchUser,
-		pgCtlPath,
-		"start",
-		"-l", logPath,
-		"-D", datasetPath,
-	)
-
-	outputString := strings.Replace(output, "\n", "\\\\", -1)
-
-	if err != nil {
-		log.Errorf("Failed to start postgres. output: %s data: %v", outputString, err)
-		return db.BranchPgFailed, nil
+	if err := writeServerCert(datasetPath, branchName, branchId); err != nil {
+		return err
 	}
 
-	log.Infof("Started postgres. output: %s", outputString)
+	logPath := filepath.Join(mountPath, branchName, "logs", "postgres_start.log")
+
+	return manager.Start(ctx, pgPath, datasetPath, logPath)
+}
 
-	return db.BranchPgRunning, nil
+// Status checks whether the postmaster of the branch is running
+func Status(ctx context.Context, pgPath, mountPath, branchName string) (db.BranchPgStatus, error) {
+	return manager.Status(ctx, pgPath, filepath.Join(mountPath, branchName, "data"), true)
 }
 
 // StopPg is potentially expensive. It SHOULD always be called as/inside a goroutine.
-func StopPg(pgPath, mountPath, branchName string, skipLog bool) error {
+func StopPg(ctx context.Context, pgPath, mountPath, branchName string, skipLog bool) error {
 	if !skipLog {
 		log.Infof("Stopping Postgres for branch: %v with postgres path: %v and mount path: %v", branchName, pgPath, mountPath)
 	}
 
 	datasetPath := filepath.Join(mountPath, branchName, "data")
 
-	status, err := getPgStatus(pgPath, datasetPath, skipLog)
+	status, err := manager.Status(ctx, pgPath, datasetPath, skipLog)
 	if err != nil {
 		return err
 	}
@@ -282,72 +281,7 @@ func StopPg(pgPath, mountPath, branchName string, skipLog bool) error {
 		return nil
 	}
 
-	//logPath := filepath.Join(mountPath, branchName, "logs", "postgres_start.log")
-	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
-
-	output, err := runner.Single(
-		"stop-postgres",
-		skipLog,
-		false,
-		"sudo",
-		"-u", PostBranchUser,
-		pgCtlPath,
-		"stop",
-		"-D", datasetPath,
-	)
-
-	if err != nil {
-		if !skipLog {
-			log.Errorf("Failed to stop postgres. output: %s data: %v", output, err)
-		}
-
-		return err
-	}
-
-	if skipLog {
-		log.Infof("Stopped postgres. output: %s", output)
-	}
-
-	return nil
-}
-
-func getPgStatus(pgPath, datasetPath string, skipLog bool) (db.BranchPgStatus, error) {
-	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
-
-	pgCtlCmd := exec.Command(
-		"sudo",
-		"-u", PostBranchUser,
-		pgCtlPath,
-		"status", "-D",
-		datasetPath,
-	)
-
-	pgCtlCmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
-	}
-
-	output, err := pgCtlCmd.CombinedOutput()
-	outputStr := strings.Replace(string(output), "\n", "\\\\", -1)
-
-	if err == nil {
-		return db.BranchPgRunning, nil
-	}
-
-	var exitErr *exec.ExitError
-	if errors.As(err, &exitErr) {
-		// Exit code 3 means that postgres is not running
-		// See https://www.postgresql.org/docs/current/app-pg-ctl.html
-		if exitErr.ExitCode() == 3 {
-			return db.BranchPgStopped, nil
-		}
-	}
-
-	// All other cases, it's an error
-	if !skipLog {
-		log.Errorf("Failed to run pg_ctl status. output: %s, error: %v", outputStr, err)
-	}
-
-	return "", err
+	return manager.Stop(ctx, pgPath, datasetPath, skipLog)
 }
 
 func ValidatePgPath(pgPath string) error {
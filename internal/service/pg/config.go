@@ -59,14 +59,28 @@ func UpdatePostgresConfig(datasetPath, configName, configVal string) error {
 		return fmt.Errorf("failed to read postgres config file: %w", err)
 	}
 
+	setting := fmt.Sprintf("%s = %s", configName, configVal)
+	found := false
+
 	lines := strings.Split(string(content), "\n")
 	for i, line := range lines {
-		if strings.Contains(line, configName) {
-			lines[i] = fmt.Sprintf("%s = %s", configName, configVal)
+		name, _, _ := strings.Cut(line, "=")
+		if strings.TrimSpace(name) == configName {
+			lines[i] = setting
+			found = true
 			break
 		}
 	}
 
+	// Settings missing from the config are added before the trailing newline
+	if !found {
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = append(lines[:len(lines)-1], setting, "")
+		} else {
+			lines = append(lines, setting)
+		}
+	}
+
 	err = os.WriteFile(configPath, []byte(strings.Join(lines, "\n")), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write postgres config file: %w", err)
@@ -95,6 +109,10 @@ func WritePostgresConfig(port int32, repoName, branchName, logPath, datasetPath
 	builder.WriteString("full_page_writes = off\n")
 	builder.WriteString("password_encryption = 'scram-sha-256'\n")
 
+	// The certificate is issued by the CA of PostBranch every time the branch is started, the start
+	// also points ssl_cert_file and ssl_key_file to it
+	builder.WriteString("ssl = on\n")
+
 	builder.WriteString(fmt.Sprintf("log_directory = '%s'\n", logPath))
 	builder.WriteString(fmt.Sprintf("log_filename = '%s_%s__%s.log'\n", repoName, branchName, "%Y-%m-%d_%H-%M-%S"))
 	builder.WriteString("logging_collector = on\n")
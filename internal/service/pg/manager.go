@@ -0,0 +1,127 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/runner"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Manager starts and stops the Postgres cluster of a branch. The data directory is the datasetPath.
+type Manager interface {
+	Start(ctx context.Context, pgPath, datasetPath, logPath string) error
+	Stop(ctx context.Context, pgPath, datasetPath string, skipLog bool) error
+	Status(ctx context.Context, pgPath, datasetPath string, skipLog bool) (db.BranchPgStatus, error)
+}
+
+var manager Manager = PgCtlManager{}
+
+// Initialize sets the manager used for every branch. pg_ctl is used by default.
+func Initialize(pgManager Manager) {
+	manager = pgManager
+}
+
+// PgCtlManager runs pg_ctl as the postbranch user
+type PgCtlManager struct{}
+
+func (PgCtlManager) Start(ctx context.Context, pgPath, datasetPath, logPath string) error {
+	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
+
+	output, err := runner.Single(
+		ctx,
+		"starting-postgres",
+		false,
+		false,
+		"sudo",
+		"-u", opts.Config.Branch.User,
+		pgCtlPath,
+		"start",
+		"-l", logPath,
+		"-D", datasetPath,
+	)
+
+	outputString := strings.Replace(output, "\n", "\\\\", -1)
+
+	if err != nil {
+		log.Errorf("Failed to start postgres. output: %s data: %v", outputString, err)
+		return err
+	}
+
+	log.Infof("Started postgres. output: %s", outputString)
+	return nil
+}
+
+func (PgCtlManager) Stop(ctx context.Context, pgPath, datasetPath string, skipLog bool) error {
+	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
+
+	output, err := runner.Single(
+		ctx,
+		"stop-postgres",
+		skipLog,
+		false,
+		"sudo",
+		"-u", opts.Config.Branch.User,
+		pgCtlPath,
+		"stop",
+		"-D", datasetPath,
+	)
+
+	if err != nil {
+		if !skipLog {
+			log.Errorf("Failed to stop postgres. output: %s data: %v", output, err)
+		}
+
+		return err
+	}
+
+	if skipLog {
+		log.Infof("Stopped postgres. output: %s", output)
+	}
+
+	return nil
+}
+
+func (PgCtlManager) Status(ctx context.Context, pgPath, datasetPath string, skipLog bool) (db.BranchPgStatus, error) {
+	pgCtlPath := filepath.Join(pgPath, "bin", "pg_ctl")
+
+	pgCtlCmd := exec.CommandContext(
+		ctx,
+		"sudo",
+		"-u", opts.Config.Branch.User,
+		pgCtlPath,
+		"status", "-D",
+		datasetPath,
+	)
+
+	pgCtlCmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+
+	output, err := pgCtlCmd.CombinedOutput()
+	outputStr := strings.Replace(string(output), "\n", "\\\\", -1)
+
+	if err == nil {
+		return db.BranchPgRunning, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// Exit code 3 means that postgres is not running
+		// See https://www.postgresql.org/docs/current/app-pg-ctl.html
+		if exitErr.ExitCode() == 3 {
+			return db.BranchPgStopped, nil
+		}
+	}
+
+	// All other cases, it's an error
+	if !skipLog {
+		log.Errorf("Failed to run pg_ctl status. output: %s, error: %v", outputStr, err)
+	}
+
+	return "", err
+}
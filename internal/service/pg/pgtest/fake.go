@@ -0,0 +1,81 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FakeManager keeps track of running clusters in memory instead of running pg_ctl. Like pg_ctl, it
+// refuses to start a data directory that doesn't exist or is already running, and to stop one that
+// isn't running.
+type FakeManager struct {
+	// FailStart makes every start fail, the way a broken cluster would
+	FailStart bool
+
+	mu      sync.Mutex
+	running map[string]bool
+}
+
+func NewFakeManager() *FakeManager {
+	return &FakeManager{running: make(map[string]bool)}
+}
+
+func (m *FakeManager) Start(_ context.Context, _, datasetPath, logPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := os.Stat(datasetPath); err != nil {
+		return fmt.Errorf("pg_ctl: directory \"%s\" does not exist", datasetPath)
+	}
+
+	if m.running[datasetPath] {
+		return fmt.Errorf("pg_ctl: another server might be running; trying to start server anyway")
+	}
+
+	if m.FailStart {
+		return fmt.Errorf("pg_ctl: could not start server")
+	}
+
+	// The storage monitor looks for this line in the newest log
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err == nil {
+		_ = os.WriteFile(logPath, []byte("LOG:  database system is ready to accept connections\n"), 0644)
+	}
+
+	m.running[datasetPath] = true
+	return nil
+}
+
+func (m *FakeManager) Stop(_ context.Context, _, datasetPath string, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.running[datasetPath] {
+		return fmt.Errorf("pg_ctl: PID file \"%s\" does not exist", filepath.Join(datasetPath, "postmaster.pid"))
+	}
+
+	delete(m.running, datasetPath)
+	return nil
+}
+
+func (m *FakeManager) Status(_ context.Context, _, datasetPath string, _ bool) (db.BranchPgStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running[datasetPath] {
+		return db.BranchPgRunning, nil
+	}
+
+	return db.BranchPgStopped, nil
+}
+
+// Running reports if the cluster in the data directory was started
+func (m *FakeManager) Running(datasetPath string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.running[datasetPath]
+}
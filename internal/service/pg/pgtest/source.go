@@ -0,0 +1,77 @@
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/dto/pg"
+	"github.com/jamius19/postbranch/internal/runner"
+	pgSvc "github.com/jamius19/postbranch/internal/service/pg"
+	"os"
+	"path/filepath"
+)
+
+// FakeSource stands in for the Postgres cluster of the host. A backup writes the files the import
+// configures afterwards, instead of copying a real cluster.
+type FakeSource struct {
+	// SizeInMb is the reported size of the cluster
+	SizeInMb int64
+
+	// FailBackup makes every backup fail, the way an unreachable cluster would
+	FailBackup bool
+}
+
+func NewFakeSource() *FakeSource {
+	return &FakeSource{SizeInMb: 100}
+}
+
+func (s *FakeSource) Validate(_ context.Context, pgInit pg.HostImportReqDto) error {
+	return nil
+}
+
+func (s *FakeSource) ClusterSize(pgInit pg.HostImportReqDto) (int64, error) {
+	return s.SizeInMb, nil
+}
+
+func (s *FakeSource) HbaConfig(pgInit pg.HostImportReqDto) ([]pgSvc.HbaConfig, error) {
+	return []pgSvc.HbaConfig{
+		{Type: "local", Database: "{all}", Username: "{all}", AuthMethod: "trust"},
+	}, nil
+}
+
+func (s *FakeSource) Backup(
+	_ context.Context,
+	pgInit pg.HostImportReqDto,
+	dataPath, walPath string,
+	onLine func(runner.Line),
+) (string, error) {
+
+	if s.FailBackup {
+		return "pg_basebackup: error: connection to server failed", fmt.Errorf("exit status 1")
+	}
+
+	files := map[string]string{
+		"PG_VERSION":      fmt.Sprintf("%d\n", pgInit.Version),
+		"postgresql.conf": "port = 5432\n",
+		"pg_hba.conf":     "local all all trust\n",
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dataPath, name), []byte(content), 0600); err != nil {
+			return "", err
+		}
+	}
+
+	// pg_basebackup links the WAL directory with an absolute path
+	walLink := filepath.Join(dataPath, "pg_wal")
+	if walPath != "" {
+		if err := os.Symlink(walPath, walLink); err != nil {
+			return "", err
+		}
+	} else if err := os.Mkdir(walLink, 0700); err != nil {
+		return "", err
+	}
+
+	onLine(runner.Line{Stream: runner.Stderr, Text: "1024/1024 kB (100%), 1/1 tablespace"})
+
+	return "", nil
+}
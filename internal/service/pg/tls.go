@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"fmt"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/ca"
+	"github.com/jamius19/postbranch/internal/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	serverCertFile = "server.crt"
+	serverKeyFile  = "server.key"
+)
+
+// ServerCertDir is where the certificate and key of the branch are kept, outside of its dataset
+func ServerCertDir(branchId int32) string {
+	return filepath.Join(opts.Config.Branch.TLS.CertDir, strconv.Itoa(int(branchId)))
+}
+
+// RemoveServerCert removes the certificate and key of a branch that won't be started anymore
+func RemoveServerCert(branchId int32) {
+	if err := os.RemoveAll(ServerCertDir(branchId)); err != nil {
+		log.Errorf("Can't remove certificate of branch %d: %s", branchId, err)
+	}
+}
+
+// writeServerCert issues the certificate of the branch and turns on SSL with it. It's issued on
+// every start so that a change to the hosts in the config is picked up by the next restart.
+func writeServerCert(datasetPath, branchName string, branchId int32) error {
+	certPem, keyPem, err := ca.IssueServerCert(branchName, opts.Config.Branch.TLS.Hosts)
+	if err != nil {
+		log.Errorf("Failed to issue certificate for branch: %s, error: %v", branchName, err)
+		return err
+	}
+
+	if err := os.MkdirAll(opts.Config.Branch.TLS.CertDir, 0755); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	certDir := ServerCertDir(branchId)
+	if err := util.CreateDirectories(certDir, opts.Config.Branch.User, 0700); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content []byte
+		perm    os.FileMode
+	}{
+		{serverCertFile, certPem, 0644},
+
+		// Postgres refuses to start with a key other users can read
+		{serverKeyFile, keyPem, 0600},
+	}
+
+	for _, file := range files {
+		path := filepath.Join(certDir, file.name)
+
+		if err := os.WriteFile(path, file.content, file.perm); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+
+		// WriteFile keeps the mode of an existing file
+		if err := os.Chmod(path, file.perm); err != nil {
+			return fmt.Errorf("failed to change mode of %s: %w", file.name, err)
+		}
+
+		if err := util.SetPermissions(path, opts.Config.Branch.User); err != nil {
+			return err
+		}
+
+		// Earlier versions wrote them into the data directory, where every export and replica got a copy
+		if err := util.RemoveFile(filepath.Join(datasetPath, file.name)); err != nil {
+			return err
+		}
+	}
+
+	// Branches forked before SSL was turned on don't have it in their config yet
+	settings := [][2]string{
+		{"ssl", "on"},
+		{"ssl_cert_file", quoteConfigValue(filepath.Join(certDir, serverCertFile))},
+		{"ssl_key_file", quoteConfigValue(filepath.Join(certDir, serverKeyFile))},
+	}
+
+	for _, setting := range settings {
+		if err := UpdatePostgresConfig(datasetPath, setting[0], setting[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func quoteConfigValue(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,231 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-jet/jet/v2/qrm"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/preview"
+	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/service/repo"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"slices"
+)
+
+const (
+	defaultParentBranch = "main"
+	defaultBranchPrefix = "pr-"
+)
+
+// Actions taken on the branch of a pull request
+const (
+	ResultCreated   = "created"
+	ResultReopened  = "reopened"
+	ResultClosed    = "closed"
+	ResultUnchanged = "unchanged"
+)
+
+var log = logger.Logger
+
+// Service opens and closes the branches of pull requests
+type Service struct {
+	repos *repo.Service
+}
+
+func NewService(repos *repo.Service) *Service {
+	return &Service{repos: repos}
+}
+
+var ErrUnverified = errors.New("pull request event could not be verified")
+
+func CreatePreview(ctx context.Context, repoDetail db.RepoDetail, previewInit preview.Init) (model.PrPreview, error) {
+	newPreview := model.PrPreview{
+		RepoID:       *repoDetail.Repo.ID,
+		Provider:     previewInit.Provider,
+		Project:      previewInit.Project,
+		Secret:       previewInit.Secret,
+		ParentBranch: previewInit.ParentBranch,
+		BranchPrefix: previewInit.BranchPrefix,
+	}
+
+	if newPreview.ParentBranch == "" {
+		newPreview.ParentBranch = defaultParentBranch
+	}
+
+	if newPreview.BranchPrefix == "" {
+		newPreview.BranchPrefix = defaultBranchPrefix
+	}
+
+	hasParent := slices.ContainsFunc(repoDetail.Branches, func(branch model.Branch) bool {
+		return branch.Name == newPreview.ParentBranch
+	})
+
+	if !hasParent {
+		return model.PrPreview{}, responseerror.From("Parent branch not found")
+	}
+
+	previews, err := db.ListRepoPrPreviews(ctx, *repoDetail.Repo.ID)
+	if err != nil {
+		return model.PrPreview{}, err
+	}
+
+	for _, existing := range previews {
+		if existing.Provider == newPreview.Provider && existing.Project == newPreview.Project {
+			return model.PrPreview{}, responseerror.From("Project already has a preview in this repository")
+		}
+	}
+
+	return db.CreatePrPreview(ctx, newPreview)
+}
+
+// Handle applies a pull request event to the branches of every repo the project is mapped to. Only
+// the mappings whose secret verifies the payload are applied, ErrUnverified is returned if there's
+// none.
+func (s *Service) Handle(ctx context.Context, provider db.GitProvider, header http.Header, body []byte) ([]preview.Result, error) {
+	pr, ok, err := parse(provider, header, body)
+	if err != nil {
+		return nil, responseerror.From("Invalid pull request payload")
+	}
+
+	results := []preview.Result{}
+	if !ok {
+		return results, nil
+	}
+
+	previews, err := db.ListProjectPrPreviews(ctx, provider, pr.project)
+	if err != nil {
+		return nil, err
+	}
+
+	var verified []model.PrPreview
+	for _, projectPreview := range previews {
+		if verify(provider, projectPreview.Secret, header, body) {
+			verified = append(verified, projectPreview)
+		}
+	}
+
+	if len(verified) == 0 {
+		log.Warnf("Rejected %s pull request event of project %s", provider, pr.project)
+		return nil, ErrUnverified
+	}
+
+	if pr.action == "" {
+		return results, nil
+	}
+
+	for _, projectPreview := range verified {
+		results = append(results, s.apply(ctx, projectPreview, pr))
+	}
+
+	return results, nil
+}
+
+func (s *Service) apply(ctx context.Context, projectPreview model.PrPreview, pr pullRequest) preview.Result {
+	branchName := fmt.Sprintf("%s%d", projectPreview.BranchPrefix, pr.number)
+	result := preview.Result{Branch: branchName, Action: ResultUnchanged}
+
+	repoDetail, err := db.GetRepo(ctx, int64(projectPreview.RepoID))
+	if err == nil {
+		result.Repo = repoDetail.Repo.Name
+
+		if !db.IsRepoActive(repoDetail.Repo.Status) {
+			err = responseerror.From("Repository is not ready")
+		}
+	}
+
+	if err == nil {
+		switch pr.action {
+		case actionOpen, actionReopen:
+			result.Action, result.JobID, err = s.openBranch(ctx, repoDetail, projectPreview, branchName)
+		case actionClose:
+			result.Action, err = s.closeBranch(ctx, repoDetail, branchName)
+		}
+	}
+
+	if err != nil {
+		log.Errorf("Failed to apply %s of pull request %d to branch %s: %s", pr.action, pr.number, branchName, err)
+
+		message := err.Error()
+		result.Error = &message
+		return result
+	}
+
+	log.Infof("Pull request %d of %s: branch %s %s", pr.number, pr.project, branchName, result.Action)
+	return result
+}
+
+// openBranch makes sure the branch of the pull request is open, it's forked from the parent branch
+// unless it's only closed
+func (s *Service) openBranch(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	projectPreview model.PrPreview,
+	branchName string,
+) (string, *int32, error) {
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if err == nil {
+		switch db.BranchStatus(branch.Status) {
+		case db.BranchOpen:
+			return ResultUnchanged, nil, nil
+		case db.BranchPurged:
+			// The dataset is gone, CreateBranch replaces the record
+		default:
+			_, startJob, err := repo.ReopenBranch(ctx, repoDetail, branchName)
+			if err != nil {
+				return ResultUnchanged, nil, err
+			}
+
+			return ResultReopened, startJob.ID, nil
+		}
+	} else if !errors.Is(err, qrm.ErrNoRows) {
+		return ResultUnchanged, nil, err
+	}
+
+	parentBranch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, projectPreview.ParentBranch)
+	if err != nil {
+		return ResultUnchanged, nil, responseerror.From("Parent branch not found")
+	}
+
+	branchInit := repoDto.BranchInit{
+		Name:     branchName,
+		ParentId: *parentBranch.ID,
+	}
+
+	_, startJob, err := s.repos.CreateBranch(ctx, repoDetail, branchInit)
+	if err != nil {
+		return ResultUnchanged, nil, err
+	}
+
+	return ResultCreated, startJob.ID, nil
+}
+
+// closeBranch closes the branch of the pull request. Branches forked from it by hand are kept, they
+// take over its snapshots.
+func (s *Service) closeBranch(ctx context.Context, repoDetail db.RepoDetail, branchName string) (string, error) {
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if errors.Is(err, qrm.ErrNoRows) {
+		return ResultUnchanged, nil
+	} else if err != nil {
+		return ResultUnchanged, err
+	}
+
+	if branch.Status != string(db.BranchOpen) {
+		return ResultUnchanged, nil
+	}
+
+	branchClose := repoDto.BranchClose{
+		Name: branchName,
+		Mode: repoDto.CloseReparent,
+	}
+
+	if _, err := s.repos.CloseBranch(ctx, repoDetail, branchClose); err != nil {
+		return ResultUnchanged, err
+	}
+
+	return ResultClosed, nil
+}
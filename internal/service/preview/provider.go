@@ -0,0 +1,109 @@
+package preview
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/service/webhook"
+	"net/http"
+)
+
+const (
+	actionOpen   = "open"
+	actionReopen = "reopen"
+	actionClose  = "close"
+)
+
+// pullRequest is a pull request event of either provider. action is empty for the events that
+// don't change the branch, like new commits.
+type pullRequest struct {
+	project string
+	number  int64
+	action  string
+}
+
+type githubPullRequestEvent struct {
+	Action     string `json:"action"`
+	Number     int64  `json:"number"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+type gitlabMergeRequestEvent struct {
+	ObjectKind string `json:"object_kind"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int64  `json:"iid"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
+}
+
+// parse reads the pull request event from the payload, ok is false for other kinds of events
+func parse(provider db.GitProvider, header http.Header, body []byte) (pullRequest, bool, error) {
+	switch provider {
+	case db.GitHub:
+		if header.Get("X-GitHub-Event") != "pull_request" {
+			return pullRequest{}, false, nil
+		}
+
+		var event githubPullRequestEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return pullRequest{}, false, err
+		}
+
+		// Merged pull requests are closed as well, both of them close the branch
+		actions := map[string]string{
+			"opened":   actionOpen,
+			"reopened": actionReopen,
+			"closed":   actionClose,
+		}
+
+		return pullRequest{
+			project: event.Repository.FullName,
+			number:  event.Number,
+			action:  actions[event.Action],
+		}, true, nil
+	case db.GitLab:
+		var event gitlabMergeRequestEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			return pullRequest{}, false, err
+		}
+
+		if event.ObjectKind != "merge_request" {
+			return pullRequest{}, false, nil
+		}
+
+		actions := map[string]string{
+			"open":   actionOpen,
+			"reopen": actionReopen,
+			"close":  actionClose,
+			"merge":  actionClose,
+		}
+
+		return pullRequest{
+			project: event.Project.PathWithNamespace,
+			number:  event.ObjectAttributes.IID,
+			action:  actions[event.ObjectAttributes.Action],
+		}, true, nil
+	}
+
+	return pullRequest{}, false, nil
+}
+
+// verify checks the payload against the secret. GitHub signs the payload, GitLab sends the secret
+// as a token.
+func verify(provider db.GitProvider, secret string, header http.Header, body []byte) bool {
+	switch provider {
+	case db.GitHub:
+		signature := header.Get("X-Hub-Signature-256")
+		return signature != "" && hmac.Equal([]byte(signature), []byte(webhook.Sign(secret, body)))
+	case db.GitLab:
+		token := header.Get("X-Gitlab-Token")
+		return token != "" && hmac.Equal([]byte(token), []byte(secret))
+	}
+
+	return false
+}
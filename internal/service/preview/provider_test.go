@@ -0,0 +1,129 @@
+package preview
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/service/webhook"
+)
+
+const (
+	fixtureDir    = "../../../test/fixtures"
+	fixtureSecret = "preview-fixture-secret"
+)
+
+// signedHeader returns the headers the provider sends along with the fixture
+func signedHeader(provider db.GitProvider, secret string, body []byte) http.Header {
+	header := http.Header{}
+
+	switch provider {
+	case db.GitHub:
+		header.Set("X-GitHub-Event", "pull_request")
+		header.Set("X-Hub-Signature-256", webhook.Sign(secret, body))
+	case db.GitLab:
+		header.Set("X-Gitlab-Event", "Merge Request Hook")
+		header.Set("X-Gitlab-Token", secret)
+	}
+
+	return header
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	body, err := os.ReadFile(filepath.Join(fixtureDir, name))
+	if err != nil {
+		t.Fatalf("can't read fixture %s: %s", name, err)
+	}
+
+	return body
+}
+
+func TestFixtures(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		provider   db.GitProvider
+		wantAction string
+	}{
+		{"github/pull_request_opened.json", db.GitHub, actionOpen},
+		{"github/pull_request_reopened.json", db.GitHub, actionReopen},
+		{"github/pull_request_closed.json", db.GitHub, actionClose},
+		{"github/pull_request_merged.json", db.GitHub, actionClose},
+		{"github/pull_request_synchronize.json", db.GitHub, ""},
+		{"gitlab/merge_request_open.json", db.GitLab, actionOpen},
+		{"gitlab/merge_request_reopen.json", db.GitLab, actionReopen},
+		{"gitlab/merge_request_close.json", db.GitLab, actionClose},
+		{"gitlab/merge_request_merge.json", db.GitLab, actionClose},
+		{"gitlab/merge_request_update.json", db.GitLab, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			body := readFixture(t, tt.fixture)
+			header := signedHeader(tt.provider, fixtureSecret, body)
+
+			if !verify(tt.provider, fixtureSecret, header, body) {
+				t.Fatal("signed fixture wasn't verified")
+			}
+
+			pr, ok, err := parse(tt.provider, header, body)
+			if err != nil || !ok {
+				t.Fatalf("parse() = %v, %s, want a pull request", ok, err)
+			}
+
+			want := pullRequest{project: "acme/shop", number: 42, action: tt.wantAction}
+			if pr != want {
+				t.Errorf("parse() = %+v, want %+v", pr, want)
+			}
+		})
+	}
+}
+
+func TestFixturesUnverified(t *testing.T) {
+	fixtures := map[db.GitProvider]string{
+		db.GitHub: "github/pull_request_opened.json",
+		db.GitLab: "gitlab/merge_request_open.json",
+	}
+
+	for provider, fixture := range fixtures {
+		body := readFixture(t, fixture)
+
+		tests := map[string]struct {
+			header http.Header
+			body   []byte
+		}{
+			"wrong secret":   {signedHeader(provider, "other-secret", body), body},
+			"tampered body":  {signedHeader(provider, fixtureSecret, body), append([]byte(" "), body...)},
+			"missing header": {http.Header{}, body},
+		}
+
+		// GitLab sends the secret itself, only GitHub signatures cover the body
+		if provider == db.GitLab {
+			delete(tests, "tampered body")
+		}
+
+		for name, tt := range tests {
+			if verify(provider, fixtureSecret, tt.header, tt.body) {
+				t.Errorf("%s: %s fixture was verified", provider, name)
+			}
+		}
+	}
+}
+
+func TestParseOtherEvents(t *testing.T) {
+	body := readFixture(t, "github/pull_request_opened.json")
+
+	header := signedHeader(db.GitHub, fixtureSecret, body)
+	header.Set("X-GitHub-Event", "push")
+
+	if _, ok, err := parse(db.GitHub, header, body); ok || err != nil {
+		t.Errorf("push event parsed as a pull request, ok: %v, err: %v", ok, err)
+	}
+
+	if _, ok, err := parse(db.GitLab, http.Header{}, []byte(`{"object_kind": "push"}`)); ok || err != nil {
+		t.Errorf("push event parsed as a merge request, ok: %v, err: %v", ok, err)
+	}
+}
@@ -0,0 +1,524 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/reconcile"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exportSnapshotGrace is how long an export snapshot is left alone, it's destroyed once the export
+// is written so an older one was left behind by an interrupted export
+const exportSnapshotGrace = 24 * time.Hour
+
+var log = logger.Logger
+
+// Service compares the metadata database with the pools and fixes what drifted
+type Service struct {
+	zfs *zfs.Zfs
+}
+
+func NewService(zfs *zfs.Zfs) *Service {
+	return &Service{zfs: zfs}
+}
+
+// Only one reconciliation runs at a time, their fixes would race each other otherwise
+var mu sync.Mutex
+
+type finding struct {
+	drift reconcile.Drift
+	fixes map[reconcile.Action]func(ctx context.Context) error
+}
+
+func newFinding(kind reconcile.DriftKind, repoName string, branchName *string, name, detail string) *finding {
+	return &finding{
+		drift: reconcile.Drift{
+			Kind:    kind,
+			Repo:    repoName,
+			Branch:  branchName,
+			Name:    name,
+			Detail:  detail,
+			Actions: []reconcile.Action{},
+		},
+		fixes: make(map[reconcile.Action]func(ctx context.Context) error),
+	}
+}
+
+func (f *finding) offer(action reconcile.Action, fix func(ctx context.Context) error) {
+	f.drift.Actions = append(f.drift.Actions, action)
+	f.fixes[action] = fix
+}
+
+// Report runs the reconciler without fixing anything and logs the drift it finds. It's run once
+// the pools are mounted at boot.
+func (s *Service) Report(ctx context.Context) {
+	response, err := s.Run(ctx, nil)
+	if err != nil {
+		log.Errorf("Failed to reconcile database with ZFS and Postgres: %s", err)
+		return
+	}
+
+	for repoName, reason := range response.Skipped {
+		log.Infof("Skipped reconciling repo %s: %s", repoName, reason)
+	}
+
+	if len(response.Drift) == 0 {
+		log.Info("Database matches ZFS and Postgres, no drift found")
+		return
+	}
+
+	for _, drift := range response.Drift {
+		log.Warnf(
+			"Drift %s in repo %s on %s: %s. Fix it with POST /api/admin/reconcile, actions: %v",
+			drift.Kind, drift.Repo, drift.Name, drift.Detail, drift.Actions,
+		)
+	}
+}
+
+// Run compares the datasets, snapshots, loop devices and postmasters of every repo with the database
+// and applies the fixes that match the drift it finds
+func (s *Service) Run(ctx context.Context, fixes []reconcile.Fix) (reconcile.Response, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	repoDetails, err := db.ListRepo(ctx)
+	if err != nil {
+		log.Errorf("Failed to list repos for reconciliation: %s", err)
+		return reconcile.Response{}, err
+	}
+
+	response := reconcile.Response{
+		Drift:   []reconcile.Drift{},
+		Skipped: map[string]string{},
+	}
+
+	for _, repoDetail := range repoDetails {
+		drift, skipReason, err := s.reconcileRepo(ctx, repoDetail, fixes)
+		if err != nil {
+			return reconcile.Response{}, err
+		}
+
+		if skipReason != "" {
+			response.Skipped[repoDetail.Repo.Name] = skipReason
+			continue
+		}
+
+		response.Drift = append(response.Drift, drift...)
+	}
+
+	return response, nil
+}
+
+// reconcileRepo inspects and fixes the repo while it's locked, branches created or closed meanwhile
+// would show up as drift
+func (s *Service) reconcileRepo(ctx context.Context, repoDetail db.RepoDetail, fixes []reconcile.Fix) ([]reconcile.Drift, string, error) {
+	unlock, ok := repo.TryLockRepo(*repoDetail.Repo.ID)
+	if !ok {
+		return nil, "Branches are being changed", nil
+	}
+	defer unlock()
+
+	findings, skipReason, err := s.inspect(ctx, repoDetail)
+	if err != nil || skipReason != "" {
+		return nil, skipReason, err
+	}
+
+	drift := make([]reconcile.Drift, 0, len(findings))
+	for _, finding := range findings {
+		applyFix(ctx, finding, fixes)
+		drift = append(drift, finding.drift)
+	}
+
+	return drift, "", nil
+}
+
+func applyFix(ctx context.Context, finding *finding, fixes []reconcile.Fix) {
+	for _, fix := range fixes {
+		if fix.Kind != finding.drift.Kind || fix.Name != finding.drift.Name {
+			continue
+		}
+
+		action := fix.Action
+		finding.drift.Applied = &action
+
+		fixFunc, ok := finding.fixes[action]
+		if !ok {
+			message := fmt.Sprintf("%s can't fix %s", action, finding.drift.Kind)
+			finding.drift.FixError = &message
+			return
+		}
+
+		if err := fixFunc(ctx); err != nil {
+			log.Errorf("Can't %s %s drift of %s: %s", action, finding.drift.Kind, finding.drift.Name, err)
+
+			message := err.Error()
+			finding.drift.FixError = &message
+			return
+		}
+
+		log.Infof("Applied %s to %s drift of %s", action, finding.drift.Kind, finding.drift.Name)
+		return
+	}
+}
+
+// inspect returns the drift of the repo, or why it was skipped. Repos that are changing are skipped,
+// what they have on disk doesn't match the database until their job is done.
+func (s *Service) inspect(ctx context.Context, repoDetail db.RepoDetail) ([]*finding, string, error) {
+	repoInfo, pool := repoDetail.Repo, repoDetail.Pool
+
+	if repoInfo.Status == string(db.RepoStarted) {
+		return nil, "Repo is being imported", nil
+	}
+
+	jobFilter := db.JobFilter{
+		State: string(db.JobRunning),
+		Repo:  repoInfo.Name,
+		Limit: 1,
+	}
+
+	runningJobs, err := db.ListJobs(ctx, jobFilter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(runningJobs) > 0 {
+		return nil, fmt.Sprintf("Job %d is running", *runningJobs[0].ID), nil
+	}
+
+	datasets, err := s.zfs.ListBranchDatasets(ctx, pool.Name)
+	if err != nil {
+		if repoInfo.Status == string(db.RepoFailed) {
+			return nil, "Repo has failed and its pool isn't imported", nil
+		}
+
+		detail := fmt.Sprintf("Pool %s isn't imported", pool.Name)
+		poolFinding := newFinding(reconcile.MissingPool, repoInfo.Name, nil, pool.Name, detail)
+
+		poolFinding.offer(reconcile.MarkFailed, func(ctx context.Context) error {
+			_, err := db.UpdateRepoStatus(ctx, *repoInfo.ID, db.RepoFailed, detail)
+			return err
+		})
+
+		return []*finding{poolFinding}, "", nil
+	}
+
+	findings := s.inspectDatasets(repoDetail, datasets)
+
+	snapshotFindings, err := s.inspectSnapshots(ctx, repoDetail, datasets)
+	if err != nil {
+		return nil, "", err
+	}
+
+	findings = append(findings, snapshotFindings...)
+
+	loopFindings, err := s.inspectLoopDevices(ctx, repoDetail)
+	if err != nil {
+		return nil, "", err
+	}
+
+	findings = append(findings, loopFindings...)
+
+	// Postgres isn't started on locked or failed repos
+	if db.IsRepoActive(repoInfo.Status) {
+		findings = append(findings, inspectPostgres(ctx, repoDetail, datasets)...)
+	}
+
+	return findings, "", nil
+}
+
+// inspectDatasets finds the datasets without a branch and the branches without a dataset
+func (s *Service) inspectDatasets(repoDetail db.RepoDetail, datasets []zfs.Dataset) []*finding {
+	repoInfo, pool := repoDetail.Repo, repoDetail.Pool
+
+	var findings []*finding
+
+	branchByDataset := liveBranches(repoDetail)
+
+	existing := make(map[string]bool)
+	for _, dataset := range datasets {
+		existing[dataset.Name] = true
+
+		if _, ok := branchByDataset[dataset.Name]; ok {
+			continue
+		}
+
+		branchName := strings.TrimPrefix(dataset.Name, pool.Name+"/")
+		detail := fmt.Sprintf("Dataset %s has no branch", dataset.Name)
+		finding := newFinding(reconcile.OrphanDataset, repoInfo.Name, &branchName, dataset.Name, detail)
+
+		origin := dataset.Properties["origin"]
+		finding.offer(reconcile.Adopt, func(ctx context.Context) error {
+			return adoptDataset(ctx, repoDetail, branchName, origin)
+		})
+
+		// Clones need their origin, a dataset they're cloned from can only be adopted
+		if !hasClones(datasets, dataset.Name) {
+			datasetName := dataset.Name
+			finding.offer(reconcile.Cleanup, func(ctx context.Context) error {
+				return s.zfs.Destroy(ctx, datasetName, true)
+			})
+		}
+
+		findings = append(findings, finding)
+	}
+
+	for _, branch := range repoDetail.Branches {
+		datasetName := zfs.DatasetName(pool.Name, branch.Name)
+		if branch.Status == string(db.BranchPurged) || existing[datasetName] {
+			continue
+		}
+
+		branchId := *branch.ID
+		detail := fmt.Sprintf("Dataset %s of %s branch %s doesn't exist", datasetName, strings.ToLower(branch.Status), branch.Name)
+		finding := newFinding(reconcile.MissingDataset, repoInfo.Name, &branch.Name, datasetName, detail)
+
+		finding.offer(reconcile.MarkPurged, func(ctx context.Context) error {
+			if err := db.UpdateBranchPgStatus(ctx, branchId, db.BranchPgStopped); err != nil {
+				return err
+			}
+
+			return db.UpdateBranchStatus(ctx, branchId, db.BranchPurged)
+		})
+
+		findings = append(findings, finding)
+	}
+
+	return findings
+}
+
+// inspectSnapshots finds the snapshots PostBranch took that nothing needs anymore. Snapshots taken
+// by anyone else are left alone.
+func (s *Service) inspectSnapshots(ctx context.Context, repoDetail db.RepoDetail, datasets []zfs.Dataset) ([]*finding, error) {
+	repoInfo, pool := repoDetail.Repo, repoDetail.Pool
+
+	snapshots, err := s.zfs.ListSnapshots(ctx, pool.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := db.ListRepoReplicationTargets(ctx, *repoInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	branchDatasets := make(map[string]bool)
+	origins := make(map[string]bool)
+
+	for _, dataset := range datasets {
+		branchDatasets[dataset.Name] = true
+		origins[dataset.Properties["origin"]] = true
+	}
+
+	var findings []*finding
+
+	for _, snapshot := range snapshots {
+		dataset, tag, _ := strings.Cut(snapshot.Name, "@")
+
+		// Snapshots of child datasets, like pg_wal, are taken and destroyed along with their branch
+		if !branchDatasets[dataset] {
+			continue
+		}
+
+		var detail string
+
+		switch {
+		case strings.HasPrefix(tag, "pb-branch-"):
+			if !origins[snapshot.Name] {
+				detail = "No branch is cloned from the fork snapshot"
+			}
+		case strings.HasPrefix(tag, "pb-export-"):
+			createdAt, err := strconv.ParseInt(strings.TrimPrefix(tag, "pb-export-"), 10, 64)
+			if err == nil && time.Since(time.Unix(createdAt, 0)) > exportSnapshotGrace {
+				detail = "Export snapshot was left behind by an interrupted export"
+			}
+		case strings.HasPrefix(tag, "pb-repl-"):
+			detail = replicationSnapshotDrift(snapshot.Name, tag, targets)
+		}
+
+		if detail == "" {
+			continue
+		}
+
+		snapshotName := snapshot.Name
+		branchName := strings.TrimPrefix(dataset, pool.Name+"/")
+		finding := newFinding(reconcile.OrphanSnapshot, repoInfo.Name, &branchName, snapshotName, detail)
+
+		finding.offer(reconcile.Cleanup, func(ctx context.Context) error {
+			return s.zfs.Destroy(ctx, snapshotName, true)
+		})
+
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// replicationSnapshotDrift tells why a replication snapshot isn't needed, only the last snapshot
+// sent to a target is kept as the base of the next incremental send
+func replicationSnapshotDrift(snapshotName, tag string, targets []model.ReplicationTarget) string {
+	targetPart, _, _ := strings.Cut(strings.TrimPrefix(tag, "pb-repl-"), "-")
+
+	targetId, err := strconv.ParseInt(targetPart, 10, 32)
+	if err != nil {
+		return ""
+	}
+
+	for _, target := range targets {
+		if *target.ID != int32(targetId) {
+			continue
+		}
+
+		// The snapshot of a sync in progress isn't recorded until it's sent
+		if target.Status == string(db.ReplicationSyncing) {
+			return ""
+		}
+
+		if target.LastSnapshot != nil && *target.LastSnapshot == snapshotName {
+			return ""
+		}
+
+		return fmt.Sprintf("Replication snapshot isn't the last one sent to target %s", target.Name)
+	}
+
+	return fmt.Sprintf("Replication target %d doesn't exist", targetId)
+}
+
+func (s *Service) inspectLoopDevices(ctx context.Context, repoDetail db.RepoDetail) ([]*finding, error) {
+	stray, err := s.zfs.FindStrayLoopDevices(ctx, repoDetail.Pool)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []*finding
+
+	for _, device := range stray {
+		detail := fmt.Sprintf("Loop device is attached to %s but isn't used by the pool", repoDetail.Pool.Path)
+		finding := newFinding(reconcile.StrayLoopDevice, repoDetail.Repo.Name, nil, device, detail)
+
+		finding.offer(reconcile.Cleanup, func(ctx context.Context) error {
+			return s.zfs.RemoveLoopDevice(device)
+		})
+
+		findings = append(findings, finding)
+	}
+
+	return findings, nil
+}
+
+// inspectPostgres compares the running postmasters with the recorded Postgres status of the branches
+func inspectPostgres(ctx context.Context, repoDetail db.RepoDetail, datasets []zfs.Dataset) []*finding {
+	repoInfo, pool := repoDetail.Repo, repoDetail.Pool
+
+	existing := make(map[string]bool)
+	for _, dataset := range datasets {
+		existing[dataset.Name] = true
+	}
+
+	var findings []*finding
+
+	for _, branch := range repoDetail.Branches {
+		datasetName := zfs.DatasetName(pool.Name, branch.Name)
+		if branch.Status == string(db.BranchPurged) || !existing[datasetName] {
+			continue
+		}
+
+		status, err := pg.Status(ctx, repoInfo.PgPath, pool.MountPath, branch.Name)
+		if err != nil {
+			log.Errorf("Can't check postgres of branch %s: %s", branch.Name, err)
+			continue
+		}
+
+		branchId := *branch.ID
+		isOpen := branch.Status == string(db.BranchOpen)
+
+		switch {
+		case isOpen && branch.PgStatus == string(db.BranchPgRunning) && status != db.BranchPgRunning:
+			detail := fmt.Sprintf("Postgres of branch %s is recorded as running but isn't", branch.Name)
+			finding := newFinding(reconcile.PostgresStopped, repoInfo.Name, &branch.Name, datasetName, detail)
+
+			finding.offer(reconcile.MarkFailed, func(ctx context.Context) error {
+				return db.UpdateBranchPgStatus(ctx, branchId, db.BranchPgFailed)
+			})
+
+			findings = append(findings, finding)
+		case !isOpen && status == db.BranchPgRunning:
+			branchName := branch.Name
+			detail := fmt.Sprintf("Postgres is running on %s branch %s", strings.ToLower(branch.Status), branch.Name)
+			finding := newFinding(reconcile.PostgresRunning, repoInfo.Name, &branch.Name, datasetName, detail)
+
+			finding.offer(reconcile.Cleanup, func(ctx context.Context) error {
+				return pg.StopPg(ctx, repoInfo.PgPath, pool.MountPath, branchName, false)
+			})
+
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// adoptDataset registers the dataset as a closed branch, forked from the branch its origin belongs to
+func adoptDataset(ctx context.Context, repoDetail db.RepoDetail, branchName, origin string) error {
+	// A purged branch with the same name is brought back instead, reopening it assigns a new port
+	for _, existing := range repoDetail.Branches {
+		if existing.Name == branchName {
+			return db.CloseBranch(ctx, *existing.ID)
+		}
+	}
+
+	port, err := pg.GetPgPort(ctx)
+	if err != nil {
+		log.Errorf("Can't get pg port: %s", err)
+		return err
+	}
+
+	closedAt := time.Now().UTC()
+
+	branch := model.Branch{
+		Name:     branchName,
+		Status:   string(db.BranchClosed),
+		PgStatus: string(db.BranchPgStopped),
+		PgPort:   port,
+		RepoID:   *repoDetail.Repo.ID,
+		ClosedAt: &closedAt,
+	}
+
+	if parent, ok := liveBranches(repoDetail)[zfs.SnapshotDataset(origin)]; ok && origin != "" && origin != "-" {
+		branch.ParentID = parent.ID
+	}
+
+	_, err = db.CreateBranch(ctx, branch)
+	return err
+}
+
+// liveBranches returns the branches that have a dataset, keyed by dataset name
+func liveBranches(repoDetail db.RepoDetail) map[string]model.Branch {
+	branches := make(map[string]model.Branch)
+
+	for _, branch := range repoDetail.Branches {
+		if branch.Status != string(db.BranchPurged) {
+			branches[zfs.DatasetName(repoDetail.Pool.Name, branch.Name)] = branch
+		}
+	}
+
+	return branches
+}
+
+func hasClones(datasets []zfs.Dataset, datasetName string) bool {
+	for _, dataset := range datasets {
+		if zfs.SnapshotDataset(dataset.Properties["origin"]) == datasetName {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,248 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/replication"
+	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const schedulerInterval = 30 * time.Second
+
+var log = logger.Logger
+
+// Service sends the branches to their replication targets
+type Service struct {
+	zfs *zfs.Zfs
+}
+
+func NewService(zfs *zfs.Zfs) *Service {
+	return &Service{zfs: zfs}
+}
+
+var ErrSyncInProgress = errors.New("replication is already in progress")
+
+// syncing has the ids of the targets with a send in progress, so that a manual sync can't overlap
+// with a scheduled one
+var syncing sync.Map
+
+// Start sends the due replication targets until the context is cancelled. It SHOULD always be
+// called as a goroutine.
+func (s *Service) Start(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	log.Info("Started replication scheduler")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Root context cancelled. Stopping replication scheduler")
+			return
+		case <-ticker.C:
+			s.syncDue(ctx)
+		}
+	}
+}
+
+func (s *Service) syncDue(ctx context.Context) {
+	targets, err := db.ListReplicationTargets(ctx)
+	if err != nil {
+		log.Errorf("Failed to list replication targets: %s", err)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	for _, target := range targets {
+		interval := time.Duration(target.IntervalSeconds) * time.Second
+
+		if target.LastSentAt != nil && target.LastSentAt.Add(interval).After(now) {
+			continue
+		}
+
+		if err := s.Sync(ctx, target); err != nil && !errors.Is(err, ErrSyncInProgress) {
+			log.Errorf("Failed to replicate target %s: %s", target.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+func CreateTarget(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	targetInit replication.TargetInit,
+) (model.ReplicationTarget, error) {
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, targetInit.Branch)
+	if err != nil {
+		return model.ReplicationTarget{}, responseerror.From("Invalid Branch Name")
+	}
+
+	if branch.Status != string(db.BranchOpen) {
+		return model.ReplicationTarget{}, responseerror.From("Branch is not open")
+	}
+
+	destination, err := resolveDestination(db.ReplicationSink(targetInit.Sink), targetInit.Destination)
+	if err != nil {
+		return model.ReplicationTarget{}, err
+	}
+
+	switch db.ReplicationSink(targetInit.Sink) {
+	case db.FileSink:
+		if err := util.CreateDirectories(destination, "root", 0700); err != nil {
+			log.Errorf("Can't create replication directory: %s", err)
+			return model.ReplicationTarget{}, responseerror.From("Can't create destination directory")
+		}
+
+	case db.PoolSink:
+		poolName := repoDetail.Pool.Name
+		if destination == poolName || strings.HasPrefix(destination, poolName+"/") {
+			return model.ReplicationTarget{}, responseerror.From("Destination can't be inside the repository pool")
+		}
+	}
+
+	target := model.ReplicationTarget{
+		Name:            targetInit.Name,
+		RepoID:          *repoDetail.Repo.ID,
+		BranchID:        *branch.ID,
+		Sink:            targetInit.Sink,
+		Destination:     destination,
+		IntervalSeconds: targetInit.IntervalSeconds,
+		Status:          string(db.ReplicationIdle),
+	}
+
+	if db.ReplicationSink(targetInit.Sink) == db.SshSink {
+		target.SSHHost = &targetInit.SshHost
+
+		if targetInit.SshUser != "" {
+			target.SSHUser = &targetInit.SshUser
+		}
+
+		if targetInit.SshPort != 0 {
+			target.SSHPort = &targetInit.SshPort
+		}
+	}
+
+	return db.CreateReplicationTarget(ctx, target)
+}
+
+// resolveDestination checks the destination of a sink. File sinks can only write below the
+// replication directory, pool and ssh sinks need a dataset name that can't be read as an option.
+func resolveDestination(sink db.ReplicationSink, destination string) (string, error) {
+	switch sink {
+	case db.FileSink:
+		replicationDir := filepath.Clean(opts.Config.Replication.Dir)
+
+		resolved, err := util.ResolvePathIn(replicationDir, destination)
+		if errors.Is(err, util.ErrOutsideDir) {
+			return "", responseerror.From(
+				fmt.Sprintf("Destination has to be inside the replication directory %s", replicationDir),
+			)
+		}
+
+		return resolved, err
+
+	case db.PoolSink, db.SshSink:
+		if !validation.IsDatasetName(destination) {
+			return "", responseerror.From("Destination must be a valid dataset name")
+		}
+
+		return destination, nil
+	}
+
+	return "", fmt.Errorf("unknown replication sink: %s", sink)
+}
+
+func (s *Service) DeleteTarget(ctx context.Context, target model.ReplicationTarget) error {
+	if IsSyncing(*target.ID) {
+		return ErrSyncInProgress
+	}
+
+	// The last snapshot is only kept as the base of the next incremental send
+	if target.LastSnapshot != nil {
+		if err := s.zfsDestroy(ctx, *target.LastSnapshot); err != nil {
+			log.Errorf("Can't destroy replication snapshot %s: %s", *target.LastSnapshot, err)
+		}
+	}
+
+	return db.DeleteReplicationTarget(ctx, *target.ID)
+}
+
+func IsSyncing(targetId int32) bool {
+	_, ok := syncing.Load(targetId)
+	return ok
+}
+
+func TargetResponse(repoDetail db.RepoDetail, target model.ReplicationTarget) replication.TargetResponse {
+	var branchName string
+	for _, branch := range repoDetail.Branches {
+		if *branch.ID == target.BranchID {
+			branchName = branch.Name
+		}
+	}
+
+	var lagSeconds *int64
+	if target.LastSnapshotAt != nil {
+		lag := int64(time.Since(*target.LastSnapshotAt).Seconds())
+		lagSeconds = &lag
+	}
+
+	return replication.TargetResponse{
+		ID:              target.ID,
+		Name:            target.Name,
+		Branch:          branchName,
+		Sink:            db.ReplicationSink(target.Sink),
+		Destination:     target.Destination,
+		SshHost:         target.SSHHost,
+		SshUser:         target.SSHUser,
+		SshPort:         target.SSHPort,
+		IntervalSeconds: target.IntervalSeconds,
+		Status:          db.ReplicationStatus(target.Status),
+		LastSnapshot:    target.LastSnapshot,
+		LastSnapshotAt:  target.LastSnapshotAt,
+		LastSentAt:      target.LastSentAt,
+		LastError:       target.LastError,
+		LagSeconds:      lagSeconds,
+		CreatedAt:       target.CreatedAt,
+		UpdatedAt:       target.UpdatedAt,
+	}
+}
+
+func findBranch(repoDetail db.RepoDetail, branchId int32) (model.Branch, error) {
+	for _, branch := range repoDetail.Branches {
+		if *branch.ID == branchId {
+			return branch, nil
+		}
+	}
+
+	return model.Branch{}, fmt.Errorf("branch %d not found in repo %s", branchId, repoDetail.Repo.Name)
+}
+
+// StartSync syncs the target in a background job
+func (s *Service) StartSync(repoDetail db.RepoDetail, target model.ReplicationTarget) (model.Job, error) {
+	jobTarget := repoDetail.Repo.Name + "/" + target.Name
+
+	return job.Run(db.JobReplicationSync, jobTarget, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		tracker.Step("Sending snapshot", 0)
+		return "", s.Sync(ctx, target)
+	})
+}
@@ -0,0 +1,230 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sync sends a new snapshot of the target branch. The first send is a full stream, after that only
+// the changes since the last sent snapshot are sent.
+func (s *Service) Sync(ctx context.Context, target model.ReplicationTarget) error {
+	if _, running := syncing.LoadOrStore(*target.ID, true); running {
+		return ErrSyncInProgress
+	}
+	defer syncing.Delete(*target.ID)
+
+	repoDetail, err := db.GetRepo(ctx, int64(target.RepoID))
+	if err != nil {
+		return err
+	}
+
+	branch, err := findBranch(repoDetail, target.BranchID)
+	if err != nil {
+		return failSync(ctx, target, err)
+	}
+
+	if branch.Status == string(db.BranchPurged) {
+		return failSync(ctx, target, fmt.Errorf("branch %s has been purged", branch.Name))
+	}
+
+	if err := db.UpdateReplicationStatus(ctx, *target.ID, db.ReplicationSyncing); err != nil {
+		return err
+	}
+
+	snapshotAt := time.Now().UTC()
+	snapshot := fmt.Sprintf(
+		"%s@pb-repl-%d-%d",
+		zfs.DatasetName(repoDetail.Pool.Name, branch.Name),
+		*target.ID,
+		snapshotAt.Unix(),
+	)
+
+	log.Infof("Replicating %s to target %s", snapshot, target.Name)
+
+	if err := s.zfs.CreateSnapshot(ctx, snapshot); err != nil {
+		return failSync(ctx, target, err)
+	}
+
+	sendStream := func(stream io.Writer) error {
+		if target.LastSnapshot == nil {
+			return s.zfs.Send(ctx, snapshot, stream)
+		}
+
+		return s.zfs.SendIncremental(ctx, *target.LastSnapshot, snapshot, stream)
+	}
+
+	if err := s.sendToSink(ctx, target, repoDetail, branch, snapshotAt, sendStream); err != nil {
+		if err := s.zfsDestroy(context.WithoutCancel(ctx), snapshot); err != nil {
+			log.Errorf("Can't destroy replication snapshot %s: %s", snapshot, err)
+		}
+
+		return failSync(ctx, target, err)
+	}
+
+	// Only the newest snapshot is needed as the base for the next incremental send
+	if target.LastSnapshot != nil {
+		if err := s.zfsDestroy(ctx, *target.LastSnapshot); err != nil {
+			log.Errorf("Can't destroy replication snapshot %s: %s", *target.LastSnapshot, err)
+		}
+	}
+
+	if err := db.UpdateReplicationSent(ctx, *target.ID, snapshot, snapshotAt); err != nil {
+		return err
+	}
+
+	log.Infof("Replicated %s to target %s", snapshot, target.Name)
+	return nil
+}
+
+func (s *Service) sendToSink(
+	ctx context.Context,
+	target model.ReplicationTarget,
+	repoDetail db.RepoDetail,
+	branch model.Branch,
+	snapshotAt time.Time,
+	sendStream func(io.Writer) error,
+) error {
+
+	// Targets are checked again before every send, rows written by older versions weren't validated
+	destination, err := resolveDestination(db.ReplicationSink(target.Sink), target.Destination)
+	if err != nil {
+		return err
+	}
+
+	if db.ReplicationSink(target.Sink) == db.SshSink && !isSshTarget(target) {
+		return fmt.Errorf("invalid ssh host or user of target %s", target.Name)
+	}
+
+	switch db.ReplicationSink(target.Sink) {
+	case db.FileSink:
+		kind := "full"
+		if target.LastSnapshot != nil {
+			kind = "incr"
+		}
+
+		path := filepath.Join(
+			destination,
+			fmt.Sprintf("%s_%s_%d.%s.zfs", repoDetail.Repo.Name, branch.Name, snapshotAt.Unix(), kind),
+		)
+
+		return writeFile(path, sendStream)
+
+	case db.PoolSink:
+		return pipe(sendStream, func(stream io.Reader) error {
+			return s.zfs.ReceiveReplica(ctx, destination, stream)
+		})
+
+	case db.SshSink:
+		return pipe(sendStream, func(stream io.Reader) error {
+			output, err := runner.Pipe(ctx, "ssh-receive-replica", stream, nil, "ssh", sshArgs(target, destination)...)
+			if err != nil {
+				return fmt.Errorf("remote receive failed: %s", output)
+			}
+
+			return nil
+		})
+	}
+
+	return fmt.Errorf("unknown replication sink: %s", target.Sink)
+}
+
+// sshArgs ends the options with '--' so the host is never read as one. The remote side joins the
+// command with spaces and runs it through a shell, so every part of it is quoted.
+func sshArgs(target model.ReplicationTarget, destination string) []string {
+	args := []string{"-o", "BatchMode=yes"}
+
+	if target.SSHPort != nil {
+		args = append(args, "-p", fmt.Sprintf("%d", *target.SSHPort))
+	}
+
+	if target.SSHUser != nil {
+		args = append(args, "-l", *target.SSHUser)
+	}
+
+	args = append(args, "--", *target.SSHHost)
+
+	for _, arg := range append([]string{"zfs"}, zfs.ReceiveArgs(destination)...) {
+		args = append(args, shellQuote(arg))
+	}
+
+	return args
+}
+
+func isSshTarget(target model.ReplicationTarget) bool {
+	if target.SSHHost == nil || validation.Validate(sshHost{*target.SSHHost}) != nil {
+		return false
+	}
+
+	return target.SSHUser == nil || validation.IsUsername(*target.SSHUser)
+}
+
+type sshHost struct {
+	Host string `validate:"hostname_rfc1123|ip"`
+}
+
+// shellQuote wraps the argument in single quotes, a single quote inside is closed, escaped and reopened
+func shellQuote(arg string) string {
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func writeFile(path string, sendStream func(io.Writer) error) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create replication file: %w", err)
+	}
+	defer file.Close()
+
+	if err := sendStream(file); err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+
+	return file.Sync()
+}
+
+// pipe connects a send to a receive. If the receive fails, the send is stopped as well.
+func pipe(sendStream func(io.Writer) error, receiveStream func(io.Reader) error) error {
+	reader, writer := io.Pipe()
+	sendErr := make(chan error, 1)
+
+	go func() {
+		err := sendStream(writer)
+		_ = writer.CloseWithError(err)
+		sendErr <- err
+	}()
+
+	receiveErr := receiveStream(reader)
+	if receiveErr != nil {
+		_ = reader.CloseWithError(receiveErr)
+	} else {
+		_ = reader.Close()
+	}
+
+	if err := <-sendErr; err != nil && receiveErr == nil {
+		return err
+	}
+
+	return receiveErr
+}
+
+func failSync(ctx context.Context, target model.ReplicationTarget, err error) error {
+	if err := db.UpdateReplicationFailed(ctx, *target.ID, err.Error()); err != nil {
+		log.Errorf("Can't update replication target %s: %s", target.Name, err)
+	}
+
+	return err
+}
+
+func (s *Service) zfsDestroy(ctx context.Context, snapshot string) error {
+	return s.zfs.Destroy(ctx, snapshot, true)
+}
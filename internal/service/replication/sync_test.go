@@ -0,0 +1,121 @@
+package replication
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/replication"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/validation"
+)
+
+func TestSshArgs(t *testing.T) {
+	host := "backup.example.com"
+	user := "replica"
+	port := int32(2222)
+
+	target := model.ReplicationTarget{SSHHost: &host, SSHUser: &user, SSHPort: &port}
+
+	got := sshArgs(target, "tank/it's")
+	want := []string{
+		"-o", "BatchMode=yes", "-p", "2222", "-l", "replica", "--", "backup.example.com",
+		"'zfs'", "'receive'", "'-F'", "'-u'",
+		"'-x'", "'quota'", "'-x'", "'refquota'", "'-x'", "'reservation'", "'-x'", "'refreservation'",
+		"'-x'", "'mountpoint'", `'tank/it'\''s'`,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sshArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestTargetInitValidation(t *testing.T) {
+	valid := replication.TargetInit{
+		Name:            "offsite",
+		Branch:          "main",
+		Sink:            "ssh",
+		Destination:     "backup/main",
+		SshHost:         "backup.example.com",
+		SshUser:         "replica",
+		IntervalSeconds: 60,
+	}
+
+	if err := validation.Validate(valid); err != nil {
+		t.Fatalf("valid target rejected: %s", err)
+	}
+
+	tests := map[string]func(*replication.TargetInit){
+		"host option":       func(t *replication.TargetInit) { t.SshHost = "-oProxyCommand=touch /tmp/pwned" },
+		"host with command": func(t *replication.TargetInit) { t.SshHost = "host;reboot" },
+		"user option":       func(t *replication.TargetInit) { t.SshUser = "-oProxyCommand=id" },
+		"user with command": func(t *replication.TargetInit) { t.SshUser = "root$(id)" },
+		"destination flag":  func(t *replication.TargetInit) { t.Destination = "-o" },
+	}
+
+	for name, mutate := range tests {
+		target := valid
+		mutate(&target)
+
+		if err := validation.Validate(target); err == nil {
+			t.Errorf("%s: target %+v accepted", name, target)
+		}
+	}
+
+	for _, host := range []string{"10.0.0.7", "::1", "backup-1"} {
+		target := valid
+		target.SshHost = host
+
+		if err := validation.Validate(target); err != nil {
+			t.Errorf("host %s rejected: %s", host, err)
+		}
+	}
+}
+
+func TestResolveDestination(t *testing.T) {
+	replicationDir := t.TempDir()
+
+	opts.Config = &opts.Opts{}
+	opts.Config.Replication.Dir = replicationDir
+
+	if err := os.Symlink("/etc", filepath.Join(replicationDir, "etc")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sink        db.ReplicationSink
+		destination string
+		want        string
+	}{
+		{db.FileSink, "nightly", filepath.Join(replicationDir, "nightly")},
+		{db.FileSink, replicationDir, replicationDir},
+		{db.FileSink, "/etc", ""},
+		{db.FileSink, "../nightly", ""},
+		{db.FileSink, "etc/cron.d", ""},
+		{db.PoolSink, "backup/main", "backup/main"},
+		{db.PoolSink, "-o", ""},
+		{db.SshSink, "backup/main;reboot", ""},
+		{db.SshSink, "backup/-F", ""},
+	}
+
+	for _, test := range tests {
+		got, err := resolveDestination(test.sink, test.destination)
+
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("resolveDestination(%s, %q) = %q, want error", test.sink, test.destination, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("resolveDestination(%s, %q) returned error: %s", test.sink, test.destination, err)
+		} else if got != test.want {
+			t.Errorf("resolveDestination(%s, %q) = %q, want %q", test.sink, test.destination, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package repo
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrOtherRepoExport = errors.New("only maintainers of both repositories can import a branch exported from another repository")
+
+// ExportBranch writes a zfs send stream of the branch to a file in an export job, along with a
+// manifest describing where it came from. The branch can be open or closed, as long as it hasn't
+// been purged. The manifest is the output of the job.
+func (s *Service) ExportBranch(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	branchName string,
+	branchExport repo.BranchExport,
+) (model.Job, error) {
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if err != nil {
+		log.Errorf("Can't get branch: %s", err)
+		return model.Job{}, err
+	}
+
+	if branch.Status == string(db.BranchPurged) {
+		return model.Job{}, responseerror.From("Branch has been purged and can't be exported")
+	}
+
+	streamPath, err := archivePath(branchExport.Path)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	manifestPath, err := archivePath(streamPath + repo.ManifestSuffix)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	for _, path := range []string{streamPath, manifestPath} {
+		if _, err := os.Stat(path); err == nil {
+			return model.Job{}, responseerror.From(fmt.Sprintf("File %s already exists", path))
+		}
+	}
+
+	jobTarget := repoDetail.Repo.Name + "/" + branch.Name
+
+	return job.Run(db.JobExportBranch, jobTarget, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		manifestJson, err := s.exportBranch(ctx, tracker, repoDetail, branch, streamPath, branchExport.GetCompression())
+		if err != nil {
+			return "", err
+		}
+
+		if err := os.WriteFile(manifestPath, manifestJson, 0600); err != nil {
+			_ = util.RemoveFile(streamPath)
+			return "", fmt.Errorf("failed to write manifest: %w", err)
+		}
+
+		log.Infof("Exported branch %s of repo %s to %s", branch.Name, repoDetail.Repo.Name, streamPath)
+		return string(manifestJson), nil
+	})
+}
+
+func (s *Service) exportBranch(
+	ctx context.Context,
+	tracker *job.Tracker,
+	repoDetail db.RepoDetail,
+	branch model.Branch,
+	streamPath string,
+	compression string,
+) ([]byte, error) {
+
+	tracker.Step("Creating snapshot", 0)
+
+	_, dir := util.SplitPath(streamPath)
+	if err := util.CreateDirectories(dir, "root", 0700); err != nil {
+		log.Errorf("Can't create export directory: %s", err)
+		return nil, err
+	}
+
+	createdAt := time.Now().UTC()
+	snapshotName := fmt.Sprintf(
+		"%s@pb-export-%d",
+		zfs.DatasetName(repoDetail.Pool.Name, branch.Name),
+		createdAt.Unix(),
+	)
+
+	if err := s.zfs.CreateSnapshot(ctx, snapshotName); err != nil {
+		return nil, err
+	}
+
+	// The export snapshot is only needed for the send, keeping it would pin the branch data
+	defer func() {
+		if err := s.zfs.Destroy(context.WithoutCancel(ctx), snapshotName, true); err != nil {
+			log.Errorf("Can't destroy export snapshot %s: %s", snapshotName, err)
+		}
+	}()
+
+	tracker.Step("Writing stream", 10)
+
+	size, checksum, err := s.writeStream(ctx, snapshotName, streamPath, compression)
+	if err != nil {
+		_ = util.RemoveFile(streamPath)
+		return nil, err
+	}
+
+	tracker.Step("Writing manifest", 90)
+
+	manifest := repo.Manifest{
+		FormatVersion: repo.ManifestVersion,
+		Repo:          repoDetail.Repo.Name,
+		Branch:        branch.Name,
+		PgVersion:     repoDetail.Repo.Version,
+		Lineage:       branchLineage(repoDetail, branch),
+		Snapshot:      snapshotName,
+		Compression:   compression,
+		SizeInBytes:   size,
+		Sha256:        checksum,
+		CreatedAt:     createdAt,
+	}
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		_ = util.RemoveFile(streamPath)
+		return nil, err
+	}
+
+	return manifestJson, nil
+}
+
+// ImportBranch receives an exported stream into the repo as a new branch without a parent. The
+// stream is checked, received and started in an import job.
+func (s *Service) ImportBranch(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	branchImport repo.BranchImport,
+) (model.Job, error) {
+
+	streamPath, err := archivePath(branchImport.Path)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	manifestPath, err := archivePath(streamPath + repo.ManifestSuffix)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	// Handing a branch to another repo needs the caller to maintain both, the archive directory is
+	// shared by every repo
+	if manifest.Repo != repoDetail.Repo.Name {
+		caller, ok := auth.CallerFrom(ctx)
+		if ok && (!caller.CanAccessRepo(manifest.Repo, db.RoleMaintainer) ||
+			!caller.CanAccessRepo(repoDetail.Repo.Name, db.RoleMaintainer)) {
+			return model.Job{}, ErrOtherRepoExport
+		}
+	}
+
+	if manifest.PgVersion != repoDetail.Repo.Version {
+		return model.Job{}, responseerror.From(fmt.Sprintf(
+			"Branch was exported from Postgres %d, but the repository uses Postgres %d",
+			manifest.PgVersion,
+			repoDetail.Repo.Version,
+		))
+	}
+
+	purgedBranchId, err := purgedBranchOf(ctx, repoDetail, branchImport.Name)
+	if err != nil {
+		return model.Job{}, err
+	}
+
+	jobTarget := repoDetail.Repo.Name + "/" + branchImport.Name
+
+	return job.Run(db.JobImportBranch, jobTarget, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		branch, err := s.importBranch(ctx, tracker, repoDetail, branchImport, purgedBranchId, streamPath, manifest)
+		if err != nil {
+			return "", err
+		}
+
+		log.Infof(
+			"Imported branch %s of repo %s as %s into repo %s",
+			manifest.Branch, manifest.Repo, branch.Name, repoDetail.Repo.Name,
+		)
+
+		return "", startBranchPg(ctx, tracker, repoDetail, branch)
+	})
+}
+
+func (s *Service) importBranch(
+	ctx context.Context,
+	tracker *job.Tracker,
+	repoDetail db.RepoDetail,
+	branchImport repo.BranchImport,
+	purgedBranchId *int32,
+	streamPath string,
+	manifest repo.Manifest,
+) (_ model.Branch, err error) {
+
+	tracker.Step("Verifying stream", 0)
+
+	// The stream is checked before anything is received, a corrupted stream never reaches zfs
+	checksum, err := fileChecksum(streamPath)
+	if err != nil {
+		return model.Branch{}, err
+	}
+
+	if checksum != manifest.Sha256 {
+		log.Errorf("Checksum mismatch for %s, expected: %s, got: %s", streamPath, manifest.Sha256, checksum)
+		return model.Branch{}, responseerror.From("Exported stream is corrupted, checksum mismatch")
+	}
+
+	tracker.Step("Receiving stream", 10)
+
+	dataset := zfs.DatasetName(repoDetail.Pool.Name, branchImport.Name)
+
+	if err := s.readStream(ctx, dataset, streamPath, manifest.Compression); err != nil {
+		return model.Branch{}, err
+	}
+
+	branchCreated := false
+
+	// Until the branch is recorded nothing else knows about the dataset, so it's cleaned up here
+	defer func() {
+		if err == nil || branchCreated {
+			return
+		}
+
+		if err := s.zfs.Destroy(context.WithoutCancel(ctx), dataset, true); err != nil {
+			log.Errorf("Can't destroy received dataset %s: %s", dataset, err)
+		}
+	}()
+
+	tracker.Step("Creating branch", 40)
+
+	quota := RepoDefaultQuota(repoDetail.Repo)
+	if err := s.zfs.SetQuota(ctx, dataset, quota); err != nil {
+		// The received data might already be larger than the defaults, the branch is kept without limits
+		log.Errorf("Can't set quota of imported branch %s: %s", branchImport.Name, err)
+		quota = repo.Quota{}
+	}
+
+	// The stream keeps the owner ids of the exporting host, which might not match this one
+	branchPath := filepath.Join(repoDetail.Pool.MountPath, branchImport.Name)
+	err = util.SetPermissionsRecursive(branchPath, opts.Config.Branch.User)
+	if err != nil {
+		return model.Branch{}, err
+	}
+
+	port, err := pg.GetPgPort(ctx)
+	if err != nil {
+		log.Errorf("Can't get pg port: %s", err)
+		return model.Branch{}, err
+	}
+
+	branch := model.Branch{
+		Name:     branchImport.Name,
+		Status:   string(db.BranchOpen),
+		PgStatus: string(db.BranchPgStarting),
+		PgPort:   port,
+		RepoID:   *repoDetail.Repo.ID,
+
+		OwnerTokenID: branchImport.OwnerTokenID,
+	}
+
+	setBranchQuota(&branch, quota)
+
+	if err := applyMetadata(branchImport.Metadata, &branch.Owner, &branch.Description, &branch.Labels); err != nil {
+		return model.Branch{}, err
+	}
+
+	branch, err = createBranchRecord(ctx, purgedBranchId, branch)
+	if err != nil {
+		log.Errorf("Can't create branch: %s", err)
+		return model.Branch{}, err
+	}
+
+	branchCreated = true
+	return branch, nil
+}
+
+func (s *Service) writeStream(ctx context.Context, snapshotName, path, compression string) (int64, string, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	fileWriter := io.MultiWriter(file, hash, counter)
+
+	var stream io.Writer = fileWriter
+	var gzipWriter *gzip.Writer
+
+	if compression == repo.CompressionGzip {
+		gzipWriter = gzip.NewWriter(fileWriter)
+		stream = gzipWriter
+	}
+
+	if err := s.zfs.Send(ctx, snapshotName, stream); err != nil {
+		return 0, "", err
+	}
+
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return 0, "", fmt.Errorf("failed to finish compressed stream: %w", err)
+		}
+	}
+
+	if err := file.Sync(); err != nil {
+		return 0, "", fmt.Errorf("failed to sync export file: %w", err)
+	}
+
+	return counter.count, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *Service) readStream(ctx context.Context, dataset, path, compression string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open exported stream: %w", err)
+	}
+	defer file.Close()
+
+	var stream io.Reader = file
+
+	if compression == repo.CompressionGzip {
+		gzipReader, err := gzip.NewReader(stream)
+		if err != nil {
+			return fmt.Errorf("failed to read compressed stream: %w", err)
+		}
+		defer gzipReader.Close()
+
+		stream = gzipReader
+	}
+
+	return s.zfs.Receive(ctx, dataset, stream)
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open exported stream: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read exported stream: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// archivePath resolves an export path against the archive directory, nothing outside of it can be
+// read or written by an export or import
+func archivePath(path string) (string, error) {
+	archiveDir := filepath.Clean(opts.Config.Branch.ArchiveDir)
+
+	resolved, err := util.ResolvePathIn(archiveDir, path)
+	if errors.Is(err, util.ErrOutsideDir) || resolved == archiveDir {
+		return "", responseerror.From(fmt.Sprintf("Path has to be inside the archive directory %s", archiveDir))
+	}
+
+	return resolved, err
+}
+
+func readManifest(path string) (repo.Manifest, error) {
+	var manifest repo.Manifest
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Errorf("Can't read manifest %s: %s", path, err)
+		return repo.Manifest{}, responseerror.From(fmt.Sprintf("Can't read manifest %s", path))
+	}
+
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return repo.Manifest{}, responseerror.From(fmt.Sprintf("Invalid manifest %s", path))
+	}
+
+	if manifest.FormatVersion != repo.ManifestVersion {
+		return repo.Manifest{}, responseerror.From(
+			fmt.Sprintf("Unsupported manifest version %d", manifest.FormatVersion),
+		)
+	}
+
+	return manifest, nil
+}
+
+func branchLineage(repoDetail db.RepoDetail, branch model.Branch) []string {
+	branchById := make(map[int32]model.Branch)
+	for _, repoBranch := range repoDetail.Branches {
+		branchById[*repoBranch.ID] = repoBranch
+	}
+
+	lineage := []string{}
+
+	for parentId := branch.ParentID; parentId != nil; {
+		parent, ok := branchById[*parentId]
+		if !ok {
+			break
+		}
+
+		lineage = append(lineage, parent.Name)
+		parentId = parent.ParentID
+	}
+
+	return lineage
+}
+
+type countingWriter struct {
+	count int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.count += int64(len(p))
+	return len(p), nil
+}
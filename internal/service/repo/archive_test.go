@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/opts"
+)
+
+func TestArchivePath(t *testing.T) {
+	root := t.TempDir()
+	archiveDir := filepath.Join(root, "archives")
+	outsideDir := filepath.Join(root, "outside")
+
+	for _, dir := range []string{archiveDir, outsideDir} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(outsideDir, filepath.Join(archiveDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("/etc/shadow", filepath.Join(archiveDir, "shadow")); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Config = &opts.Opts{}
+	opts.Config.Branch.ArchiveDir = archiveDir
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.zfs", filepath.Join(archiveDir, "main.zfs")},
+		{"nightly/main.zfs", filepath.Join(archiveDir, "nightly/main.zfs")},
+		{filepath.Join(archiveDir, "main.zfs"), filepath.Join(archiveDir, "main.zfs")},
+		{"nightly/../main.zfs", filepath.Join(archiveDir, "main.zfs")},
+		{"../outside/main.zfs", ""},
+		{"/etc/shadow", ""},
+		{filepath.Join(archiveDir, "../outside/main.zfs"), ""},
+		{archiveDir, ""},
+		{".", ""},
+		{"escape/main.zfs", ""},
+		{"escape/nested/main.zfs", ""},
+		{"shadow", ""},
+	}
+
+	for _, test := range tests {
+		got, err := archivePath(test.path)
+
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("archivePath(%q) = %q, want error", test.path, got)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("archivePath(%q) returned error: %s", test.path, err)
+		} else if got != test.want {
+			t.Errorf("archivePath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -2,60 +2,75 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/go-jet/jet/v2/qrm"
 	"github.com/jamius19/postbranch/internal/db"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/dto/repo"
-	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/service/job"
 	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/zfs"
 	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
 	"path/filepath"
+	"slices"
+	"time"
 )
 
-func CreateBranch(ctx context.Context, repoDetail db.RepoDetail, branchInit repo.BranchInit) (model.Branch, error) {
-	parentBranch, err := db.GetBranch(ctx, branchInit.ParentId)
+// CreateBranch clones the parent into the new branch and starts it in a job. The repo is locked
+// until the job is registered.
+func (s *Service) CreateBranch(ctx context.Context, repoDetail db.RepoDetail, branchInit repo.BranchInit) (model.Branch, model.Job, error) {
+	unlock := LockRepo(*repoDetail.Repo.ID)
+	defer unlock()
+
+	parentBranch, err := db.GetBranch(ctx, *repoDetail.Repo.ID, branchInit.ParentId)
 	if err != nil {
-		log.Error("Can't get parent branch: %s", err)
-		return model.Branch{}, err
+		log.Errorf("Can't get parent branch: %s", err)
+		return model.Branch{}, model.Job{}, err
 	}
 
-	// TODO: Add a checkpoint to parent branch
-
-	snapshotName := fmt.Sprintf("%s/%s@pb-branch-%s", repoDetail.Pool.Name, parentBranch.Name, branchInit.Name)
-	_, err = runner.Single(
-		"create-zfs-branch-snapshot",
-		false,
-		false,
-		"zfs",
-		"snapshot",
-		snapshotName,
-	)
+	if parentBranch.Status != string(db.BranchOpen) {
+		log.Errorf("Parent branch %s is not open, status: %s", parentBranch.Name, parentBranch.Status)
+		return model.Branch{}, model.Job{}, responseerror.From("Parent branch is not open")
+	}
 
+	purgedBranchId, err := purgedBranchOf(ctx, repoDetail, branchInit.Name)
 	if err != nil {
+		return model.Branch{}, model.Job{}, err
+	}
+
+	// TODO: Add a checkpoint to parent branch
+
+	snapshotName := zfs.BranchSnapshotName(zfs.DatasetName(repoDetail.Pool.Name, parentBranch.Name), branchInit.Name)
+	if err := s.zfs.CreateSnapshot(ctx, snapshotName); err != nil {
 		log.Errorf("Can't create branch snapshot: %s", err)
-		return model.Branch{}, err
+		return model.Branch{}, model.Job{}, err
 	}
 
 	log.Infof("Created branch snapshot %s", snapshotName)
 
-	_, err = runner.Single(
-		"clone-zfs-branch",
-		false,
-		false,
-		"zfs",
-		"clone",
-		snapshotName,
-		fmt.Sprintf("%s/%s", repoDetail.Pool.Name, branchInit.Name),
-	)
-	if err != nil {
+	dataset := zfs.DatasetName(repoDetail.Pool.Name, branchInit.Name)
+	if err := s.zfs.Clone(ctx, snapshotName, dataset); err != nil {
 		log.Errorf("Can't clone branch: %s", err)
-		return model.Branch{}, err
+		return model.Branch{}, model.Job{}, err
+	}
+
+	quota := branchInit.Quota.Or(RepoDefaultQuota(repoDetail.Repo))
+	if err := s.zfs.SetQuota(ctx, dataset, quota); err != nil {
+		log.Errorf("Can't set branch quota: %s", err)
+
+		if err := s.zfs.Destroy(context.WithoutCancel(ctx), dataset, true); err != nil {
+			log.Errorf("Can't destroy branch dataset %s: %s", dataset, err)
+		}
+
+		return model.Branch{}, model.Job{}, responseerror.From("Failed to set branch quota")
 	}
 
 	port, err := pg.GetPgPort(ctx)
 	if err != nil {
 		log.Errorf("Can't get pg port: %s", err)
-		return model.Branch{}, err
+		return model.Branch{}, model.Job{}, err
 	}
 
 	branch := model.Branch{
@@ -65,65 +80,221 @@ func CreateBranch(ctx context.Context, repoDetail db.RepoDetail, branchInit repo
 		PgPort:   port,
 		RepoID:   *repoDetail.Repo.ID,
 		ParentID: parentBranch.ID,
+
+		OwnerTokenID: branchInit.OwnerTokenID,
 	}
 
-	branch, err = db.CreateBranch(ctx, branch)
+	setBranchQuota(&branch, quota)
+
+	if err := applyMetadata(branchInit.Metadata, &branch.Owner, &branch.Description, &branch.Labels); err != nil {
+		return model.Branch{}, model.Job{}, err
+	}
+
+	branch, err = createBranchRecord(ctx, purgedBranchId, branch)
 	if err != nil {
 		log.Errorf("Can't create branch: %s", err)
-		return model.Branch{}, err
+		return model.Branch{}, model.Job{}, err
 	}
 
-	go startBranchPg(repoDetail, branch)
+	startJob, err := startBranch(repoDetail, branch)
+	if err != nil {
+		return model.Branch{}, model.Job{}, err
+	}
 
 	log.Infof("Created new branch %s", branchInit.Name)
-	return model.Branch{}, nil
+	return branch, startJob, nil
 }
 
-func CloseBranch(ctx context.Context, repoDetail db.RepoDetail, branchClose repo.BranchClose) error {
-	branch, err := db.GetBranchByName(ctx, branchClose.Name)
-	if err != nil {
-		log.Error("Can't get branch: %s", err)
-		return err
+// purgedBranchOf fails if a branch with the name exists, unless it has been purged. The id of the
+// purged branch is returned, its record is only replaced once the new branch is created.
+func purgedBranchOf(ctx context.Context, repoDetail db.RepoDetail, branchName string) (*int32, error) {
+	existingBranch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if errors.Is(err, qrm.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	err = pg.StopPg(repoDetail.Repo.PgPath, repoDetail.Pool.MountPath, branch.Name, false)
+	if existingBranch.Status != string(db.BranchPurged) {
+		return nil, responseerror.From("Branch already exists")
+	}
+
+	return existingBranch.ID, nil
+}
+
+// createBranchRecord creates the branch, in place of the purged branch with the same name if there is
+// one. The dataset of a purged branch is already gone, only the record is left.
+func createBranchRecord(ctx context.Context, purgedBranchId *int32, branch model.Branch) (model.Branch, error) {
+	if purgedBranchId == nil {
+		return db.CreateBranch(ctx, branch)
+	}
+
+	return db.ReplacePurgedBranch(ctx, *purgedBranchId, branch)
+}
+
+// ReopenBranch restarts a closed branch on a fresh port. It's only possible until the branch has
+// been purged.
+func ReopenBranch(ctx context.Context, repoDetail db.RepoDetail, branchName string) (model.Branch, model.Job, error) {
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
 	if err != nil {
-		return err
+		log.Errorf("Can't get branch: %s", err)
+		return model.Branch{}, model.Job{}, err
 	}
 
-	branchDatasetName := fmt.Sprintf("%s/%s", repoDetail.Pool.Name, branch.Name)
+	switch db.BranchStatus(branch.Status) {
+	case db.BranchOpen:
+		return model.Branch{}, model.Job{}, responseerror.From("Branch is already open")
+	case db.BranchPurged:
+		return model.Branch{}, model.Job{}, responseerror.From("Branch has been purged and can't be reopened")
+	}
 
-	_, err = runner.Single(
-		"delete-zfs-dataset",
-		false,
-		false,
-		"zfs",
-		"destroy",
-		"-r",
-		branchDatasetName,
-	)
+	port, err := pg.GetPgPort(ctx)
+	if err != nil {
+		log.Errorf("Can't get pg port: %s", err)
+		return model.Branch{}, model.Job{}, err
+	}
 
+	branch, err = db.ReopenBranch(ctx, *branch.ID, port)
 	if err != nil {
-		log.Errorf("Can't close branch: %s", err)
-		return err
+		return model.Branch{}, model.Job{}, err
 	}
 
-	err = db.UpdateBranchStatus(ctx, *branch.ID, db.BranchClosed)
+	startJob, err := startBranch(repoDetail, branch)
 	if err != nil {
-		return err
+		return model.Branch{}, model.Job{}, err
 	}
 
-	return nil
+	log.Infof("Reopened branch %s on port %d", branch.Name, port)
+	return branch, startJob, nil
 }
 
-func startBranchPg(repoDetail db.RepoDetail, branch model.Branch) {
+// BranchTree returns the branches of a repo as a parent/child hierarchy. The fork snapshot and
+// dependency info of each branch is read from ZFS, so it stays correct even if a dataset has been
+// promoted since the branch was created.
+func (s *Service) BranchTree(ctx context.Context, repoDetail db.RepoDetail) ([]repo.BranchNode, error) {
+	origins, err := s.zfs.ListOrigins(ctx, repoDetail.Pool.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	branchByDataset := make(map[string]string)
+	for _, branch := range repoDetail.Branches {
+		branchByDataset[zfs.DatasetName(repoDetail.Pool.Name, branch.Name)] = branch.Name
+	}
+
+	dependents := make(map[string][]string)
+	for dataset, origin := range origins {
+		dependent, ok := branchByDataset[dataset]
+		if !ok {
+			continue
+		}
+
+		if owner, ok := branchByDataset[zfs.SnapshotDataset(origin)]; ok {
+			dependents[owner] = append(dependents[owner], dependent)
+		}
+	}
+
+	childrenOf := make(map[int32][]model.Branch)
+	var roots []model.Branch
+
+	for _, branch := range repoDetail.Branches {
+		if branch.ParentID == nil {
+			roots = append(roots, branch)
+			continue
+		}
+
+		childrenOf[*branch.ParentID] = append(childrenOf[*branch.ParentID], branch)
+	}
+
+	var buildNode func(branch model.Branch) repo.BranchNode
+	buildNode = func(branch model.Branch) repo.BranchNode {
+		dataset := zfs.DatasetName(repoDetail.Pool.Name, branch.Name)
+
+		node := repo.BranchNode{
+			Branch:     BranchResponse(branch),
+			Dataset:    dataset,
+			Dependents: []string{},
+			Children:   []repo.BranchNode{},
+		}
+
+		if origin, ok := origins[dataset]; ok {
+			node.ForkSnapshot = &origin
+
+			if owner, ok := branchByDataset[zfs.SnapshotDataset(origin)]; ok {
+				node.DependsOn = &owner
+			}
+		}
+
+		if branchDependents, ok := dependents[branch.Name]; ok {
+			slices.Sort(branchDependents)
+			node.Dependents = branchDependents
+		}
+
+		for _, child := range childrenOf[*branch.ID] {
+			node.Children = append(node.Children, buildNode(child))
+		}
+
+		return node
+	}
+
+	tree := []repo.BranchNode{}
+	for _, root := range roots {
+		tree = append(tree, buildNode(root))
+	}
+
+	return tree, nil
+}
+
+func BranchResponse(branch model.Branch) repo.Branch {
+	return repo.Branch{
+		ID:       branch.ID,
+		Name:     branch.Name,
+		Status:   db.BranchStatus(branch.Status),
+		PgStatus: db.BranchPgStatus(branch.PgStatus),
+		Port:     branch.PgPort,
+		ParentID: branch.ParentID,
+		ClosedAt: branch.ClosedAt,
+		PurgeAt:  purgeAt(branch),
+		Quota:    BranchQuota(branch),
+
+		StorageError: branch.StorageError,
+		OwnerTokenID: branch.OwnerTokenID,
+		Owner:        branch.Owner,
+		Description:  branch.Description,
+		Labels:       Labels(branch.Labels),
+		CreatedAt:    branch.CreatedAt,
+		UpdatedAt:    branch.UpdatedAt,
+	}
+}
+
+func purgeAt(branch model.Branch) *time.Time {
+	if branch.Status != string(db.BranchClosed) || branch.ClosedAt == nil {
+		return nil
+	}
+
+	purgeAt := branch.ClosedAt.Add(retention())
+	return &purgeAt
+}
+
+// startBranch starts Postgres on the branch in a start branch job
+func startBranch(repoDetail db.RepoDetail, branch model.Branch) (model.Job, error) {
+	jobTarget := repoDetail.Repo.Name + "/" + branch.Name
+
+	return job.Run(db.JobStartBranch, jobTarget, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		return "", startBranchPg(ctx, tracker, repoDetail, branch)
+	})
+}
+
+func startBranchPg(ctx context.Context, tracker *job.Tracker, repoDetail db.RepoDetail, branch model.Branch) error {
 	datasetPath := filepath.Join(repoDetail.Pool.MountPath, branch.Name, "data")
 	logPath := filepath.Join(repoDetail.Pool.MountPath, branch.Name, "logs")
 
+	tracker.Step("Configuring Postgres", 0)
+
 	err := pg.UpdatePostgresConfig(datasetPath, "port", util.StringVal(branch.PgPort))
 	if err != nil {
 		log.Errorf("Can't update postgres port, branch: %s, err: %s", branch.Name, err)
-		return
+		return err
 	}
 
 	err = pg.UpdatePostgresConfig(
@@ -134,7 +305,7 @@ func startBranchPg(repoDetail db.RepoDetail, branch model.Branch) {
 
 	if err != nil {
 		log.Errorf("Can't update postgres log file pattern, branch: %s, err: %s", branch.Name, err)
-		return
+		return err
 	}
 
 	err = pg.UpdatePostgresConfig(
@@ -145,33 +316,29 @@ func startBranchPg(repoDetail db.RepoDetail, branch model.Branch) {
 
 	if err != nil {
 		log.Errorf("Can't update postgres log dir, branch: %s, err: %s", branch.Name, err)
-		return
+		return err
 	}
 
 	logDirGlobPattern := filepath.Join(repoDetail.Pool.MountPath, branch.Name, "logs", "*")
 	err = util.RemoveGlob(logDirGlobPattern)
 	if err != nil {
 		log.Errorf("Can't remove log files, branch: %s, err: %s", branch.Name, err)
-		return
+		return err
 	}
 
 	err = pg.CleanPidFile(datasetPath)
 	if err != nil {
 		log.Errorf("Can't clean pid file, branch: %s, err: %s", branch.Name, err)
-		return
+		return err
 	}
 
-	status, err := pg.StartPg(repoDetail.Repo.PgPath, repoDetail.Pool.MountPath, branch.Name)
-	if err != nil {
-		log.Errorf("Can't start Postgres: %s", err)
-		return
-	}
+	tracker.Step("Starting Postgres", 50)
 
-	err = db.UpdateBranchPgStatus(context.Background(), *branch.ID, status)
-	if err != nil {
-		log.Errorf("Can't update branch status: %s", err)
-		return
+	if err := pg.StartPg(ctx, repoDetail.Repo.PgPath, repoDetail.Pool.MountPath, branch.Name, *branch.ID); err != nil {
+		log.Errorf("Can't start Postgres: %s", err)
+		return err
 	}
 
 	log.Infof("Started Postgres on branch %s", branch.Name)
+	return nil
 }
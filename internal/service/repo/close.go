@@ -0,0 +1,355 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"slices"
+	"strings"
+	"time"
+)
+
+var ErrDependentBranches = errors.New("branch has dependent branches")
+
+// closePlan is the list of ZFS and database changes needed to close a branch. It's built up front
+// so that a dry run reports exactly what a real close would do, and what the purge will destroy
+// once the retention period is over.
+type closePlan struct {
+	response repo.BranchCloseResponse
+
+	// datasets are closed in order, the dependents always come before the dataset they're cloned from
+	datasets []string
+
+	// promote is the dependent dataset which takes over the snapshots of the closed branch
+	promote string
+
+	reparent map[int32]*int32
+}
+
+func (s *Service) CloseBranch(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	branchClose repo.BranchClose,
+) (repo.BranchCloseResponse, error) {
+
+	unlock := LockRepo(*repoDetail.Repo.ID)
+	defer unlock()
+
+	// The close is planned on the branches as they are once no other change is running
+	repoDetail, err := db.GetRepo(ctx, int64(*repoDetail.Repo.ID))
+	if err != nil {
+		return repo.BranchCloseResponse{}, err
+	}
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchClose.Name)
+	if err != nil {
+		log.Errorf("Can't get branch: %s", err)
+		return repo.BranchCloseResponse{}, err
+	}
+
+	if branch.Status != string(db.BranchOpen) {
+		return repo.BranchCloseResponse{}, responseerror.From("Branch is not open")
+	}
+
+	plan, err := s.planClose(ctx, repoDetail, branch, branchClose.GetMode())
+	if err != nil {
+		return repo.BranchCloseResponse{}, err
+	}
+
+	plan.response.DryRun = branchClose.DryRun
+
+	if branchClose.DryRun {
+		log.Infof("Dry run for closing branch %s: %v", branch.Name, plan.response)
+		return plan.response, nil
+	}
+
+	if err := s.executeClose(ctx, repoDetail, plan); err != nil {
+		return repo.BranchCloseResponse{}, err
+	}
+
+	log.Infof("Closed branch %s with mode %s", branch.Name, plan.response.Mode)
+	return plan.response, nil
+}
+
+func (s *Service) planClose(ctx context.Context, repoDetail db.RepoDetail, branch model.Branch, mode string) (closePlan, error) {
+	poolName := repoDetail.Pool.Name
+
+	origins, err := s.zfs.ListOrigins(ctx, poolName)
+	if err != nil {
+		return closePlan{}, err
+	}
+
+	clones := make(map[string][]string)
+	for dataset, origin := range origins {
+		originDataset := zfs.SnapshotDataset(origin)
+		clones[originDataset] = append(clones[originDataset], dataset)
+	}
+
+	for _, datasets := range clones {
+		slices.Sort(datasets)
+	}
+
+	branchByDataset := make(map[string]model.Branch)
+	for _, repoBranch := range repoDetail.Branches {
+		branchByDataset[zfs.DatasetName(poolName, repoBranch.Name)] = repoBranch
+	}
+
+	dataset := zfs.DatasetName(poolName, branch.Name)
+	dependents := clones[dataset]
+
+	plan := closePlan{
+		response: repo.BranchCloseResponse{
+			Mode:       mode,
+			Closed:     []string{},
+			Promoted:   []string{},
+			Reparented: []repo.BranchReparent{},
+			Destroyed:  []string{},
+		},
+		reparent: make(map[int32]*int32),
+	}
+
+	// minCreateTxg skips the snapshots which move to the promoted dataset instead of being destroyed
+	var minCreateTxg int64
+
+	switch mode {
+	case repo.CloseRefuse:
+		var blocking []string
+		for _, dependent := range dependents {
+			if dependentBranch, ok := branchByDataset[dependent]; ok && dependentBranch.Status != string(db.BranchOpen) {
+				continue
+			}
+
+			blocking = append(blocking, dependent)
+		}
+
+		if len(blocking) > 0 {
+			return closePlan{}, fmt.Errorf(
+				"%w: %s",
+				ErrDependentBranches,
+				strings.Join(datasetBranchNames(poolName, blocking), ", "),
+			)
+		}
+
+		plan.datasets = []string{dataset}
+
+	case repo.CloseCascade:
+		var visit func(dataset string) error
+		visit = func(dataset string) error {
+			for _, dependent := range clones[dataset] {
+				if err := visit(dependent); err != nil {
+					return err
+				}
+			}
+
+			closeBranch, ok := branchByDataset[dataset]
+			if !ok {
+				return responseerror.From(fmt.Sprintf("Dependent dataset %s does not belong to a branch", dataset))
+			}
+
+			// Closed dependents are already waiting for their own retention period to expire
+			if closeBranch.Status == string(db.BranchOpen) {
+				plan.datasets = append(plan.datasets, dataset)
+			}
+
+			return nil
+		}
+
+		if err := visit(dataset); err != nil {
+			return closePlan{}, err
+		}
+
+	case repo.CloseReparent:
+		plan.datasets = []string{dataset}
+
+		if len(dependents) == 0 {
+			break
+		}
+
+		snapshots, err := s.zfs.ListSnapshots(ctx, dataset)
+		if err != nil {
+			return closePlan{}, err
+		}
+
+		createTxgs := make(map[string]int64)
+		for _, snapshot := range snapshots {
+			createTxgs[snapshot.Name] = snapshot.CreateTxg
+		}
+
+		// Promoting the clone of the newest snapshot moves every older snapshot along with it, so
+		// the rest of the dependents end up cloned from the promoted dataset. Closed dependents are
+		// only waiting to be purged, they can't take over.
+		for _, dependent := range dependents {
+			dependentBranch, ok := branchByDataset[dependent]
+			if !ok || dependentBranch.Status != string(db.BranchOpen) {
+				continue
+			}
+
+			if plan.promote == "" || createTxgs[origins[dependent]] > minCreateTxg {
+				plan.promote = dependent
+				minCreateTxg = createTxgs[origins[dependent]]
+			}
+		}
+
+		if plan.promote == "" {
+			break
+		}
+
+		plan.response.Promoted = append(plan.response.Promoted, plan.promote)
+		promotedBranch := branchByDataset[plan.promote]
+
+		var branchParent *string
+		if origin, ok := origins[dataset]; ok {
+			if parent, ok := branchByDataset[zfs.SnapshotDataset(origin)]; ok {
+				branchParent = &parent.Name
+			}
+		}
+
+		plan.reparent[*promotedBranch.ID] = branch.ParentID
+		plan.response.Reparented = append(plan.response.Reparented, repo.BranchReparent{
+			Branch: promotedBranch.Name,
+			Parent: branchParent,
+		})
+
+		for _, dependent := range dependents {
+			dependentBranch, ok := branchByDataset[dependent]
+
+			// Clones of snapshots newer than the promoted origin stay with the closed branch
+			if dependent == plan.promote || !ok || createTxgs[origins[dependent]] > minCreateTxg {
+				continue
+			}
+
+			plan.reparent[*dependentBranch.ID] = promotedBranch.ID
+			plan.response.Reparented = append(plan.response.Reparented, repo.BranchReparent{
+				Branch: dependentBranch.Name,
+				Parent: &promotedBranch.Name,
+			})
+		}
+
+	default:
+		return closePlan{}, responseerror.From(fmt.Sprintf("Invalid close mode: %s", mode))
+	}
+
+	for _, closeDataset := range plan.datasets {
+		snapshots, err := s.zfs.ListSnapshots(ctx, closeDataset)
+		if err != nil {
+			return closePlan{}, err
+		}
+
+		for _, snapshot := range snapshots {
+			if closeDataset == dataset && snapshot.CreateTxg <= minCreateTxg {
+				continue
+			}
+
+			plan.response.Destroyed = append(plan.response.Destroyed, snapshot.Name)
+		}
+
+		plan.response.Destroyed = append(plan.response.Destroyed, closeDataset)
+
+		if closeBranch, ok := branchByDataset[closeDataset]; ok {
+			plan.response.Closed = append(plan.response.Closed, closeBranch.Name)
+		}
+	}
+
+	// The snapshot the branch was forked from isn't needed anymore once the branch is purged, unless
+	// it now belongs to the promoted dataset.
+	if origin, ok := origins[dataset]; ok && plan.promote == "" {
+		plan.response.Destroyed = append(plan.response.Destroyed, origin)
+	}
+
+	purgeAt := time.Now().UTC().Add(retention())
+	plan.response.PurgeAt = &purgeAt
+
+	return plan, nil
+}
+
+// executeClose checks every branch of the plan before anything is changed. Postgres is stopped
+// first, and the branches are only recorded as closed once the promotion is done. A failed step
+// undoes the ones before it.
+func (s *Service) executeClose(ctx context.Context, repoDetail db.RepoDetail, plan closePlan) error {
+	pgPath, mountPath := repoDetail.Repo.PgPath, repoDetail.Pool.MountPath
+
+	branchByDataset := make(map[string]model.Branch)
+	for _, repoBranch := range repoDetail.Branches {
+		branchByDataset[zfs.DatasetName(repoDetail.Pool.Name, repoBranch.Name)] = repoBranch
+	}
+
+	closing := make([]model.Branch, 0, len(plan.datasets))
+	for _, dataset := range plan.datasets {
+		branch, ok := branchByDataset[dataset]
+		if !ok || branch.Status != string(db.BranchOpen) {
+			return responseerror.From(fmt.Sprintf("Dataset %s does not belong to an open branch", dataset))
+		}
+
+		closing = append(closing, branch)
+	}
+
+	if promoted, ok := branchByDataset[plan.promote]; plan.promote != "" && (!ok || promoted.Status != string(db.BranchOpen)) {
+		return responseerror.From(fmt.Sprintf("Dataset %s does not belong to an open branch", plan.promote))
+	}
+
+	var stopped []model.Branch
+
+	restart := func() {
+		for _, branch := range stopped {
+			if branch.PgStatus != string(db.BranchPgRunning) {
+				continue
+			}
+
+			if err := pg.StartPg(context.WithoutCancel(ctx), pgPath, mountPath, branch.Name, *branch.ID); err != nil {
+				log.Errorf("Can't restart postgres of branch %s: %s", branch.Name, err)
+			}
+		}
+	}
+
+	// Datasets are only stopped here, they're destroyed by the purge once the retention is over
+	for _, branch := range closing {
+		if err := pg.StopPg(ctx, pgPath, mountPath, branch.Name, false); err != nil {
+			restart()
+			return err
+		}
+
+		stopped = append(stopped, branch)
+	}
+
+	if plan.promote != "" {
+		if err := s.zfs.Promote(ctx, plan.promote); err != nil {
+			restart()
+			return err
+		}
+	}
+
+	branchIds := make([]int32, 0, len(closing))
+	for _, branch := range closing {
+		branchIds = append(branchIds, *branch.ID)
+	}
+
+	if err := db.CloseBranches(ctx, branchIds, plan.reparent); err != nil {
+		// A reparent close has a single dataset, promoting it again gives its snapshots back
+		if plan.promote != "" {
+			if err := s.zfs.Promote(context.WithoutCancel(ctx), plan.datasets[0]); err != nil {
+				log.Errorf("Can't undo promotion of %s: %s", plan.promote, err)
+			}
+		}
+
+		restart()
+		return err
+	}
+
+	return nil
+}
+
+func datasetBranchNames(poolName string, datasets []string) []string {
+	names := make([]string, 0, len(datasets))
+
+	for _, dataset := range datasets {
+		names = append(names, strings.TrimPrefix(dataset, poolName+"/"))
+	}
+
+	return names
+}
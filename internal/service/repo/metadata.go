@@ -0,0 +1,316 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"slices"
+	"strings"
+	"time"
+)
+
+type selectorOp int
+
+const (
+	selectorEquals selectorOp = iota
+	selectorNotEquals
+	selectorExists
+)
+
+type selectorTerm struct {
+	key   string
+	value string
+	op    selectorOp
+}
+
+// Selector matches labels the way "ci=true,team!=core,temporary" reads: every term has to match,
+// a bare key only needs the label to be set
+type Selector []selectorTerm
+
+func ParseSelector(selector string) (Selector, error) {
+	var terms Selector
+
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var parsed selectorTerm
+
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			parsed = selectorTerm{key: key, value: value, op: selectorNotEquals}
+		} else if key, value, ok := strings.Cut(term, "="); ok {
+			parsed = selectorTerm{key: key, value: value, op: selectorEquals}
+		} else {
+			parsed = selectorTerm{key: term, op: selectorExists}
+		}
+
+		parsed.key = strings.TrimSpace(parsed.key)
+		parsed.value = strings.TrimSpace(parsed.value)
+
+		if !validation.IsLabelKey(parsed.key) {
+			return nil, responseerror.From(fmt.Sprintf("Invalid label selector: %s", term))
+		}
+
+		terms = append(terms, parsed)
+	}
+
+	return terms, nil
+}
+
+func (selector Selector) Matches(labels map[string]string) bool {
+	for _, term := range selector {
+		value, ok := labels[term.key]
+
+		switch term.op {
+		case selectorEquals:
+			if !ok || value != term.value {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == term.value {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Labels decodes the stored labels, it's never nil
+func Labels(raw *string) map[string]string {
+	labels := map[string]string{}
+
+	if raw == nil || *raw == "" {
+		return labels
+	}
+
+	if err := json.Unmarshal([]byte(*raw), &labels); err != nil {
+		log.Errorf("Can't decode labels %s: %s", *raw, err)
+		return map[string]string{}
+	}
+
+	return labels
+}
+
+// BranchFilter picks branches out of a listing, the zero value matches every branch
+type BranchFilter struct {
+	Owner    string
+	Status   string
+	Selector Selector
+}
+
+func (filter BranchFilter) Matches(branch model.Branch) bool {
+	if filter.Owner != "" && (branch.Owner == nil || *branch.Owner != filter.Owner) {
+		return false
+	}
+
+	if filter.Status != "" && branch.Status != filter.Status {
+		return false
+	}
+
+	return filter.Selector.Matches(Labels(branch.Labels))
+}
+
+func FilterBranches(branches []model.Branch, filter BranchFilter) []model.Branch {
+	var filtered []model.Branch
+
+	for _, branch := range branches {
+		if filter.Matches(branch) {
+			filtered = append(filtered, branch)
+		}
+	}
+
+	return filtered
+}
+
+// MatchesRepo tells whether the repo has the owner and labels, an empty owner matches every repo
+func MatchesRepo(repoInfo model.Repo, owner string, selector Selector) bool {
+	if owner != "" && (repoInfo.Owner == nil || *repoInfo.Owner != owner) {
+		return false
+	}
+
+	return selector.Matches(Labels(repoInfo.Labels))
+}
+
+func UpdateBranchMetadata(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	branchName string,
+	metadata repo.Metadata,
+) (model.Branch, error) {
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if err != nil {
+		log.Errorf("Can't get branch: %s", err)
+		return model.Branch{}, responseerror.From("Branch not found")
+	}
+
+	if err := applyMetadata(metadata, &branch.Owner, &branch.Description, &branch.Labels); err != nil {
+		return model.Branch{}, err
+	}
+
+	return db.UpdateBranchMetadata(ctx, branch)
+}
+
+func UpdateRepoMetadata(ctx context.Context, repoDetail db.RepoDetail, metadata repo.Metadata) (model.Repo, error) {
+	repoInfo := repoDetail.Repo
+
+	if err := applyMetadata(metadata, &repoInfo.Owner, &repoInfo.Description, &repoInfo.Labels); err != nil {
+		return model.Repo{}, err
+	}
+
+	return db.UpdateRepoMetadata(ctx, repoInfo)
+}
+
+// BulkCloseBranches closes every open branch matched by the selector. The newest branches are
+// closed first as forks are always newer than the branch they're forked from, a failure doesn't
+// stop the others.
+func (s *Service) BulkCloseBranches(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	bulkClose repo.BranchBulkClose,
+) (repo.BranchBulkCloseResponse, error) {
+
+	selector, err := ParseSelector(bulkClose.Selector)
+	if err != nil {
+		return repo.BranchBulkCloseResponse{}, err
+	}
+
+	if len(selector) == 0 {
+		return repo.BranchBulkCloseResponse{}, responseerror.From("Label selector is required")
+	}
+
+	filter := BranchFilter{
+		Owner:    bulkClose.Owner,
+		Status:   string(db.BranchOpen),
+		Selector: selector,
+	}
+
+	createdBefore := time.Now().UTC().Add(-time.Duration(bulkClose.OlderThanHours) * time.Hour)
+
+	var matched []model.Branch
+	for _, branch := range FilterBranches(repoDetail.Branches, filter) {
+		if branch.Name == "main" || branch.CreatedAt.After(createdBefore) {
+			continue
+		}
+
+		if bulkClose.OwnerTokenID != nil &&
+			(branch.OwnerTokenID == nil || *branch.OwnerTokenID != *bulkClose.OwnerTokenID) {
+			continue
+		}
+
+		matched = append(matched, branch)
+	}
+
+	slices.SortFunc(matched, func(a, b model.Branch) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	response := repo.BranchBulkCloseResponse{
+		DryRun:  bulkClose.DryRun,
+		Matched: []string{},
+		Closed:  []string{},
+		Failed:  []repo.BranchBulkError{},
+	}
+
+	for _, branch := range matched {
+		response.Matched = append(response.Matched, branch.Name)
+	}
+
+	if bulkClose.DryRun {
+		return response, nil
+	}
+
+	for _, branch := range matched {
+		// Closing a branch can change its relatives, the repo is reloaded for every branch
+		currentDetail, err := db.GetRepo(ctx, int64(*repoDetail.Repo.ID))
+		if err != nil {
+			return repo.BranchBulkCloseResponse{}, err
+		}
+
+		// Cascading closes might have closed it already
+		stillOpen := slices.ContainsFunc(currentDetail.Branches, func(repoBranch model.Branch) bool {
+			return *repoBranch.ID == *branch.ID && repoBranch.Status == string(db.BranchOpen)
+		})
+
+		if !stillOpen {
+			continue
+		}
+
+		branchClose := repo.BranchClose{
+			Name: branch.Name,
+			Mode: bulkClose.Mode,
+		}
+
+		closeResponse, err := s.CloseBranch(ctx, currentDetail, branchClose)
+		if err != nil {
+			response.Failed = append(response.Failed, repo.BranchBulkError{Branch: branch.Name, Error: err.Error()})
+			continue
+		}
+
+		response.Closed = append(response.Closed, closeResponse.Closed...)
+	}
+
+	log.Infof(
+		"Bulk closed %d branches of repo %s with selector %s",
+		len(response.Closed), repoDetail.Repo.Name, bulkClose.Selector,
+	)
+
+	return response, nil
+}
+
+// applyMetadata sets the fields that are present in the update, empty values clear them
+func applyMetadata(metadata repo.Metadata, owner, description, labels **string) error {
+	if metadata.Owner != nil {
+		*owner = emptyToNil(*metadata.Owner)
+	}
+
+	if metadata.Description != nil {
+		*description = emptyToNil(*metadata.Description)
+	}
+
+	if metadata.Labels != nil {
+		encoded, err := encodeLabels(metadata.Labels)
+		if err != nil {
+			return err
+		}
+
+		*labels = encoded
+	}
+
+	return nil
+}
+
+func encodeLabels(labels map[string]string) (*string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(labels)
+	if err != nil {
+		log.Errorf("Can't encode labels: %s", err)
+		return nil, err
+	}
+
+	value := string(encoded)
+	return &value, nil
+}
+
+func emptyToNil(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"sort"
+	"strings"
+)
+
+// DatasetProperties reads the effective ZFS properties of the pool root and every branch dataset,
+// including the WAL datasets.
+func (s *Service) DatasetProperties(ctx context.Context, repoDetail db.RepoDetail) ([]repo.DatasetPropertiesResponse, error) {
+	poolName := repoDetail.Pool.Name
+
+	datasetProperties, err := s.zfs.ListDatasetProperties(ctx, poolName)
+	if err != nil {
+		return nil, responseerror.From("Failed to get dataset properties")
+	}
+
+	branchNames := make(map[string]string)
+	for _, branch := range repoDetail.Branches {
+		branchNames[zfs.DatasetName(poolName, branch.Name)] = branch.Name
+	}
+
+	datasets := make([]string, 0, len(datasetProperties))
+	for dataset := range datasetProperties {
+		datasets = append(datasets, dataset)
+	}
+	sort.Strings(datasets)
+
+	response := make([]repo.DatasetPropertiesResponse, 0, len(datasets))
+
+	for _, dataset := range datasets {
+		properties := make(map[string]repo.DatasetProperty)
+		for name, property := range datasetProperties[dataset] {
+			properties[name] = repo.DatasetProperty{Value: property.Value, Source: property.Source}
+		}
+
+		datasetResponse := repo.DatasetPropertiesResponse{
+			Dataset:    dataset,
+			Properties: properties,
+		}
+
+		// Child datasets like pg_wal belong to the branch they're mounted in
+		branchDataset := dataset
+		if rest, ok := strings.CutPrefix(dataset, poolName+"/"); ok {
+			component, _, _ := strings.Cut(rest, "/")
+			branchDataset = zfs.DatasetName(poolName, component)
+		}
+
+		if branchName, ok := branchNames[branchDataset]; ok {
+			datasetResponse.Branch = &branchName
+		}
+
+		response = append(response, datasetResponse)
+	}
+
+	return response, nil
+}
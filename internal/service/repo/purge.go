@@ -0,0 +1,149 @@
+package repo
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/event"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/audit"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"time"
+)
+
+// StartPurge destroys the datasets of closed branches once their retention period is over. It
+// blocks until the context is cancelled, so it SHOULD always be called as a goroutine.
+func (s *Service) StartPurge(ctx context.Context) {
+	interval := time.Duration(opts.Config.Branch.PurgeIntervalMinutes) * time.Minute
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("Started branch purge, retention: %s, interval: %s", retention(), interval)
+
+	for {
+		s.PurgeExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Info("Root context cancelled. Stopping branch purge")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) PurgeExpired(ctx context.Context) {
+	repoDetails, err := db.ListRepoWithStatus(ctx, db.ActiveRepoStatuses...)
+	if err != nil {
+		log.Errorf("Failed to list repos for purge: %s", err)
+		return
+	}
+
+	expiredBefore := time.Now().UTC().Add(-retention())
+
+	for _, repoDetail := range repoDetails {
+		var expired []model.Branch
+
+		for _, branch := range repoDetail.Branches {
+			if branch.Status == string(db.BranchClosed) &&
+				branch.ClosedAt != nil &&
+				branch.ClosedAt.Before(expiredBefore) {
+
+				expired = append(expired, branch)
+			}
+		}
+
+		if len(expired) == 0 {
+			continue
+		}
+
+		origins, err := s.zfs.ListOrigins(ctx, repoDetail.Pool.Name)
+		if err != nil {
+			log.Errorf("Failed to list origins for repo %s: %s", repoDetail.Repo.Name, err)
+			continue
+		}
+
+		// A dataset can't be destroyed while it has clones, so branches are purged in passes until
+		// only the ones with live dependents are left. Those are retried on the next run.
+		purged := make(map[int32]bool)
+
+		for progress := true; progress; {
+			progress = false
+
+			for _, branch := range expired {
+				if purged[*branch.ID] {
+					continue
+				}
+
+				ok, err := s.purgeBranch(ctx, repoDetail, branch, origins)
+				if ok || err != nil {
+					audit.RecordSystem(ctx, "branch.purge", repoDetail.Repo.Name+"/"+branch.Name, nil, err)
+				}
+
+				if err != nil {
+					log.Errorf("Failed to purge branch %s of repo %s: %s", branch.Name, repoDetail.Repo.Name, err)
+					continue
+				}
+
+				if ok {
+					purged[*branch.ID] = true
+					progress = true
+				}
+			}
+		}
+	}
+}
+
+func (s *Service) purgeBranch(ctx context.Context, repoDetail db.RepoDetail, branch model.Branch, origins map[string]string) (bool, error) {
+	dataset := zfs.DatasetName(repoDetail.Pool.Name, branch.Name)
+
+	for clone, origin := range origins {
+		if zfs.SnapshotDataset(origin) == dataset {
+			log.Infof("Branch %s can't be purged yet, dataset %s is cloned from it", branch.Name, clone)
+			return false, nil
+		}
+	}
+
+	log.Infof("Purging closed branch %s of repo %s", branch.Name, repoDetail.Repo.Name)
+
+	if err := s.zfs.Destroy(ctx, dataset, true); err != nil {
+		return false, err
+	}
+
+	forkSnapshot, hasOrigin := origins[dataset]
+	delete(origins, dataset)
+
+	if hasOrigin && !hasClone(origins, forkSnapshot) {
+		if err := s.zfs.Destroy(ctx, forkSnapshot, true); err != nil {
+			log.Errorf("Failed to destroy fork snapshot %s: %s", forkSnapshot, err)
+		}
+	}
+
+	if err := db.UpdateBranchStatus(ctx, *branch.ID, db.BranchPurged); err != nil {
+		return false, err
+	}
+
+	pg.RemoveServerCert(*branch.ID)
+
+	event.Publish(event.BranchExpired, repoDetail.Repo.Name, branch.Name, event.BranchExpiredData{
+		BranchID: *branch.ID,
+		ClosedAt: branch.ClosedAt,
+	})
+
+	return true, nil
+}
+
+func hasClone(origins map[string]string, snapshot string) bool {
+	for _, origin := range origins {
+		if origin == snapshot {
+			return true
+		}
+	}
+
+	return false
+}
+
+func retention() time.Duration {
+	return time.Duration(opts.Config.Branch.RetentionHours) * time.Hour
+}
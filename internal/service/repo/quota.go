@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+)
+
+// SetBranchQuota replaces the storage limits of an open branch
+func (s *Service) SetBranchQuota(
+	ctx context.Context,
+	repoDetail db.RepoDetail,
+	branchName string,
+	quota repo.Quota,
+) (model.Branch, error) {
+
+	branch, err := db.GetBranchByName(ctx, *repoDetail.Repo.ID, branchName)
+	if err != nil {
+		return model.Branch{}, responseerror.From("Invalid Branch Name")
+	}
+
+	if branch.Status != string(db.BranchOpen) {
+		return model.Branch{}, responseerror.From("Branch is not open")
+	}
+
+	if err := s.zfs.SetQuota(ctx, zfs.DatasetName(repoDetail.Pool.Name, branch.Name), quota); err != nil {
+		return model.Branch{}, responseerror.From("Failed to set quota, it might be lower than the used space")
+	}
+
+	setBranchQuota(&branch, quota)
+
+	return db.UpdateBranchQuota(ctx, branch)
+}
+
+// SetRepoDefaultQuota replaces the limits new branches get. Existing branches keep their limits.
+func SetRepoDefaultQuota(ctx context.Context, repoDetail db.RepoDetail, quota repo.Quota) (model.Repo, error) {
+	repoInfo := repoDetail.Repo
+
+	repoInfo.DefaultQuotaInMb = quota.QuotaInMb
+	repoInfo.DefaultRefquotaInMb = quota.RefquotaInMb
+	repoInfo.DefaultReservationInMb = quota.ReservationInMb
+
+	return db.UpdateRepoDefaultQuota(ctx, repoInfo)
+}
+
+func BranchQuota(branch model.Branch) repo.Quota {
+	return repo.Quota{
+		QuotaInMb:       branch.QuotaInMb,
+		RefquotaInMb:    branch.RefquotaInMb,
+		ReservationInMb: branch.ReservationInMb,
+	}
+}
+
+func RepoDefaultQuota(repoInfo model.Repo) repo.Quota {
+	return repo.Quota{
+		QuotaInMb:       repoInfo.DefaultQuotaInMb,
+		RefquotaInMb:    repoInfo.DefaultRefquotaInMb,
+		ReservationInMb: repoInfo.DefaultReservationInMb,
+	}
+}
+
+func setBranchQuota(branch *model.Branch, quota repo.Quota) {
+	branch.QuotaInMb = quota.QuotaInMb
+	branch.RefquotaInMb = quota.RefquotaInMb
+	branch.ReservationInMb = quota.ReservationInMb
+}
@@ -8,20 +8,69 @@ import (
 	"github.com/jamius19/postbranch/internal/dto/pg"
 	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
 	"github.com/jamius19/postbranch/internal/logger"
-	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/service/job"
 	pgSvc "github.com/jamius19/postbranch/internal/service/pg"
 	"github.com/jamius19/postbranch/internal/service/zfs"
 	"github.com/jamius19/postbranch/web/responseerror"
 	"os"
+	"sync"
 )
 
 var log = logger.Logger
 
-func InitializeRepo(ctx context.Context, repoInit repoDto.Info, pgInfo pg.Info) (model.Repo, model.ZfsPool, error) {
+// repoLocks has a mutex per repo id. It's held while the datasets of the repo are changed outside
+// of a job, the reconciler would take them for drift otherwise.
+var repoLocks sync.Map
+
+func repoLock(repoId int32) *sync.Mutex {
+	lock, _ := repoLocks.LoadOrStore(repoId, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// LockRepo waits until the datasets of the repo can be changed, the returned func unlocks it
+func LockRepo(repoId int32) func() {
+	lock := repoLock(repoId)
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+// TryLockRepo locks the repo unless its datasets are being changed
+func TryLockRepo(repoId int32) (func(), bool) {
+	lock := repoLock(repoId)
+	if !lock.TryLock() {
+		return nil, false
+	}
+
+	return lock.Unlock, true
+}
+
+// Service manages the repos and their branches on top of ZFS
+type Service struct {
+	zfs *zfs.Zfs
+}
+
+func NewService(zfs *zfs.Zfs) *Service {
+	return &Service{zfs: zfs}
+}
+
+func (s *Service) InitializeRepo(ctx context.Context, repoInit repoDto.Info, pgInfo pg.Info) (model.Repo, model.ZfsPool, error) {
+	if encryption := repoInit.GetEncryption(); encryption != nil {
+		if encryption.KeyFile == "" && encryption.Passphrase == "" {
+			return model.Repo{}, model.ZfsPool{}, responseerror.From("Encryption needs a key file or a passphrase")
+		}
+
+		if encryption.KeyFile != "" {
+			if _, err := os.Stat(encryption.KeyFile); err != nil {
+				return model.Repo{}, model.ZfsPool{}, responseerror.From("Encryption key file does not exist")
+			}
+		}
+	}
+
 	if repoInit.GetRepoType() == "virtual" {
 		log.Infof("Initializing virtual repo")
 
-		pool, err := zfs.VirtualPool(ctx, repoInit)
+		pool, err := s.zfs.VirtualPool(ctx, repoInit)
 		if err != nil {
 			return model.Repo{}, model.ZfsPool{}, err
 		}
@@ -35,6 +84,15 @@ func InitializeRepo(ctx context.Context, repoInit repoDto.Info, pgInfo pg.Info)
 			Version: pgInfo.GetVersion(),
 			Status:  string(db.RepoStarted),
 			Adapter: string(pgInfo.GetAdapter()),
+
+			DefaultQuotaInMb:       repoInit.GetDefaultQuota().QuotaInMb,
+			DefaultRefquotaInMb:    repoInit.GetDefaultQuota().RefquotaInMb,
+			DefaultReservationInMb: repoInit.GetDefaultQuota().ReservationInMb,
+		}
+
+		err = applyMetadata(repoInit.GetMetadata(), &repoInfo.Owner, &repoInfo.Description, &repoInfo.Labels)
+		if err != nil {
+			return model.Repo{}, model.ZfsPool{}, err
 		}
 
 		createdRepo, err := db.CreateRepo(ctx, repoInfo)
@@ -50,16 +108,44 @@ func InitializeRepo(ctx context.Context, repoInit repoDto.Info, pgInfo pg.Info)
 	return model.Repo{}, model.ZfsPool{}, fmt.Errorf("not implemented yet")
 }
 
-func DeleteRepo(ctx context.Context, repoDetail db.RepoDetail) error {
+// ResizePool grows the virtual pool of the repo in a resize job
+func (s *Service) ResizePool(repoDetail db.RepoDetail, sizeInMb int64) (model.Job, error) {
+	if err := zfs.CheckResize(repoDetail.Pool, sizeInMb); err != nil {
+		return model.Job{}, err
+	}
+
+	return job.Run(db.JobResizePool, repoDetail.Repo.Name, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		tracker.Step("Resizing pool", 0)
+
+		pool, err := s.zfs.ResizeVirtualPool(ctx, repoDetail.Pool, sizeInMb)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Pool %s resized to %d MB", pool.Name, pool.SizeInMb), nil
+	})
+}
+
+func (s *Service) DeleteRepo(ctx context.Context, repoDetail db.RepoDetail) error {
 	log.Infof("Deleting repo: %s, pool: %s", repoDetail.Repo.Name, repoDetail.Pool.Path)
+
+	// A half deleted repo can't be used anymore, so the delete isn't stopped with the request
+	ctx = context.WithoutCancel(ctx)
+
 	pool := repoDetail.Pool
 
+	// Started branches get a new certificate anyway, so they're removed even if the delete fails
+	for _, branch := range repoDetail.Branches {
+		pgSvc.RemoveServerCert(*branch.ID)
+	}
+
 	if _, err := os.Stat(pool.Path); os.IsNotExist(err) {
 		log.Warnf("Pool file does not exist for pool %v: %s", pool, err)
 
 		log.Infof("Trying to stop pg instances, expect failure")
 		for _, branch := range repoDetail.Branches {
 			_ = pgSvc.StopPg(
+				ctx,
 				repoDetail.Repo.PgPath,
 				pool.MountPath,
 				branch.Name,
@@ -68,9 +154,7 @@ func DeleteRepo(ctx context.Context, repoDetail db.RepoDetail) error {
 		}
 
 		log.Infof("Trying to destroy pool %s anyway, expect failure", pool.Name)
-		_, err = runner.Single(
-			"zpool-destroy", false, false, "zpool", "destroy", "-f", pool.Name,
-		)
+		_ = s.zfs.DestroyPool(ctx, pool.Name)
 
 		if err := os.RemoveAll(pool.MountPath); err != nil {
 			return fmt.Errorf("failed to remove mount path: %w", err)
@@ -85,7 +169,12 @@ func DeleteRepo(ctx context.Context, repoDetail db.RepoDetail) error {
 	}
 
 	for _, branch := range repoDetail.Branches {
+		if branch.Status != string(db.BranchOpen) {
+			continue
+		}
+
 		err := pgSvc.StopPg(
+			ctx,
 			repoDetail.Repo.PgPath,
 			pool.MountPath,
 			branch.Name,
@@ -97,26 +186,18 @@ func DeleteRepo(ctx context.Context, repoDetail db.RepoDetail) error {
 		}
 	}
 
-	loopbackPath, err := zfs.FindDevicePath(pool.Name)
+	loopbackPath, err := s.zfs.FindDevicePath(ctx, pool.Name)
 	if err != nil {
 		return err
 	}
 
-	_, err = runner.Single(
-		"zpool-destroy", false, false, "zpool", "destroy", "-f", pool.Name,
-	)
-
-	if err != nil {
+	if err := s.zfs.DestroyPool(ctx, pool.Name); err != nil {
 		return fmt.Errorf("failed to destroy pool: %s", err)
 	}
 
 	if pool.PoolType == "virtual" {
-		if err := zfs.ReleaseLoopDevice(loopbackPath); err != nil {
-			return fmt.Errorf("failed to release loopback device: %s", err)
-		}
-
-		if err := os.Remove(loopbackPath); err != nil {
-			return fmt.Errorf("failed to remove loopback device: %w", err)
+		if err := s.zfs.RemoveLoopDevice(loopbackPath); err != nil {
+			return err
 		}
 
 		if err := os.Remove(pool.Path); err != nil {
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	storageCheckInterval = time.Minute
+
+	// A branch with less than this much space left can't do any meaningful work anymore
+	lowSpaceInBytes = 1024 * 1024
+
+	// Only the end of the newest log file is read, older ENOSPC errors don't matter
+	logTailInBytes = 64 * 1024
+)
+
+var (
+	noSpaceMarkers = [][]byte{[]byte("No space left on device"), []byte("Disk quota exceeded")}
+	pgReadyMarker  = []byte("database system is ready to accept connections")
+)
+
+// StartStorageMonitor flags branches that ran out of space. It blocks until the context is
+// cancelled, so it SHOULD always be called as a goroutine.
+func (s *Service) StartStorageMonitor(ctx context.Context) {
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+
+	log.Info("Started branch storage monitor")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Root context cancelled. Stopping branch storage monitor")
+			return
+		case <-ticker.C:
+			s.CheckStorage(ctx)
+		}
+	}
+}
+
+func (s *Service) CheckStorage(ctx context.Context) {
+	repoDetails, err := db.ListRepoWithStatus(ctx, db.ActiveRepoStatuses...)
+	if err != nil {
+		log.Errorf("Failed to list repos for storage check: %s", err)
+		return
+	}
+
+	for _, repoDetail := range repoDetails {
+		datasetUsages, err := s.zfs.ListDatasetUsage(ctx, repoDetail.Pool.Name)
+		if err != nil {
+			log.Errorf("Failed to get dataset usage for repo %s: %s", repoDetail.Repo.Name, err)
+			continue
+		}
+
+		for _, branch := range repoDetail.Branches {
+			if branch.Status != string(db.BranchOpen) {
+				continue
+			}
+
+			usage, ok := datasetUsages[zfs.DatasetName(repoDetail.Pool.Name, branch.Name)]
+			if !ok {
+				continue
+			}
+
+			storageError := branchStorageError(repoDetail, branch, usage)
+			if equalStorageError(storageError, branch.StorageError) {
+				continue
+			}
+
+			if storageError != nil {
+				log.Warnf("Branch %s of repo %s is out of space: %s", branch.Name, repoDetail.Repo.Name, *storageError)
+			} else {
+				log.Infof("Branch %s of repo %s has space again", branch.Name, repoDetail.Repo.Name)
+			}
+
+			if err := db.UpdateBranchStorageError(ctx, *branch.ID, storageError); err != nil {
+				log.Errorf("Failed to update storage error of branch %s: %s", branch.Name, err)
+			}
+		}
+	}
+}
+
+// branchStorageError returns why the branch is out of space, or nil if it isn't. The space left in
+// the dataset is checked first. Postgres logs are checked as well, since an ENOSPC crash is still
+// relevant after some space was freed, until Postgres is restarted.
+func branchStorageError(repoDetail db.RepoDetail, branch model.Branch, usage zfs.DatasetUsage) *string {
+	var storageError string
+
+	if usage.Available < lowSpaceInBytes {
+		switch {
+		case branch.RefquotaInMb != nil && usage.Referenced >= *branch.RefquotaInMb*1024*1024-lowSpaceInBytes:
+			storageError = fmt.Sprintf("Refquota of %d MB reached", *branch.RefquotaInMb)
+		case branch.QuotaInMb != nil:
+			storageError = fmt.Sprintf("Quota of %d MB reached", *branch.QuotaInMb)
+		default:
+			storageError = fmt.Sprintf("Pool %s is out of space", repoDetail.Pool.Name)
+		}
+	}
+
+	if line := lastNoSpaceLogLine(filepath.Join(repoDetail.Pool.MountPath, branch.Name, "logs")); line != "" {
+		if storageError == "" {
+			storageError = "Postgres ran out of space"
+		}
+
+		storageError = fmt.Sprintf("%s: %s", storageError, line)
+	}
+
+	if storageError == "" {
+		return nil
+	}
+
+	return &storageError
+}
+
+// lastNoSpaceLogLine returns the last ENOSPC error in the newest Postgres log, as long as Postgres
+// hasn't been started successfully after it.
+func lastNoSpaceLogLine(logPath string) string {
+	logFiles, err := filepath.Glob(filepath.Join(logPath, "*.log"))
+	if err != nil || len(logFiles) == 0 {
+		return ""
+	}
+
+	var newestFile string
+	var newestModTime time.Time
+
+	for _, logFile := range logFiles {
+		info, err := os.Stat(logFile)
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().After(newestModTime) {
+			newestFile = logFile
+			newestModTime = info.ModTime()
+		}
+	}
+
+	tail, err := readTail(newestFile, logTailInBytes)
+	if err != nil {
+		return ""
+	}
+
+	lines := bytes.Split(tail, []byte("\n"))
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		if bytes.Contains(lines[i], pgReadyMarker) {
+			return ""
+		}
+
+		for _, marker := range noSpaceMarkers {
+			if bytes.Contains(lines[i], marker) {
+				return strings.TrimSpace(string(lines[i]))
+			}
+		}
+	}
+
+	return ""
+}
+
+func readTail(path string, size int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := max(info.Size()-size, 0)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(file)
+}
+
+func equalStorageError(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return *a == *b
+}
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/health"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"sync"
+)
+
+// UnlockRepo loads the key of a locked repo and starts its open branches in an unlock job
+func (s *Service) UnlockRepo(ctx context.Context, repoDetail db.RepoDetail, unlock repo.Unlock) (model.Repo, model.Job, error) {
+	if repoDetail.Repo.Status != string(db.RepoLocked) {
+		return model.Repo{}, model.Job{}, responseerror.From("Repository is not locked")
+	}
+
+	if !zfs.HasKeyFile(repoDetail.Pool) && unlock.Passphrase == "" {
+		return model.Repo{}, model.Job{}, responseerror.From("Passphrase is required")
+	}
+
+	if err := s.zfs.LoadKey(ctx, repoDetail.Pool, unlock.Passphrase); err != nil {
+		return model.Repo{}, model.Job{}, responseerror.From("Failed to unlock repository, is the key correct?")
+	}
+
+	// The warning of a degraded pool was replaced by the lock, it's brought back right away
+	repoStatus, output := db.RepoCompleted, ""
+	if poolStatus, err := s.zfs.GetPoolStatus(ctx, repoDetail.Pool.Name); err == nil {
+		repoStatus, output = health.RepoStatus(poolStatus)
+	} else {
+		log.Errorf("Can't get status of pool %s, the next health check updates it: %s", repoDetail.Pool.Name, err)
+	}
+
+	unlockedRepo, err := db.UpdateRepoStatus(ctx, *repoDetail.Repo.ID, repoStatus, output)
+	if err != nil {
+		return model.Repo{}, model.Job{}, err
+	}
+
+	unlockJob, err := job.Run(db.JobUnlock, repoDetail.Repo.Name, func(ctx context.Context, tracker *job.Tracker) (string, error) {
+		return "", startUnlockedBranches(ctx, tracker, repoDetail)
+	})
+
+	if err != nil {
+		return model.Repo{}, model.Job{}, err
+	}
+
+	log.Infof("Unlocked repo %s", repoDetail.Repo.Name)
+	return unlockedRepo, unlockJob, nil
+}
+
+// startUnlockedBranches starts the open branches of the repo together, the job progresses as
+// each of them is up
+func startUnlockedBranches(ctx context.Context, tracker *job.Tracker, repoDetail db.RepoDetail) error {
+	var openBranches []model.Branch
+	for _, branch := range repoDetail.Branches {
+		if branch.Status == string(db.BranchOpen) {
+			openBranches = append(openBranches, branch)
+		}
+	}
+
+	tracker.Step("Starting branches", 0)
+
+	var (
+		branchWg sync.WaitGroup
+		mu       sync.Mutex
+		started  int64
+		errs     []error
+	)
+
+	for _, branch := range openBranches {
+		branchWg.Add(1)
+
+		go func() {
+			defer branchWg.Done()
+
+			err := pg.StartPg(ctx, repoDetail.Repo.PgPath, repoDetail.Pool.MountPath, branch.Name, *branch.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.Errorf("Failed to start postgres for branch: %s, error: %v", branch.Name, err)
+				errs = append(errs, fmt.Errorf("branch %s: %w", branch.Name, err))
+			}
+
+			started++
+			tracker.Progress(started * 100 / int64(len(openBranches)))
+		}()
+	}
+
+	branchWg.Wait()
+	log.Infof("Started branches of unlocked repo %s", repoDetail.Repo.Name)
+
+	return errors.Join(errs...)
+}
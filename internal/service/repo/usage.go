@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"sort"
+	"strings"
+)
+
+// Usage reads the live pool and dataset usage of the repo. Branches and snapshots are sorted by the
+// space they use, largest first.
+func (s *Service) Usage(ctx context.Context, repoDetail db.RepoDetail) (repo.Usage, error) {
+	if !db.IsRepoActive(repoDetail.Repo.Status) {
+		return repo.Usage{}, responseerror.From("Repository is not ready")
+	}
+
+	poolName := repoDetail.Pool.Name
+
+	poolUsage, err := s.zfs.GetPoolUsage(ctx, poolName)
+	if err != nil {
+		return repo.Usage{}, responseerror.From("Failed to get pool usage")
+	}
+
+	datasetUsages, err := s.zfs.ListDatasetUsage(ctx, poolName)
+	if err != nil {
+		return repo.Usage{}, responseerror.From("Failed to get dataset usage")
+	}
+
+	origins, err := s.zfs.ListOrigins(ctx, poolName)
+	if err != nil {
+		return repo.Usage{}, responseerror.From("Failed to get dataset origins")
+	}
+
+	usage := repo.Usage{
+		Pool: repo.PoolUsage{
+			SizeInBytes:          poolUsage.Size,
+			AllocatedInBytes:     poolUsage.Allocated,
+			FreeInBytes:          poolUsage.Free,
+			FragmentationPercent: poolUsage.Fragmentation,
+		},
+		Branches:  []repo.BranchUsage{},
+		Snapshots: []repo.SnapshotUsage{},
+	}
+
+	branchNames := make(map[string]string)
+
+	for _, branch := range repoDetail.Branches {
+		dataset := zfs.DatasetName(poolName, branch.Name)
+		branchNames[dataset] = branch.Name
+
+		datasetUsage, ok := datasetUsages[dataset]
+		if !ok {
+			continue
+		}
+
+		usage.Branches = append(usage.Branches, repo.BranchUsage{
+			Branch:                 branch.Name,
+			Dataset:                dataset,
+			UsedInBytes:            datasetUsage.Used,
+			ReferencedInBytes:      datasetUsage.Referenced,
+			WrittenInBytes:         datasetUsage.Written,
+			UsedBySnapshotsInBytes: datasetUsage.UsedBySnapshots,
+			AvailableInBytes:       datasetUsage.Available,
+			CompressRatio:          datasetUsage.CompressRatio,
+		})
+	}
+
+	clones := make(map[string][]string)
+	for dataset, origin := range origins {
+		clone := dataset
+		if branchName, ok := branchNames[dataset]; ok {
+			clone = branchName
+		}
+
+		clones[origin] = append(clones[origin], clone)
+	}
+
+	for name, datasetUsage := range datasetUsages {
+		if !strings.Contains(name, "@") {
+			continue
+		}
+
+		snapshotClones := clones[name]
+		if snapshotClones == nil {
+			snapshotClones = []string{}
+		}
+		sort.Strings(snapshotClones)
+
+		usage.Snapshots = append(usage.Snapshots, repo.SnapshotUsage{
+			Name:              name,
+			Dataset:           zfs.SnapshotDataset(name),
+			UsedInBytes:       datasetUsage.Used,
+			ReferencedInBytes: datasetUsage.Referenced,
+			Clones:            snapshotClones,
+		})
+	}
+
+	sort.Slice(usage.Branches, func(i, j int) bool {
+		return usage.Branches[i].UsedInBytes > usage.Branches[j].UsedInBytes
+	})
+
+	sort.Slice(usage.Snapshots, func(i, j int) bool {
+		if usage.Snapshots[i].UsedInBytes == usage.Snapshots[j].UsedInBytes {
+			return usage.Snapshots[i].Name < usage.Snapshots[j].Name
+		}
+
+		return usage.Snapshots[i].UsedInBytes > usage.Snapshots[j].UsedInBytes
+	})
+
+	return usage, nil
+}
@@ -0,0 +1,41 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"regexp"
+	"strings"
+)
+
+// datasetComponentRegex follows the ZFS naming rules for a single dataset component. Slashes are
+// rejected as every branch is a direct child of its repo pool, and '@', '#' and '%' are reserved
+// by ZFS for snapshots, bookmarks and temporary names.
+var datasetComponentRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:-]*$`)
+
+func datasetComponent(fl validator.FieldLevel) bool {
+	return IsDatasetComponent(fl.Field().String())
+}
+
+func IsDatasetComponent(name string) bool {
+	return datasetComponentRegex.MatchString(name)
+}
+
+func datasetName(fl validator.FieldLevel) bool {
+	return IsDatasetName(fl.Field().String())
+}
+
+// IsDatasetName checks a full dataset name, a pool name followed by any number of components
+func IsDatasetName(name string) bool {
+	components := strings.Split(name, "/")
+
+	if !IsPoolName(components[0]) {
+		return false
+	}
+
+	for _, component := range components[1:] {
+		if !IsDatasetComponent(component) {
+			return false
+		}
+	}
+
+	return true
+}
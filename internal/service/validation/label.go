@@ -0,0 +1,17 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"regexp"
+)
+
+// labelKeyRegex allows the keys to be namespaced, e.g. "ci.example.com/pipeline"
+var labelKeyRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_./-]*[A-Za-z0-9])?$`)
+
+func labelKey(fl validator.FieldLevel) bool {
+	return IsLabelKey(fl.Field().String())
+}
+
+func IsLabelKey(key string) bool {
+	return labelKeyRegex.MatchString(key)
+}
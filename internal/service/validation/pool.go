@@ -0,0 +1,44 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"regexp"
+	"strings"
+)
+
+// poolNameRegex follows the naming rules of zpool create, pool names start with a letter and
+// can't have the '/', '@', '#' and '%' a dataset name uses for its parts
+var poolNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:-]*$`)
+
+// reservedPoolPrefixes are vdev types, zpool create reads a pool named after one as a vdev
+var reservedPoolPrefixes = []string{"mirror", "raidz", "draid", "spare"}
+
+// reservedPoolNames can't be used as a whole pool name, though longer names starting with them can
+var reservedPoolNames = []string{"log"}
+
+// diskNameRegex matches Solaris style disk names, which zpool create rejects as pool names
+var diskNameRegex = regexp.MustCompile(`^c[0-9]`)
+
+func poolName(fl validator.FieldLevel) bool {
+	return IsPoolName(fl.Field().String())
+}
+
+func IsPoolName(name string) bool {
+	if !poolNameRegex.MatchString(name) || diskNameRegex.MatchString(name) {
+		return false
+	}
+
+	for _, prefix := range reservedPoolPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+
+	for _, reserved := range reservedPoolNames {
+		if name == reserved {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package validation
+
+import "testing"
+
+func TestIsPoolName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"shop", true},
+		{"shop-db_1.prod:a", true},
+		{"logs", true},
+		{"1shop", false},
+		{"-shop", false},
+		{"mirror", false},
+		{"mirrored", false},
+		{"raidz2", false},
+		{"draid", false},
+		{"spare", false},
+		{"log", false},
+		{"c0t0d0", false},
+		{"c9", false},
+		{"cache", true},
+		{"shop/main", false},
+		{"shop@snap", false},
+		{"shop%", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		if got := IsPoolName(test.name); got != test.valid {
+			t.Errorf("IsPoolName(%q) = %v, want %v", test.name, got, test.valid)
+		}
+	}
+}
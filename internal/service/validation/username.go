@@ -0,0 +1,18 @@
+package validation
+
+import (
+	"github.com/go-playground/validator/v10"
+	"regexp"
+)
+
+// usernameRegex follows the portable user name rules of useradd, it can't start with a '-' so
+// that it's never read as an option
+var usernameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+func username(fl validator.FieldLevel) bool {
+	return IsUsername(fl.Field().String())
+}
+
+func IsUsername(name string) bool {
+	return usernameRegex.MatchString(name)
+}
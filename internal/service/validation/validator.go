@@ -12,10 +12,30 @@ func init() {
 	validate = validator.New()
 	log.Info("Initialized validator")
 
-	//err := validate.RegisterValidation("initCon", repo.InitValidation)
-	//if err != nil {
-	//	log.Fatalf("Failed to register custom validation function: %s", err)
-	//}
+	err := validate.RegisterValidation("dataset", datasetComponent)
+	if err != nil {
+		log.Fatalf("Failed to register custom validation function: %s", err)
+	}
+
+	err = validate.RegisterValidation("pool", poolName)
+	if err != nil {
+		log.Fatalf("Failed to register custom validation function: %s", err)
+	}
+
+	err = validate.RegisterValidation("datasetname", datasetName)
+	if err != nil {
+		log.Fatalf("Failed to register custom validation function: %s", err)
+	}
+
+	err = validate.RegisterValidation("username", username)
+	if err != nil {
+		log.Fatalf("Failed to register custom validation function: %s", err)
+	}
+
+	err = validate.RegisterValidation("label", labelKey)
+	if err != nil {
+		log.Fatalf("Failed to register custom validation function: %s", err)
+	}
 }
 
 func Validate(val any) error {
@@ -0,0 +1,432 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/webhook"
+	"github.com/jamius19/postbranch/internal/event"
+	"github.com/jamius19/postbranch/internal/logger"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lifecycle events sent to webhooks
+const (
+	BranchReady     = "branch.ready"
+	BranchFailed    = "branch.failed"
+	BranchExpired   = "branch.expired"
+	ImportSucceeded = "import.succeeded"
+	ImportFailed    = "import.failed"
+
+	// PingEvent is only sent when a webhook is tested, every webhook receives it
+	PingEvent = "ping"
+)
+
+const (
+	SignatureHeader = "X-PostBranch-Signature"
+	EventHeader     = "X-PostBranch-Event"
+	DeliveryHeader  = "X-PostBranch-Delivery"
+)
+
+const (
+	// maxAttempts gives up on a receiver after about a quarter of an hour of backoff
+	maxAttempts     = 6
+	retryBackoff    = 30 * time.Second
+	retryInterval   = 15 * time.Second
+	deliveryTimeout = 10 * time.Second
+	maxResponseBody = 4 * 1024
+)
+
+var log = logger.Logger
+
+var client = &http.Client{Timeout: deliveryTimeout}
+
+// inFlight keeps the retries from sending a delivery that is still being sent
+var inFlight sync.Map
+
+type Payload struct {
+	Event  string    `json:"event"`
+	Repo   string    `json:"repo,omitempty"`
+	Branch string    `json:"branch,omitempty"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// Start sends the webhooks of lifecycle events and retries the failed deliveries until the context is
+// cancelled. It SHOULD always be called as a goroutine.
+func Start(ctx context.Context) {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	filter := event.Filter{
+		Types: []event.Type{event.BranchPgStatus, event.BranchExpired, event.JobProgress},
+	}
+
+	subscription, _, _ := event.Subscribe(filter, 0)
+	defer func() {
+		event.Unsubscribe(subscription)
+	}()
+
+	var lastId int64
+
+	log.Info("Started webhook dispatcher")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Root context cancelled. Stopping webhook dispatcher")
+			return
+		case <-ticker.C:
+			retryDue(ctx)
+		case newEvent, ok := <-subscription.Events:
+			if !ok {
+				// The subscription is dropped when it falls behind, the missed events are still buffered
+				var missed []event.Event
+				subscription, missed, _ = event.Subscribe(filter, lastId)
+
+				for _, missedEvent := range missed {
+					lastId = missedEvent.ID
+					dispatch(ctx, missedEvent)
+				}
+
+				continue
+			}
+
+			lastId = newEvent.ID
+			dispatch(ctx, newEvent)
+		}
+	}
+}
+
+func Create(ctx context.Context, webhookInit webhook.Init) (model.Webhook, error) {
+	secret := webhookInit.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return model.Webhook{}, err
+		}
+
+		secret = generated
+	}
+
+	newWebhook := model.Webhook{
+		URL:     webhookInit.URL,
+		Secret:  secret,
+		Events:  strings.Join(webhookInit.Events, ","),
+		Repo:    webhookInit.Repo,
+		Enabled: webhookInit.Enabled == nil || *webhookInit.Enabled,
+	}
+
+	return db.CreateWebhook(ctx, newWebhook)
+}
+
+// Update replaces the settings of the webhook, the secret is kept when it's left empty
+func Update(ctx context.Context, existing model.Webhook, webhookInit webhook.Init) (model.Webhook, error) {
+	existing.URL = webhookInit.URL
+	existing.Events = strings.Join(webhookInit.Events, ",")
+	existing.Repo = webhookInit.Repo
+
+	if webhookInit.Secret != "" {
+		existing.Secret = webhookInit.Secret
+	}
+
+	if webhookInit.Enabled != nil {
+		existing.Enabled = *webhookInit.Enabled
+	}
+
+	return db.UpdateWebhook(ctx, existing)
+}
+
+// Events returns the lifecycle events the webhook is limited to, empty for all of them
+func Events(hook model.Webhook) []string {
+	if hook.Events == "" {
+		return []string{}
+	}
+
+	return strings.Split(hook.Events, ",")
+}
+
+// Ping sends a ping to the webhook right away, so a receiver can be tested without waiting for an event
+func Ping(ctx context.Context, hook model.Webhook) (model.WebhookDelivery, error) {
+	payload, err := json.Marshal(Payload{
+		Event: PingEvent,
+		Time:  time.Now().UTC(),
+		Data:  map[string]any{"webhookId": *hook.ID},
+	})
+
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	delivery, err := createDelivery(ctx, hook, PingEvent, string(payload), nil)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	return deliver(ctx, hook, delivery), nil
+}
+
+// Replay sends the payload of a past delivery again as a new delivery
+func Replay(ctx context.Context, hook model.Webhook, delivery model.WebhookDelivery) (model.WebhookDelivery, error) {
+	replayDelivery, err := createDelivery(ctx, hook, delivery.Event, delivery.Payload, delivery.ID)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	return deliver(ctx, hook, replayDelivery), nil
+}
+
+// Sign returns the signature of the payload, the hex encoded HMAC-SHA256 with the webhook secret
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func dispatch(ctx context.Context, newEvent event.Event) {
+	name, ok := lifecycleEvent(newEvent)
+	if !ok {
+		return
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event:  name,
+		Repo:   newEvent.Repo,
+		Branch: newEvent.Branch,
+		Time:   newEvent.Time,
+		Data:   newEvent.Data,
+	})
+
+	if err != nil {
+		log.Errorf("Can't marshal webhook payload of event %d: %s", newEvent.ID, err)
+		return
+	}
+
+	hooks, err := db.ListWebhooks(ctx)
+	if err != nil {
+		log.Errorf("Failed to list webhooks: %s", err)
+		return
+	}
+
+	for _, hook := range hooks {
+		if !subscribed(hook, name, newEvent.Repo) {
+			continue
+		}
+
+		delivery, err := createDelivery(ctx, hook, name, string(payload), nil)
+		if err != nil {
+			continue
+		}
+
+		go deliver(ctx, hook, delivery)
+	}
+}
+
+// lifecycleEvent maps the state changes PostBranch publishes to the events webhooks are sent for
+func lifecycleEvent(newEvent event.Event) (string, bool) {
+	switch newEvent.Type {
+	case event.BranchPgStatus:
+		data, ok := newEvent.Data.(event.BranchPgStatusData)
+		if !ok {
+			return "", false
+		}
+
+		switch db.BranchPgStatus(data.PgStatus) {
+		case db.BranchPgRunning:
+			return BranchReady, true
+		case db.BranchPgFailed:
+			return BranchFailed, true
+		}
+	case event.BranchExpired:
+		return BranchExpired, true
+	case event.JobProgress:
+		data, ok := newEvent.Data.(event.JobProgressData)
+		if !ok || db.JobType(data.Type) != db.JobImport {
+			return "", false
+		}
+
+		switch db.JobState(data.State) {
+		case db.JobSucceeded:
+			return ImportSucceeded, true
+		case db.JobFailed:
+			return ImportFailed, true
+		}
+	}
+
+	return "", false
+}
+
+func subscribed(hook model.Webhook, name, repo string) bool {
+	if !hook.Enabled {
+		return false
+	}
+
+	if hook.Repo != nil && *hook.Repo != repo {
+		return false
+	}
+
+	events := Events(hook)
+	return len(events) == 0 || slices.Contains(events, name)
+}
+
+func createDelivery(
+	ctx context.Context,
+	hook model.Webhook,
+	name, payload string,
+	replayOf *int32,
+) (model.WebhookDelivery, error) {
+
+	// The first attempt is made right away, this only picks it up again if PostBranch stops before that
+	nextAttemptAt := time.Now().UTC().Add(2 * deliveryTimeout)
+
+	delivery := model.WebhookDelivery{
+		WebhookID:     *hook.ID,
+		Event:         name,
+		Payload:       payload,
+		Status:        string(db.WebhookDeliveryPending),
+		NextAttemptAt: &nextAttemptAt,
+		ReplayOf:      replayOf,
+	}
+
+	return db.CreateWebhookDelivery(ctx, delivery)
+}
+
+// deliver makes one attempt at sending the delivery and schedules a retry if it fails
+func deliver(ctx context.Context, hook model.Webhook, delivery model.WebhookDelivery) model.WebhookDelivery {
+	if _, sending := inFlight.LoadOrStore(*delivery.ID, struct{}{}); sending {
+		return delivery
+	}
+
+	defer inFlight.Delete(*delivery.ID)
+
+	delivery.Attempts++
+	responseCode, responseBody, err := send(ctx, hook, delivery)
+
+	delivery.ResponseCode = responseCode
+	delivery.ResponseBody = responseBody
+	delivery.Error = nil
+	delivery.NextAttemptAt = nil
+
+	now := time.Now().UTC()
+
+	switch {
+	case err == nil:
+		delivery.Status = string(db.WebhookDeliverySucceeded)
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= maxAttempts:
+		message := err.Error()
+		delivery.Status = string(db.WebhookDeliveryFailed)
+		delivery.Error = &message
+
+		log.Errorf("Giving up on webhook delivery %d to %s: %s", *delivery.ID, hook.URL, err)
+	default:
+		message := err.Error()
+		nextAttemptAt := now.Add(retryBackoff << (delivery.Attempts - 1))
+		delivery.Error = &message
+		delivery.NextAttemptAt = &nextAttemptAt
+
+		log.Warnf("Webhook delivery %d to %s failed, retrying at %s: %s", *delivery.ID, hook.URL, nextAttemptAt, err)
+	}
+
+	// The result is recorded even when the request was cancelled by a shutdown
+	updatedDelivery, err := db.UpdateWebhookDelivery(context.WithoutCancel(ctx), delivery)
+	if err != nil {
+		return delivery
+	}
+
+	return updatedDelivery
+}
+
+func send(ctx context.Context, hook model.Webhook, delivery model.WebhookDelivery) (*int32, *string, error) {
+	payload := []byte(delivery.Payload)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "PostBranch-Webhook")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.Itoa(int(*delivery.ID)))
+	request.Header.Set(SignatureHeader, Sign(hook.Secret, payload))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxResponseBody))
+
+	responseCode := int32(response.StatusCode)
+	responseBody := string(body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return &responseCode, &responseBody, fmt.Errorf("receiver responded with %d", response.StatusCode)
+	}
+
+	return &responseCode, &responseBody, nil
+}
+
+func retryDue(ctx context.Context) {
+	deliveries, err := db.ListPendingWebhookDeliveries(ctx)
+	if err != nil || len(deliveries) == 0 {
+		return
+	}
+
+	hooks, err := db.ListWebhooks(ctx)
+	if err != nil {
+		log.Errorf("Failed to list webhooks: %s", err)
+		return
+	}
+
+	now := time.Now().UTC()
+
+	for _, delivery := range deliveries {
+		if delivery.NextAttemptAt != nil && delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		index := slices.IndexFunc(hooks, func(hook model.Webhook) bool {
+			return *hook.ID == delivery.WebhookID
+		})
+
+		if index < 0 || !hooks[index].Enabled {
+			message := "Webhook was disabled before the delivery succeeded"
+			delivery.Status = string(db.WebhookDeliveryFailed)
+			delivery.Error = &message
+			delivery.NextAttemptAt = nil
+
+			_, _ = db.UpdateWebhookDelivery(ctx, delivery)
+			continue
+		}
+
+		go deliver(ctx, hooks[index], delivery)
+	}
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Errorf("Can't generate webhook secret: %s", err)
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
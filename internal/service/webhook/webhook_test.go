@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/webhook"
+	"github.com/jamius19/postbranch/internal/opts"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// receiver records the requests it gets and answers with the queued status codes, 200 once they run out
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.requests = append(rc.requests, receivedRequest{header: r.Header.Clone(), body: body})
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status = rc.statuses[0]
+		rc.statuses = rc.statuses[1:]
+	}
+
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(http.StatusText(status)))
+}
+
+func (rc *receiver) received() []receivedRequest {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return append([]receivedRequest(nil), rc.requests...)
+}
+
+// setup creates a database and a webhook pointing at a receiver answering with the given statuses
+func setup(t *testing.T, statuses ...int) (*receiver, model.Webhook) {
+	t.Helper()
+
+	opts.Config = &opts.Opts{}
+	opts.Config.Database.Path = filepath.Join(t.TempDir(), "postbranch.sqlite")
+
+	t.Cleanup(db.Initialize())
+
+	rc := &receiver{statuses: statuses}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	hook, err := Create(context.Background(), webhook.Init{URL: server.URL, Secret: testSecret})
+	if err != nil {
+		t.Fatalf("can't create webhook: %s", err)
+	}
+
+	return rc, hook
+}
+
+func TestSignature(t *testing.T) {
+	rc, hook := setup(t)
+
+	delivery, err := Ping(context.Background(), hook)
+	if err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	if delivery.Status != string(db.WebhookDeliverySucceeded) {
+		t.Fatalf("delivery is %s, want %s", delivery.Status, db.WebhookDeliverySucceeded)
+	}
+
+	requests := rc.received()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+
+	// The check a receiver makes with its copy of the secret
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(requests[0].body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	got := requests[0].header.Get(SignatureHeader)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	if event := requests[0].header.Get(EventHeader); event != PingEvent {
+		t.Errorf("event header = %q, want %q", event, PingEvent)
+	}
+
+	if Sign("other secret", requests[0].body) == got {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rc, hook := setup(t, http.StatusServiceUnavailable, http.StatusInternalServerError)
+	ctx := context.Background()
+
+	delivery, err := Ping(ctx, hook)
+	if err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	// Every failed attempt doubles the wait before the next one
+	for attempt, backoff := range []time.Duration{retryBackoff, 2 * retryBackoff} {
+		if delivery.Status != string(db.WebhookDeliveryPending) || delivery.Attempts != int32(attempt+1) {
+			t.Fatalf("attempt %d: delivery is %s after %d attempts", attempt+1, delivery.Status, delivery.Attempts)
+		}
+
+		if delivery.ResponseCode == nil || *delivery.ResponseCode < 500 {
+			t.Fatalf("attempt %d: response code %v wasn't recorded", attempt+1, delivery.ResponseCode)
+		}
+
+		if delivery.NextAttemptAt == nil {
+			t.Fatalf("attempt %d: no retry was scheduled", attempt+1)
+		}
+
+		wait := time.Until(*delivery.NextAttemptAt)
+		if wait > backoff || wait < backoff-5*time.Second {
+			t.Fatalf("attempt %d: retry in %s, want %s", attempt+1, wait, backoff)
+		}
+
+		if attempt == 0 {
+			delivery = deliver(ctx, hook, delivery)
+		}
+	}
+
+	// Once the retry is due the dispatcher sends it again
+	due := time.Now().UTC().Add(-time.Second)
+	delivery.NextAttemptAt = &due
+
+	if _, err := db.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		t.Fatalf("can't update delivery: %s", err)
+	}
+
+	retryDue(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for delivery.Status == string(db.WebhookDeliveryPending) && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+
+		delivery, err = db.GetWebhookDelivery(ctx, *hook.ID, *delivery.ID)
+		if err != nil {
+			t.Fatalf("can't get delivery: %s", err)
+		}
+	}
+
+	if delivery.Status != string(db.WebhookDeliverySucceeded) || delivery.Attempts != 3 {
+		t.Fatalf("delivery is %s after %d attempts, want %s after 3", delivery.Status, delivery.Attempts, db.WebhookDeliverySucceeded)
+	}
+
+	if requests := rc.received(); len(requests) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(requests))
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	statuses := make([]int, maxAttempts)
+	for i := range statuses {
+		statuses[i] = http.StatusBadGateway
+	}
+
+	_, hook := setup(t, statuses...)
+	ctx := context.Background()
+
+	delivery, err := Ping(ctx, hook)
+	if err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	for delivery.Status == string(db.WebhookDeliveryPending) {
+		delivery = deliver(ctx, hook, delivery)
+	}
+
+	if delivery.Status != string(db.WebhookDeliveryFailed) || delivery.Attempts != maxAttempts {
+		t.Fatalf("delivery is %s after %d attempts, want %s after %d", delivery.Status, delivery.Attempts, db.WebhookDeliveryFailed, maxAttempts)
+	}
+
+	if delivery.NextAttemptAt != nil || delivery.Error == nil {
+		t.Fatalf("failed delivery still has a retry at %v or no error", delivery.NextAttemptAt)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	rc, hook := setup(t)
+	ctx := context.Background()
+
+	original, err := Ping(ctx, hook)
+	if err != nil {
+		t.Fatalf("ping failed: %s", err)
+	}
+
+	// The replay is read back from the delivery log, the way the API does it
+	logged, err := db.GetWebhookDelivery(ctx, *hook.ID, *original.ID)
+	if err != nil {
+		t.Fatalf("can't get delivery: %s", err)
+	}
+
+	replayed, err := Replay(ctx, hook, logged)
+	if err != nil {
+		t.Fatalf("replay failed: %s", err)
+	}
+
+	if *replayed.ID == *original.ID || replayed.ReplayOf == nil || *replayed.ReplayOf != *original.ID {
+		t.Fatalf("replay %d isn't a new delivery of %d, replay of: %v", *replayed.ID, *original.ID, replayed.ReplayOf)
+	}
+
+	if replayed.Status != string(db.WebhookDeliverySucceeded) || replayed.Payload != original.Payload {
+		t.Fatalf("replay is %s with payload %s", replayed.Status, replayed.Payload)
+	}
+
+	requests := rc.received()
+	if len(requests) != 2 {
+		t.Fatalf("receiver got %d requests, want 2", len(requests))
+	}
+
+	if string(requests[1].body) != string(requests[0].body) {
+		t.Errorf("replayed body %s, want %s", requests[1].body, requests[0].body)
+	}
+
+	if requests[1].header.Get(SignatureHeader) != requests[0].header.Get(SignatureHeader) {
+		t.Error("replayed payload has a different signature")
+	}
+
+	if requests[1].header.Get(DeliveryHeader) == requests[0].header.Get(DeliveryHeader) {
+		t.Error("replay was sent with the delivery id of the original")
+	}
+}
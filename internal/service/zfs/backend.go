@@ -0,0 +1,131 @@
+package zfs
+
+import (
+	"context"
+	"io"
+)
+
+// Backend is the set of ZFS operations PostBranch needs. The pool, branch and replication logic
+// is written against it, so it doesn't depend on how ZFS is reached.
+type Backend interface {
+	CreatePool(ctx context.Context, spec PoolSpec) error
+	DestroyPool(ctx context.Context, poolName string) error
+	ImportPools(ctx context.Context) error
+	ExportPool(ctx context.Context, poolName string) error
+	ExpandDevice(ctx context.Context, poolName, devicePath string) error
+	ListDevices(ctx context.Context, poolName string) ([]string, error)
+	PoolStatus(ctx context.Context, poolName string) (PoolStatus, error)
+	PoolUsage(ctx context.Context, poolName string) (PoolUsage, error)
+	Scrub(ctx context.Context, poolName string) error
+
+	CreateDataset(ctx context.Context, datasetName string, properties ...Property) error
+	Snapshot(ctx context.Context, snapshotName string, recursive bool) error
+	Clone(ctx context.Context, snapshotName, datasetName string, properties ...Property) error
+	Promote(ctx context.Context, datasetName string) error
+	Destroy(ctx context.Context, name string, recursive bool) error
+	Rollback(ctx context.Context, snapshotName string) error
+	GetProperty(ctx context.Context, name, property string) (string, error)
+	GetProperties(ctx context.Context, name string, options GetOptions, properties ...string) ([]PropertyValue, error)
+	SetProperty(ctx context.Context, name string, properties ...Property) error
+	ListDatasets(ctx context.Context, name string, options ListOptions, properties ...string) ([]Dataset, error)
+	ListSnapshots(ctx context.Context, datasetName string) ([]Snapshot, error)
+
+	// Send writes a replication stream of the snapshot. The stream is incremental from fromSnapshot
+	// if it isn't empty.
+	Send(ctx context.Context, fromSnapshot, snapshotName string, stream io.Writer) error
+	Receive(ctx context.Context, datasetName string, stream io.Reader, options ReceiveOptions) error
+
+	LoadKey(ctx context.Context, name string, passphrase string) error
+	UnloadKey(ctx context.Context, name string) error
+	MountAll(ctx context.Context) error
+}
+
+type PoolSpec struct {
+	Name       string
+	DevicePath string
+	MountPath  string
+
+	// PoolProperties are set on the pool, RootProperties on its root dataset
+	PoolProperties []Property
+	RootProperties []Property
+
+	// Passphrase is only needed for encrypted pools which prompt for the key
+	Passphrase string
+}
+
+type Property struct {
+	Name  string
+	Value string
+}
+
+func (property Property) String() string {
+	return property.Name + "=" + property.Value
+}
+
+type PropertyValue struct {
+	Name     string
+	Property string
+	Value    string
+	Source   string
+}
+
+type GetOptions struct {
+	Recursive bool
+
+	// Types and Sources are comma separated, all types and sources are included when empty
+	Types   string
+	Sources string
+
+	// Parsable returns exact numbers instead of human readable sizes
+	Parsable bool
+}
+
+type ListOptions struct {
+	// Types is comma separated, only filesystems are listed when empty
+	Types string
+
+	// Depth limits the recursion, a negative depth lists every descendant
+	Depth int
+}
+
+type Dataset struct {
+	Name       string
+	Properties map[string]string
+}
+
+type ReceiveOptions struct {
+	// Force rolls back the target to the last received snapshot
+	Force bool
+
+	// NoMount leaves the received datasets unmounted
+	NoMount bool
+
+	// ExcludeProperties aren't taken from the stream, the received datasets inherit them instead
+	ExcludeProperties []string
+}
+
+// Devices attach the image files of virtual pools as block devices, which the pools are created on
+type Devices interface {
+	// Attach returns the path of the device the image is attached to
+	Attach(imgPath string) (string, error)
+
+	// Detach releases the device and removes its node
+	Detach(device string) error
+
+	// Find returns every device the image is attached to
+	Find(imgPath string) ([]string, error)
+
+	// Refresh makes the device pick up the new size of its image
+	Refresh(device string) error
+}
+
+// Zfs runs the pool and dataset operations through its backend. The services that need ZFS are
+// given one when they're created.
+type Zfs struct {
+	backend Backend
+	devices Devices
+}
+
+func New(backend Backend, devices Devices) *Zfs {
+	return &Zfs{backend: backend, devices: devices}
+}
@@ -0,0 +1,402 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/runner"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CliBackend runs the zfs and zpool commands directly, without a shell, and parses their
+// tab separated -H output.
+type CliBackend struct{}
+
+func (CliBackend) CreatePool(ctx context.Context, spec PoolSpec) error {
+	args := []string{"create", "-m", spec.MountPath}
+
+	for _, property := range spec.PoolProperties {
+		args = append(args, "-o", property.String())
+	}
+
+	for _, property := range spec.RootProperties {
+		args = append(args, "-O", property.String())
+	}
+
+	args = append(args, spec.Name, spec.DevicePath)
+
+	output, err := runner.Pipe(ctx, "create-zpool", passphraseInput(spec.Passphrase), nil, "zpool", args...)
+	if err != nil {
+		log.Errorf("Failed to create pool: %s, output: %s", spec.Name, output)
+		return err
+	}
+
+	return nil
+}
+
+func (CliBackend) DestroyPool(ctx context.Context, poolName string) error {
+	_, err := runner.Single(ctx, "zpool-destroy", false, false, "zpool", "destroy", "-f", poolName)
+	return err
+}
+
+// ImportPools can take long with many pools or a slow disk, it's stopped when the context is done
+func (CliBackend) ImportPools(ctx context.Context) error {
+	_, err := runner.Run(ctx, runner.Options{Key: "import-zpools"}, "zpool", "import", "-a")
+	return err
+}
+
+func (CliBackend) ExportPool(ctx context.Context, poolName string) error {
+	_, err := runner.Single(ctx, "zpool-export", true, false, "zpool", "export", poolName)
+	return err
+}
+
+func (CliBackend) ExpandDevice(ctx context.Context, poolName, devicePath string) error {
+	_, err := runner.Single(ctx, "zpool-expand", false, false, "zpool", "online", "-e", poolName, devicePath)
+	return err
+}
+
+// ListDevices returns the full paths of the disks in the pool. Grouping vdevs like mirrors aren't
+// included.
+func (CliBackend) ListDevices(ctx context.Context, poolName string) ([]string, error) {
+	output, err := runner.Single(ctx, "list-zpool-devices", false, false, "zpool", "list", "-H", "-P", "-v", poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []string
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimLeft(line, "\t "), "\t")
+		if strings.HasPrefix(fields[0], "/dev/") {
+			devices = append(devices, fields[0])
+		}
+	}
+
+	return devices, nil
+}
+
+func (CliBackend) PoolStatus(ctx context.Context, poolName string) (PoolStatus, error) {
+	output, err := runner.Single(ctx, "zpool-status", true, false, "zpool", "status", "-p", poolName)
+	if err != nil {
+		log.Errorf("Failed to get status of pool: %s, error: %s, output: %s", poolName, err, output)
+		return PoolStatus{}, err
+	}
+
+	return ParsePoolStatus(output)
+}
+
+func (CliBackend) PoolUsage(ctx context.Context, poolName string) (PoolUsage, error) {
+	output, err := runner.Single(
+		ctx,
+		"zpool-usage",
+		true,
+		false,
+		"zpool",
+		"list", "-Hp",
+		"-o", "size,alloc,free,frag",
+		poolName,
+	)
+
+	if err != nil {
+		return PoolUsage{}, err
+	}
+
+	fields := strings.Split(strings.TrimSpace(output), "\t")
+	if len(fields) != 4 {
+		return PoolUsage{}, fmt.Errorf("unexpected zpool list output: %s", output)
+	}
+
+	var usage PoolUsage
+
+	for i, target := range []*int64{&usage.Size, &usage.Allocated, &usage.Free} {
+		if *target, err = strconv.ParseInt(fields[i], 10, 64); err != nil {
+			return PoolUsage{}, fmt.Errorf("invalid zpool list value %s: %w", fields[i], err)
+		}
+	}
+
+	if fragmentation, err := strconv.ParseInt(strings.TrimSuffix(fields[3], "%"), 10, 64); err == nil {
+		usage.Fragmentation = &fragmentation
+	}
+
+	return usage, nil
+}
+
+func (CliBackend) Scrub(ctx context.Context, poolName string) error {
+	_, err := runner.Single(ctx, "zpool-scrub", false, false, "zpool", "scrub", poolName)
+	return err
+}
+
+func (CliBackend) CreateDataset(ctx context.Context, datasetName string, properties ...Property) error {
+	args := []string{"create"}
+	args = append(args, propertyArgs(properties)...)
+	args = append(args, datasetName)
+
+	_, err := runner.Single(ctx, "create-dataset", false, false, "zfs", args...)
+	return err
+}
+
+func (CliBackend) Snapshot(ctx context.Context, snapshotName string, recursive bool) error {
+	args := []string{"snapshot"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, snapshotName)
+
+	_, err := runner.Single(ctx, "create-snapshot", false, false, "zfs", args...)
+	return err
+}
+
+func (CliBackend) Clone(ctx context.Context, snapshotName, datasetName string, properties ...Property) error {
+	args := []string{"clone"}
+	args = append(args, propertyArgs(properties)...)
+	args = append(args, snapshotName, datasetName)
+
+	_, err := runner.Single(ctx, "clone-snapshot", false, false, "zfs", args...)
+	return err
+}
+
+func (CliBackend) Promote(ctx context.Context, datasetName string) error {
+	_, err := runner.Single(ctx, "promote-dataset", false, false, "zfs", "promote", datasetName)
+	return err
+}
+
+func (CliBackend) Destroy(ctx context.Context, name string, recursive bool) error {
+	args := []string{"destroy"}
+	if recursive {
+		args = append(args, "-r")
+	}
+	args = append(args, name)
+
+	_, err := runner.Single(ctx, "destroy-dataset", false, false, "zfs", args...)
+	return err
+}
+
+// Rollback rolls the dataset back to the snapshot, destroying any newer snapshots.
+func (CliBackend) Rollback(ctx context.Context, snapshotName string) error {
+	_, err := runner.Single(ctx, "rollback-snapshot", false, false, "zfs", "rollback", "-r", snapshotName)
+	return err
+}
+
+func (CliBackend) GetProperty(ctx context.Context, name, property string) (string, error) {
+	output, err := runner.Single(ctx, "get-property", false, false, "zfs", "get", "-Hp", "-o", "value", property, name)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+func (CliBackend) GetProperties(ctx context.Context, name string, options GetOptions, properties ...string) ([]PropertyValue, error) {
+	args := []string{"get", "-H"}
+
+	if options.Parsable {
+		args = append(args, "-p")
+	}
+
+	if options.Recursive {
+		args = append(args, "-r")
+	}
+
+	if options.Types != "" {
+		args = append(args, "-t", options.Types)
+	}
+
+	if options.Sources != "" {
+		args = append(args, "-s", options.Sources)
+	}
+
+	property := "all"
+	if len(properties) > 0 {
+		property = strings.Join(properties, ",")
+	}
+
+	args = append(args, "-o", "name,property,value,source", property, name)
+
+	output, err := runner.Single(ctx, "get-properties", true, false, "zfs", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []PropertyValue
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+
+		values = append(values, PropertyValue{
+			Name:     fields[0],
+			Property: fields[1],
+			Value:    fields[2],
+			Source:   fields[3],
+		})
+	}
+
+	return values, nil
+}
+
+func (CliBackend) SetProperty(ctx context.Context, name string, properties ...Property) error {
+	args := []string{"set"}
+
+	for _, property := range properties {
+		args = append(args, property.String())
+	}
+
+	args = append(args, name)
+
+	_, err := runner.Single(ctx, "set-property", false, false, "zfs", args...)
+	return err
+}
+
+func (CliBackend) ListDatasets(ctx context.Context, name string, options ListOptions, properties ...string) ([]Dataset, error) {
+	types := options.Types
+	if types == "" {
+		types = "filesystem"
+	}
+
+	columns := append([]string{"name"}, properties...)
+	args := []string{"list", "-Hp", "-o", strings.Join(columns, ","), "-t", types}
+
+	if options.Depth >= 0 {
+		args = append(args, "-d", strconv.Itoa(options.Depth))
+	}
+
+	args = append(args, "-r", name)
+
+	output, err := runner.Single(ctx, "list-datasets", false, false, "zfs", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var datasets []Dataset
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(columns) {
+			continue
+		}
+
+		dataset := Dataset{Name: fields[0], Properties: make(map[string]string)}
+		for i, property := range properties {
+			dataset.Properties[property] = fields[i+1]
+		}
+
+		datasets = append(datasets, dataset)
+	}
+
+	return datasets, nil
+}
+
+// ListSnapshots returns the snapshots of the dataset and its descendants, oldest first.
+func (CliBackend) ListSnapshots(ctx context.Context, datasetName string) ([]Snapshot, error) {
+	output, err := runner.Single(
+		ctx,
+		"list-zfs-snapshots",
+		false,
+		false,
+		"zfs",
+		"list", "-Hp",
+		"-o", "name,createtxg",
+		"-t", "snapshot",
+		"-s", "createtxg",
+		"-r", datasetName,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 {
+			continue
+		}
+
+		createTxg, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid createtxg for snapshot %s: %w", fields[0], err)
+		}
+
+		snapshots = append(snapshots, Snapshot{Name: fields[0], CreateTxg: createTxg})
+	}
+
+	return snapshots, nil
+}
+
+func (CliBackend) Send(ctx context.Context, fromSnapshot, snapshotName string, stream io.Writer) error {
+	args := []string{"send", "-R"}
+	if fromSnapshot != "" {
+		args = append(args, "-i", fromSnapshot)
+	}
+	args = append(args, snapshotName)
+
+	output, err := runner.Pipe(ctx, "send-snapshot", nil, stream, "zfs", args...)
+	if err != nil {
+		log.Errorf("Failed to send snapshot: %s, output: %s", snapshotName, output)
+		return err
+	}
+
+	return nil
+}
+
+func (CliBackend) Receive(ctx context.Context, datasetName string, stream io.Reader, options ReceiveOptions) error {
+	output, err := runner.Pipe(ctx, "receive-dataset", stream, nil, "zfs", receiveArgs(datasetName, options)...)
+	if err != nil {
+		log.Errorf("Failed to receive dataset: %s, output: %s", datasetName, output)
+		return err
+	}
+
+	return nil
+}
+
+func (CliBackend) LoadKey(ctx context.Context, name string, passphrase string) error {
+	output, err := runner.Pipe(ctx, "load-zfs-key", passphraseInput(passphrase), nil, "zfs", "load-key", name)
+	if err != nil {
+		log.Errorf("Failed to load key of: %s, output: %s", name, output)
+		return err
+	}
+
+	return nil
+}
+
+// UnloadKey unmounts the datasets and unloads the key in one go
+func (CliBackend) UnloadKey(ctx context.Context, name string) error {
+	_, err := runner.Single(ctx, "unload-zfs-key", false, false, "zfs", "unmount", "-u", name)
+	return err
+}
+
+func (CliBackend) MountAll(ctx context.Context) error {
+	_, err := runner.Single(ctx, "mount-datasets", false, false, "zfs", "mount", "-a")
+	return err
+}
+
+func receiveArgs(datasetName string, options ReceiveOptions) []string {
+	args := []string{"receive"}
+
+	if options.Force {
+		args = append(args, "-F")
+	}
+
+	if options.NoMount {
+		args = append(args, "-u")
+	}
+
+	for _, property := range options.ExcludeProperties {
+		args = append(args, "-x", property)
+	}
+
+	return append(args, datasetName)
+}
+
+func propertyArgs(properties []Property) []string {
+	var args []string
+	for _, property := range properties {
+		args = append(args, "-o", property.String())
+	}
+
+	return args
+}
@@ -1,34 +1,48 @@
 package zfs
 
 import (
+	"context"
 	"fmt"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
-	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/dto/repo"
 	"github.com/jamius19/postbranch/internal/util"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
-func EmptyDataset(pool model.ZfsPool, branchName string) error {
+func (z *Zfs) EmptyDataset(ctx context.Context, pool model.ZfsPool, branchName string) error {
 	log.Infof("ZFS Dataset init %v", pool)
-	datasetName := fmt.Sprintf("%s/%s", pool.Name, branchName)
+	datasetName := DatasetName(pool.Name, branchName)
 	datasetPath := filepath.Join(pool.MountPath, branchName)
 
 	if _, err := os.Stat(datasetPath); err == nil {
 		log.Errorf("Dataset path already exists: %s, removing", datasetPath)
 
-		datasetFileRemovePattern := filepath.Join(pool.MountPath, branchName, "*")
-		err := util.RemoveGlob(datasetFileRemovePattern)
+		// The WAL dataset is mounted inside the branch, so only its contents can be removed
+		entries, err := os.ReadDir(datasetPath)
 		if err != nil {
-			log.Errorf("Failed to remove existing data from dataset path: %s", err)
+			log.Errorf("Failed to read dataset path: %s", err)
 			return err
 		}
 
+		for _, entry := range entries {
+			removePath := filepath.Join(datasetPath, entry.Name())
+			if entry.Name() == repo.WalDataset {
+				removePath = filepath.Join(removePath, "*")
+			}
+
+			if err := util.RemoveGlob(removePath); err != nil {
+				log.Errorf("Failed to remove existing data from dataset path: %s", err)
+				return err
+			}
+		}
+
 		return nil
 	}
 
-	_, err := runner.Single("create-dataset", false, false, "zfs", "create", datasetName)
-	if err != nil {
+	if err := z.backend.CreateDataset(ctx, datasetName); err != nil {
 		log.Errorf("Failed to create dataset: %s", err)
 		return err
 	}
@@ -36,3 +50,265 @@ func EmptyDataset(pool model.ZfsPool, branchName string) error {
 	log.Infof("Created dataset. Dataset: %s Pool: %s", datasetName, pool.Name)
 	return nil
 }
+
+// DatasetName returns the dataset that backs a branch. Branches are always a direct child of the
+// repo pool, so the branch name must be a single ZFS component.
+func DatasetName(poolName, branchName string) string {
+	return fmt.Sprintf("%s/%s", poolName, branchName)
+}
+
+// BranchSnapshotName returns the snapshot of the parent dataset a new branch is cloned from.
+func BranchSnapshotName(parentDataset, branchName string) string {
+	return fmt.Sprintf("%s@pb-branch-%s", parentDataset, branchName)
+}
+
+// SnapshotDataset returns the dataset part of a snapshot name.
+func SnapshotDataset(snapshotName string) string {
+	dataset, _, _ := strings.Cut(snapshotName, "@")
+	return dataset
+}
+
+// ListOrigins returns the origin snapshot of every cloned branch dataset in the pool, keyed by dataset
+// name. Child datasets of a branch, like pg_wal, follow their branch and aren't included.
+func (z *Zfs) ListOrigins(ctx context.Context, poolName string) (map[string]string, error) {
+	datasets, err := z.backend.ListDatasets(ctx, poolName, ListOptions{Depth: 1}, "origin")
+	if err != nil {
+		log.Errorf("Failed to list dataset origins for pool: %s, error: %s", poolName, err)
+		return nil, err
+	}
+
+	return datasetOrigins(datasets), nil
+}
+
+// ListBranchDatasets returns the direct children of the pool with their origin, every branch is
+// backed by one of them
+func (z *Zfs) ListBranchDatasets(ctx context.Context, poolName string) ([]Dataset, error) {
+	datasets, err := z.backend.ListDatasets(ctx, poolName, ListOptions{Depth: 1}, "origin")
+	if err != nil {
+		log.Errorf("Failed to list branch datasets for pool: %s, error: %s", poolName, err)
+		return nil, err
+	}
+
+	var branchDatasets []Dataset
+	for _, dataset := range datasets {
+		if dataset.Name != poolName {
+			branchDatasets = append(branchDatasets, dataset)
+		}
+	}
+
+	return branchDatasets, nil
+}
+
+// datasetOrigins maps the cloned datasets to their origin snapshot
+func datasetOrigins(datasets []Dataset) map[string]string {
+	origins := make(map[string]string)
+
+	for _, dataset := range datasets {
+		origin := dataset.Properties["origin"]
+		if origin == "" || origin == "-" {
+			continue
+		}
+
+		origins[dataset.Name] = origin
+	}
+
+	return origins
+}
+
+type Snapshot struct {
+	Name      string
+	CreateTxg int64
+}
+
+// ListSnapshots returns the snapshots of the dataset and its descendants, oldest first.
+func (z *Zfs) ListSnapshots(ctx context.Context, datasetName string) ([]Snapshot, error) {
+	snapshots, err := z.backend.ListSnapshots(ctx, datasetName)
+	if err != nil {
+		log.Errorf("Failed to list snapshots for dataset: %s, error: %s", datasetName, err)
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// Promote makes a clone independent of its origin. The origin snapshot and every older snapshot of
+// the origin dataset are moved to the clone, and the origin dataset becomes a clone of it instead.
+// Cloned child datasets are promoted along with it.
+func (z *Zfs) Promote(ctx context.Context, datasetName string) error {
+	datasets, err := z.backend.ListDatasets(ctx, datasetName, ListOptions{Depth: -1}, "origin")
+	if err != nil {
+		log.Errorf("Failed to list child datasets of: %s, error: %s", datasetName, err)
+		return err
+	}
+
+	for _, dataset := range datasets {
+		if origin := dataset.Properties["origin"]; origin == "" || origin == "-" {
+			continue
+		}
+
+		if err := z.backend.Promote(ctx, dataset.Name); err != nil {
+			log.Errorf("Failed to promote dataset: %s, error: %s", dataset.Name, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Destroy destroys a dataset or a snapshot. With recursive set, the snapshots and children of the
+// dataset are destroyed too, or for a snapshot, the snapshots of the same name on the children.
+func (z *Zfs) Destroy(ctx context.Context, name string, recursive bool) error {
+	if err := z.backend.Destroy(ctx, name, recursive); err != nil {
+		log.Errorf("Failed to destroy: %s, error: %s", name, err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateSnapshot snapshots the dataset along with its child datasets, atomically. The child
+// snapshots share the same snapshot name.
+func (z *Zfs) CreateSnapshot(ctx context.Context, snapshotName string) error {
+	if err := z.backend.Snapshot(ctx, snapshotName, true); err != nil {
+		log.Errorf("Failed to create snapshot: %s, error: %s", snapshotName, err)
+		return err
+	}
+
+	return nil
+}
+
+// Clone clones a recursive snapshot. The child datasets are cloned below the new dataset with the
+// same locally set properties as their source, since clones only inherit from their new parent.
+func (z *Zfs) Clone(ctx context.Context, snapshotName, datasetName string) error {
+	if err := z.backend.Clone(ctx, snapshotName, datasetName); err != nil {
+		log.Errorf("Failed to clone snapshot: %s to %s, error: %s", snapshotName, datasetName, err)
+		return err
+	}
+
+	sourceDataset, snapName, _ := strings.Cut(snapshotName, "@")
+
+	snapshots, err := z.backend.ListDatasets(ctx, sourceDataset, ListOptions{Types: "snapshot", Depth: -1})
+	if err != nil {
+		log.Errorf("Failed to list child snapshots of: %s, error: %s", sourceDataset, err)
+		return err
+	}
+
+	for _, childSnapshot := range snapshots {
+		childDataset, childSnapName, _ := strings.Cut(childSnapshot.Name, "@")
+		if childSnapName != snapName || childDataset == sourceDataset {
+			continue
+		}
+
+		properties, err := z.localProperties(ctx, childDataset)
+		if err != nil {
+			return err
+		}
+
+		cloneName := datasetName + strings.TrimPrefix(childDataset, sourceDataset)
+
+		if err := z.backend.Clone(ctx, childSnapshot.Name, cloneName, properties...); err != nil {
+			log.Errorf("Failed to clone child snapshot: %s, error: %s", childSnapshot.Name, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localProperties returns the properties set directly on the dataset
+func (z *Zfs) localProperties(ctx context.Context, datasetName string) ([]Property, error) {
+	values, err := z.backend.GetProperties(ctx, datasetName, GetOptions{Sources: "local", Parsable: true})
+	if err != nil {
+		log.Errorf("Failed to get local properties of: %s, error: %s", datasetName, err)
+		return nil, err
+	}
+
+	var properties []Property
+	for _, value := range values {
+		properties = append(properties, Property{Name: value.Property, Value: value.Value})
+	}
+
+	return properties, nil
+}
+
+// Send writes a full replication stream of the snapshot, including its child datasets and their
+// properties. Clones are sent as standalone datasets, so the stream can be received without its
+// origin.
+func (z *Zfs) Send(ctx context.Context, snapshotName string, stream io.Writer) error {
+	if err := z.backend.Send(ctx, "", snapshotName, stream); err != nil {
+		log.Errorf("Failed to send snapshot: %s, error: %s", snapshotName, err)
+		return err
+	}
+
+	return nil
+}
+
+// receiveExcludedProperties are left out of a received stream. The limits and the mount point of the
+// sending dataset don't fit the pool it's received into.
+var receiveExcludedProperties = []string{"quota", "refquota", "reservation", "refreservation", "mountpoint"}
+
+// Receive creates a new dataset from a send stream.
+func (z *Zfs) Receive(ctx context.Context, datasetName string, stream io.Reader) error {
+	options := ReceiveOptions{ExcludeProperties: receiveExcludedProperties}
+
+	if err := z.backend.Receive(ctx, datasetName, stream, options); err != nil {
+		log.Errorf("Failed to receive dataset: %s, error: %s", datasetName, err)
+		return err
+	}
+
+	return nil
+}
+
+// SendIncremental writes the changes between two snapshots of the same dataset and its children.
+func (z *Zfs) SendIncremental(ctx context.Context, fromSnapshot, toSnapshot string, stream io.Writer) error {
+	if err := z.backend.Send(ctx, fromSnapshot, toSnapshot, stream); err != nil {
+		log.Errorf("Failed to send snapshot: %s from: %s, error: %s", toSnapshot, fromSnapshot, err)
+		return err
+	}
+
+	return nil
+}
+
+// replicaReceiveOptions roll the target back to the last received snapshot if it was modified, and
+// leave it unmounted, so it never clashes with a branch mount.
+var replicaReceiveOptions = ReceiveOptions{Force: true, NoMount: true, ExcludeProperties: receiveExcludedProperties}
+
+// ReceiveArgs are the zfs receive arguments for a replica, used when receiving over ssh.
+func ReceiveArgs(datasetName string) []string {
+	return receiveArgs(datasetName, replicaReceiveOptions)
+}
+
+func (z *Zfs) ReceiveReplica(ctx context.Context, datasetName string, stream io.Reader) error {
+	if err := z.backend.Receive(ctx, datasetName, stream, replicaReceiveOptions); err != nil {
+		log.Errorf("Failed to receive replica: %s, error: %s", datasetName, err)
+		return err
+	}
+
+	return nil
+}
+
+// SetQuota sets the quota, refquota and reservation of the dataset. Limits that are nil are removed.
+func (z *Zfs) SetQuota(ctx context.Context, datasetName string, quota repo.Quota) error {
+	err := z.backend.SetProperty(
+		ctx,
+		datasetName,
+		quotaProperty("quota", quota.QuotaInMb),
+		quotaProperty("refquota", quota.RefquotaInMb),
+		quotaProperty("reservation", quota.ReservationInMb),
+	)
+
+	if err != nil {
+		log.Errorf("Failed to set quota of dataset: %s, error: %s", datasetName, err)
+		return err
+	}
+
+	return nil
+}
+
+func quotaProperty(property string, sizeInMb *int64) Property {
+	if sizeInMb == nil {
+		return Property{Name: property, Value: "none"}
+	}
+
+	return Property{Name: property, Value: fmt.Sprintf("%dM", *sizeInMb)}
+}
@@ -0,0 +1,86 @@
+package zfs_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/internal/service/zfs/zfstest"
+)
+
+func TestReceiveLeavesOutLimits(t *testing.T) {
+	ctx := context.Background()
+	backend := zfstest.NewFakeBackend()
+	z := zfs.New(backend, zfstest.NewFakeDevices())
+
+	spec := zfs.PoolSpec{Name: "pool", DevicePath: "/dev/loop0", MountPath: filepath.Join(t.TempDir(), "pool")}
+	if err := backend.CreatePool(ctx, spec); err != nil {
+		t.Fatalf("can't create pool: %s", err)
+	}
+
+	err := backend.CreateDataset(
+		ctx,
+		"pool/source",
+		zfs.Property{Name: "quota", Value: "1073741824"},
+		zfs.Property{Name: "refreservation", Value: "536870912"},
+		zfs.Property{Name: "recordsize", Value: "8K"},
+	)
+
+	if err != nil {
+		t.Fatalf("can't create dataset: %s", err)
+	}
+
+	if err := backend.CreateDataset(ctx, "pool/source/pg_wal", zfs.Property{Name: "quota", Value: "268435456"}); err != nil {
+		t.Fatalf("can't create child dataset: %s", err)
+	}
+
+	if err := backend.Snapshot(ctx, "pool/source@export", true); err != nil {
+		t.Fatalf("can't snapshot dataset: %s", err)
+	}
+
+	var stream bytes.Buffer
+	if err := z.Send(ctx, "pool/source@export", &stream); err != nil {
+		t.Fatalf("Send() returned error: %s", err)
+	}
+
+	if err := z.Receive(ctx, "pool/copy", &stream); err != nil {
+		t.Fatalf("Receive() returned error: %s", err)
+	}
+
+	tests := []struct {
+		dataset  string
+		property string
+		want     string
+	}{
+		{"pool/copy", "quota", "0"},
+		{"pool/copy", "refreservation", "0"},
+		{"pool/copy/pg_wal", "quota", "0"},
+		{"pool/copy", "recordsize", "8K"},
+		{"pool/copy", "mountpoint", filepath.Join(spec.MountPath, "copy")},
+	}
+
+	for _, tt := range tests {
+		value, err := backend.GetProperty(ctx, tt.dataset, tt.property)
+		if err != nil {
+			t.Fatalf("can't get %s of %s: %s", tt.property, tt.dataset, err)
+		}
+
+		if value != tt.want {
+			t.Errorf("%s of %s = %s, want %s", tt.property, tt.dataset, value, tt.want)
+		}
+	}
+}
+
+func TestReplicaReceiveArgs(t *testing.T) {
+	args := zfs.ReceiveArgs("backup/shop/main")
+
+	for _, property := range []string{"quota", "refquota", "reservation", "refreservation", "mountpoint"} {
+		index := slices.Index(args, property)
+		if index < 1 || args[index-1] != "-x" {
+			t.Errorf("receive args %v don't exclude %s", args, property)
+		}
+	}
+}
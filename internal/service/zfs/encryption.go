@@ -0,0 +1,78 @@
+package zfs
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"io"
+	"strings"
+)
+
+// encryptionProperties returns the root dataset properties that encrypt the pool
+func encryptionProperties(encryption *repo.Encryption) []Property {
+	if encryption == nil {
+		return nil
+	}
+
+	return []Property{
+		{Name: "encryption", Value: repo.EncryptionAlgorithm},
+		{Name: "keyformat", Value: encryption.GetKeyFormat()},
+		{Name: "keylocation", Value: encryption.GetKeyLocation()},
+	}
+}
+
+// passphraseInput is the stdin for commands which prompt for the passphrase. It's nil if the key is
+// read from a file.
+func passphraseInput(passphrase string) io.Reader {
+	if passphrase == "" {
+		return nil
+	}
+
+	return strings.NewReader(passphrase + "\n")
+}
+
+func IsEncrypted(pool model.ZfsPool) bool {
+	return pool.Encryption != nil
+}
+
+// HasKeyFile reports if the key of an encrypted pool can be loaded without a passphrase
+func HasKeyFile(pool model.ZfsPool) bool {
+	return pool.KeyLocation != nil && strings.HasPrefix(*pool.KeyLocation, "file://")
+}
+
+// LoadKey loads the key of the pool and mounts its datasets. The passphrase is only used if the key
+// isn't in a file.
+func (z *Zfs) LoadKey(ctx context.Context, pool model.ZfsPool, passphrase string) error {
+	if err := z.backend.LoadKey(ctx, pool.Name, passphrase); err != nil {
+		log.Errorf("Failed to load key of pool: %s, error: %s", pool.Name, err)
+		return err
+	}
+
+	if err := z.backend.MountAll(ctx); err != nil {
+		log.Errorf("Failed to mount datasets of pool: %s, error: %s", pool.Name, err)
+		return err
+	}
+
+	log.Infof("Loaded key of pool %s", pool.Name)
+	return nil
+}
+
+// UnloadKey unmounts the datasets of the pool and unloads its key
+func (z *Zfs) UnloadKey(ctx context.Context, pool model.ZfsPool) error {
+	keyStatus, err := z.backend.GetProperty(ctx, pool.Name, "keystatus")
+	if err != nil {
+		return err
+	}
+
+	if keyStatus != "available" {
+		return nil
+	}
+
+	if err := z.backend.UnloadKey(ctx, pool.Name); err != nil {
+		log.Errorf("Failed to unload key of pool: %s, error: %s", pool.Name, err)
+		return err
+	}
+
+	log.Infof("Unloaded key of pool %s", pool.Name)
+	return nil
+}
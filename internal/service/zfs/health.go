@@ -0,0 +1,207 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	ScrubNone       = "NONE"
+	ScrubInProgress = "IN_PROGRESS"
+	ScrubFinished   = "FINISHED"
+	ScrubCanceled   = "CANCELED"
+)
+
+var (
+	scrubErrorsPattern   = regexp.MustCompile(`with (\d+) errors`)
+	scrubRepairedPattern = regexp.MustCompile(`repaired (\S+)`)
+)
+
+// PoolStatus is the parsed output of zpool status
+type PoolStatus struct {
+	State string
+	Scan  string
+
+	ScrubState    string
+	ScrubErrors   *int64
+	ScrubRepaired *string
+
+	Vdevs []Vdev
+
+	// DataErrors is the errors line, it's "No known data errors" on a healthy pool
+	DataErrors string
+}
+
+type Vdev struct {
+	Name           string
+	State          string
+	ReadErrors     int64
+	WriteErrors    int64
+	ChecksumErrors int64
+
+	// Depth is the nesting level in the config tree, the pool itself is 0
+	Depth int
+}
+
+// Healthy reports if the pool is online without any read, write, checksum or data errors
+func (status PoolStatus) Healthy() bool {
+	if status.State != "ONLINE" {
+		return false
+	}
+
+	if status.ScrubErrors != nil && *status.ScrubErrors > 0 {
+		return false
+	}
+
+	for _, vdev := range status.Vdevs {
+		if vdev.State != "ONLINE" || vdev.ReadErrors > 0 || vdev.WriteErrors > 0 || vdev.ChecksumErrors > 0 {
+			return false
+		}
+	}
+
+	return status.DataErrors == "" || status.DataErrors == "No known data errors"
+}
+
+// Problems describes what's wrong with the pool, it's empty for a healthy pool
+func (status PoolStatus) Problems() []string {
+	var problems []string
+
+	if status.State != "ONLINE" {
+		problems = append(problems, fmt.Sprintf("pool is %s", status.State))
+	}
+
+	for _, vdev := range status.Vdevs {
+		if vdev.State != "ONLINE" {
+			problems = append(problems, fmt.Sprintf("%s is %s", vdev.Name, vdev.State))
+		}
+
+		if vdev.ReadErrors > 0 || vdev.WriteErrors > 0 || vdev.ChecksumErrors > 0 {
+			problems = append(problems, fmt.Sprintf(
+				"%s has %d read, %d write and %d checksum errors",
+				vdev.Name,
+				vdev.ReadErrors,
+				vdev.WriteErrors,
+				vdev.ChecksumErrors,
+			))
+		}
+	}
+
+	if status.ScrubErrors != nil && *status.ScrubErrors > 0 {
+		problems = append(problems, fmt.Sprintf("last scrub found %d errors", *status.ScrubErrors))
+	}
+
+	if status.DataErrors != "" && status.DataErrors != "No known data errors" {
+		problems = append(problems, status.DataErrors)
+	}
+
+	return problems
+}
+
+func (z *Zfs) GetPoolStatus(ctx context.Context, poolName string) (PoolStatus, error) {
+	return z.backend.PoolStatus(ctx, poolName)
+}
+
+func ParsePoolStatus(output string) (PoolStatus, error) {
+	status := PoolStatus{ScrubState: ScrubNone}
+	inConfig := false
+
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "state:"):
+			status.State = strings.TrimSpace(strings.TrimPrefix(trimmed, "state:"))
+
+		case strings.HasPrefix(trimmed, "scan:"):
+			status.Scan = strings.TrimSpace(strings.TrimPrefix(trimmed, "scan:"))
+			parseScan(&status)
+
+		case strings.HasPrefix(trimmed, "config:"):
+			inConfig = true
+
+		case strings.HasPrefix(trimmed, "errors:"):
+			inConfig = false
+			status.DataErrors = strings.TrimSpace(strings.TrimPrefix(trimmed, "errors:"))
+
+		case inConfig && trimmed != "" && !strings.HasPrefix(trimmed, "NAME"):
+			if vdev, ok := parseVdev(line); ok {
+				status.Vdevs = append(status.Vdevs, vdev)
+			}
+		}
+	}
+
+	if status.State == "" {
+		return PoolStatus{}, fmt.Errorf("no pool state in zpool status output")
+	}
+
+	return status, nil
+}
+
+func parseScan(status *PoolStatus) {
+	scan := status.Scan
+
+	switch {
+	case !strings.HasPrefix(scan, "scrub"):
+		// Resilvers and "none requested" don't tell anything about the last scrub
+		return
+	case strings.Contains(scan, "in progress"):
+		status.ScrubState = ScrubInProgress
+	case strings.Contains(scan, "canceled"):
+		status.ScrubState = ScrubCanceled
+	default:
+		status.ScrubState = ScrubFinished
+	}
+
+	if match := scrubErrorsPattern.FindStringSubmatch(scan); match != nil {
+		if errors, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			status.ScrubErrors = &errors
+		}
+	}
+
+	if match := scrubRepairedPattern.FindStringSubmatch(scan); match != nil {
+		status.ScrubRepaired = &match[1]
+	}
+}
+
+// parseVdev parses a row of the config tree. The rows are indented by two spaces per level, below a
+// single tab.
+func parseVdev(line string) (Vdev, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return Vdev{}, false
+	}
+
+	counts := make([]int64, 3)
+	for i := range counts {
+		count, err := strconv.ParseInt(fields[i+2], 10, 64)
+		if err != nil {
+			return Vdev{}, false
+		}
+
+		counts[i] = count
+	}
+
+	indent := len(strings.TrimLeft(line, "\t")) - len(strings.TrimLeft(strings.TrimLeft(line, "\t"), " "))
+
+	return Vdev{
+		Name:           fields[0],
+		State:          fields[1],
+		ReadErrors:     counts[0],
+		WriteErrors:    counts[1],
+		ChecksumErrors: counts[2],
+		Depth:          indent / 2,
+	}, true
+}
+
+// Scrub starts a scrub of the pool. It returns as soon as the scrub has started.
+func (z *Zfs) Scrub(ctx context.Context, poolName string) error {
+	if err := z.backend.Scrub(ctx, poolName); err != nil {
+		log.Errorf("Failed to start scrub of pool: %s, error: %s", poolName, err)
+		return err
+	}
+
+	return nil
+}
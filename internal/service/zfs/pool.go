@@ -7,18 +7,21 @@ import (
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/dto/repo"
 	"github.com/jamius19/postbranch/internal/logger"
-	"github.com/jamius19/postbranch/internal/runner"
+	"github.com/jamius19/postbranch/internal/opts"
 	"github.com/jamius19/postbranch/internal/service/pg"
 	"github.com/jamius19/postbranch/web/responseerror"
 	"os"
+	"path/filepath"
 	"slices"
-	"strings"
 	"sync"
 )
 
 var log = logger.Logger
 
-func VirtualPool(ctx context.Context, repoinit repo.Info) (model.ZfsPool, error) {
+// resizeMu makes sure only one pool resize runs at a time
+var resizeMu sync.Mutex
+
+func (z *Zfs) VirtualPool(ctx context.Context, repoinit repo.Info) (model.ZfsPool, error) {
 	log.Infof("ZFS Pool init %v", repoinit)
 
 	if err := CreateSparseFile(repoinit.GetPath(), repoinit.GetSizeInMb()); err != nil {
@@ -26,13 +29,13 @@ func VirtualPool(ctx context.Context, repoinit repo.Info) (model.ZfsPool, error)
 		return model.ZfsPool{}, responseerror.From("Failed to create sparse file")
 	}
 
-	loopNo, err := SetupLoopDevice(repoinit.GetPath())
+	devicePath, err := z.devices.Attach(repoinit.GetPath())
 	if err != nil {
 		log.Errorf("Failed to setup loopback device. Error: %s", err)
 		return model.ZfsPool{}, responseerror.From("Failed to setup loopback device")
 	}
 
-	pool, err := createPool(ctx, repoinit, loopNo)
+	pool, err := z.createPool(ctx, repoinit, devicePath)
 	if err != nil {
 		log.Errorf("Failed to create createPool: %s", err)
 		return model.ZfsPool{}, err
@@ -41,22 +44,27 @@ func VirtualPool(ctx context.Context, repoinit repo.Info) (model.ZfsPool, error)
 	return pool, nil
 }
 
-func createPool(ctx context.Context, repoinit repo.Info, loopNo int) (model.ZfsPool, error) {
-	devicePath := fmt.Sprintf("/dev/loop%d", loopNo)
-	mountPath := fmt.Sprintf("/mnt/pb-%s", repoinit.GetName())
-
-	_, err := runner.Single(
-		"create-zpool",
-		false,
-		false,
-		"zpool",
-		"create", "-m",
-		mountPath,
-		repoinit.GetName(),
-		devicePath,
-	)
+func (z *Zfs) createPool(ctx context.Context, repoinit repo.Info, devicePath string) (model.ZfsPool, error) {
+	mountPath := filepath.Join(opts.Config.Pool.MountDir, "pb-"+repoinit.GetName())
 
-	if err != nil {
+	encryption := repoinit.GetEncryption()
+
+	spec := PoolSpec{
+		Name:           repoinit.GetName(),
+		DevicePath:     devicePath,
+		MountPath:      mountPath,
+		PoolProperties: poolFeatureProperties(),
+		RootProperties: append(
+			rootProperties(repoinit.GetDatasetProperties()),
+			encryptionProperties(encryption)...,
+		),
+	}
+
+	if encryption != nil && encryption.KeyFile == "" {
+		spec.Passphrase = encryption.Passphrase
+	}
+
+	if err := z.backend.CreatePool(ctx, spec); err != nil {
 		log.Errorf("Failed to create createPool: %s", err)
 		return model.ZfsPool{}, err
 	}
@@ -70,6 +78,14 @@ func createPool(ctx context.Context, repoinit repo.Info, loopNo int) (model.ZfsP
 		PoolType:  repoinit.GetRepoType(),
 	}
 
+	if encryption != nil {
+		algorithm := repo.EncryptionAlgorithm
+		keyLocation := encryption.GetKeyLocation()
+
+		poolData.Encryption = &algorithm
+		poolData.KeyLocation = &keyLocation
+	}
+
 	pool, err := db.CreatePool(ctx, poolData)
 	if err != nil {
 		// TODO: Cleanup Pool
@@ -82,7 +98,67 @@ func createPool(ctx context.Context, repoinit repo.Info, loopNo int) (model.ZfsP
 	return pool, nil
 }
 
-func MountAll(ctx context.Context) error {
+// CheckResize checks that the pool can be resized to the new size
+func CheckResize(pool model.ZfsPool, sizeInMb int64) error {
+	if pool.PoolType != "virtual" {
+		return responseerror.From("Only virtual pools can be resized")
+	}
+
+	if sizeInMb <= pool.SizeInMb {
+		return responseerror.From(
+			fmt.Sprintf("Pools can't be shrunk, new size must be larger than %d MB", pool.SizeInMb),
+		)
+	}
+
+	return nil
+}
+
+// ResizeVirtualPool grows the image file of a virtual pool and expands the pool to use the new space.
+// The pool stays online while it's resized.
+func (z *Zfs) ResizeVirtualPool(ctx context.Context, pool model.ZfsPool, sizeInMb int64) (model.ZfsPool, error) {
+	if err := CheckResize(pool, sizeInMb); err != nil {
+		return model.ZfsPool{}, err
+	}
+
+	resizeMu.Lock()
+	defer resizeMu.Unlock()
+
+	devices, err := z.devices.Find(pool.Path)
+	if err != nil || len(devices) == 0 {
+		log.Errorf("Failed to find loopback device for pool %s: %v", pool.Name, err)
+		return model.ZfsPool{}, responseerror.From("Pool is not mounted")
+	}
+
+	log.Infof("Resizing pool %s from %d MB to %d MB", pool.Name, pool.SizeInMb, sizeInMb)
+
+	if err := GrowSparseFile(pool.Path, sizeInMb); err != nil {
+		log.Errorf("Failed to grow sparse file. Error: %s", err)
+		return model.ZfsPool{}, responseerror.From("Failed to grow virtual disk file")
+	}
+
+	for _, device := range devices {
+		if err := z.devices.Refresh(device); err != nil {
+			log.Errorf("Failed to refresh loopback device. Error: %s", err)
+			return model.ZfsPool{}, responseerror.From("Failed to refresh loopback device")
+		}
+
+		if err := z.backend.ExpandDevice(ctx, pool.Name, device); err != nil {
+			log.Errorf("Failed to expand pool %s: %s", pool.Name, err)
+			return model.ZfsPool{}, err
+		}
+	}
+
+	resizedPool, err := db.UpdatePoolSize(ctx, *pool.ID, sizeInMb)
+	if err != nil {
+		return model.ZfsPool{}, responseerror.From("Failed to update pool size")
+	}
+
+	log.Infof("Pool %s resized to %d MB", pool.Name, sizeInMb)
+
+	return resizedPool, nil
+}
+
+func (z *Zfs) MountAll(ctx context.Context) error {
 	repoDetails, err := db.ListRepo(ctx)
 	if err != nil {
 		log.Errorf("Failed to list pools: %s", err)
@@ -103,13 +179,14 @@ func MountAll(ctx context.Context) error {
 	log.Infof("Stopping potential dangling postgres instances")
 	for _, repoDetail := range repoDetails {
 		for _, branch := range repoDetail.Branches {
-			if branch.Status == string(db.BranchClosed) {
+			if branch.Status != string(db.BranchOpen) {
 				continue
 			}
 
 			poolWg.Add(1)
 
 			go pg.StopDangingPg(
+				ctx,
 				repoDetail.Repo.PgPath,
 				repoDetail.Pool.MountPath,
 				branch.Name,
@@ -136,7 +213,7 @@ func MountAll(ctx context.Context) error {
 		}
 
 		if pool.PoolType == "virtual" {
-			if err := setupLoopback(&pool); err != nil {
+			if err := z.setupLoopback(ctx, &pool); err != nil {
 				failedPools = append(failedPools, pool.Name)
 				log.Errorf("Failed to setup loopback for pool %v: %s", pool, err)
 			}
@@ -144,6 +221,11 @@ func MountAll(ctx context.Context) error {
 			log.Infof("Pool is not virtual, skipping loopback setup. pool %v", repoDetail.Pool)
 		}
 
+		// A degraded pool stays in WARNING until the health check finds it healthy again
+		if repoDetail.Repo.Status == string(db.RepoWarning) {
+			continue
+		}
+
 		_, err := db.UpdateRepoStatus(ctx, *repoDetail.Repo.ID, db.RepoCompleted, "")
 		if err != nil {
 			log.Errorf("Failed to update repo status: %s", err)
@@ -157,15 +239,47 @@ func MountAll(ctx context.Context) error {
 	if len(failedPools) < len(repoDetails) {
 		log.Infof("**** Importing all pools. This is a time consuming operation. Please wait. ****")
 
-		output, err := runner.Single("import-zpools", false, false, "zpool", "import", "-a")
-		if err != nil {
-			log.Errorf("Failed to import zpools: %s, output: %s", err, output)
+		if err := z.backend.ImportPools(ctx); err != nil {
+			log.Errorf("Failed to import zpools: %s", err)
 			return err
 		}
 
 		log.Infof("%d pool(s) are mounted.", len(repoDetails))
 	}
 
+	// lockedPools are encrypted pools whose key isn't available, their branches start once unlocked
+	var lockedPools []string
+
+	for _, repoDetail := range repoDetails {
+		pool := repoDetail.Pool
+		if !IsEncrypted(pool) || slices.Contains(failedPools, pool.Name) {
+			continue
+		}
+
+		var lockReason string
+
+		if HasKeyFile(pool) {
+			if err := z.LoadKey(ctx, pool, ""); err != nil {
+				lockReason = fmt.Sprintf("Failed to load key from %s", *pool.KeyLocation)
+			}
+		} else {
+			lockReason = "Repository is encrypted, unlock it with the passphrase to start its branches"
+		}
+
+		if lockReason == "" {
+			continue
+		}
+
+		lockedPools = append(lockedPools, pool.Name)
+
+		_, err := db.UpdateRepoStatus(ctx, *repoDetail.Repo.ID, db.RepoLocked, lockReason)
+		if err != nil {
+			log.Errorf("Failed to update repo status: %s", err)
+		}
+
+		log.Warnf("Repo %s is locked: %s", repoDetail.Repo.Name, lockReason)
+	}
+
 	select {
 	case <-ctx.Done():
 		log.Infof("Root Context cancelled. Skipping database start")
@@ -176,12 +290,25 @@ func MountAll(ctx context.Context) error {
 	log.Infof("**** Importing all databases. Please wait. ****")
 
 	for _, repoDetail := range repoDetails {
-		if slices.Contains(failedPools, repoDetail.Repo.Name) {
+		if slices.Contains(failedPools, repoDetail.Pool.Name) || slices.Contains(lockedPools, repoDetail.Pool.Name) {
+			continue
+		}
+
+		// A branch whose dataset is gone can't start, the reconciler reports it
+		datasets, err := z.ListBranchDatasets(ctx, repoDetail.Pool.Name)
+		if err != nil {
+			log.Errorf("Failed to list datasets of repo %s, not starting its branches", repoDetail.Repo.Name)
 			continue
 		}
 
 		for _, branch := range repoDetail.Branches {
-			if branch.Status == string(db.BranchClosed) {
+			if branch.Status != string(db.BranchOpen) {
+				continue
+			}
+
+			dataset := DatasetName(repoDetail.Pool.Name, branch.Name)
+			if !slices.ContainsFunc(datasets, func(d Dataset) bool { return d.Name == dataset }) {
+				log.Warnf("Dataset %s of branch %s is missing, not starting it", dataset, branch.Name)
 				continue
 			}
 
@@ -206,31 +333,29 @@ func MountAll(ctx context.Context) error {
 	return nil
 }
 
-func setupLoopback(pool *model.ZfsPool) error {
-	err := cleanDanglingLoopbackDevices(pool)
+func (z *Zfs) setupLoopback(ctx context.Context, pool *model.ZfsPool) error {
+	err := z.cleanDanglingLoopbackDevices(ctx, pool)
 	if err != nil {
 		return err
 	}
 
 	log.Infof("Setting up loopbacks for pool %v", pool)
-	if _, err := SetupLoopDevice(pool.Path); err != nil {
+	if _, err := z.devices.Attach(pool.Path); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func cleanDanglingLoopbackDevices(pool *model.ZfsPool) error {
+func (z *Zfs) cleanDanglingLoopbackDevices(ctx context.Context, pool *model.ZfsPool) error {
 	log.Infof("Unmounting in case it's already mounted. pool %v", pool)
-	_, err := runner.Single("zpool-export", true, false, "zpool", "export", pool.Name)
-
-	if err != nil {
+	if err := z.backend.ExportPool(ctx, pool.Name); err != nil {
 		log.Infof("Pool is not mounted. Continuing. pool: %v", pool)
 	} else {
 		log.Warnf("Pool is already mounted. Unmounting it. pool: %v", pool)
 	}
 
-	devices, err := FindLoopDeviceFromSys(pool.Path)
+	devices, err := z.devices.Find(pool.Path)
 	if err != nil {
 		log.Errorf("Failed to find loopback for pool %v, error: %s", pool, err)
 		return err
@@ -242,21 +367,57 @@ func cleanDanglingLoopbackDevices(pool *model.ZfsPool) error {
 	}
 
 	for _, device := range devices {
-		if err := ReleaseLoopDevice(device); err != nil {
-			return fmt.Errorf("failed to release loopback device: %s", err)
+		if err := z.RemoveLoopDevice(device); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if err := os.Remove(device); err != nil {
-			log.Errorf("Failed to remove loopback device %s: %s", device, err)
-			return err
+// FindStrayLoopDevices returns the loop devices attached to the image of a virtual pool that the pool
+// doesn't use, like the ones left behind by a crash during import
+func (z *Zfs) FindStrayLoopDevices(ctx context.Context, pool model.ZfsPool) ([]string, error) {
+	if pool.PoolType != "virtual" {
+		return nil, nil
+	}
+
+	attached, err := z.devices.Find(pool.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	poolDevices, err := z.backend.ListDevices(ctx, pool.Name)
+	if err != nil {
+		log.Errorf("Failed to list devices for pool: %s, error: %s", pool.Name, err)
+		return nil, err
+	}
+
+	var stray []string
+	for _, device := range attached {
+		if !slices.Contains(poolDevices, device) {
+			stray = append(stray, device)
 		}
 	}
+
+	return stray, nil
+}
+
+// RemoveLoopDevice detaches the image from the loop device and removes the device node
+func (z *Zfs) RemoveLoopDevice(device string) error {
+	if err := z.devices.Detach(device); err != nil {
+		log.Errorf("Failed to remove loopback device %s: %s", device, err)
+		return err
+	}
+
 	return nil
 }
 
-func UnmountAll() error {
+// UnmountAll runs on shutdown, so it's called with a context that outlives the root context
+func (z *Zfs) UnmountAll(ctx context.Context) error {
 	log.Infof("Unmounting all pools")
-	repoDetails, err := db.ListRepoWithStatus(context.Background(), db.RepoCompleted)
+	// Locked repos are imported as well, only their datasets aren't mounted
+	statuses := append([]db.RepoStatus{db.RepoLocked}, db.ActiveRepoStatuses...)
+	repoDetails, err := db.ListRepoWithStatus(ctx, statuses...)
 
 	if err != nil {
 		log.Errorf("Failed to list repoDetails: %s", err)
@@ -270,11 +431,15 @@ func UnmountAll() error {
 
 	log.Infof("Stopping all databases")
 	var poolWg sync.WaitGroup
-	ctx := context.Background()
 
 	for _, repoDetail := range repoDetails {
+		// The branches of a locked repo were never started
+		if repoDetail.Repo.Status == string(db.RepoLocked) {
+			continue
+		}
+
 		for _, branch := range repoDetail.Branches {
-			if branch.Status == string(db.BranchClosed) {
+			if branch.Status != string(db.BranchOpen) {
 				continue
 			}
 
@@ -296,7 +461,7 @@ func UnmountAll() error {
 	log.Infof("All databases are stopped")
 
 	for _, repoDetail := range repoDetails {
-		if err := Unmount(repoDetail.Pool); err != nil {
+		if err := z.Unmount(ctx, repoDetail.Pool); err != nil {
 			log.Errorf("Failed to unmount pool: %v, error: %s", repoDetail.Pool, err)
 			return err
 		}
@@ -305,32 +470,28 @@ func UnmountAll() error {
 	return nil
 }
 
-func Unmount(pool model.ZfsPool) error {
+func (z *Zfs) Unmount(ctx context.Context, pool model.ZfsPool) error {
 	log.Infof("Unmounting pool %v", pool)
 
-	loopbackPath, err := FindDevicePath(pool.Name)
+	loopbackPath, err := z.FindDevicePath(ctx, pool.Name)
 	if err != nil {
 		return err
 	}
 
-	_, err = runner.Single(
-		"zpool-export",
-		false,
-		false,
-		"zpool", "export", pool.Name,
-	)
+	if IsEncrypted(pool) {
+		if err := z.UnloadKey(ctx, pool); err != nil {
+			return err
+		}
+	}
 
-	if err != nil {
+	if err := z.backend.ExportPool(ctx, pool.Name); err != nil {
+		log.Errorf("Failed to export pool: %s, error: %s", pool.Name, err)
 		return err
 	}
 
 	if pool.PoolType == "virtual" {
-		if err := ReleaseLoopDevice(loopbackPath); err != nil {
-			return fmt.Errorf("failed to release loopback device: %s", err)
-		}
-
-		if err := os.Remove(loopbackPath); err != nil {
-			return fmt.Errorf("failed to remove loopback device: %w", err)
+		if err := z.devices.Detach(loopbackPath); err != nil {
+			return err
 		}
 	}
 
@@ -341,19 +502,27 @@ func Unmount(pool model.ZfsPool) error {
 	return nil
 }
 
-func FindDevicePath(poolName string) (string, error) {
-	devicePath, err := runner.Single(
-		"find-zpool-device",
-		false,
-		false,
-		"su", "-c",
-		fmt.Sprintf(FindLoopBackFromZpoolCmd, poolName),
-	)
-
+// FindDevicePath returns the first disk of the pool, which for a virtual pool is its loopback device
+func (z *Zfs) FindDevicePath(ctx context.Context, poolName string) (string, error) {
+	devices, err := z.backend.ListDevices(ctx, poolName)
 	if err != nil {
-		log.Errorf("Failed to get path path for pool: %s, error: %s", poolName, err)
+		log.Errorf("Failed to get device path for pool: %s, error: %s", poolName, err)
 		return "", err
 	}
 
-	return "/dev/" + strings.TrimSpace(devicePath), nil
+	if len(devices) == 0 {
+		return "", nil
+	}
+
+	return devices[0], nil
+}
+
+// DestroyPool destroys the pool even if its datasets are busy
+func (z *Zfs) DestroyPool(ctx context.Context, poolName string) error {
+	if err := z.backend.DestroyPool(ctx, poolName); err != nil {
+		log.Errorf("Failed to destroy pool: %s, error: %s", poolName, err)
+		return err
+	}
+
+	return nil
 }
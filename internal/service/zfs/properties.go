@@ -0,0 +1,114 @@
+package zfs
+
+import (
+	"context"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto/repo"
+	"os"
+	"path/filepath"
+)
+
+// walRecordSizeProperty is a user property on the pool root. It's only set when the repo keeps the
+// WAL of each branch in a separate dataset, and holds the record size of those datasets.
+const walRecordSizeProperty = "postbranch:wal_recordsize"
+
+var reportedProperties = []string{
+	"compression",
+	"compressratio",
+	"recordsize",
+	"atime",
+	"logbias",
+	"primarycache",
+	walRecordSizeProperty,
+}
+
+type DatasetProperty struct {
+	Value  string
+	Source string
+}
+
+// rootProperties returns the properties set on the pool root when it's created
+func rootProperties(properties repo.DatasetProperties) []Property {
+	rootProperties := []Property{
+		{Name: "compression", Value: properties.Compression},
+		{Name: "recordsize", Value: properties.RecordSize},
+		{Name: "atime", Value: properties.Atime},
+		{Name: "logbias", Value: properties.Logbias},
+		{Name: "primarycache", Value: properties.PrimaryCache},
+	}
+
+	if properties.SeparateWal != nil && *properties.SeparateWal {
+		rootProperties = append(rootProperties, Property{Name: walRecordSizeProperty, Value: properties.WalRecordSize})
+	}
+
+	return rootProperties
+}
+
+// WalDatasetPath creates the WAL dataset of a branch if the repo keeps the WAL separately, and
+// returns its mount path. The path is empty if the WAL is kept in the data directory.
+func (z *Zfs) WalDatasetPath(ctx context.Context, pool model.ZfsPool, branchName string) (string, error) {
+	walRecordSize, err := z.backend.GetProperty(ctx, pool.Name, walRecordSizeProperty)
+	if err != nil {
+		log.Errorf("Failed to get wal record size of pool: %s, error: %s", pool.Name, err)
+		return "", err
+	}
+
+	if walRecordSize == "" || walRecordSize == "-" {
+		return "", nil
+	}
+
+	datasetName := DatasetName(pool.Name, branchName) + "/" + repo.WalDataset
+	walPath := filepath.Join(pool.MountPath, branchName, repo.WalDataset)
+
+	if _, err := os.Stat(walPath); err == nil {
+		log.Infof("WAL dataset %s already exists", datasetName)
+		return walPath, nil
+	}
+
+	err = z.backend.CreateDataset(
+		ctx,
+		datasetName,
+		Property{Name: "recordsize", Value: walRecordSize},
+		Property{Name: "logbias", Value: "latency"},
+	)
+
+	if err != nil {
+		log.Errorf("Failed to create wal dataset: %s, error: %s", datasetName, err)
+		return "", err
+	}
+
+	log.Infof("Created WAL dataset %s with record size %s", datasetName, walRecordSize)
+	return walPath, nil
+}
+
+// ListDatasetProperties returns the tuned properties of every filesystem in the pool, along with
+// where each value comes from, keyed by dataset name.
+func (z *Zfs) ListDatasetProperties(ctx context.Context, poolName string) (map[string]map[string]DatasetProperty, error) {
+	values, err := z.backend.GetProperties(
+		ctx,
+		poolName,
+		GetOptions{Recursive: true, Types: "filesystem"},
+		reportedProperties...,
+	)
+
+	if err != nil {
+		log.Errorf("Failed to get dataset properties for pool: %s, error: %s", poolName, err)
+		return nil, err
+	}
+
+	properties := make(map[string]map[string]DatasetProperty)
+
+	for _, value := range values {
+		if value.Value == "-" {
+			continue
+		}
+
+		if properties[value.Name] == nil {
+			properties[value.Name] = make(map[string]DatasetProperty)
+		}
+
+		properties[value.Name][value.Property] = DatasetProperty{Value: value.Value, Source: value.Source}
+	}
+
+	return properties, nil
+}
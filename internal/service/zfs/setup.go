@@ -10,6 +10,38 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// LoopDevices attaches the images of virtual pools to loop devices
+type LoopDevices struct{}
+
+func (LoopDevices) Attach(imgPath string) (string, error) {
+	loopNo, err := SetupLoopDevice(imgPath)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("/dev/loop%d", loopNo), nil
+}
+
+func (LoopDevices) Detach(device string) error {
+	if err := ReleaseLoopDevice(device); err != nil {
+		return fmt.Errorf("failed to release loopback device: %s", err)
+	}
+
+	if err := os.Remove(device); err != nil {
+		return fmt.Errorf("failed to remove loopback device: %w", err)
+	}
+
+	return nil
+}
+
+func (LoopDevices) Find(imgPath string) ([]string, error) {
+	return FindLoopDeviceFromSys(imgPath)
+}
+
+func (LoopDevices) Refresh(device string) error {
+	return RefreshLoopDeviceCapacity(device)
+}
+
 func findFreeLoopNo() (int, error) {
 	controlFd, err := os.OpenFile("/dev/loop-control", os.O_RDWR, 0)
 	if err != nil {
@@ -32,7 +64,7 @@ func CreateSparseFile(imgPath string, sizeInMb int64) error {
 	_, path := util.SplitPath(imgPath)
 	log.Infof("Creating virtual disk file at %s", imgPath)
 
-	err := util.CreateDirectories(path, "root", 0600)
+	err := os.MkdirAll(path, 0700)
 	if err != nil {
 		return fmt.Errorf("failed to create directories for the sparse file. Error: %s", err)
 	}
@@ -58,6 +90,56 @@ func CreateSparseFile(imgPath string, sizeInMb int64) error {
 	return nil
 }
 
+// GrowSparseFile extends the image file to the new size. The added space is sparse, so it doesn't
+// take up any disk space until it's written to.
+func GrowSparseFile(imgPath string, sizeInMb int64) error {
+	file, err := os.OpenFile(imgPath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	sizeInBytes := sizeInMb * 1024 * 1024
+
+	if sizeInBytes < info.Size() {
+		return fmt.Errorf("new size %d bytes is smaller than the current size %d bytes", sizeInBytes, info.Size())
+	}
+
+	// A resize that failed after growing the file leaves it at the new size, the retry goes on from there
+	if sizeInBytes == info.Size() {
+		log.Infof("Virtual disk file %s is already %d MB", imgPath, sizeInMb)
+		return nil
+	}
+
+	if err := file.Truncate(sizeInBytes); err != nil {
+		return fmt.Errorf("failed to set file size: %w", err)
+	}
+
+	log.Infof("Virtual disk file %s grown to %d MB", imgPath, sizeInMb)
+	return nil
+}
+
+// RefreshLoopDeviceCapacity makes the loop device pick up the new size of its backing file
+func RefreshLoopDeviceCapacity(loopDevice string) error {
+	loopFd, err := os.OpenFile(loopDevice, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open loop device %s: %w", loopDevice, err)
+	}
+	defer loopFd.Close()
+
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, loopFd.Fd(), unix.LOOP_SET_CAPACITY, 0); errno != 0 {
+		return fmt.Errorf("ioctl LOOP_SET_CAPACITY failed: %w", errno)
+	}
+
+	log.Infof("Refreshed capacity of loop device %s", loopDevice)
+	return nil
+}
+
 func SetupLoopDevice(imgFilePath string) (int, error) {
 	loopNo, err := findFreeLoopNo()
 	if err != nil {
@@ -0,0 +1,41 @@
+package zfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrowSparseFileRetry(t *testing.T) {
+	imgPath := filepath.Join(t.TempDir(), "pool.img")
+
+	if err := os.WriteFile(imgPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Truncate(imgPath, 100*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := GrowSparseFile(imgPath, 200); err != nil {
+		t.Fatalf("GrowSparseFile() returned error: %s", err)
+	}
+
+	// A resize that failed after growing the file is retried with the same size
+	if err := GrowSparseFile(imgPath, 200); err != nil {
+		t.Fatalf("retried GrowSparseFile() returned error: %s", err)
+	}
+
+	info, err := os.Stat(imgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Size() != 200*1024*1024 {
+		t.Errorf("file size = %d, want %d", info.Size(), 200*1024*1024)
+	}
+
+	if err := GrowSparseFile(imgPath, 150); err == nil {
+		t.Error("GrowSparseFile() shrunk the file")
+	}
+}
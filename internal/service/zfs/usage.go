@@ -0,0 +1,95 @@
+package zfs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type PoolUsage struct {
+	Size      int64
+	Allocated int64
+	Free      int64
+
+	// Fragmentation is nil when the pool doesn't report it
+	Fragmentation *int64
+}
+
+// DatasetUsage has the space accounting of a filesystem or snapshot. UsedBySnapshots is always zero
+// for snapshots.
+type DatasetUsage struct {
+	Name            string
+	Used            int64
+	Referenced      int64
+	Written         int64
+	UsedBySnapshots int64
+	Available       int64
+	CompressRatio   float64
+}
+
+func (z *Zfs) GetPoolUsage(ctx context.Context, poolName string) (PoolUsage, error) {
+	usage, err := z.backend.PoolUsage(ctx, poolName)
+	if err != nil {
+		log.Errorf("Failed to get usage of pool: %s, error: %s", poolName, err)
+		return PoolUsage{}, err
+	}
+
+	return usage, nil
+}
+
+// ListDatasetUsage returns the usage of every filesystem and snapshot in the pool, keyed by name.
+func (z *Zfs) ListDatasetUsage(ctx context.Context, poolName string) (map[string]DatasetUsage, error) {
+	values, err := z.backend.GetProperties(
+		ctx,
+		poolName,
+		GetOptions{Recursive: true, Types: "filesystem,snapshot", Parsable: true},
+		"used", "referenced", "written", "usedbysnapshots", "available", "compressratio",
+	)
+
+	if err != nil {
+		log.Errorf("Failed to get dataset usage for pool: %s, error: %s", poolName, err)
+		return nil, err
+	}
+
+	usages := make(map[string]DatasetUsage)
+
+	for _, propertyValue := range values {
+		if propertyValue.Value == "-" {
+			continue
+		}
+
+		name, property, value := propertyValue.Name, propertyValue.Property, propertyValue.Value
+
+		usage := usages[name]
+		usage.Name = name
+
+		if property == "compressratio" {
+			usage.CompressRatio, err = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		} else {
+			var bytes int64
+			bytes, err = strconv.ParseInt(value, 10, 64)
+
+			switch property {
+			case "used":
+				usage.Used = bytes
+			case "referenced":
+				usage.Referenced = bytes
+			case "written":
+				usage.Written = bytes
+			case "usedbysnapshots":
+				usage.UsedBySnapshots = bytes
+			case "available":
+				usage.Available = bytes
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %s for %s: %w", property, value, name, err)
+		}
+
+		usages[name] = usage
+	}
+
+	return usages, nil
+}
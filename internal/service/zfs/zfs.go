@@ -1,36 +1,212 @@
 package zfs
 
 import (
-	"github.com/jamius19/postbranch/internal/logger"
+	"context"
+	"fmt"
 	"github.com/jamius19/postbranch/internal/runner"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	FindLoopBackFromZpoolCmd = "zpool list -v %s | grep '^  loop' | awk '{print $1}'"
+	kmodVersionPath     = "/sys/module/zfs/version"
+	versionCheckTimeout = 10 * time.Second
 )
 
-var zfsVersions = []string{
-	"2.1.5",
+var (
+	// MinVersion is the oldest supported release. Releases from MaxTestedVersion on are allowed, but
+	// haven't been tested.
+	MinVersion       = SemVer{Major: 2, Minor: 1, Patch: 5}
+	MaxTestedVersion = SemVer{Major: 2, Minor: 4, Patch: 0}
+
+	// jsonOutputVersion added -j to zfs and zpool commands
+	jsonOutputVersion = SemVer{Major: 2, Minor: 3, Patch: 0}
+
+	// blockCloningVersion added the block_cloning pool feature, safeBlockCloningVersion fixed the
+	// data corruption it could cause
+	blockCloningVersion     = SemVer{Major: 2, Minor: 2, Patch: 0}
+	safeBlockCloningVersion = SemVer{Major: 2, Minor: 2, Patch: 2}
+
+	semVerPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+)
+
+type SemVer struct {
+	Major int
+	Minor int
+	Patch int
 }
 
-func Version() (*string, bool) {
-	log.Info("Checking ZFS availability")
+func ParseSemVer(version string) (SemVer, error) {
+	match := semVerPattern.FindStringSubmatch(version)
+	if match == nil {
+		return SemVer{}, fmt.Errorf("no version found in %q", version)
+	}
+
+	var semVer SemVer
+	semVer.Major, _ = strconv.Atoi(match[1])
+	semVer.Minor, _ = strconv.Atoi(match[2])
+
+	if match[3] != "" {
+		semVer.Patch, _ = strconv.Atoi(match[3])
+	}
+
+	return semVer, nil
+}
+
+func (v SemVer) Compare(other SemVer) int {
+	switch {
+	case v.Major != other.Major:
+		return v.Major - other.Major
+	case v.Minor != other.Minor:
+		return v.Minor - other.Minor
+	default:
+		return v.Patch - other.Patch
+	}
+}
+
+func (v SemVer) AtLeast(other SemVer) bool {
+	return v.Compare(other) >= 0
+}
+
+func (v SemVer) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+type VersionInfo struct {
+	Userland SemVer
+	Kmod     SemVer
+
+	// The raw versions keep the distro suffix, like 2.2.2-0ubuntu9
+	UserlandRaw string
+	KmodRaw     string
+}
+
+// Capabilities are the optional features of the running ZFS. They're based on the older of the
+// userland and kernel module, since a feature needs both.
+type Capabilities struct {
+	JsonOutput   bool
+	BlockCloning bool
+}
 
-	zfsOutput, err := runner.Single("zfs-version-check", true, false, "zfs", "--version")
+// Detected and Features are set by CheckVersion on startup
+var (
+	Detected VersionInfo
+	Features Capabilities
+)
+
+// DetectVersion reads the userland and kernel module versions. The kernel module version is read
+// from sysfs if zfs --version doesn't report it.
+func DetectVersion() (VersionInfo, error) {
+	output, err := runner.Run(
+		context.Background(),
+		runner.Options{Key: "zfs-version-check", SkipLog: true, Timeout: versionCheckTimeout},
+		"zfs", "--version",
+	)
 
-	if err != nil || zfsOutput == runner.EmptyOutput {
-		return nil, false
+	if err != nil || output == runner.EmptyOutput {
+		return VersionInfo{}, fmt.Errorf("zfs command is not available")
 	}
 
-	version := strings.Replace(zfsOutput, "\n", "\\\\", -1)
+	var info VersionInfo
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "zfs-kmod-"):
+			info.KmodRaw = strings.TrimPrefix(line, "zfs-kmod-")
+		case strings.HasPrefix(line, "zfs-"):
+			info.UserlandRaw = strings.TrimPrefix(line, "zfs-")
+		}
+	}
 
-	logger.Logger.Infof("ZFS version: %s", version)
-	for _, v := range zfsVersions {
-		if strings.Contains(version, v) {
-			return &v, true
+	if info.KmodRaw == "" {
+		if kmodVersion, err := os.ReadFile(kmodVersionPath); err == nil {
+			info.KmodRaw = strings.TrimSpace(string(kmodVersion))
 		}
 	}
 
-	return nil, false
+	if info.UserlandRaw == "" {
+		return VersionInfo{}, fmt.Errorf("can't find the userland version in %q", output)
+	}
+
+	if info.KmodRaw == "" {
+		return VersionInfo{}, fmt.Errorf("zfs kernel module is not loaded, load it with modprobe zfs")
+	}
+
+	if info.Userland, err = ParseSemVer(info.UserlandRaw); err != nil {
+		return VersionInfo{}, err
+	}
+
+	if info.Kmod, err = ParseSemVer(info.KmodRaw); err != nil {
+		return VersionInfo{}, err
+	}
+
+	return info, nil
+}
+
+// CheckVersion makes sure the installed ZFS is supported and detects its capabilities. The error
+// explains what's wrong, so it can be shown as is.
+func CheckVersion() (VersionInfo, error) {
+	log.Info("Checking ZFS availability")
+
+	info, err := DetectVersion()
+	if err != nil {
+		return VersionInfo{}, err
+	}
+
+	log.Infof("ZFS userland version: %s, kernel module version: %s", info.UserlandRaw, info.KmodRaw)
+
+	if info.Userland.Major != info.Kmod.Major || info.Userland.Minor != info.Kmod.Minor {
+		return VersionInfo{}, fmt.Errorf(
+			"zfs userland %s doesn't match the kernel module %s. This usually happens after an upgrade "+
+				"without a reboot, reboot or reload the zfs module so that both are on the same release",
+			info.UserlandRaw,
+			info.KmodRaw,
+		)
+	}
+
+	if info.Userland.Patch != info.Kmod.Patch {
+		log.Warnf("ZFS userland %s and kernel module %s are on different patch releases", info.UserlandRaw, info.KmodRaw)
+	}
+
+	oldest := info.Userland
+	if info.Kmod.Compare(oldest) < 0 {
+		oldest = info.Kmod
+	}
+
+	if !oldest.AtLeast(MinVersion) {
+		return VersionInfo{}, fmt.Errorf("zfs %s is not supported, %s or newer is required", oldest, MinVersion)
+	}
+
+	if oldest.AtLeast(MaxTestedVersion) {
+		log.Warnf("ZFS %s is newer than the tested releases, which are below %s", oldest, MaxTestedVersion)
+	}
+
+	Detected = info
+	Features = Capabilities{
+		JsonOutput:   oldest.AtLeast(jsonOutputVersion),
+		BlockCloning: oldest.AtLeast(safeBlockCloningVersion),
+	}
+
+	log.Infof("ZFS capabilities: %+v", Features)
+
+	return info, nil
+}
+
+// poolFeatureProperties turns off the pool features which aren't safe on the running ZFS
+func poolFeatureProperties() []Property {
+	oldest := Detected.Userland
+	if Detected.Kmod.Compare(oldest) < 0 {
+		oldest = Detected.Kmod
+	}
+
+	if oldest.AtLeast(blockCloningVersion) && !Features.BlockCloning {
+		return []Property{{Name: "feature@block_cloning", Value: "disabled"}}
+	}
+
+	return nil
 }
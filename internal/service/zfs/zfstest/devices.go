@@ -0,0 +1,73 @@
+package zfstest
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// FakeDevices hands out device names for the images of virtual pools without attaching anything.
+// Like losetup, it refuses to attach an image that doesn't exist or to detach a free device.
+type FakeDevices struct {
+	mu       sync.Mutex
+	next     int
+	attached map[string]string
+}
+
+func NewFakeDevices() *FakeDevices {
+	return &FakeDevices{attached: make(map[string]string)}
+}
+
+func (d *FakeDevices) Attach(imgPath string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, err := os.Stat(imgPath); err != nil {
+		return "", fmt.Errorf("failed to open img file: %w", err)
+	}
+
+	device := fmt.Sprintf("/dev/loop%d", d.next)
+	d.next++
+	d.attached[device] = imgPath
+
+	return device, nil
+}
+
+func (d *FakeDevices) Detach(device string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.attached[device]; !ok {
+		return fmt.Errorf("failed to release loopback device: ioctl LOOP_CLR_FD failed: no such device or address")
+	}
+
+	delete(d.attached, device)
+	return nil
+}
+
+func (d *FakeDevices) Find(imgPath string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var devices []string
+	for device, attachedPath := range d.attached {
+		if attachedPath == imgPath {
+			devices = append(devices, device)
+		}
+	}
+
+	slices.Sort(devices)
+	return devices, nil
+}
+
+func (d *FakeDevices) Refresh(device string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.attached[device]; !ok {
+		return fmt.Errorf("failed to open loop device %s: no such device", device)
+	}
+
+	return nil
+}
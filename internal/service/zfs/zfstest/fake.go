@@ -0,0 +1,1282 @@
+package zfstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jamius19/postbranch/internal/service/zfs"
+)
+
+const fakePoolSize = 10 * 1024 * 1024 * 1024
+
+// fakeReadonlyProperties are computed by the fake and can't be set
+var fakeReadonlyProperties = []string{
+	"name", "type", "origin", "createtxg", "mountpoint", "keystatus",
+	"used", "referenced", "written", "usedbysnapshots", "available", "compressratio",
+}
+
+// fakeLocalOnlyProperties aren't inherited from the parent dataset
+var fakeLocalOnlyProperties = []string{"quota", "refquota", "reservation", "refreservation"}
+
+var fakeDefaultProperties = map[string]string{
+	"compression":  "off",
+	"recordsize":   "128K",
+	"atime":        "on",
+	"logbias":      "latency",
+	"primarycache": "all",
+	"encryption":   "off",
+	"keyformat":    "none",
+	"keylocation":  "none",
+}
+
+// FakeBackend keeps pools, datasets and snapshots in memory. It follows the rules of real ZFS,
+// like refusing to destroy a snapshot with dependent clones or to create a dataset without its
+// parent, and fails with the same messages, so the branch lifecycle can run without root or ZFS.
+//
+// With Materialize set, every filesystem gets a directory at its mount path, a clone starts with a
+// copy of the contents of its origin dataset and a send stream carries the contents along. Snapshots
+// don't keep the contents from the time they were taken, so a rollback doesn't change the directory.
+type FakeBackend struct {
+	Materialize bool
+
+	// PoolSize is the size reported for every pool in bytes
+	PoolSize int64
+
+	mu       sync.Mutex
+	txg      int64
+	pools    map[string]*fakePool
+	datasets map[string]*fakeDataset
+}
+
+type fakePool struct {
+	spec      zfs.PoolSpec
+	imported  bool
+	keyLoaded bool
+	scrubbed  bool
+}
+
+type fakeDataset struct {
+	name       string
+	createTxg  int64
+	properties map[string]string
+	origin     string
+}
+
+func (dataset *fakeDataset) isSnapshot() bool {
+	return strings.Contains(dataset.name, "@")
+}
+
+// fakeStream is what the fake writes for zfs send, it's only understood by the fake itself
+type fakeStream struct {
+	FromSnapshot string
+	Snapshot     string
+	Datasets     []fakeStreamDataset
+}
+
+type fakeStreamDataset struct {
+	// Name is relative to the sent dataset, it's empty for the sent dataset itself
+	Name       string
+	Properties map[string]string
+	Snapshots  []string
+
+	// Files has the contents of the dataset, it's only sent by a materializing fake
+	Files []fakeStreamFile
+}
+
+type fakeStreamFile struct {
+	Path    string
+	Mode    fs.FileMode
+	Link    string
+	Content []byte
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		PoolSize: fakePoolSize,
+		pools:    make(map[string]*fakePool),
+		datasets: make(map[string]*fakeDataset),
+	}
+}
+
+func (f *FakeBackend) CreatePool(_ context.Context, spec zfs.PoolSpec) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.pools[spec.Name]; ok {
+		return fmt.Errorf("cannot create '%s': pool already exists", spec.Name)
+	}
+
+	for _, pool := range f.pools {
+		if pool.spec.DevicePath == spec.DevicePath {
+			return fmt.Errorf("%s is part of active pool '%s'", spec.DevicePath, pool.spec.Name)
+		}
+	}
+
+	pool := &fakePool{spec: spec, imported: true, keyLoaded: true}
+	f.pools[spec.Name] = pool
+
+	root := f.addDataset(spec.Name, "")
+	for _, property := range spec.RootProperties {
+		root.properties[property.Name] = property.Value
+	}
+
+	return f.materialize(spec.Name)
+}
+
+func (f *FakeBackend) DestroyPool(_ context.Context, poolName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return err
+	}
+
+	for name := range f.datasets {
+		if poolOf(name) == poolName {
+			delete(f.datasets, name)
+		}
+	}
+
+	delete(f.pools, poolName)
+
+	if f.Materialize {
+		return os.RemoveAll(pool.spec.MountPath)
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) ImportPools(_ context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, pool := range f.pools {
+		if pool.imported {
+			continue
+		}
+
+		pool.imported = true
+
+		// Keys in a file are loaded on import, passphrases have to be given with load-key
+		pool.keyLoaded = !f.isEncrypted(pool) || strings.HasPrefix(f.localProperty(pool.spec.Name, "keylocation"), "file://")
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) ExportPool(_ context.Context, poolName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return err
+	}
+
+	pool.imported = false
+	pool.keyLoaded = false
+	return nil
+}
+
+func (f *FakeBackend) ExpandDevice(_ context.Context, poolName, devicePath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return err
+	}
+
+	if pool.spec.DevicePath != devicePath {
+		return fmt.Errorf("cannot expand %s: no such device in pool", devicePath)
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) ListDevices(_ context.Context, poolName string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{pool.spec.DevicePath}, nil
+}
+
+func (f *FakeBackend) PoolStatus(_ context.Context, poolName string) (zfs.PoolStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return zfs.PoolStatus{}, err
+	}
+
+	status := zfs.PoolStatus{
+		State:      "ONLINE",
+		ScrubState: zfs.ScrubNone,
+		Vdevs: []zfs.Vdev{
+			{Name: poolName, State: "ONLINE", Depth: 0},
+			{Name: pool.spec.DevicePath, State: "ONLINE", Depth: 1},
+		},
+		DataErrors: "No known data errors",
+	}
+
+	if pool.scrubbed {
+		var scrubErrors int64
+		scrubRepaired := "0B"
+
+		status.ScrubState = zfs.ScrubFinished
+		status.ScrubErrors = &scrubErrors
+		status.ScrubRepaired = &scrubRepaired
+		status.Scan = "scrub repaired 0B in 00:00:00 with 0 errors"
+	}
+
+	return status, nil
+}
+
+func (f *FakeBackend) PoolUsage(_ context.Context, poolName string) (zfs.PoolUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.importedPool(poolName); err != nil {
+		return zfs.PoolUsage{}, err
+	}
+
+	var fragmentation int64
+
+	return zfs.PoolUsage{
+		Size:          f.PoolSize,
+		Allocated:     0,
+		Free:          f.PoolSize,
+		Fragmentation: &fragmentation,
+	}, nil
+}
+
+func (f *FakeBackend) Scrub(_ context.Context, poolName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolName)
+	if err != nil {
+		return err
+	}
+
+	pool.scrubbed = true
+	return nil
+}
+
+func (f *FakeBackend) CreateDataset(_ context.Context, datasetName string, properties ...zfs.Property) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.checkNewDataset("create", datasetName); err != nil {
+		return err
+	}
+
+	dataset := f.addDataset(datasetName, "")
+	for _, property := range properties {
+		dataset.properties[property.Name] = property.Value
+	}
+
+	return f.materialize(datasetName)
+}
+
+func (f *FakeBackend) Snapshot(_ context.Context, snapshotName string, recursive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	datasetName, snapName, ok := strings.Cut(snapshotName, "@")
+	if !ok || snapName == "" {
+		return fmt.Errorf("cannot create snapshot '%s': invalid snapshot name", snapshotName)
+	}
+
+	if _, err := f.filesystem(datasetName); err != nil {
+		return err
+	}
+
+	targets := []string{datasetName}
+	if recursive {
+		targets = append(targets, f.descendantFilesystems(datasetName)...)
+	}
+
+	// Recursive snapshots are atomic, so nothing is created if any of them exists
+	for _, target := range targets {
+		if _, ok := f.datasets[target+"@"+snapName]; ok {
+			return fmt.Errorf("cannot create snapshot '%s@%s': dataset already exists", target, snapName)
+		}
+	}
+
+	f.txg++
+	for _, target := range targets {
+		snapshot := &fakeDataset{
+			name:       target + "@" + snapName,
+			createTxg:  f.txg,
+			properties: make(map[string]string),
+		}
+
+		f.datasets[snapshot.name] = snapshot
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) Clone(_ context.Context, snapshotName, datasetName string, properties ...zfs.Property) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snapshot, ok := f.datasets[snapshotName]
+	if !ok || !snapshot.isSnapshot() || !f.poolImported(snapshotName) {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", snapshotName)
+	}
+
+	if err := f.checkNewDataset("create", datasetName); err != nil {
+		return err
+	}
+
+	clone := f.addDataset(datasetName, snapshotName)
+	for _, property := range properties {
+		clone.properties[property.Name] = property.Value
+	}
+
+	if err := f.materialize(datasetName); err != nil {
+		return err
+	}
+
+	if f.Materialize {
+		sourceDataset := zfs.SnapshotDataset(snapshotName)
+
+		return copyTree(f.mountPath(sourceDataset), f.mountPath(datasetName), f.childMounts(sourceDataset))
+	}
+
+	return nil
+}
+
+// Promote swaps the clone with its origin dataset. The origin snapshot and the older snapshots of the
+// origin dataset move to the clone, and the origin dataset becomes a clone of the moved snapshot.
+func (f *FakeBackend) Promote(_ context.Context, datasetName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	clone, err := f.filesystem(datasetName)
+	if err != nil {
+		return err
+	}
+
+	if clone.origin == "" {
+		return fmt.Errorf("cannot promote '%s': not a cloned filesystem", datasetName)
+	}
+
+	originDatasetName := zfs.SnapshotDataset(clone.origin)
+	originDataset := f.datasets[originDatasetName]
+	originSnapshot := f.datasets[clone.origin]
+
+	var moved []*fakeDataset
+	for _, snapshot := range f.snapshotsOf(originDatasetName) {
+		if snapshot.createTxg > originSnapshot.createTxg {
+			continue
+		}
+
+		_, snapName, _ := strings.Cut(snapshot.name, "@")
+		if _, ok := f.datasets[datasetName+"@"+snapName]; ok {
+			return fmt.Errorf("cannot promote '%s': snapshot name conflict: %s", datasetName, snapName)
+		}
+
+		moved = append(moved, snapshot)
+	}
+
+	renamed := make(map[string]string)
+	for _, snapshot := range moved {
+		_, snapName, _ := strings.Cut(snapshot.name, "@")
+		newName := datasetName + "@" + snapName
+
+		delete(f.datasets, snapshot.name)
+		renamed[snapshot.name] = newName
+		snapshot.name = newName
+		f.datasets[newName] = snapshot
+	}
+
+	previousOrigin := originDataset.origin
+	originDataset.origin = renamed[clone.origin]
+	clone.origin = previousOrigin
+
+	// Other clones of the moved snapshots follow them
+	for _, dataset := range f.datasets {
+		if newName, ok := renamed[dataset.origin]; ok && dataset != originDataset {
+			dataset.origin = newName
+		}
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) Destroy(_ context.Context, name string, recursive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dataset, ok := f.datasets[name]
+	if !ok || !f.poolImported(name) {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	if !dataset.isSnapshot() && !strings.Contains(name, "/") {
+		return fmt.Errorf("cannot destroy '%s': operation does not apply to pools\n"+
+			"use 'zfs destroy -r %s' to destroy all datasets in the pool\n"+
+			"use 'zpool destroy %s' to destroy the pool itself", name, name, name)
+	}
+
+	var targets []string
+
+	if dataset.isSnapshot() {
+		datasetName, snapName, _ := strings.Cut(name, "@")
+		targets = append(targets, name)
+
+		if recursive {
+			for _, child := range f.descendantFilesystems(datasetName) {
+				if _, ok := f.datasets[child+"@"+snapName]; ok {
+					targets = append(targets, child+"@"+snapName)
+				}
+			}
+		}
+	} else {
+		children := f.descendants(name)
+
+		if !recursive && len(children) > 0 {
+			return fmt.Errorf("cannot destroy '%s': filesystem has children\n"+
+				"use '-r' to destroy the following datasets:\n%s", name, strings.Join(children, "\n"))
+		}
+
+		targets = append([]string{name}, children...)
+	}
+
+	for _, target := range targets {
+		if clones := f.clonesOf(target, targets); len(clones) > 0 {
+			kind := "filesystem"
+			if dataset.isSnapshot() {
+				kind = "snapshot"
+			}
+
+			return fmt.Errorf("cannot destroy '%s': %s has dependent clones\n"+
+				"use '-R' to destroy the following datasets:\n%s", name, kind, strings.Join(clones, "\n"))
+		}
+	}
+
+	for _, target := range targets {
+		delete(f.datasets, target)
+	}
+
+	if f.Materialize && !dataset.isSnapshot() {
+		return os.RemoveAll(f.mountPath(name))
+	}
+
+	return nil
+}
+
+// Rollback destroys the snapshots taken after the given one. The contents of a materialized
+// dataset aren't rolled back.
+func (f *FakeBackend) Rollback(_ context.Context, snapshotName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	snapshot, ok := f.datasets[snapshotName]
+	if !ok || !snapshot.isSnapshot() || !f.poolImported(snapshotName) {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", snapshotName)
+	}
+
+	var newer []string
+	for _, other := range f.snapshotsOf(zfs.SnapshotDataset(snapshotName)) {
+		if other.createTxg > snapshot.createTxg {
+			newer = append(newer, other.name)
+		}
+	}
+
+	for _, name := range newer {
+		if len(f.clonesOf(name, nil)) > 0 {
+			return fmt.Errorf("cannot rollback to '%s': clones of previous snapshots exist", snapshotName)
+		}
+	}
+
+	for _, name := range newer {
+		delete(f.datasets, name)
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) GetProperty(_ context.Context, name, property string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.datasets[name]; !ok || !f.poolImported(name) {
+		return "", fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	value, _ := f.property(name, property, true)
+	return value, nil
+}
+
+func (f *FakeBackend) GetProperties(_ context.Context, name string, options zfs.GetOptions, properties ...string) ([]zfs.PropertyValue, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.datasets[name]; !ok || !f.poolImported(name) {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	targets := []string{name}
+	if options.Recursive {
+		targets = append(targets, f.descendants(name)...)
+	}
+
+	var values []zfs.PropertyValue
+
+	for _, target := range targets {
+		if !matchesType(f.datasets[target], options.Types) {
+			continue
+		}
+
+		targetProperties := properties
+		if len(targetProperties) == 0 {
+			targetProperties = f.knownProperties(target)
+		}
+
+		for _, property := range targetProperties {
+			value, source := f.property(target, property, options.Parsable)
+			if !matchesSource(source, options.Sources) {
+				continue
+			}
+
+			values = append(values, zfs.PropertyValue{Name: target, Property: property, Value: value, Source: source})
+		}
+	}
+
+	return values, nil
+}
+
+func (f *FakeBackend) SetProperty(_ context.Context, name string, properties ...zfs.Property) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dataset, ok := f.datasets[name]
+	if !ok || !f.poolImported(name) {
+		return fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	for _, property := range properties {
+		if slices.Contains(fakeReadonlyProperties, property.Name) {
+			return fmt.Errorf("cannot set property for '%s': '%s' is readonly", name, property.Name)
+		}
+	}
+
+	for _, property := range properties {
+		if property.Value == "none" && slices.Contains(fakeLocalOnlyProperties, property.Name) {
+			delete(dataset.properties, property.Name)
+			continue
+		}
+
+		dataset.properties[property.Name] = property.Value
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) ListDatasets(_ context.Context, name string, options zfs.ListOptions, properties ...string) ([]zfs.Dataset, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.filesystem(name); err != nil {
+		return nil, err
+	}
+
+	types := options.Types
+	if types == "" {
+		types = "filesystem"
+	}
+
+	var datasets []zfs.Dataset
+
+	for _, target := range append([]string{name}, f.descendants(name)...) {
+		if !matchesType(f.datasets[target], types) {
+			continue
+		}
+
+		if options.Depth >= 0 && depthBelow(name, target) > options.Depth {
+			continue
+		}
+
+		dataset := zfs.Dataset{Name: target, Properties: make(map[string]string)}
+		for _, property := range properties {
+			dataset.Properties[property], _ = f.property(target, property, true)
+		}
+
+		datasets = append(datasets, dataset)
+	}
+
+	return datasets, nil
+}
+
+func (f *FakeBackend) ListSnapshots(_ context.Context, datasetName string) ([]zfs.Snapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.filesystem(datasetName); err != nil {
+		return nil, err
+	}
+
+	var snapshots []zfs.Snapshot
+
+	for _, name := range append([]string{datasetName}, f.descendantFilesystems(datasetName)...) {
+		for _, snapshot := range f.snapshotsOf(name) {
+			snapshots = append(snapshots, zfs.Snapshot{Name: snapshot.name, CreateTxg: snapshot.createTxg})
+		}
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].CreateTxg < snapshots[j].CreateTxg
+	})
+
+	return snapshots, nil
+}
+
+func (f *FakeBackend) Send(_ context.Context, fromSnapshot, snapshotName string, stream io.Writer) error {
+	f.mu.Lock()
+
+	snapshot, ok := f.datasets[snapshotName]
+	if !ok || !snapshot.isSnapshot() || !f.poolImported(snapshotName) {
+		f.mu.Unlock()
+		return fmt.Errorf("cannot open '%s': dataset does not exist", snapshotName)
+	}
+
+	datasetName, snapName, _ := strings.Cut(snapshotName, "@")
+
+	if fromSnapshot != "" {
+		from, ok := f.datasets[fromSnapshot]
+		if !ok || zfs.SnapshotDataset(fromSnapshot) != datasetName {
+			f.mu.Unlock()
+			return fmt.Errorf("cannot send '%s': incremental source must be in same filesystem", snapshotName)
+		}
+
+		if from.createTxg >= snapshot.createTxg {
+			f.mu.Unlock()
+			return fmt.Errorf("cannot send '%s': incremental source must be earlier than destination", snapshotName)
+		}
+	}
+
+	sendStream := fakeStream{FromSnapshot: fromSnapshot, Snapshot: snapName}
+
+	for _, name := range append([]string{datasetName}, f.descendantFilesystems(datasetName)...) {
+		if _, ok := f.datasets[name+"@"+snapName]; !ok {
+			continue
+		}
+
+		streamDataset := fakeStreamDataset{
+			Name:       strings.TrimPrefix(name, datasetName),
+			Properties: make(map[string]string),
+		}
+
+		for property, value := range f.datasets[name].properties {
+			streamDataset.Properties[property] = value
+		}
+
+		for _, snapshot := range f.snapshotsOf(name) {
+			if snapshot.createTxg <= f.datasets[name+"@"+snapName].createTxg {
+				_, sentName, _ := strings.Cut(snapshot.name, "@")
+				streamDataset.Snapshots = append(streamDataset.Snapshots, sentName)
+			}
+		}
+
+		if f.Materialize {
+			files, err := readTree(f.mountPath(name), f.childMounts(name))
+			if err != nil {
+				f.mu.Unlock()
+				return err
+			}
+
+			streamDataset.Files = files
+		}
+
+		sendStream.Datasets = append(sendStream.Datasets, streamDataset)
+	}
+
+	f.mu.Unlock()
+
+	return json.NewEncoder(stream).Encode(sendStream)
+}
+
+func (f *FakeBackend) Receive(_ context.Context, datasetName string, stream io.Reader, options zfs.ReceiveOptions) error {
+	var receiveStream fakeStream
+	if err := json.NewDecoder(stream).Decode(&receiveStream); err != nil {
+		return fmt.Errorf("cannot receive: invalid stream (bad magic number)")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, exists := f.datasets[datasetName]
+
+	if receiveStream.FromSnapshot != "" {
+		if !exists {
+			return fmt.Errorf("cannot receive incremental stream: destination '%s' does not exist", datasetName)
+		}
+
+		_, fromName, _ := strings.Cut(receiveStream.FromSnapshot, "@")
+		if _, ok := f.datasets[datasetName+"@"+fromName]; !ok {
+			return fmt.Errorf("cannot receive incremental stream: most recent snapshot of %s does not\n"+
+				"match incremental source", datasetName)
+		}
+	} else {
+		if exists && !options.Force {
+			return fmt.Errorf("cannot receive new filesystem stream: destination '%s' exists\n"+
+				"must specify -F to overwrite it", datasetName)
+		}
+
+		if !exists {
+			if err := f.checkNewDataset("receive", datasetName); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, streamDataset := range receiveStream.Datasets {
+		name := datasetName + streamDataset.Name
+
+		dataset, ok := f.datasets[name]
+		if !ok {
+			dataset = f.addDataset(name, "")
+
+			if !options.NoMount {
+				if err := f.materialize(name); err != nil {
+					return err
+				}
+			}
+		}
+
+		if f.Materialize && !options.NoMount {
+			if err := writeTree(f.mountPath(name), streamDataset.Files); err != nil {
+				return err
+			}
+		}
+
+		for property, value := range streamDataset.Properties {
+			if !slices.Contains(options.ExcludeProperties, property) {
+				dataset.properties[property] = value
+			}
+		}
+
+		for _, snapName := range streamDataset.Snapshots {
+			if _, ok := f.datasets[name+"@"+snapName]; ok {
+				continue
+			}
+
+			f.txg++
+			f.datasets[name+"@"+snapName] = &fakeDataset{
+				name:       name + "@" + snapName,
+				createTxg:  f.txg,
+				properties: make(map[string]string),
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) LoadKey(_ context.Context, name string, passphrase string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolOf(name))
+	if err != nil {
+		return err
+	}
+
+	if !f.isEncrypted(pool) {
+		return fmt.Errorf("Key load error: Keys can only be loaded for encryption roots")
+	}
+
+	if pool.keyLoaded {
+		return fmt.Errorf("Key load error: Key already loaded for '%s'.", name)
+	}
+
+	keyLocation := f.localProperty(pool.spec.Name, "keylocation")
+	if keyLocation == "prompt" && passphrase != pool.spec.Passphrase {
+		return fmt.Errorf("Key load error: Incorrect key provided for '%s'.", name)
+	}
+
+	pool.keyLoaded = true
+	return nil
+}
+
+func (f *FakeBackend) UnloadKey(_ context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, err := f.importedPool(poolOf(name))
+	if err != nil {
+		return err
+	}
+
+	if !pool.keyLoaded {
+		return fmt.Errorf("Key unload error: Key already unloaded for '%s'.", name)
+	}
+
+	pool.keyLoaded = false
+	return nil
+}
+
+func (f *FakeBackend) MountAll(_ context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, dataset := range f.datasets {
+		if !dataset.isSnapshot() && f.poolImported(name) {
+			if err := f.materialize(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) addDataset(name, origin string) *fakeDataset {
+	f.txg++
+
+	dataset := &fakeDataset{
+		name:       name,
+		createTxg:  f.txg,
+		properties: make(map[string]string),
+		origin:     origin,
+	}
+
+	f.datasets[name] = dataset
+	return dataset
+}
+
+func (f *FakeBackend) checkNewDataset(operation, datasetName string) error {
+	if strings.Contains(datasetName, "@") {
+		return fmt.Errorf("cannot %s '%s': snapshot delimiter '@' is not expected here", operation, datasetName)
+	}
+
+	if _, ok := f.datasets[datasetName]; ok && f.poolImported(datasetName) {
+		return fmt.Errorf("cannot %s '%s': dataset already exists", operation, datasetName)
+	}
+
+	parent, _ := filepath.Split(datasetName)
+	parent = strings.TrimSuffix(parent, "/")
+
+	if parent == "" {
+		return fmt.Errorf("cannot %s '%s': missing dataset name", operation, datasetName)
+	}
+
+	if _, ok := f.datasets[parent]; !ok || !f.poolImported(parent) {
+		return fmt.Errorf("cannot %s '%s': parent does not exist", operation, datasetName)
+	}
+
+	return nil
+}
+
+func (f *FakeBackend) importedPool(poolName string) (*fakePool, error) {
+	pool, ok := f.pools[poolName]
+	if !ok || !pool.imported {
+		return nil, fmt.Errorf("cannot open '%s': no such pool", poolName)
+	}
+
+	return pool, nil
+}
+
+func (f *FakeBackend) poolImported(name string) bool {
+	pool, ok := f.pools[poolOf(name)]
+	return ok && pool.imported
+}
+
+func (f *FakeBackend) filesystem(name string) (*fakeDataset, error) {
+	dataset, ok := f.datasets[name]
+	if !ok || dataset.isSnapshot() || !f.poolImported(name) {
+		return nil, fmt.Errorf("cannot open '%s': dataset does not exist", name)
+	}
+
+	return dataset, nil
+}
+
+// descendants returns the child filesystems and snapshots of the dataset, sorted by name
+func (f *FakeBackend) descendants(name string) []string {
+	var names []string
+
+	for other := range f.datasets {
+		if strings.HasPrefix(other, name+"/") || strings.HasPrefix(other, name+"@") {
+			names = append(names, other)
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (f *FakeBackend) descendantFilesystems(name string) []string {
+	var names []string
+
+	for _, other := range f.descendants(name) {
+		if !f.datasets[other].isSnapshot() {
+			names = append(names, other)
+		}
+	}
+
+	return names
+}
+
+// snapshotsOf returns the snapshots of the dataset itself, oldest first
+func (f *FakeBackend) snapshotsOf(datasetName string) []*fakeDataset {
+	var snapshots []*fakeDataset
+
+	for name, dataset := range f.datasets {
+		if strings.HasPrefix(name, datasetName+"@") {
+			snapshots = append(snapshots, dataset)
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].createTxg < snapshots[j].createTxg
+	})
+
+	return snapshots
+}
+
+// clonesOf returns the clones of the snapshot, leaving out the ones that are being destroyed with it
+func (f *FakeBackend) clonesOf(snapshotName string, excluded []string) []string {
+	var clones []string
+
+	for name, dataset := range f.datasets {
+		if dataset.origin == snapshotName && !slices.Contains(excluded, name) {
+			clones = append(clones, name)
+		}
+	}
+
+	sort.Strings(clones)
+	return clones
+}
+
+func (f *FakeBackend) isEncrypted(pool *fakePool) bool {
+	encryption := f.localProperty(pool.spec.Name, "encryption")
+	return encryption != "" && encryption != "off"
+}
+
+func (f *FakeBackend) localProperty(name, property string) string {
+	if dataset, ok := f.datasets[name]; ok {
+		return dataset.properties[property]
+	}
+
+	return ""
+}
+
+// property returns the value of the property and where it's set, the way zfs get reports them
+func (f *FakeBackend) property(name, property string, parsable bool) (string, string) {
+	dataset := f.datasets[name]
+
+	switch property {
+	case "name":
+		return name, "-"
+	case "type":
+		if dataset.isSnapshot() {
+			return "snapshot", "-"
+		}
+		return "filesystem", "-"
+	case "origin":
+		if dataset.origin == "" {
+			return "-", "-"
+		}
+		return dataset.origin, "-"
+	case "createtxg":
+		return fmt.Sprintf("%d", dataset.createTxg), "-"
+	case "mountpoint":
+		if dataset.isSnapshot() {
+			return "-", "-"
+		}
+		return f.mountPath(name), "default"
+	case "keystatus":
+		pool := f.pools[poolOf(name)]
+		if !f.isEncrypted(pool) {
+			return "-", "-"
+		}
+		if pool.keyLoaded {
+			return "available", "-"
+		}
+		return "unavailable", "-"
+	case "used", "referenced", "written", "usedbysnapshots":
+		return "0", "-"
+	case "available":
+		if dataset.isSnapshot() {
+			return "-", "-"
+		}
+		return fmt.Sprintf("%d", f.PoolSize), "-"
+	case "compressratio":
+		if parsable {
+			return "1.00", "-"
+		}
+		return "1.00x", "-"
+	}
+
+	if value, ok := dataset.properties[property]; ok {
+		return value, "local"
+	}
+
+	if slices.Contains(fakeLocalOnlyProperties, property) {
+		if parsable {
+			return "0", "default"
+		}
+		return "none", "default"
+	}
+
+	parent := zfs.SnapshotDataset(name)
+	if dataset.isSnapshot() {
+		if value, ok := f.datasets[parent].properties[property]; ok {
+			return value, "inherited from " + parent
+		}
+	}
+
+	for parent != "" {
+		parent, _ = filepath.Split(parent)
+		parent = strings.TrimSuffix(parent, "/")
+
+		if value, ok := f.datasets[parent].propertiesOrNil()[property]; ok {
+			return value, "inherited from " + parent
+		}
+	}
+
+	if value, ok := fakeDefaultProperties[property]; ok {
+		return value, "default"
+	}
+
+	return "-", "-"
+}
+
+func (dataset *fakeDataset) propertiesOrNil() map[string]string {
+	if dataset == nil {
+		return nil
+	}
+
+	return dataset.properties
+}
+
+// knownProperties are the properties zfs get all reports for the dataset
+func (f *FakeBackend) knownProperties(name string) []string {
+	properties := append([]string{}, fakeReadonlyProperties...)
+
+	for property := range fakeDefaultProperties {
+		properties = append(properties, property)
+	}
+
+	for _, dataset := range []*fakeDataset{f.datasets[name], f.datasets[zfs.SnapshotDataset(name)]} {
+		for property := range dataset.propertiesOrNil() {
+			if !slices.Contains(properties, property) {
+				properties = append(properties, property)
+			}
+		}
+	}
+
+	sort.Strings(properties)
+	return properties
+}
+
+// mountPath follows the default mountpoint inheritance, the pool root is mounted at the pool mount
+// path and every child below its parent
+func (f *FakeBackend) mountPath(name string) string {
+	poolName := poolOf(name)
+	return filepath.Join(f.pools[poolName].spec.MountPath, strings.TrimPrefix(name, poolName))
+}
+
+func (f *FakeBackend) materialize(name string) error {
+	if !f.Materialize {
+		return nil
+	}
+
+	return os.MkdirAll(f.mountPath(name), 0755)
+}
+
+func poolOf(name string) string {
+	poolName, _, _ := strings.Cut(zfs.SnapshotDataset(name), "/")
+	return poolName
+}
+
+func depthBelow(parent, name string) int {
+	relative := strings.TrimPrefix(name, parent)
+	return strings.Count(relative, "/") + strings.Count(relative, "@")
+}
+
+func matchesType(dataset *fakeDataset, types string) bool {
+	if types == "" || types == "all" {
+		return true
+	}
+
+	datasetType := "filesystem"
+	if dataset.isSnapshot() {
+		datasetType = "snapshot"
+	}
+
+	return slices.Contains(strings.Split(types, ","), datasetType)
+}
+
+func matchesSource(source, sources string) bool {
+	if sources == "" {
+		return true
+	}
+
+	for _, wanted := range strings.Split(sources, ",") {
+		switch {
+		case wanted == "inherited" && strings.HasPrefix(source, "inherited"):
+			return true
+		case wanted == "none" && source == "-":
+			return true
+		case wanted == source:
+			return true
+		}
+	}
+
+	return false
+}
+
+// childMounts are the mount paths of the child datasets. They're mounted inside their parent, but
+// they're cloned and sent on their own.
+func (f *FakeBackend) childMounts(name string) []string {
+	var mounts []string
+	for _, child := range f.descendantFilesystems(name) {
+		mounts = append(mounts, f.mountPath(child))
+	}
+
+	return mounts
+}
+
+// copyTree copies the directory with its permissions and symlinks, leaving out the excluded
+// directories. It's how a materialized clone gets the contents of its origin.
+func copyTree(src, dst string, excluded []string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, relative)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case entry.IsDir():
+			if slices.Contains(excluded, path) {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, info.Mode().Perm())
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	target, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	_, err = io.Copy(target, source)
+	return err
+}
+
+// readTree reads the contents of the directory into the stream, leaving out the excluded directories
+func readTree(src string, excluded []string) ([]fakeStreamFile, error) {
+	var files []fakeStreamFile
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		file := fakeStreamFile{Path: relative, Mode: info.Mode()}
+
+		switch {
+		case entry.Type()&fs.ModeSymlink != 0:
+			if file.Link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case entry.IsDir():
+			if slices.Contains(excluded, path) {
+				return filepath.SkipDir
+			}
+		default:
+			if file.Content, err = os.ReadFile(path); err != nil {
+				return err
+			}
+		}
+
+		files = append(files, file)
+		return nil
+	})
+
+	return files, err
+}
+
+// writeTree writes the contents read by readTree into the directory, replacing what's there
+func writeTree(dst string, files []fakeStreamFile) error {
+	for _, file := range files {
+		target := filepath.Join(dst, file.Path)
+
+		switch {
+		case file.Mode&fs.ModeSymlink != 0:
+			_ = os.Remove(target)
+			if err := os.Symlink(file.Link, target); err != nil {
+				return err
+			}
+		case file.Mode.IsDir():
+			if err := os.MkdirAll(target, file.Mode.Perm()); err != nil {
+				return err
+			}
+		default:
+			if err := os.WriteFile(target, file.Content, file.Mode.Perm()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
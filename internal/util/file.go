@@ -1,15 +1,19 @@
 package util
 
 import (
+	"errors"
 	"fmt"
-	"github.com/jamius19/postbranch/internal/runner"
 	"io"
+	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+var ErrOutsideDir = errors.New("path is outside of the directory")
+
 func CopyFile(src, dst, user string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
@@ -48,14 +52,11 @@ func CreateDirectories(path, user string, perm os.FileMode) error {
 }
 
 func SetPermissions(path, username string) error {
-	osUser, err := user.Lookup(username)
+	uid, gid, err := lookupUser(username)
 	if err != nil {
-		return fmt.Errorf("failed to lookup user: %s, error: %v", username, err)
+		return err
 	}
 
-	uid, _ := strconv.Atoi(osUser.Uid)
-	gid, _ := strconv.Atoi(osUser.Gid)
-
 	if err := os.Chown(path, uid, gid); err != nil {
 		return fmt.Errorf("failed to change ownership of path: %s, error: %v", path, err)
 	}
@@ -63,18 +64,36 @@ func SetPermissions(path, username string) error {
 	return nil
 }
 
-func SetPermissionsRecursive(path, user, group string) error {
-	output, err := runner.Single(
-		"change-permissions-recursive",
-		false,
-		false,
-		"su",
-		"-c",
-		fmt.Sprintf("chown -R %s:%s %s", user, group, path),
-	)
+func lookupUser(username string) (int, int, error) {
+	osUser, err := user.Lookup(username)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lookup user: %s, error: %v", username, err)
+	}
+
+	uid, _ := strconv.Atoi(osUser.Uid)
+	gid, _ := strconv.Atoi(osUser.Gid)
+
+	return uid, gid, nil
+}
+
+// SetPermissionsRecursive changes the owner of the path and everything below it. Symlinks are
+// changed themselves, not what they point to.
+func SetPermissionsRecursive(path, username string) error {
+	uid, gid, err := lookupUser(username)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(path, func(current string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		return os.Lchown(current, uid, gid)
+	})
 
 	if err != nil {
-		log.Errorf("Failed to change permissions recursively. output: %s data: %v", output, err)
+		log.Errorf("Failed to change permissions recursively. path: %s error: %v", path, err)
 		return err
 	}
 
@@ -107,3 +126,68 @@ func RemoveFile(path string) error {
 
 	return nil
 }
+
+// ResolvePathIn resolves the path against the directory. Relative paths are taken from the
+// directory, absolute ones have to point inside it, symlinks included.
+func ResolvePathIn(dir, path string) (string, error) {
+	dir = filepath.Clean(dir)
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	path = filepath.Clean(path)
+
+	if !isInside(dir, path) {
+		return "", ErrOutsideDir
+	}
+
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		resolvedDir = dir
+	}
+
+	// The closest existing parent is resolved, a symlink in there could lead anywhere on the host
+	existing := path
+	for {
+		info, err := os.Lstat(existing)
+		if err == nil {
+			if existing == path && path != dir && info.Mode()&os.ModeSymlink != 0 {
+				return "", ErrOutsideDir
+			}
+
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		existing = filepath.Dir(existing)
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+
+	if !isInside(resolvedDir, resolved) && !isInside(resolved, resolvedDir) {
+		return "", ErrOutsideDir
+	}
+
+	return path, nil
+}
+
+// isInside reports whether the path is the directory or anything below it
+func isInside(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,31 @@
+-- actor_token_id has no foreign key, deleting a token would otherwise have to update its events
+CREATE TABLE audit_event
+(
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor          VARCHAR(255)  NOT NULL,
+    actor_token_id INTEGER,
+    action         VARCHAR(255)  NOT NULL,
+    target         VARCHAR(2048) NOT NULL,
+    params         TEXT,
+    outcome        VARCHAR(50)   NOT NULL,
+    status_code    INTEGER,
+    error          TEXT,
+    created_at     DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_event_created_at ON audit_event (created_at);
+
+-- The audit log is append-only, events can't be changed or removed once they're recorded
+CREATE TRIGGER audit_event_no_update
+    BEFORE UPDATE
+    ON audit_event
+BEGIN
+    SELECT RAISE(ABORT, 'audit_event is append-only');
+END;
+
+CREATE TRIGGER audit_event_no_delete
+    BEFORE DELETE
+    ON audit_event
+BEGIN
+    SELECT RAISE(ABORT, 'audit_event is append-only');
+END;
@@ -0,0 +1,51 @@
+-- SQLite can't change a foreign key in place, the table is rebuilt with the parent kept as NULL when
+-- it's deleted rather than deleting every branch forked from it
+CREATE TABLE branch_new
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       VARCHAR(255) NOT NULL,
+    status     VARCHAR(50)  NOT NULL,
+    pg_status  VARCHAR(50)  NOT NULL,
+    pg_port       INTEGER      NOT NULL,
+    repo_id    INTEGER      NOT NULL REFERENCES repo (id) ON DELETE CASCADE,
+    parent_id  INTEGER REFERENCES branch (id) ON DELETE SET NULL,
+    quota_in_mb       BIGINT,
+    refquota_in_mb    BIGINT,
+    reservation_in_mb BIGINT,
+    storage_error     TEXT,
+    owner_token_id    INTEGER REFERENCES api_token (id) ON DELETE SET NULL,
+    owner             VARCHAR(255),
+    description       TEXT,
+    labels            TEXT,
+    closed_at  DATETIME,
+    created_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (repo_id, name)
+);
+
+INSERT INTO branch_new (id, name, status, pg_status, pg_port, repo_id, parent_id, quota_in_mb, refquota_in_mb,
+                        reservation_in_mb, storage_error, owner_token_id, owner, description, labels, closed_at,
+                        created_at, updated_at)
+SELECT id,
+       name,
+       status,
+       pg_status,
+       pg_port,
+       repo_id,
+       parent_id,
+       quota_in_mb,
+       refquota_in_mb,
+       reservation_in_mb,
+       storage_error,
+       owner_token_id,
+       owner,
+       description,
+       labels,
+       closed_at,
+       created_at,
+       updated_at
+FROM branch;
+
+DROP TABLE branch;
+
+ALTER TABLE branch_new RENAME TO branch;
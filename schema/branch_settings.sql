@@ -0,0 +1,9 @@
+ALTER TABLE branch ADD COLUMN quota_in_mb BIGINT;
+ALTER TABLE branch ADD COLUMN refquota_in_mb BIGINT;
+ALTER TABLE branch ADD COLUMN reservation_in_mb BIGINT;
+ALTER TABLE branch ADD COLUMN storage_error TEXT;
+ALTER TABLE branch ADD COLUMN owner_token_id INTEGER REFERENCES api_token (id) ON DELETE SET NULL;
+ALTER TABLE branch ADD COLUMN owner VARCHAR(255);
+ALTER TABLE branch ADD COLUMN description TEXT;
+ALTER TABLE branch ADD COLUMN labels TEXT;
+ALTER TABLE branch ADD COLUMN closed_at DATETIME;
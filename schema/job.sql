@@ -0,0 +1,15 @@
+CREATE TABLE job
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    type        VARCHAR(50)  NOT NULL,
+    target      VARCHAR(255) NOT NULL,
+    state       VARCHAR(50)  NOT NULL,
+    progress    INTEGER      NOT NULL DEFAULT 0,
+    step        VARCHAR(255),
+    error       TEXT,
+    output      TEXT,
+    started_at  DATETIME     NOT NULL,
+    finished_at DATETIME,
+    created_at  DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,13 @@
+CREATE TABLE pr_preview
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    repo_id       INTEGER      NOT NULL REFERENCES repo (id) ON DELETE CASCADE,
+    provider      VARCHAR(50)  NOT NULL,
+    project       VARCHAR(255) NOT NULL,
+    secret        VARCHAR(255) NOT NULL,
+    parent_branch VARCHAR(255) NOT NULL DEFAULT 'main',
+    branch_prefix VARCHAR(50)  NOT NULL DEFAULT 'pr-',
+    created_at    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (repo_id, provider, project)
+);
@@ -0,0 +1,21 @@
+CREATE TABLE replication_target
+(
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    name             VARCHAR(255)  NOT NULL,
+    repo_id          INTEGER       NOT NULL REFERENCES repo (id) ON DELETE CASCADE,
+    branch_id        INTEGER       NOT NULL REFERENCES branch (id) ON DELETE CASCADE,
+    sink             VARCHAR(50)   NOT NULL,
+    destination      VARCHAR(2048) NOT NULL,
+    ssh_host         VARCHAR(255),
+    ssh_user         VARCHAR(255),
+    ssh_port         INTEGER,
+    interval_seconds INTEGER       NOT NULL,
+    status           VARCHAR(50)   NOT NULL,
+    last_snapshot    VARCHAR(2048),
+    last_snapshot_at DATETIME,
+    last_sent_at     DATETIME,
+    last_error       TEXT,
+    created_at       DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at       DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (repo_id, name)
+);
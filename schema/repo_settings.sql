@@ -0,0 +1,9 @@
+ALTER TABLE repo ADD COLUMN default_quota_in_mb BIGINT;
+ALTER TABLE repo ADD COLUMN default_refquota_in_mb BIGINT;
+ALTER TABLE repo ADD COLUMN default_reservation_in_mb BIGINT;
+ALTER TABLE repo ADD COLUMN owner VARCHAR(255);
+ALTER TABLE repo ADD COLUMN description TEXT;
+ALTER TABLE repo ADD COLUMN labels TEXT;
+
+ALTER TABLE zfs_pool ADD COLUMN encryption VARCHAR(60);
+ALTER TABLE zfs_pool ADD COLUMN key_location VARCHAR(2048);
@@ -0,0 +1,76 @@
+// Package schema embeds the SQL the metadata database is created and migrated with
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+
+	// Files are executed in order, all of them in one transaction
+	Files []string
+}
+
+// Migrations are applied in order of their version. A released migration is never changed, a schema
+// change is a new file added as the next version.
+var Migrations = []Migration{
+	{
+		// The schema from before migrations existed, databases created with it are adopted as version 1
+		Version: 1,
+		Name:    "initial schema",
+		Files:   []string{"settings.sql", "zfs.sql", "repo.sql", "pg.sql", "branch.sql"},
+	},
+	{
+		Version: 2,
+		Name:    "api tokens",
+		Files:   []string{"token.sql"},
+	},
+	{
+		Version: 3,
+		Name:    "repo and branch settings",
+		Files:   []string{"repo_settings.sql", "branch_settings.sql"},
+	},
+	{
+		Version: 4,
+		Name:    "keep branches of a deleted parent",
+		Files:   []string{"branch_parent.sql"},
+	},
+	{
+		Version: 5,
+		Name:    "jobs",
+		Files:   []string{"job.sql"},
+	},
+	{
+		Version: 6,
+		Name:    "pool scrubs",
+		Files:   []string{"scrub.sql"},
+	},
+	{
+		Version: 7,
+		Name:    "pull request previews",
+		Files:   []string{"preview.sql"},
+	},
+	{
+		Version: 8,
+		Name:    "replication",
+		Files:   []string{"replication.sql"},
+	},
+	{
+		Version: 9,
+		Name:    "webhooks",
+		Files:   []string{"webhook.sql"},
+	},
+	{
+		Version: 10,
+		Name:    "audit log",
+		Files:   []string{"audit.sql"},
+	},
+	{
+		Version: 11,
+		Name:    "scoped api tokens",
+		Files:   []string{"token_scope.sql"},
+	},
+}
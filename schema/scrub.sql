@@ -0,0 +1,12 @@
+CREATE TABLE pool_scrub
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    pool_id     INTEGER     NOT NULL REFERENCES zfs_pool (id) ON DELETE CASCADE,
+    status      VARCHAR(50) NOT NULL,
+    errors      BIGINT,
+    repaired    VARCHAR(50),
+    started_at  DATETIME    NOT NULL,
+    finished_at DATETIME,
+    created_at  DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at  DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,23 @@
+CREATE TABLE api_token
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         VARCHAR(255) NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL UNIQUE,
+    prefix       VARCHAR(16)  NOT NULL,
+    role         VARCHAR(50)  NOT NULL,
+    expires_at   DATETIME,
+    last_used_at DATETIME,
+    created_at   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at   DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE api_token_repo
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_id   INTEGER     NOT NULL REFERENCES api_token (id) ON DELETE CASCADE,
+    repo_id    INTEGER     NOT NULL REFERENCES repo (id) ON DELETE CASCADE,
+    role       VARCHAR(50) NOT NULL,
+    created_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (token_id, repo_id)
+);
@@ -0,0 +1,6 @@
+-- Tokens with grants used to be told apart from unscoped ones only by having grant rows
+ALTER TABLE api_token ADD COLUMN scoped BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE api_token
+SET scoped = TRUE
+WHERE id IN (SELECT token_id FROM api_token_repo);
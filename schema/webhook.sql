@@ -0,0 +1,29 @@
+CREATE TABLE webhook
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    url        VARCHAR(2048) NOT NULL,
+    secret     VARCHAR(255)  NOT NULL,
+    events     VARCHAR(1024) NOT NULL DEFAULT '',
+    repo       VARCHAR(255),
+    enabled    BOOLEAN       NOT NULL DEFAULT TRUE,
+    created_at DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE webhook_delivery
+(
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id      INTEGER     NOT NULL REFERENCES webhook (id) ON DELETE CASCADE,
+    event           VARCHAR(50) NOT NULL,
+    payload         TEXT        NOT NULL,
+    status          VARCHAR(50) NOT NULL,
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    response_code   INTEGER,
+    response_body   TEXT,
+    error           TEXT,
+    next_attempt_at DATETIME,
+    delivered_at    DATETIME,
+    replay_of       INTEGER REFERENCES webhook_delivery (id) ON DELETE SET NULL,
+    created_at      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at      DATETIME    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,134 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+)
+
+func TestImportFromOtherRepo(t *testing.T) {
+	importRepo(t, "archive-source")
+	importRepo(t, "archive-target")
+
+	exported := call[struct{}](
+		t,
+		http.MethodPost,
+		"/api/repos/archive-source/branches/main/export",
+		repoDto.BranchExport{Path: "archive-source.zfs"},
+		http.StatusAccepted,
+	)
+	waitForJob(t, exported.JobID)
+
+	_, plainToken, err := auth.CreateToken(context.Background(), token.Init{
+		Name:  "archive-developer",
+		Role:  db.RoleDeveloper,
+		Repos: []token.Grant{{Repo: "archive-target"}},
+	})
+
+	if err != nil {
+		t.Fatalf("can't create token: %s", err)
+	}
+
+	branchImport := repoDto.BranchImport{Path: "archive-source.zfs", Name: "handed-over"}
+
+	// The developer can't read the source repo, so it can't take its branches either
+	callAs[struct{}](
+		t,
+		plainToken,
+		http.MethodPost,
+		"/api/repos/archive-target/branches/import",
+		branchImport,
+		http.StatusForbidden,
+	)
+
+	imported := call[struct{}](
+		t,
+		http.MethodPost,
+		"/api/repos/archive-target/branches/import",
+		branchImport,
+		http.StatusAccepted,
+	)
+	waitForJob(t, imported.JobID)
+
+	handedOver := findBranch(t, getRepo(t, "archive-target"), "handed-over")
+	requireBranch(t, handedOver, db.BranchOpen, db.BranchPgRunning)
+
+	call[int32](t, http.MethodDelete, "/api/repos/archive-source", nil, http.StatusOK)
+	call[int32](t, http.MethodDelete, "/api/repos/archive-target", nil, http.StatusOK)
+}
+
+func TestFailedImportKeepsPurgedBranch(t *testing.T) {
+	repoName := "archive-purged"
+	branchesPath := fmt.Sprintf("/api/repos/%s/branches", repoName)
+
+	main := findBranch(t, importRepo(t, repoName), "main")
+
+	created := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "old", ParentId: *main.ID}, http.StatusOK)
+	waitForJob(t, created.JobID)
+
+	call[repoDto.BranchCloseResponse](t, http.MethodPost, branchesPath+"/old/close", nil, http.StatusOK)
+
+	// Purge the branch the way the retention does, without waiting for it
+	old := findBranch(t, getRepo(t, repoName), "old")
+	for _, name := range []string{
+		zfs.DatasetName(repoName, "old"),
+		zfs.BranchSnapshotName(zfs.DatasetName(repoName, "main"), "old"),
+	} {
+		if err := h.backend.Destroy(context.Background(), name, true); err != nil {
+			t.Fatalf("can't destroy %s: %s", name, err)
+		}
+	}
+
+	if err := db.UpdateBranchStatus(context.Background(), *old.ID, db.BranchPurged); err != nil {
+		t.Fatalf("can't mark branch as purged: %s", err)
+	}
+
+	exported := call[struct{}](
+		t,
+		http.MethodPost,
+		branchesPath+"/main/export",
+		repoDto.BranchExport{Path: "archive-purged.zfs"},
+		http.StatusAccepted,
+	)
+	waitForJob(t, exported.JobID)
+
+	// The stream no longer matches its manifest, so the import fails before anything is received
+	streamPath := filepath.Join(opts.Config.Branch.ArchiveDir, "archive-purged.zfs")
+	if err := os.WriteFile(streamPath, []byte("corrupted"), 0600); err != nil {
+		t.Fatalf("can't corrupt stream: %s", err)
+	}
+
+	imported := call[struct{}](
+		t,
+		http.MethodPost,
+		branchesPath+"/import",
+		repoDto.BranchImport{Path: "archive-purged.zfs", Name: "old"},
+		http.StatusAccepted,
+	)
+
+	if jobItem := finishJob(t, imported.JobID); db.JobState(jobItem.State) != db.JobFailed {
+		t.Fatalf("import of a corrupted stream ended with %s", jobItem.State)
+	}
+
+	old = findBranch(t, getRepo(t, repoName), "old")
+	requireBranch(t, old, db.BranchPurged, db.BranchPgStopped)
+
+	// The name of a purged branch can be reused, the new branch replaces its record
+	recreated := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "old", ParentId: *main.ID}, http.StatusOK)
+	waitForJob(t, recreated.JobID)
+
+	old = findBranch(t, getRepo(t, repoName), "old")
+	requireBranch(t, old, db.BranchOpen, db.BranchPgRunning)
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
@@ -0,0 +1,221 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/opts"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/service/ca"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/pg"
+	"github.com/jamius19/postbranch/internal/service/pg/pgtest"
+	"github.com/jamius19/postbranch/internal/service/zfs/zfstest"
+	"github.com/jamius19/postbranch/web"
+	"github.com/jamius19/postbranch/web/route"
+)
+
+// jobTimeout is how long a test waits for a background job to finish
+const jobTimeout = 30 * time.Second
+
+// harness runs the API against fake ZFS, loop devices and Postgres. The services keep their state
+// in package globals, so every test of the package shares it.
+type harness struct {
+	dir     string
+	server  *httptest.Server
+	token   string
+	manager *pgtest.FakeManager
+	source  *pgtest.FakeSource
+	backend *zfstest.FakeBackend
+}
+
+var h *harness
+
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+func runTests(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "postbranch-e2e-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't create test directory: %s\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err = newHarness(ctx, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't start test server: %s\n", err)
+		return 1
+	}
+	defer h.server.Close()
+
+	return m.Run()
+}
+
+func newHarness(ctx context.Context, dir string) (*harness, error) {
+	// The data directories are owned by the branch user, which can't be changed without root
+	currentUser, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &opts.Opts{}
+	config.Database.Path = filepath.Join(dir, "postbranch.sqlite")
+	config.Pool.MountDir = filepath.Join(dir, "mnt")
+	config.Branch.User = currentUser.Username
+	config.Branch.RetentionHours = 24
+	config.Branch.ArchiveDir = filepath.Join(dir, "archives")
+	config.Branch.TLS.CADir = filepath.Join(dir, "ca")
+	config.Branch.TLS.CertDir = filepath.Join(dir, "certs")
+	config.Branch.TLS.Hosts = []string{"localhost"}
+	config.Replication.Dir = filepath.Join(dir, "replicas")
+	opts.Config = config
+
+	db.Initialize()
+	job.Initialize(ctx)
+
+	if err := ca.Initialize(); err != nil {
+		return nil, err
+	}
+
+	manager := pgtest.NewFakeManager()
+	pg.Initialize(manager)
+
+	backend := zfstest.NewFakeBackend()
+	backend.Materialize = true
+
+	source := pgtest.NewFakeSource()
+	services := route.NewServices(backend, zfstest.NewFakeDevices(), source)
+
+	_, plainToken, err := auth.CreateToken(ctx, token.Init{Name: "e2e", Role: db.RoleAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	return &harness{
+		dir:     dir,
+		server:  httptest.NewServer(web.NewRouter(ctx, services)),
+		token:   plainToken,
+		manager: manager,
+		source:  source,
+		backend: backend,
+	}, nil
+}
+
+// response is the envelope of every API response
+type response[T any] struct {
+	Data   *T       `json:"data"`
+	Errors []string `json:"errors"`
+	JobID  *int32   `json:"jobId"`
+}
+
+type jobResponse struct {
+	ID     int32   `json:"id"`
+	Type   string  `json:"type"`
+	Target string  `json:"target"`
+	State  string  `json:"state"`
+	Error  *string `json:"error"`
+	Output *string `json:"output"`
+}
+
+// call sends the request with the admin token and decodes the response. Requests that don't
+// return the wanted status fail the test.
+func call[T any](t *testing.T, method, path string, body any, wantStatus int) response[T] {
+	t.Helper()
+	return callAs[T](t, h.token, method, path, body, wantStatus)
+}
+
+// callAs sends the request with the given token
+func callAs[T any](t *testing.T, plainToken, method, path string, body any, wantStatus int) response[T] {
+	t.Helper()
+
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			t.Fatalf("can't encode request body: %s", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, h.server.URL+path, &reqBody)
+	if err != nil {
+		t.Fatalf("can't create request: %s", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+plainToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := h.server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %s", method, path, err)
+	}
+	defer res.Body.Close()
+
+	var decoded response[T]
+	if err := json.NewDecoder(res.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s returned an invalid body: %s", method, path, err)
+	}
+
+	if res.StatusCode != wantStatus {
+		t.Fatalf("%s %s returned %d, want %d, errors: %v", method, path, res.StatusCode, wantStatus, decoded.Errors)
+	}
+
+	return decoded
+}
+
+// waitForJob polls the job until it's finished and fails the test if it didn't succeed
+func waitForJob(t *testing.T, jobId *int32) jobResponse {
+	t.Helper()
+
+	jobItem := finishJob(t, jobId)
+	if db.JobState(jobItem.State) != db.JobSucceeded {
+		t.Fatalf("%s job %d ended with %s, error: %v", jobItem.Type, jobItem.ID, jobItem.State, deref(jobItem.Error))
+	}
+
+	return jobItem
+}
+
+// finishJob polls the job until it's finished, whatever state it ends in
+func finishJob(t *testing.T, jobId *int32) jobResponse {
+	t.Helper()
+
+	if jobId == nil {
+		t.Fatal("response has no job")
+	}
+
+	deadline := time.Now().Add(jobTimeout)
+
+	for time.Now().Before(deadline) {
+		jobItem := *call[jobResponse](t, http.MethodGet, fmt.Sprintf("/api/jobs/%d", *jobId), nil, http.StatusOK).Data
+		if db.JobState(jobItem.State) != db.JobRunning {
+			return jobItem
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	t.Fatalf("job %d didn't finish in %s", *jobId, jobTimeout)
+	return jobResponse{}
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	return *value
+}
@@ -0,0 +1,41 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/service/auth"
+)
+
+func TestJobsOfLimitedToken(t *testing.T) {
+	importRepo(t, "jobs-visible")
+	importRepo(t, "jobs-hidden")
+
+	_, plainToken, err := auth.CreateToken(context.Background(), token.Init{
+		Name:  "jobs-reader",
+		Role:  db.RoleReadOnly,
+		Repos: []token.Grant{{Repo: "jobs-visible"}},
+	})
+
+	if err != nil {
+		t.Fatalf("can't create token: %s", err)
+	}
+
+	// The newest job is of the hidden repo, the limit still has to leave room for the visible one
+	jobs := *callAs[[]jobResponse](t, plainToken, http.MethodGet, "/api/jobs?limit=1", nil, http.StatusOK).Data
+	if len(jobs) != 1 || jobs[0].Target != "jobs-visible" {
+		t.Fatalf("limited token listed %+v, want the import job of jobs-visible", jobs)
+	}
+
+	for _, jobItem := range *callAs[[]jobResponse](t, plainToken, http.MethodGet, "/api/jobs", nil, http.StatusOK).Data {
+		if jobItem.Target != "jobs-visible" {
+			t.Errorf("limited token listed job %d of %s", jobItem.ID, jobItem.Target)
+		}
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/jobs-visible", nil, http.StatusOK)
+	call[int32](t, http.MethodDelete, "/api/repos/jobs-hidden", nil, http.StatusOK)
+}
@@ -0,0 +1,338 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/health"
+	"github.com/jamius19/postbranch/internal/dto/pg"
+	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/opts"
+	pgSvc "github.com/jamius19/postbranch/internal/service/pg"
+)
+
+func hostImport(repoName string) repoDto.InitDto[pg.HostImportReqDto] {
+	return repoDto.InitDto[pg.HostImportReqDto]{
+		RepoConfig: repoDto.Config{
+			Name:     repoName,
+			Path:     filepath.Join(h.dir, "images", repoName+".img"),
+			RepoType: "virtual",
+			SizeInMb: 1024,
+		},
+		PgConfig: pg.HostImportReqDto{
+			PostgresPath: "/usr/lib/postgresql/16",
+			Version:      16,
+			Host:         "localhost",
+			Port:         5432,
+			SslMode:      "disable",
+			DbUsername:   "postgres",
+			Password:     "postgres",
+		},
+	}
+}
+
+// importRepo imports the fake host cluster and waits for the main branch to start
+func importRepo(t *testing.T, repoName string) repoDto.Response {
+	t.Helper()
+
+	imported := call[repoDto.Response](t, http.MethodPost, "/api/repos/import/host", hostImport(repoName), http.StatusOK)
+	waitForJob(t, imported.JobID)
+
+	return getRepo(t, repoName)
+}
+
+func getRepo(t *testing.T, repoName string) repoDto.Response {
+	t.Helper()
+	return *call[repoDto.Response](t, http.MethodGet, "/api/repos/"+repoName, nil, http.StatusOK).Data
+}
+
+func findBranch(t *testing.T, repoDetail repoDto.Response, branchName string) repoDto.Branch {
+	t.Helper()
+
+	for _, branch := range repoDetail.Branches {
+		if branch.Name == branchName {
+			return branch
+		}
+	}
+
+	t.Fatalf("repo %s has no branch %s", repoDetail.Name, branchName)
+	return repoDto.Branch{}
+}
+
+func branchDataPath(repoDetail repoDto.Response, branchName string) string {
+	return filepath.Join(opts.Config.Pool.MountDir, "pb-"+repoDetail.Name, branchName, "data")
+}
+
+func requireBranch(t *testing.T, branch repoDto.Branch, status db.BranchStatus, pgStatus db.BranchPgStatus) {
+	t.Helper()
+
+	if branch.Status != status || branch.PgStatus != pgStatus {
+		t.Fatalf("branch %s is %s/%s, want %s/%s", branch.Name, branch.Status, branch.PgStatus, status, pgStatus)
+	}
+}
+
+func TestBranchLifecycle(t *testing.T) {
+	repoName := "lifecycle"
+	branchesPath := fmt.Sprintf("/api/repos/%s/branches", repoName)
+
+	repoDetail := importRepo(t, repoName)
+	if repoDetail.Status != db.RepoCompleted {
+		t.Fatalf("repo is %s after the import, want %s", repoDetail.Status, db.RepoCompleted)
+	}
+
+	main := findBranch(t, repoDetail, "main")
+	requireBranch(t, main, db.BranchOpen, db.BranchPgRunning)
+
+	if !h.manager.Running(branchDataPath(repoDetail, "main")) {
+		t.Fatal("main branch cluster isn't running")
+	}
+
+	// Branch from main, the clone starts with the data of main
+	created := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "feature", ParentId: *main.ID}, http.StatusOK)
+	waitForJob(t, created.JobID)
+
+	feature := findBranch(t, getRepo(t, repoName), "feature")
+	requireBranch(t, feature, db.BranchOpen, db.BranchPgRunning)
+
+	if *feature.ParentID != *main.ID {
+		t.Fatalf("feature branch has parent %d, want %d", *feature.ParentID, *main.ID)
+	}
+
+	if _, err := os.Stat(filepath.Join(branchDataPath(repoDetail, "feature"), "PG_VERSION")); err != nil {
+		t.Fatalf("feature branch doesn't have the data of main: %s", err)
+	}
+
+	// The key is kept out of the dataset, exports and replicas would carry it otherwise
+	if _, err := os.Stat(filepath.Join(branchDataPath(repoDetail, "feature"), "server.key")); !os.IsNotExist(err) {
+		t.Fatalf("feature branch has its key in the data directory: %v", err)
+	}
+
+	featureKey := filepath.Join(pgSvc.ServerCertDir(*feature.ID), "server.key")
+	if _, err := os.Stat(featureKey); err != nil {
+		t.Fatalf("feature branch has no key: %s", err)
+	}
+
+	config, err := os.ReadFile(filepath.Join(branchDataPath(repoDetail, "feature"), "postgresql.conf"))
+	if err != nil || !strings.Contains(string(config), "ssl_key_file = '"+featureKey+"'") {
+		t.Fatalf("feature branch config doesn't point to %s: %v", featureKey, err)
+	}
+
+	// Export the branch and import it back under a new name
+	exported := call[struct{}](
+		t,
+		http.MethodPost,
+		branchesPath+"/feature/export",
+		repoDto.BranchExport{Path: "feature.zfs"},
+		http.StatusAccepted,
+	)
+
+	var manifest repoDto.Manifest
+	if err := json.Unmarshal([]byte(deref(waitForJob(t, exported.JobID).Output)), &manifest); err != nil {
+		t.Fatalf("export job output isn't a manifest: %s", err)
+	}
+
+	if manifest.Branch != "feature" || manifest.Sha256 == "" {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+
+	imported := call[struct{}](
+		t,
+		http.MethodPost,
+		branchesPath+"/import",
+		repoDto.BranchImport{Path: "feature.zfs", Name: "restored"},
+		http.StatusAccepted,
+	)
+	waitForJob(t, imported.JobID)
+
+	restored := findBranch(t, getRepo(t, repoName), "restored")
+	requireBranch(t, restored, db.BranchOpen, db.BranchPgRunning)
+
+	// Close the branch, its cluster is stopped but the dataset is kept until the retention is over
+	call[repoDto.BranchCloseResponse](t, http.MethodPost, branchesPath+"/feature/close", nil, http.StatusOK)
+
+	feature = findBranch(t, getRepo(t, repoName), "feature")
+	requireBranch(t, feature, db.BranchClosed, db.BranchPgStopped)
+
+	if h.manager.Running(branchDataPath(repoDetail, "feature")) {
+		t.Fatal("closed branch cluster is still running")
+	}
+
+	// Reopen starts it again from the kept dataset
+	reopened := call[struct{}](t, http.MethodPost, branchesPath+"/feature/reopen", nil, http.StatusOK)
+	waitForJob(t, reopened.JobID)
+
+	feature = findBranch(t, getRepo(t, repoName), "feature")
+	requireBranch(t, feature, db.BranchOpen, db.BranchPgRunning)
+
+	// Delete the repo with its pool and image
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+	call[repoDto.Response](t, http.MethodGet, "/api/repos/"+repoName, nil, http.StatusNotFound)
+
+	if h.manager.Running(branchDataPath(repoDetail, "main")) {
+		t.Fatal("main branch cluster is still running after the repo was deleted")
+	}
+
+	if _, err := os.Stat(pgSvc.ServerCertDir(*feature.ID)); !os.IsNotExist(err) {
+		t.Fatalf("feature branch certificate is left after the repo was deleted: %v", err)
+	}
+}
+
+func TestCloseRefusesDependentBranches(t *testing.T) {
+	repoName := "dependents"
+	branchesPath := fmt.Sprintf("/api/repos/%s/branches", repoName)
+
+	main := findBranch(t, importRepo(t, repoName), "main")
+
+	parent := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "parent", ParentId: *main.ID}, http.StatusOK)
+	waitForJob(t, parent.JobID)
+
+	parentBranch := findBranch(t, getRepo(t, repoName), "parent")
+
+	child := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "child", ParentId: *parentBranch.ID}, http.StatusOK)
+	waitForJob(t, child.JobID)
+
+	call[struct{}](t, http.MethodPost, branchesPath+"/parent/close", nil, http.StatusConflict)
+
+	// Cascade closes the child first
+	closed := *call[repoDto.BranchCloseResponse](
+		t,
+		http.MethodPost,
+		branchesPath+"/parent/close",
+		repoDto.BranchClose{Name: "parent", Mode: repoDto.CloseCascade},
+		http.StatusOK,
+	).Data
+
+	if len(closed.Closed) != 2 || closed.Closed[0] != "child" || closed.Closed[1] != "parent" {
+		t.Fatalf("cascade closed %v, want [child parent]", closed.Closed)
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
+
+func TestFailedImport(t *testing.T) {
+	repoName := "failed"
+
+	h.source.FailBackup = true
+	defer func() { h.source.FailBackup = false }()
+
+	imported := call[repoDto.Response](t, http.MethodPost, "/api/repos/import/host", hostImport(repoName), http.StatusOK)
+
+	jobItem := finishJob(t, imported.JobID)
+
+	if db.JobState(jobItem.State) != db.JobFailed {
+		t.Fatalf("import job is %s, want %s", jobItem.State, db.JobFailed)
+	}
+
+	if repoDetail := getRepo(t, repoName); repoDetail.Status != db.RepoFailed {
+		t.Fatalf("repo is %s after the failed import, want %s", repoDetail.Status, db.RepoFailed)
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
+
+func TestFailedStart(t *testing.T) {
+	repoName := "unstartable"
+	branchesPath := fmt.Sprintf("/api/repos/%s/branches", repoName)
+
+	main := findBranch(t, importRepo(t, repoName), "main")
+
+	h.manager.FailStart = true
+	defer func() { h.manager.FailStart = false }()
+
+	created := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "broken", ParentId: *main.ID}, http.StatusOK)
+
+	if jobItem := finishJob(t, created.JobID); db.JobState(jobItem.State) != db.JobFailed {
+		t.Fatalf("start job is %s, want %s", jobItem.State, db.JobFailed)
+	}
+
+	broken := findBranch(t, getRepo(t, repoName), "broken")
+	requireBranch(t, broken, db.BranchOpen, db.BranchPgFailed)
+
+	h.manager.FailStart = false
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
+
+func TestResizePool(t *testing.T) {
+	repoName := "resized"
+	importRepo(t, repoName)
+
+	resized := call[struct{}](t, http.MethodPatch, "/api/repos/"+repoName+"/pool", repoDto.PoolResize{SizeInMb: 2048}, http.StatusAccepted)
+	waitForJob(t, resized.JobID)
+
+	if repoDetail := getRepo(t, repoName); repoDetail.Pool.SizeInMb != 2048 {
+		t.Fatalf("pool is %d MB after the resize, want 2048 MB", repoDetail.Pool.SizeInMb)
+	}
+
+	// Shrinking is refused before a job is started
+	call[struct{}](t, http.MethodPatch, "/api/repos/"+repoName+"/pool", repoDto.PoolResize{SizeInMb: 1024}, http.StatusBadRequest)
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
+
+func TestScrub(t *testing.T) {
+	repoName := "scrubbed"
+	importRepo(t, repoName)
+
+	scrubbed := call[struct{}](t, http.MethodPost, "/api/repos/"+repoName+"/scrub", nil, http.StatusAccepted)
+	waitForJob(t, scrubbed.JobID)
+
+	poolHealth := *call[health.Response](t, http.MethodGet, "/api/repos/"+repoName+"/health", nil, http.StatusOK).Data
+	if len(poolHealth.Scrubs) == 0 || poolHealth.Scrubs[0].Status != db.ScrubFinished {
+		t.Fatalf("scrub wasn't recorded as finished: %+v", poolHealth.Scrubs)
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
+
+func TestReparentSkipsClosedDependents(t *testing.T) {
+	repoName := "reparent"
+	branchesPath := fmt.Sprintf("/api/repos/%s/branches", repoName)
+
+	main := findBranch(t, importRepo(t, repoName), "main")
+
+	parent := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: "parent", ParentId: *main.ID}, http.StatusOK)
+	waitForJob(t, parent.JobID)
+
+	parentBranch := findBranch(t, getRepo(t, repoName), "parent")
+
+	// The newest fork of the parent is closed, only the older one can take over
+	for _, name := range []string{"older", "newer"} {
+		child := call[struct{}](t, http.MethodPost, branchesPath, repoDto.BranchInit{Name: name, ParentId: *parentBranch.ID}, http.StatusOK)
+		waitForJob(t, child.JobID)
+	}
+
+	call[repoDto.BranchCloseResponse](t, http.MethodPost, branchesPath+"/newer/close", nil, http.StatusOK)
+
+	closed := *call[repoDto.BranchCloseResponse](
+		t,
+		http.MethodPost,
+		branchesPath+"/parent/close",
+		repoDto.BranchClose{Name: "parent", Mode: repoDto.CloseReparent},
+		http.StatusOK,
+	).Data
+
+	if len(closed.Promoted) != 1 || closed.Promoted[0] != repoName+"/older" {
+		t.Fatalf("reparent promoted %v, want [%s/older]", closed.Promoted, repoName)
+	}
+
+	repoDetail := getRepo(t, repoName)
+	requireBranch(t, findBranch(t, repoDetail, "parent"), db.BranchClosed, db.BranchPgStopped)
+	requireBranch(t, findBranch(t, repoDetail, "older"), db.BranchOpen, db.BranchPgRunning)
+
+	if older := findBranch(t, repoDetail, "older"); older.ParentID == nil || *older.ParentID != *main.ID {
+		t.Errorf("promoted branch has parent %v, want main", older.ParentID)
+	}
+
+	// The closed fork is still cloned from the closed parent
+	if newer := findBranch(t, repoDetail, "newer"); newer.ParentID == nil || *newer.ParentID != *parentBranch.ID {
+		t.Errorf("closed fork has parent %v, want parent", newer.ParentID)
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
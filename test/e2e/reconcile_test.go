@@ -0,0 +1,67 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/dto/reconcile"
+	"github.com/jamius19/postbranch/internal/service/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+)
+
+func TestReconcileAdopt(t *testing.T) {
+	repoName := "reconcile-drift"
+	ctx := context.Background()
+
+	repoDetail := importRepo(t, repoName)
+	main := findBranch(t, repoDetail, "main")
+
+	// A branch being created holds the repo, its new dataset isn't drift yet
+	unlock := repo.LockRepo(*repoDetail.ID)
+	skipped := *call[reconcile.Response](t, http.MethodPost, "/api/admin/reconcile", nil, http.StatusOK).Data
+	unlock()
+
+	if _, ok := skipped.Skipped[repoName]; !ok {
+		t.Fatalf("locked repo wasn't skipped, skipped: %v", skipped.Skipped)
+	}
+
+	snapshot := zfs.DatasetName(repoName, "main") + "@manual"
+	stray := zfs.DatasetName(repoName, "stray")
+
+	if err := h.backend.Snapshot(ctx, snapshot, false); err != nil {
+		t.Fatalf("can't snapshot main: %s", err)
+	}
+
+	if err := h.backend.Clone(ctx, snapshot, stray); err != nil {
+		t.Fatalf("can't clone %s: %s", snapshot, err)
+	}
+
+	fixes := reconcile.Request{Fixes: []reconcile.Fix{{Kind: reconcile.OrphanDataset, Name: stray, Action: reconcile.Adopt}}}
+	adopted := *call[reconcile.Response](t, http.MethodPost, "/api/admin/reconcile", fixes, http.StatusOK).Data
+
+	applied := false
+	for _, drift := range adopted.Drift {
+		if drift.Name == stray && drift.Applied != nil && drift.FixError == nil {
+			applied = true
+		}
+	}
+
+	if !applied {
+		t.Fatalf("adopting %s wasn't applied: %+v", stray, adopted.Drift)
+	}
+
+	branch := findBranch(t, getRepo(t, repoName), "stray")
+	requireBranch(t, branch, db.BranchClosed, db.BranchPgStopped)
+
+	if branch.Port == 0 || branch.Port == main.Port {
+		t.Errorf("adopted branch got port %d, main has %d", branch.Port, main.Port)
+	}
+
+	if branch.ParentID == nil || *branch.ParentID != *main.ID {
+		t.Errorf("adopted branch has parent %v, want main", branch.ParentID)
+	}
+
+	call[int32](t, http.MethodDelete, "/api/repos/"+repoName, nil, http.StatusOK)
+}
@@ -0,0 +1,56 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jamius19/postbranch/internal/db"
+	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/service/auth"
+)
+
+func TestTokenWithoutRepos(t *testing.T) {
+	importRepo(t, "scope-granted")
+	importRepo(t, "scope-other")
+
+	apiToken, plainToken, err := auth.CreateToken(context.Background(), token.Init{
+		Name:  "scope-reader",
+		Role:  db.RoleReadOnly,
+		Repos: []token.Grant{{Repo: "scope-granted"}},
+	})
+
+	if err != nil {
+		t.Fatalf("can't create token: %s", err)
+	}
+
+	callAs[repoDto.Response](t, plainToken, http.MethodGet, "/api/repos/scope-granted", nil, http.StatusOK)
+	callAs[repoDto.Response](t, plainToken, http.MethodGet, "/api/repos/scope-other", nil, http.StatusForbidden)
+
+	// Deleting the repo removes the only grant, the token must not fall back to every repo
+	call[int32](t, http.MethodDelete, "/api/repos/scope-granted", nil, http.StatusOK)
+
+	callAs[repoDto.Response](t, plainToken, http.MethodGet, "/api/repos/scope-other", nil, http.StatusForbidden)
+
+	repos := *callAs[[]repoDto.Response](t, plainToken, http.MethodGet, "/api/repos", nil, http.StatusOK).Data
+	if len(repos) != 0 {
+		t.Errorf("token without repos listed %d repos", len(repos))
+	}
+
+	// An empty list keeps the token scoped, only removing the limit opens every repo
+	tokenPath := fmt.Sprintf("/api/tokens/%d/repos", *apiToken.ID)
+
+	call[token.Response](t, http.MethodPut, tokenPath, []token.Grant{}, http.StatusOK)
+	callAs[repoDto.Response](t, plainToken, http.MethodGet, "/api/repos/scope-other", nil, http.StatusForbidden)
+
+	cleared := *call[token.Response](t, http.MethodDelete, tokenPath, nil, http.StatusOK).Data
+	if cleared.Scoped {
+		t.Error("token is still scoped after removing its limit")
+	}
+
+	callAs[repoDto.Response](t, plainToken, http.MethodGet, "/api/repos/scope-other", nil, http.StatusOK)
+
+	call[int32](t, http.MethodDelete, "/api/repos/scope-other", nil, http.StatusOK)
+}
@@ -0,0 +1,40 @@
+#!/bin/bash
+
+# Sends a pull request fixture to PostBranch the way GitHub or GitLab would
+# Usage: pr-webhook.sh <github|gitlab> <fixture.json> <secret> [server url]
+
+set -euo pipefail
+
+if [ $# -lt 3 ]; then
+  echo "Usage: $0 <github|gitlab> <fixture.json> <secret> [server url]"
+  exit 1
+fi
+
+provider="$1"
+fixture="$2"
+secret="$3"
+server="${4:-http://localhost:9099}"
+
+case "$provider" in
+  github)
+    signature="sha256=$(openssl dgst -sha256 -hmac "$secret" -hex < "$fixture" | awk '{print $NF}')"
+    curl -sS -X POST "$server/api/hooks/github" \
+      -H "Content-Type: application/json" \
+      -H "X-GitHub-Event: pull_request" \
+      -H "X-Hub-Signature-256: $signature" \
+      --data-binary "@$fixture"
+    ;;
+  gitlab)
+    curl -sS -X POST "$server/api/hooks/gitlab" \
+      -H "Content-Type: application/json" \
+      -H "X-Gitlab-Event: Merge Request Hook" \
+      -H "X-Gitlab-Token: $secret" \
+      --data-binary "@$fixture"
+    ;;
+  *)
+    echo "Unknown provider: $provider"
+    exit 1
+    ;;
+esac
+
+echo
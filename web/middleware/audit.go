@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/service/audit"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxAuditedBody keeps large payloads, like pull request events, out of the audit log. Longer
+// bodies are still passed on to the route in full.
+const maxAuditedBody = 64 * 1024
+
+// anonymousActor is recorded for the routes that aren't authenticated with a token
+const anonymousActor = "anonymous"
+
+// Audit records every request that changes something in the audit log, along with who made it,
+// its redacted body and how it ended
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxAuditedBody+1))
+		if err != nil {
+			body = nil
+		}
+
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		auditEvent := model.AuditEvent{
+			Actor:   anonymousActor,
+			Action:  r.Method + " " + chi.RouteContext(r.Context()).RoutePattern(),
+			Target:  r.URL.Path,
+			Outcome: string(db.AuditSucceeded),
+		}
+
+		if caller, ok := auth.CallerFrom(r.Context()); ok {
+			auditEvent.Actor = caller.Token.Name
+			auditEvent.ActorTokenID = caller.Token.ID
+		}
+
+		if len(body) <= maxAuditedBody {
+			auditEvent.Params = audit.Redact(body)
+		}
+
+		statusCode := int32(ww.Status())
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+
+		auditEvent.StatusCode = &statusCode
+
+		if statusCode >= http.StatusBadRequest {
+			auditEvent.Outcome = string(db.AuditFailed)
+
+			if requestErrors, ok := responseerror.ErrorsFrom(r.Context()); ok &&
+				len(requestErrors.Errors) > 0 {
+
+				message := strings.Join(requestErrors.Errors, "; ")
+				auditEvent.Error = &message
+			}
+		}
+
+		audit.Record(r.Context(), auditEvent)
+	})
+}
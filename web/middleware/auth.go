@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strings"
+)
+
+// Authenticate rejects requests without a valid API token and stores the caller in the request
+// context. EventSource can't set headers, event streams can pass the token as a query parameter.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plainToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok && r.Header.Get("Accept") == "text/event-stream" {
+			plainToken = r.URL.Query().Get(accessTokenParam)
+		}
+
+		if plainToken == "" {
+			util.WriteError(w, r, responseerror.From("API token is required"), http.StatusUnauthorized)
+			return
+		}
+
+		caller, err := auth.Authenticate(r.Context(), strings.TrimSpace(plainToken))
+		if errors.Is(err, auth.ErrUnauthorized) {
+			util.WriteError(w, r, responseerror.From("Invalid or expired API token"), http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			util.WriteError(w, r, responseerror.From("Failed to check API token"), http.StatusInternalServerError)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithCaller(r.Context(), caller)))
+	})
+}
+
+// RequireRole only lets callers with at least the given role through. Tokens limited to repos
+// never pass an admin check.
+func RequireRole(role db.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller, ok := auth.CallerFrom(r.Context())
+			if !ok || !caller.Role().Includes(role) || (role == db.RoleAdmin && caller.Repos != nil) {
+				forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRepoRole only lets callers with at least the given role on the repo of the URL through
+func RequireRepoRole(role db.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller, ok := auth.CallerFrom(r.Context())
+			if !ok || !caller.CanAccessRepo(chi.URLParam(r, "repoName"), role) {
+				forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	util.WriteError(w, r, responseerror.From("Insufficient permissions"), http.StatusForbidden)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
+)
+
+// accessTokenParam carries the API token of event streams, EventSource can't set headers
+const accessTokenParam = "access_token"
+
+// redactingLogFormatter logs requests like the default formatter, with the token in the query hidden
+type redactingLogFormatter struct {
+	middleware.DefaultLogFormatter
+}
+
+func (f *redactingLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	query := r.URL.Query()
+	if !query.Has(accessTokenParam) {
+		return f.DefaultLogFormatter.NewLogEntry(r)
+	}
+
+	query.Set(accessTokenParam, "REDACTED")
+
+	// Only the logged copy is changed, the handlers still read the token from the original request
+	redacted := r.Clone(r.Context())
+	redacted.URL.RawQuery = query.Encode()
+	redacted.RequestURI = redacted.URL.RequestURI()
+
+	return f.DefaultLogFormatter.NewLogEntry(redacted)
+}
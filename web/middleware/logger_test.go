@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+type capturingLogger struct {
+	lines []string
+}
+
+func (l *capturingLogger) Print(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(v...))
+}
+
+func TestRequestLogRedactsAccessToken(t *testing.T) {
+	logger := &capturingLogger{}
+	formatter := &redactingLogFormatter{middleware.DefaultLogFormatter{Logger: logger, NoColor: true}}
+
+	var seenToken string
+	handler := middleware.RequestLogger(formatter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenToken = r.URL.Query().Get(accessTokenParam)
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/api/events?access_token=pb_secret&repo=shop", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if seenToken != "pb_secret" {
+		t.Errorf("handler got token %q, want the original one", seenToken)
+	}
+
+	if len(logger.lines) != 1 {
+		t.Fatalf("logged %d lines, want 1", len(logger.lines))
+	}
+
+	if line := logger.lines[0]; strings.Contains(line, "pb_secret") || !strings.Contains(line, "repo=shop") {
+		t.Errorf("request log %q doesn't hide only the token", line)
+	}
+}
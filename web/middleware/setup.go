@@ -6,20 +6,32 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/jamius19/postbranch/internal/logger"
+	"github.com/jamius19/postbranch/internal/opts"
+	"net/http"
 )
 
 func Middlewares(r *chi.Mux, rootCtx context.Context) {
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+	// Requests are authenticated with a token header rather than cookies, so credentials aren't
+	// allowed. Without configured origins no cross-origin requests are allowed at all.
+	corsOptions := cors.Options{
+		AllowedOrigins:   opts.Config.Server.AllowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Last-Event-ID"},
 		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
+		AllowCredentials: false,
 		MaxAge:           300,
-	}))
+	}
+
+	if len(corsOptions.AllowedOrigins) == 0 {
+		corsOptions.AllowOriginFunc = func(r *http.Request, origin string) bool {
+			return false
+		}
+	}
+
+	r.Use(cors.Handler(corsOptions))
 
 	r.Use(middleware.StripSlashes)
-	r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: logger.Logger}))
+	r.Use(middleware.RequestLogger(&redactingLogFormatter{middleware.DefaultLogFormatter{Logger: logger.Logger}}))
 	r.Use(shutdownContext(rootCtx))
 	r.Use(requestError)
 }
@@ -6,7 +6,7 @@ import (
 	"strings"
 )
 
-const ErrorsContextKey = "requestErrors"
+type errorsKey struct{}
 
 type ResponseErrors struct {
 	Errors []string
@@ -16,17 +16,26 @@ func NewRequestErrors() *ResponseErrors {
 	return &ResponseErrors{}
 }
 
+func WithErrors(ctx context.Context, requestErrors *ResponseErrors) context.Context {
+	return context.WithValue(ctx, errorsKey{}, requestErrors)
+}
+
+func ErrorsFrom(ctx context.Context) (*ResponseErrors, bool) {
+	requestErrors, ok := ctx.Value(errorsKey{}).(*ResponseErrors)
+	return requestErrors, ok
+}
+
 func (re *ResponseErrors) Add(error string) {
 	re.Errors = append(re.Errors, error)
 }
 
 func AddError(ctx context.Context, error string) {
-	requestErrors := ctx.Value(ErrorsContextKey).(*ResponseErrors)
+	requestErrors, _ := ErrorsFrom(ctx)
 	requestErrors.Add(error)
 }
 
 func AddAndGetErrors(ctx context.Context, error string) *[]string {
-	requestErrors := ctx.Value(ErrorsContextKey).(*ResponseErrors)
+	requestErrors, _ := ErrorsFrom(ctx)
 
 	if strings.Contains(error, "\n") {
 		requestErrors.Errors = append(requestErrors.Errors, strings.Split(error, "\n")...)
@@ -0,0 +1,156 @@
+package route
+
+import (
+	"encoding/json"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/audit"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+
+	// auditExportBatch is how many events are read at a time while exporting the whole log
+	auditExportBatch = 1000
+)
+
+// ListAuditEvents returns the audit log filtered by the actor, action, target, outcome, since and
+// until query parameters. With format=jsonl every matching event is exported as JSON lines, oldest
+// first.
+func ListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := db.AuditFilter{
+		Actor:   query.Get("actor"),
+		Action:  query.Get("action"),
+		Target:  query.Get("target"),
+		Outcome: query.Get("outcome"),
+		Limit:   defaultAuditLimit,
+	}
+
+	for param, value := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if query.Get(param) == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, query.Get(param))
+		if err != nil {
+			util.WriteError(w, r, responseerror.From("Invalid "+param+", expected an RFC 3339 time"), http.StatusBadRequest)
+			return
+		}
+
+		*value = &parsed
+	}
+
+	if query.Get("format") == "jsonl" {
+		exportAuditEvents(w, r, filter)
+		return
+	}
+
+	// Polling with afterId returns the events recorded since, oldest first
+	if afterId := query.Get("afterId"); afterId != "" {
+		parsedAfterId, err := strconv.ParseInt(afterId, 10, 32)
+		if err != nil || parsedAfterId < 0 {
+			util.WriteError(w, r, responseerror.From("Invalid afterId"), http.StatusBadRequest)
+			return
+		}
+
+		filter.AfterID = int32(parsedAfterId)
+		filter.OldestFirst = true
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxAuditLimit {
+			util.WriteError(w, r, responseerror.From("Invalid limit"), http.StatusBadRequest)
+			return
+		}
+
+		filter.Limit = parsedLimit
+	}
+
+	auditEvents, err := db.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list audit events"), http.StatusInternalServerError)
+		return
+	}
+
+	auditResponses := make([]audit.Response, 0, len(auditEvents))
+	for _, auditEvent := range auditEvents {
+		auditResponses = append(auditResponses, auditResponse(auditEvent))
+	}
+
+	response := dto.Response[[]audit.Response]{
+		Data:   &auditResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func exportAuditEvents(w http.ResponseWriter, r *http.Request, filter db.AuditFilter) {
+	filter.Limit = auditExportBatch
+	filter.OldestFirst = true
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+	encoder := json.NewEncoder(w)
+	headerWritten := false
+
+	for {
+		auditEvents, err := db.ListAuditEvents(r.Context(), filter)
+		if err != nil {
+			if !headerWritten {
+				util.WriteError(w, r, responseerror.From("Failed to export audit events"), http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		if !headerWritten {
+			w.WriteHeader(http.StatusOK)
+			headerWritten = true
+		}
+
+		for _, auditEvent := range auditEvents {
+			if err := encoder.Encode(auditResponse(auditEvent)); err != nil {
+				return
+			}
+		}
+
+		if len(auditEvents) < auditExportBatch {
+			return
+		}
+
+		filter.AfterID = *auditEvents[len(auditEvents)-1].ID
+	}
+}
+
+func auditResponse(auditEvent model.AuditEvent) audit.Response {
+	response := audit.Response{
+		ID:           auditEvent.ID,
+		Actor:        auditEvent.Actor,
+		ActorTokenID: auditEvent.ActorTokenID,
+		Action:       auditEvent.Action,
+		Target:       auditEvent.Target,
+		Outcome:      db.AuditOutcome(auditEvent.Outcome),
+		StatusCode:   auditEvent.StatusCode,
+		Error:        auditEvent.Error,
+		CreatedAt:    auditEvent.CreatedAt,
+	}
+
+	if auditEvent.Params != nil {
+		response.Params = json.RawMessage(*auditEvent.Params)
+	}
+
+	return response
+}
@@ -2,115 +2,444 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/go-chi/chi/v5"
+	"github.com/go-jet/jet/v2/qrm"
 	"github.com/jamius19/postbranch/internal/db"
 	"github.com/jamius19/postbranch/internal/db/gen/model"
 	"github.com/jamius19/postbranch/internal/dto"
+	jobDto "github.com/jamius19/postbranch/internal/dto/job"
 	"github.com/jamius19/postbranch/internal/dto/repo"
+	"github.com/jamius19/postbranch/internal/service/auth"
 	repoSvc "github.com/jamius19/postbranch/internal/service/repo"
 	"github.com/jamius19/postbranch/internal/service/validation"
 	"github.com/jamius19/postbranch/internal/util"
 	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
 	"net/http"
 )
 
-func CreateBranch(w http.ResponseWriter, r *http.Request) {
-	repoName := chi.URLParam(r, "repoName")
-	if repoName == "" {
+func (h *Handler) CreateBranch(w http.ResponseWriter, r *http.Request) {
+	var branchInit repo.BranchInit
+	if err := json.NewDecoder(r.Body).Decode(&branchInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(branchInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	branchInit.OwnerTokenID = callerTokenId(r)
+	if branchInit.Owner == nil {
+		branchInit.Owner = callerName(r)
+	}
+
+	branch, startJob, err := h.Repos.CreateBranch(r.Context(), repoDetail, branchInit)
+	if err != nil {
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Repository Name is required"),
+			responseerror.From("Failed to create branch"),
 			http.StatusBadRequest,
 		)
 
 		return
 	}
 
-	var branchInit repo.BranchInit
-	if err := json.NewDecoder(r.Body).Decode(&branchInit); err != nil {
+	response := dto.Response[model.Branch]{
+		Data:  &branch,
+		Error: nil,
+		JobID: startJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) CloseBranch(w http.ResponseWriter, r *http.Request) {
+	var branchClose repo.BranchClose
+	if err := json.NewDecoder(r.Body).Decode(&branchClose); err != nil && !errors.Is(err, io.EOF) {
 		util.WriteError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := validation.Validate(branchInit); err != nil {
+	if branchName := chi.URLParam(r, "branchName"); branchName != "" {
+		branchClose.Name = branchName
+	}
+
+	if err := validation.Validate(branchClose); err != nil {
 		util.WriteError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	repoDetail, err := db.GetRepoByName(r.Context(), repoName)
-	if err != nil {
-		log.Error("Failed to load repo, Invalid Repository Name: %s", repoName)
-
+	if branchClose.Name == "main" {
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Invalid Repository Name"),
-			http.StatusNotFound,
+			responseerror.From("Cannot close main branch"),
+			http.StatusBadRequest,
 		)
+
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
 		return
 	}
 
-	// TODO: Add validation for parent branch status
+	if !authorizeBranch(w, r, repoDetail, branchClose.Name) {
+		return
+	}
+
+	if branchClose.Mode == repo.CloseCascade && !canMaintain(r, repoDetail) {
+		util.WriteError(
+			w,
+			r,
+			responseerror.From("Only maintainers can close dependent branches"),
+			http.StatusForbidden,
+		)
+
+		return
+	}
 
-	branch, err := repoSvc.CreateBranch(r.Context(), repoDetail, branchInit)
+	closeResponse, err := h.Repos.CloseBranch(r.Context(), repoDetail, branchClose)
 	if err != nil {
+		if errors.Is(err, repoSvc.ErrDependentBranches) {
+			util.WriteError(w, r, err, http.StatusConflict)
+			return
+		}
+
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Failed to create branch"),
+			responseerror.From("Failed to close branch"),
 			http.StatusBadRequest,
 		)
 
 		return
 	}
 
+	response := dto.Response[repo.BranchCloseResponse]{
+		Data:  &closeResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func ReopenBranch(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	if !authorizeBranch(w, r, repoDetail, chi.URLParam(r, "branchName")) {
+		return
+	}
+
+	branch, startJob, err := repoSvc.ReopenBranch(r.Context(), repoDetail, chi.URLParam(r, "branchName"))
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
 	response := dto.Response[model.Branch]{
 		Data:  &branch,
 		Error: nil,
+		JobID: startJob.ID,
 	}
 
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
-func CloseBranch(w http.ResponseWriter, r *http.Request) {
-	repoName := chi.URLParam(r, "repoName")
-	if repoName == "" {
+func (h *Handler) ExportBranch(w http.ResponseWriter, r *http.Request) {
+	var branchExport repo.BranchExport
+	if err := json.NewDecoder(r.Body).Decode(&branchExport); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(branchExport); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	if !authorizeBranch(w, r, repoDetail, chi.URLParam(r, "branchName")) {
+		return
+	}
+
+	exportJob, err := h.Repos.ExportBranch(r.Context(), repoDetail, chi.URLParam(r, "branchName"), branchExport)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	jobDetail := jobResponse(exportJob, false)
+	response := dto.Response[jobDto.Response]{
+		Data:  &jobDetail,
+		Error: nil,
+		JobID: exportJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusAccepted)
+}
+
+func (h *Handler) ImportBranch(w http.ResponseWriter, r *http.Request) {
+	var branchImport repo.BranchImport
+	if err := json.NewDecoder(r.Body).Decode(&branchImport); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(branchImport); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	branchImport.OwnerTokenID = callerTokenId(r)
+	if branchImport.Owner == nil {
+		branchImport.Owner = callerName(r)
+	}
+
+	importJob, err := h.Repos.ImportBranch(r.Context(), repoDetail, branchImport)
+	if errors.Is(err, repoSvc.ErrOtherRepoExport) {
+		util.WriteError(w, r, err, http.StatusForbidden)
+		return
+	} else if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	jobDetail := jobResponse(importJob, false)
+	response := dto.Response[jobDto.Response]{
+		Data:  &jobDetail,
+		Error: nil,
+		JobID: importJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusAccepted)
+}
+
+// ListBranches lists the branches of the repo, filtered by the owner, status and label selector
+// query parameters
+func ListBranches(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	selector, err := repoSvc.ParseSelector(query.Get("selector"))
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	filter := repoSvc.BranchFilter{
+		Owner:    query.Get("owner"),
+		Status:   query.Get("status"),
+		Selector: selector,
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	branchResponses := []repo.Branch{}
+	for _, branch := range repoSvc.FilterBranches(repoDetail.Branches, filter) {
+		branchResponses = append(branchResponses, repoSvc.BranchResponse(branch))
+	}
+
+	response := dto.Response[[]repo.Branch]{
+		Data:   &branchResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// UpdateBranch sets the owner, description and labels of the branch
+func UpdateBranch(w http.ResponseWriter, r *http.Request) {
+	var metadata repo.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(metadata); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	if !authorizeBranch(w, r, repoDetail, chi.URLParam(r, "branchName")) {
+		return
+	}
+
+	branch, err := repoSvc.UpdateBranchMetadata(r.Context(), repoDetail, chi.URLParam(r, "branchName"), metadata)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	branchResponse := repoSvc.BranchResponse(branch)
+
+	response := dto.Response[repo.Branch]{
+		Data:  &branchResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// BulkCloseBranches closes the open branches matched by a label selector. Developers only close
+// their own branches.
+func (h *Handler) BulkCloseBranches(w http.ResponseWriter, r *http.Request) {
+	var bulkClose repo.BranchBulkClose
+	if err := json.NewDecoder(r.Body).Decode(&bulkClose); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(bulkClose); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	if !canMaintain(r, repoDetail) {
+		if bulkClose.Mode == repo.CloseCascade {
+			util.WriteError(
+				w,
+				r,
+				responseerror.From("Only maintainers can close dependent branches"),
+				http.StatusForbidden,
+			)
+
+			return
+		}
+
+		bulkClose.OwnerTokenID = callerTokenId(r)
+	}
+
+	closeResponse, err := h.Repos.BulkCloseBranches(r.Context(), repoDetail, bulkClose)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	response := dto.Response[repo.BranchBulkCloseResponse]{
+		Data:  &closeResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) GetBranchTree(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	tree, err := h.Repos.BranchTree(r.Context(), repoDetail)
+	if err != nil {
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Repository Name is required"),
-			http.StatusBadRequest,
+			responseerror.From("Failed to read branch hierarchy"),
+			http.StatusInternalServerError,
 		)
 
 		return
 	}
 
-	var branchClose repo.BranchClose
-	if err := json.NewDecoder(r.Body).Decode(&branchClose); err != nil {
+	response := dto.Response[[]repo.BranchNode]{
+		Data:   &tree,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) SetBranchQuota(w http.ResponseWriter, r *http.Request) {
+	var quota repo.Quota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
 		util.WriteError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if err := validation.Validate(branchClose); err != nil {
+	if err := validation.Validate(quota); err != nil {
 		util.WriteError(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	if branchClose.Name == "main" {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	if !authorizeBranch(w, r, repoDetail, chi.URLParam(r, "branchName")) {
+		return
+	}
+
+	branch, err := h.Repos.SetBranchQuota(r.Context(), repoDetail, chi.URLParam(r, "branchName"), quota)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	branchResponse := repoSvc.BranchResponse(branch)
+
+	response := dto.Response[repo.Branch]{
+		Data:  &branchResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// loadRepo loads the repo named in the URL and writes the error response if it can't be found.
+func loadRepo(w http.ResponseWriter, r *http.Request) (db.RepoDetail, bool) {
+	repoName := chi.URLParam(r, "repoName")
+	if repoName == "" {
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Cannot close main branch"),
+			responseerror.From("Repository Name is required"),
 			http.StatusBadRequest,
 		)
 
-		return
+		return db.RepoDetail{}, false
 	}
 
 	repoDetail, err := db.GetRepoByName(r.Context(), repoName)
 	if err != nil {
-		log.Error("Failed to load repo, Invalid Repository Name: %s", repoName)
+		log.Errorf("Failed to load repo, Invalid Repository Name: %s", repoName)
 
 		util.WriteError(
 			w,
@@ -118,20 +447,66 @@ func CloseBranch(w http.ResponseWriter, r *http.Request) {
 			responseerror.From("Invalid Repository Name"),
 			http.StatusNotFound,
 		)
-		return
+
+		return db.RepoDetail{}, false
 	}
 
-	err = repoSvc.CloseBranch(r.Context(), repoDetail, branchClose)
-	if err != nil {
+	return repoDetail, true
+}
+
+// authorizeBranch writes the error response if the caller can't modify the branch, developers can
+// only modify the branches they created. Missing branches are left for the service to report to
+// maintainers only.
+func authorizeBranch(w http.ResponseWriter, r *http.Request, repoDetail db.RepoDetail, branchName string) bool {
+	if canMaintain(r, repoDetail) {
+		return true
+	}
+
+	branch, err := db.GetBranchByName(r.Context(), *repoDetail.Repo.ID, branchName)
+	if errors.Is(err, qrm.ErrNoRows) {
+		util.WriteError(w, r, responseerror.From("Branch not found"), http.StatusNotFound)
+		return false
+	} else if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to check branch"), http.StatusInternalServerError)
+		return false
+	}
+
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok || !caller.CanModifyBranch(repoDetail.Repo.Name, branch) {
 		util.WriteError(
 			w,
 			r,
-			responseerror.From("Failed to close branch"),
-			http.StatusBadRequest,
+			responseerror.From("Developers can only modify their own branches"),
+			http.StatusForbidden,
 		)
 
-		return
+		return false
+	}
+
+	return true
+}
+
+func canMaintain(r *http.Request, repoDetail db.RepoDetail) bool {
+	caller, ok := auth.CallerFrom(r.Context())
+	return ok && caller.CanAccessRepo(repoDetail.Repo.Name, db.RoleMaintainer)
+}
+
+// callerName is the default owner of what the request creates, the name of its token
+func callerName(r *http.Request) *string {
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok {
+		return nil
+	}
+
+	return &caller.Token.Name
+}
+
+// callerTokenId returns the token of the request, branches created with it are owned by it
+func callerTokenId(r *http.Request) *int32 {
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok {
+		return nil
 	}
 
-	return
+	return caller.Token.ID
 }
@@ -0,0 +1,121 @@
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jamius19/postbranch/internal/event"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heartbeatInterval keeps idle streams from being closed by proxies
+const heartbeatInterval = 15 * time.Second
+
+// StreamEvents sends repo, branch and job events as server-sent events. Clients resume with the
+// Last-Event-ID header, or the lastEventId query parameter for the first connection. A reset event
+// tells the client that events were missed and its state has to be reloaded.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		util.WriteError(w, r, responseerror.From("Streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+
+	filter := event.Filter{
+		Repo:   query.Get("repo"),
+		Branch: query.Get("branch"),
+	}
+
+	if types := query.Get("type"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			filter.Types = append(filter.Types, event.Type(strings.TrimSpace(eventType)))
+		}
+	}
+
+	if caller, ok := auth.CallerFrom(r.Context()); ok && caller.Repos != nil {
+		// Collect returns nil for a token without grants, which would match every repo
+		filter.Repos = slices.AppendSeq(make([]string, 0, len(caller.Repos)), maps.Keys(caller.Repos))
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = query.Get("lastEventId")
+	}
+
+	var lastId int64
+	if lastEventId != "" {
+		var err error
+
+		lastId, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			util.WriteError(w, r, responseerror.From("Invalid Last-Event-ID"), http.StatusBadRequest)
+			return
+		}
+	}
+
+	subscription, missed, complete := event.Subscribe(filter, lastId)
+	defer event.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		_, _ = fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+
+	for _, missedEvent := range missed {
+		if err := writeEvent(w, missedEvent); err != nil {
+			return
+		}
+	}
+
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case newEvent, ok := <-subscription.Events:
+			// The subscription is dropped when the client falls behind, it can resume from the buffer
+			if !ok {
+				return
+			}
+
+			if err := writeEvent(w, newEvent); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, newEvent event.Event) error {
+	data, err := json.Marshal(newEvent)
+	if err != nil {
+		log.Errorf("Can't marshal event %d: %s", newEvent.ID, err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", newEvent.ID, newEvent.Type, data)
+	return err
+}
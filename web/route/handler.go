@@ -0,0 +1,48 @@
+package route
+
+import (
+	"github.com/jamius19/postbranch/internal/service/health"
+	"github.com/jamius19/postbranch/internal/service/pg/adapter/host"
+	"github.com/jamius19/postbranch/internal/service/preview"
+	"github.com/jamius19/postbranch/internal/service/reconcile"
+	"github.com/jamius19/postbranch/internal/service/replication"
+	"github.com/jamius19/postbranch/internal/service/repo"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+)
+
+// Services are the ZFS backed services, they're created once at startup with the same backend
+type Services struct {
+	Zfs         *zfs.Zfs
+	Repos       *repo.Service
+	Health      *health.Service
+	Previews    *preview.Service
+	Reconciler  *reconcile.Service
+	Replication *replication.Service
+	Importer    *host.Importer
+}
+
+// NewServices creates the services on the given backend, the loop devices of virtual pools and the
+// host Postgres clusters are imported from
+func NewServices(zfsBackend zfs.Backend, devices zfs.Devices, source host.Source) Services {
+	zfsSvc := zfs.New(zfsBackend, devices)
+	repos := repo.NewService(zfsSvc)
+
+	return Services{
+		Zfs:         zfsSvc,
+		Repos:       repos,
+		Health:      health.NewService(zfsSvc),
+		Previews:    preview.NewService(repos),
+		Reconciler:  reconcile.NewService(zfsSvc),
+		Replication: replication.NewService(zfsSvc),
+		Importer:    host.NewImporter(zfsSvc, source),
+	}
+}
+
+// Handler serves the routes that call the ZFS backed services
+type Handler struct {
+	Services
+}
+
+func NewHandler(services Services) *Handler {
+	return &Handler{Services: services}
+}
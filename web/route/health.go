@@ -0,0 +1,51 @@
+package route
+
+import (
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/health"
+	jobDto "github.com/jamius19/postbranch/internal/dto/job"
+	"github.com/jamius19/postbranch/internal/util"
+	"net/http"
+)
+
+func (h *Handler) GetPoolHealth(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	poolHealth, err := h.Health.Health(r.Context(), repoDetail)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.Response[health.Response]{
+		Data:  &poolHealth,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) StartScrub(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	scrubJob, err := h.Health.StartScrub(r.Context(), repoDetail)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	jobDetail := jobResponse(scrubJob, false)
+	response := dto.Response[jobDto.Response]{
+		Data:  &jobDetail,
+		Error: nil,
+		JobID: scrubJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusAccepted)
+}
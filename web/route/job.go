@@ -0,0 +1,142 @@
+package route
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/job"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultJobLimit = 50
+	maxJobLimit     = 500
+)
+
+func ListJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := db.JobFilter{
+		Type:  query.Get("type"),
+		State: query.Get("state"),
+		Repo:  query.Get("repo"),
+		Limit: defaultJobLimit,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		parsedLimit, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || parsedLimit <= 0 || parsedLimit > maxJobLimit {
+			util.WriteError(w, r, responseerror.From("Invalid limit"), http.StatusBadRequest)
+			return
+		}
+
+		filter.Limit = parsedLimit
+	}
+
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok {
+		util.WriteError(w, r, responseerror.From("API token is required"), http.StatusUnauthorized)
+		return
+	}
+
+	if caller.Repos != nil {
+		filter.Repos = readableRepos(caller)
+	}
+
+	jobs, err := db.ListJobs(r.Context(), filter)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list jobs"), http.StatusInternalServerError)
+		return
+	}
+
+	jobResponses := make([]job.Response, 0, len(jobs))
+	for _, jobItem := range jobs {
+		jobResponses = append(jobResponses, jobResponse(jobItem, false))
+	}
+
+	response := dto.Response[[]job.Response]{
+		Data:   &jobResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func GetJob(w http.ResponseWriter, r *http.Request) {
+	jobId, err := strconv.ParseInt(chi.URLParam(r, "jobId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Job Id"), http.StatusBadRequest)
+		return
+	}
+
+	jobItem, err := db.GetJob(r.Context(), int32(jobId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Job not found"), http.StatusNotFound)
+		return
+	}
+
+	if !canReadJob(r, jobItem) {
+		util.WriteError(w, r, responseerror.From("Job not found"), http.StatusNotFound)
+		return
+	}
+
+	jobDetail := jobResponse(jobItem, true)
+
+	response := dto.Response[job.Response]{
+		Data:  &jobDetail,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// canReadJob tells whether the caller can access the repo the job ran on
+func canReadJob(r *http.Request, jobItem model.Job) bool {
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok {
+		return false
+	}
+
+	repoName, _, _ := strings.Cut(jobItem.Target, "/")
+	return caller.CanAccessRepo(repoName, db.RoleReadOnly)
+}
+
+// readableRepos lists the repos a caller limited to some repos can read the jobs of
+func readableRepos(caller auth.Caller) []string {
+	repos := make([]string, 0, len(caller.Repos))
+	for repoName := range caller.Repos {
+		if caller.CanAccessRepo(repoName, db.RoleReadOnly) {
+			repos = append(repos, repoName)
+		}
+	}
+
+	return repos
+}
+
+// jobResponse leaves out the command output from job lists, it can be large
+func jobResponse(jobItem model.Job, withOutput bool) job.Response {
+	response := job.Response{
+		ID:         jobItem.ID,
+		Type:       db.JobType(jobItem.Type),
+		Target:     jobItem.Target,
+		State:      db.JobState(jobItem.State),
+		Progress:   jobItem.Progress,
+		Step:       jobItem.Step,
+		Error:      jobItem.Error,
+		StartedAt:  jobItem.StartedAt,
+		FinishedAt: jobItem.FinishedAt,
+	}
+
+	if withOutput {
+		response.Output = jobItem.Output
+	}
+
+	return response
+}
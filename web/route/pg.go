@@ -4,13 +4,12 @@ import (
 	"encoding/json"
 	"github.com/jamius19/postbranch/internal/dto"
 	"github.com/jamius19/postbranch/internal/dto/pg"
-	"github.com/jamius19/postbranch/internal/service/pg/adapter/host"
 	"github.com/jamius19/postbranch/internal/service/validation"
 	"github.com/jamius19/postbranch/internal/util"
 	"net/http"
 )
 
-func ValidateHostPg(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ValidateHostPg(w http.ResponseWriter, r *http.Request) {
 	log.Info("Starting validation of host pg")
 
 	var pgInit pg.HostImportReqDto
@@ -24,13 +23,13 @@ func ValidateHostPg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := host.Validate(pgInit)
+	err := h.Importer.Validate(r.Context(), pgInit)
 	if err != nil {
 		util.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	clusterSizeInMb, err := host.GetClusterSize(pgInit)
+	clusterSizeInMb, err := h.Importer.ClusterSize(pgInit)
 	if err != nil {
 		util.WriteError(w, r, err, http.StatusInternalServerError)
 		return
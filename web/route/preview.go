@@ -0,0 +1,158 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/preview"
+	previewSvc "github.com/jamius19/postbranch/internal/service/preview"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxPullRequestPayload is well above the size of pull request events, which include the full
+// repository and user objects
+const maxPullRequestPayload = 10 * 1024 * 1024
+
+func ListPrPreviews(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	previews, err := db.ListRepoPrPreviews(r.Context(), *repoDetail.Repo.ID)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list previews"), http.StatusInternalServerError)
+		return
+	}
+
+	previewResponses := make([]preview.Response, 0, len(previews))
+	for _, repoPreview := range previews {
+		previewResponses = append(previewResponses, previewResponse(repoPreview))
+	}
+
+	response := dto.Response[[]preview.Response]{
+		Data:   &previewResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func CreatePrPreview(w http.ResponseWriter, r *http.Request) {
+	var previewInit preview.Init
+	if err := json.NewDecoder(r.Body).Decode(&previewInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(previewInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	repoPreview, err := previewSvc.CreatePreview(r.Context(), repoDetail, previewInit)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	writePreview(w, r, repoPreview)
+}
+
+func DeletePrPreview(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	previewId, err := strconv.ParseInt(chi.URLParam(r, "previewId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Preview Id"), http.StatusBadRequest)
+		return
+	}
+
+	repoPreview, err := db.GetPrPreview(r.Context(), *repoDetail.Repo.ID, int32(previewId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Preview not found"), http.StatusNotFound)
+		return
+	}
+
+	if err := db.DeletePrPreview(r.Context(), *repoPreview.ID); err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to delete preview"), http.StatusInternalServerError)
+		return
+	}
+
+	writePreview(w, r, repoPreview)
+}
+
+// ReceivePullRequest handles the pull request webhooks of GitHub and GitLab. The branches of every
+// repo the project is mapped to are opened or closed along with the pull request.
+func (h *Handler) ReceivePullRequest(w http.ResponseWriter, r *http.Request) {
+	provider := db.GitProvider(chi.URLParam(r, "provider"))
+	if provider != db.GitHub && provider != db.GitLab {
+		util.WriteError(w, r, responseerror.From("Unknown git provider"), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPullRequestPayload))
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.Previews.Handle(r.Context(), provider, r.Header, body)
+	if err != nil {
+		if errors.Is(err, previewSvc.ErrUnverified) {
+			util.WriteError(w, r, responseerror.From("Invalid signature"), http.StatusUnauthorized)
+			return
+		}
+
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	response := dto.Response[[]preview.Result]{
+		Data:   &results,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func writePreview(w http.ResponseWriter, r *http.Request, repoPreview model.PrPreview) {
+	previewDetail := previewResponse(repoPreview)
+
+	response := dto.Response[preview.Response]{
+		Data:  &previewDetail,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func previewResponse(repoPreview model.PrPreview) preview.Response {
+	return preview.Response{
+		ID:           repoPreview.ID,
+		Provider:     db.GitProvider(repoPreview.Provider),
+		Project:      repoPreview.Project,
+		ParentBranch: repoPreview.ParentBranch,
+		BranchPrefix: repoPreview.BranchPrefix,
+		CreatedAt:    repoPreview.CreatedAt,
+		UpdatedAt:    repoPreview.UpdatedAt,
+	}
+}
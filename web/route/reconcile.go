@@ -0,0 +1,41 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/reconcile"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
+	"net/http"
+)
+
+// Reconcile reports the drift between the database and ZFS/Postgres, and fixes the drift listed in
+// the request. A request without a body only reports.
+func (h *Handler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	var reconcileReq reconcile.Request
+	if err := json.NewDecoder(r.Body).Decode(&reconcileReq); err != nil && !errors.Is(err, io.EOF) {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(reconcileReq); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	reconcileResponse, err := h.Reconciler.Run(r.Context(), reconcileReq.Fixes)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to reconcile"), http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.Response[reconcile.Response]{
+		Data:  &reconcileResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
@@ -0,0 +1,177 @@
+package route
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/replication"
+	replicationSvc "github.com/jamius19/postbranch/internal/service/replication"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strconv"
+)
+
+func ListReplicationTargets(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	targets, err := db.ListRepoReplicationTargets(r.Context(), *repoDetail.Repo.ID)
+	if err != nil {
+		util.WriteError(
+			w,
+			r,
+			responseerror.From("Failed to list replication targets"),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	targetResponses := make([]replication.TargetResponse, 0, len(targets))
+	for _, target := range targets {
+		targetResponses = append(targetResponses, replicationSvc.TargetResponse(repoDetail, target))
+	}
+
+	response := dto.Response[[]replication.TargetResponse]{
+		Data:   &targetResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func CreateReplicationTarget(w http.ResponseWriter, r *http.Request) {
+	var targetInit replication.TargetInit
+	if err := json.NewDecoder(r.Body).Decode(&targetInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(targetInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	target, err := replicationSvc.CreateTarget(r.Context(), repoDetail, targetInit)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	writeTarget(w, r, repoDetail, target, http.StatusOK)
+}
+
+func GetReplicationTarget(w http.ResponseWriter, r *http.Request) {
+	repoDetail, target, ok := loadTarget(w, r)
+	if !ok {
+		return
+	}
+
+	writeTarget(w, r, repoDetail, target, http.StatusOK)
+}
+
+func (h *Handler) DeleteReplicationTarget(w http.ResponseWriter, r *http.Request) {
+	repoDetail, target, ok := loadTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Replication.DeleteTarget(r.Context(), target); err != nil {
+		if errors.Is(err, replicationSvc.ErrSyncInProgress) {
+			util.WriteError(w, r, responseerror.From("Replication is in progress"), http.StatusConflict)
+			return
+		}
+
+		util.WriteError(
+			w,
+			r,
+			responseerror.From("Failed to delete replication target"),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	writeTarget(w, r, repoDetail, target, http.StatusOK)
+}
+
+func (h *Handler) SyncReplicationTarget(w http.ResponseWriter, r *http.Request) {
+	repoDetail, target, ok := loadTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if replicationSvc.IsSyncing(*target.ID) {
+		util.WriteError(w, r, responseerror.From("Replication is in progress"), http.StatusConflict)
+		return
+	}
+
+	// The send can take a long time, so it runs as a job
+	syncJob, err := h.Replication.StartSync(repoDetail, target)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to start replication"), http.StatusInternalServerError)
+		return
+	}
+
+	targetResponse := replicationSvc.TargetResponse(repoDetail, target)
+
+	response := dto.Response[replication.TargetResponse]{
+		Data:  &targetResponse,
+		Error: nil,
+		JobID: syncJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusAccepted)
+}
+
+func loadTarget(w http.ResponseWriter, r *http.Request) (db.RepoDetail, model.ReplicationTarget, bool) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return db.RepoDetail{}, model.ReplicationTarget{}, false
+	}
+
+	targetId, err := strconv.ParseInt(chi.URLParam(r, "targetId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Replication Target Id"), http.StatusBadRequest)
+		return db.RepoDetail{}, model.ReplicationTarget{}, false
+	}
+
+	target, err := db.GetReplicationTarget(r.Context(), *repoDetail.Repo.ID, int32(targetId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Replication Target not found"), http.StatusNotFound)
+		return db.RepoDetail{}, model.ReplicationTarget{}, false
+	}
+
+	return repoDetail, target, true
+}
+
+func writeTarget(
+	w http.ResponseWriter,
+	r *http.Request,
+	repoDetail db.RepoDetail,
+	target model.ReplicationTarget,
+	status int,
+) {
+
+	targetResponse := replicationSvc.TargetResponse(repoDetail, target)
+
+	response := dto.Response[replication.TargetResponse]{
+		Data:  &targetResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, status)
+}
@@ -2,24 +2,27 @@ package route
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/jamius19/postbranch/internal/db"
 	"github.com/jamius19/postbranch/internal/dto"
+	jobDto "github.com/jamius19/postbranch/internal/dto/job"
 	"github.com/jamius19/postbranch/internal/dto/pg"
 	repoDto "github.com/jamius19/postbranch/internal/dto/repo"
 	"github.com/jamius19/postbranch/internal/logger"
-	"github.com/jamius19/postbranch/internal/service/pg/adapter/host"
+	"github.com/jamius19/postbranch/internal/service/auth"
 	"github.com/jamius19/postbranch/internal/service/repo"
 	"github.com/jamius19/postbranch/internal/service/validation"
 	"github.com/jamius19/postbranch/internal/util"
 	"github.com/jamius19/postbranch/web/responseerror"
+	"io"
 	"net/http"
 )
 
 var log = logger.Logger
 
-func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 	log.Info("Initializing host repo")
 
 	var repoInit repoDto.InitDto[pg.HostImportReqDto]
@@ -29,6 +32,10 @@ func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if repoInit.RepoConfig.Owner == nil {
+		repoInit.RepoConfig.Owner = callerName(r)
+	}
+
 	if err := validation.Validate(repoInit); err != nil {
 		util.WriteError(w, r, err, http.StatusBadRequest)
 		return
@@ -57,7 +64,7 @@ func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := host.Validate(repoInit.PgConfig); err != nil {
+	if err := h.Importer.Validate(r.Context(), repoInit.PgConfig); err != nil {
 		util.WriteError(
 			w,
 			r,
@@ -68,7 +75,7 @@ func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clusterSize, err := host.GetClusterSize(repoInit.PgConfig)
+	clusterSize, err := h.Importer.ClusterSize(repoInit.PgConfig)
 	if err != nil {
 		util.WriteError(
 			w,
@@ -99,14 +106,18 @@ func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	repoInfo, pool, err := repo.InitializeRepo(r.Context(), &repoInit, &repoInit.PgConfig)
+	repoInfo, pool, err := h.Repos.InitializeRepo(r.Context(), &repoInit, &repoInit.PgConfig)
 
 	if err != nil {
 		util.WriteError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	host.Import(repoInit.PgConfig, repoInfo, pool)
+	importJob, err := h.Importer.Import(repoInit.PgConfig, repoInfo, pool)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to start import"), http.StatusInternalServerError)
+		return
+	}
 
 	poolResponse := repoDto.Pool{
 		ID:       pool.ID,
@@ -128,12 +139,13 @@ func InitializeHostRepo(w http.ResponseWriter, r *http.Request) {
 	response := dto.Response[repoDto.Response]{
 		Data:  &repoResponse,
 		Error: nil,
+		JobID: importJob.ID,
 	}
 
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
-func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 	repoName := chi.URLParam(r, "repoName")
 	if repoName == "" {
 		util.WriteError(
@@ -161,7 +173,7 @@ func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 
 	repoDetail, err := db.GetRepoByName(r.Context(), repoName)
 	if err != nil {
-		log.Error("Failed to load repo, Invalid Repository Name: %s", repoName)
+		log.Errorf("Failed to load repo, Invalid Repository Name: %s", repoName)
 
 		util.WriteError(
 			w,
@@ -172,7 +184,7 @@ func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := host.Validate(pgConfig); err != nil {
+	if err := h.Importer.Validate(r.Context(), pgConfig); err != nil {
 		util.WriteError(
 			w,
 			r,
@@ -183,7 +195,7 @@ func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	clusterSize, err := host.GetClusterSize(pgConfig)
+	clusterSize, err := h.Importer.ClusterSize(pgConfig)
 	if err != nil {
 		util.WriteError(
 			w,
@@ -214,7 +226,11 @@ func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	host.Import(pgConfig, repoDetail.Repo, repoDetail.Pool)
+	importJob, err := h.Importer.Import(pgConfig, repoDetail.Repo, repoDetail.Pool)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to start import"), http.StatusInternalServerError)
+		return
+	}
 
 	poolResponse := repoDto.Pool{
 		ID:       repoDetail.Pool.ID,
@@ -237,12 +253,21 @@ func ReInitializeHostPg(w http.ResponseWriter, r *http.Request) {
 	response := dto.Response[repoDto.Response]{
 		Data:  &repoResponse,
 		Error: nil,
+		JobID: importJob.ID,
 	}
 
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
 func ListRepos(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+
+	selector, err := repo.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
 	repos, err := db.ListRepo(r.Context())
 
 	if err != nil {
@@ -253,7 +278,17 @@ func ListRepos(w http.ResponseWriter, r *http.Request) {
 
 	repoResponseList := []repoDto.Response{}
 
+	caller, _ := auth.CallerFrom(r.Context())
+
 	for _, repoDetail := range repos {
+		if !caller.CanAccessRepo(repoDetail.Repo.Name, db.RoleReadOnly) {
+			continue
+		}
+
+		if !repo.MatchesRepo(repoDetail.Repo, owner, selector) {
+			continue
+		}
+
 		repoResponse := getRepoResponse(repoDetail)
 		repoResponseList = append(repoResponseList, repoResponse)
 	}
@@ -267,7 +302,7 @@ func ListRepos(w http.ResponseWriter, r *http.Request) {
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
-func GetRepo(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetRepo(w http.ResponseWriter, r *http.Request) {
 	repoName := chi.URLParam(r, "repoName")
 	if repoName == "" {
 		util.WriteError(
@@ -282,7 +317,7 @@ func GetRepo(w http.ResponseWriter, r *http.Request) {
 
 	repoDetail, err := db.GetRepoByName(r.Context(), repoName)
 	if err != nil {
-		log.Error("Failed to load repo, Invalid Repository Name: %s", repoName)
+		log.Errorf("Failed to load repo, Invalid Repository Name: %s", repoName)
 
 		util.WriteError(
 			w,
@@ -295,6 +330,13 @@ func GetRepo(w http.ResponseWriter, r *http.Request) {
 
 	repoResponse := getRepoResponse(repoDetail)
 
+	// Usage is best effort, the repo is still returned if the pool can't be read
+	if usage, err := h.Repos.Usage(r.Context(), repoDetail); err == nil {
+		repoResponse.Usage = &usage
+	} else {
+		log.Warnf("Failed to get usage of repo %s: %s", repoName, err)
+	}
+
 	response := dto.Response[repoDto.Response]{
 		Data:  &repoResponse,
 		Error: nil,
@@ -303,7 +345,48 @@ func GetRepo(w http.ResponseWriter, r *http.Request) {
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
-func DeleteRepo(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetRepoUsage(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := h.Repos.Usage(r.Context(), repoDetail)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.Response[repoDto.Usage]{
+		Data:  &usage,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) GetDatasetProperties(w http.ResponseWriter, r *http.Request) {
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	properties, err := h.Repos.DatasetProperties(r.Context(), repoDetail)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := dto.Response[[]repoDto.DatasetPropertiesResponse]{
+		Data:   &properties,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) DeleteRepo(w http.ResponseWriter, r *http.Request) {
 	repoName := chi.URLParam(r, "repoName")
 	if repoName == "" {
 		util.WriteError(
@@ -318,7 +401,7 @@ func DeleteRepo(w http.ResponseWriter, r *http.Request) {
 
 	repoDetail, err := db.GetRepoByName(r.Context(), repoName)
 	if err != nil {
-		log.Error("Failed to load repo, Invalid Repository Name: %s", repoName)
+		log.Errorf("Failed to load repo, Invalid Repository Name: %s", repoName)
 
 		util.WriteError(
 			w,
@@ -329,7 +412,7 @@ func DeleteRepo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = repo.DeleteRepo(r.Context(), repoDetail)
+	err = h.Repos.DeleteRepo(r.Context(), repoDetail)
 	if err != nil {
 		util.WriteError(
 			w,
@@ -361,6 +444,155 @@ func DeleteRepo(w http.ResponseWriter, r *http.Request) {
 	util.WriteResponse(w, r, response, http.StatusOK)
 }
 
+func (h *Handler) ResizePool(w http.ResponseWriter, r *http.Request) {
+	var poolResize repoDto.PoolResize
+	if err := json.NewDecoder(r.Body).Decode(&poolResize); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(poolResize); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	resizeJob, err := h.Repos.ResizePool(repoDetail, poolResize.SizeInMb)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	jobDetail := jobResponse(resizeJob, false)
+	response := dto.Response[jobDto.Response]{
+		Data:  &jobDetail,
+		Error: nil,
+		JobID: resizeJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusAccepted)
+}
+
+func SetRepoDefaultQuota(w http.ResponseWriter, r *http.Request) {
+	var quota repoDto.Quota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(quota); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	updatedRepo, err := repo.SetRepoDefaultQuota(r.Context(), repoDetail, quota)
+	if err != nil {
+		util.WriteError(
+			w,
+			r,
+			responseerror.From("Failed to update default quota"),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	repoDetail.Repo = updatedRepo
+	repoResponse := getRepoResponse(repoDetail)
+
+	response := dto.Response[repoDto.Response]{
+		Data:  &repoResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// UpdateRepo sets the owner, description and labels of the repo
+func UpdateRepo(w http.ResponseWriter, r *http.Request) {
+	var metadata repoDto.Metadata
+	if err := json.NewDecoder(r.Body).Decode(&metadata); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(metadata); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	updatedRepo, err := repo.UpdateRepoMetadata(r.Context(), repoDetail, metadata)
+	if err != nil {
+		util.WriteError(
+			w,
+			r,
+			responseerror.From("Failed to update repository"),
+			http.StatusInternalServerError,
+		)
+
+		return
+	}
+
+	repoDetail.Repo = updatedRepo
+	repoResponse := getRepoResponse(repoDetail)
+
+	response := dto.Response[repoDto.Response]{
+		Data:  &repoResponse,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func (h *Handler) UnlockRepo(w http.ResponseWriter, r *http.Request) {
+	var unlock repoDto.Unlock
+	if err := json.NewDecoder(r.Body).Decode(&unlock); err != nil && !errors.Is(err, io.EOF) {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(unlock); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail, ok := loadRepo(w, r)
+	if !ok {
+		return
+	}
+
+	unlockedRepo, unlockJob, err := h.Repos.UnlockRepo(r.Context(), repoDetail, unlock)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	repoDetail.Repo = unlockedRepo
+	repoResponse := getRepoResponse(repoDetail)
+
+	response := dto.Response[repoDto.Response]{
+		Data:  &repoResponse,
+		Error: nil,
+		JobID: unlockJob.ID,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
 func getRepoResponse(repoDetail db.RepoDetail) repoDto.Response {
 	branchesInfo := []repoDto.Branch{}
 
@@ -370,19 +602,13 @@ func getRepoResponse(repoDetail db.RepoDetail) repoDto.Response {
 		Path:      repoDetail.Pool.Path,
 		MountPath: repoDetail.Pool.MountPath,
 		SizeInMb:  repoDetail.Pool.SizeInMb,
+
+		Encryption:  repoDetail.Pool.Encryption,
+		KeyLocation: repoDetail.Pool.KeyLocation,
 	}
 
 	for _, branch := range repoDetail.Branches {
-		branchesInfo = append(branchesInfo, repoDto.Branch{
-			ID:        branch.ID,
-			Name:      branch.Name,
-			Status:    db.BranchStatus(branch.Status),
-			PgStatus:  db.BranchPgStatus(branch.PgStatus),
-			Port:      branch.PgPort,
-			ParentID:  branch.ParentID,
-			CreatedAt: branch.CreatedAt,
-			UpdatedAt: branch.UpdatedAt,
-		})
+		branchesInfo = append(branchesInfo, repo.BranchResponse(branch))
 	}
 
 	repoResponse := repoDto.Response{
@@ -393,8 +619,14 @@ func getRepoResponse(repoDetail db.RepoDetail) repoDto.Response {
 		Output:    repoDetail.Repo.Output,
 		Branches:  branchesInfo,
 		Pool:      poolInfo,
-		CreatedAt: repoDetail.Repo.CreatedAt,
-		UpdatedAt: repoDetail.Repo.UpdatedAt,
+
+		DefaultQuota: repo.RepoDefaultQuota(repoDetail.Repo),
+
+		Owner:       repoDetail.Repo.Owner,
+		Description: repoDetail.Repo.Description,
+		Labels:      repo.Labels(repoDetail.Repo.Labels),
+		CreatedAt:   repoDetail.Repo.CreatedAt,
+		UpdatedAt:   repoDetail.Repo.UpdatedAt,
 	}
 	return repoResponse
 }
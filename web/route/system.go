@@ -0,0 +1,28 @@
+package route
+
+import (
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/system"
+	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/internal/util"
+	"net/http"
+)
+
+func GetZfsVersion(w http.ResponseWriter, r *http.Request) {
+	zfsVersion := system.ZfsVersion{
+		Userland:   zfs.Detected.UserlandRaw,
+		Kmod:       zfs.Detected.KmodRaw,
+		MinVersion: zfs.MinVersion.String(),
+		Capabilities: system.ZfsCapabilities{
+			JsonOutput:   zfs.Features.JsonOutput,
+			BlockCloning: zfs.Features.BlockCloning,
+		},
+	}
+
+	response := dto.Response[system.ZfsVersion]{
+		Data:  &zfsVersion,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
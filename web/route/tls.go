@@ -0,0 +1,25 @@
+package route
+
+import (
+	"github.com/jamius19/postbranch/internal/service/ca"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+)
+
+// GetCACertificate returns the CA the branch certificates are signed with, clients pass it as
+// sslrootcert to connect with sslmode=verify-full
+func GetCACertificate(w http.ResponseWriter, r *http.Request) {
+	certPem, err := ca.Certificate()
+	if err != nil {
+		log.Errorf("Can't load CA certificate: %s", err)
+		util.WriteError(w, r, responseerror.From("Failed to load CA certificate"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", `attachment; filename="postbranch-ca.crt"`)
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = w.Write(certPem)
+}
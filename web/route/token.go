@@ -0,0 +1,194 @@
+package route
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/token"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strconv"
+)
+
+func ListTokens(w http.ResponseWriter, r *http.Request) {
+	apiTokens, err := db.ListAPITokens(r.Context())
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list tokens"), http.StatusInternalServerError)
+		return
+	}
+
+	tokenResponses := make([]token.Response, 0, len(apiTokens))
+	for _, apiToken := range apiTokens {
+		tokenDetail, err := tokenResponse(r, apiToken)
+		if err != nil {
+			util.WriteError(w, r, responseerror.From("Failed to list tokens"), http.StatusInternalServerError)
+			return
+		}
+
+		tokenResponses = append(tokenResponses, tokenDetail)
+	}
+
+	response := dto.Response[[]token.Response]{
+		Data:   &tokenResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func CreateToken(w http.ResponseWriter, r *http.Request) {
+	var tokenInit token.Init
+	if err := json.NewDecoder(r.Body).Decode(&tokenInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(tokenInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	apiToken, plainToken, err := auth.CreateToken(r.Context(), tokenInit)
+	if err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	writeToken(w, r, apiToken, &plainToken)
+}
+
+// GetCurrentToken returns the token the request was made with
+func GetCurrentToken(w http.ResponseWriter, r *http.Request) {
+	caller, ok := auth.CallerFrom(r.Context())
+	if !ok {
+		util.WriteError(w, r, responseerror.From("API token is required"), http.StatusUnauthorized)
+		return
+	}
+
+	writeToken(w, r, caller.Token, nil)
+}
+
+func DeleteToken(w http.ResponseWriter, r *http.Request) {
+	apiToken, ok := loadToken(w, r)
+	if !ok {
+		return
+	}
+
+	if caller, ok := auth.CallerFrom(r.Context()); ok && *caller.Token.ID == *apiToken.ID {
+		util.WriteError(w, r, responseerror.From("Cannot delete the token of the request"), http.StatusBadRequest)
+		return
+	}
+
+	if err := db.DeleteAPIToken(r.Context(), *apiToken.ID); err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to delete token"), http.StatusInternalServerError)
+		return
+	}
+
+	writeToken(w, r, apiToken, nil)
+}
+
+// SetTokenRepos limits the token to the given repos, an empty list leaves it without access to any
+// repo
+func SetTokenRepos(w http.ResponseWriter, r *http.Request) {
+	var repos []token.Grant
+	if err := json.NewDecoder(r.Body).Decode(&repos); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	for _, grant := range repos {
+		if err := validation.Validate(grant); err != nil {
+			util.WriteError(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	apiToken, ok := loadToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := auth.SetTokenRepos(r.Context(), apiToken, repos); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	apiToken.Scoped = true
+
+	writeToken(w, r, apiToken, nil)
+}
+
+// ClearTokenRepos lets the token access every repo again
+func ClearTokenRepos(w http.ResponseWriter, r *http.Request) {
+	apiToken, ok := loadToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := auth.ClearTokenRepos(r.Context(), apiToken); err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to update token"), http.StatusInternalServerError)
+		return
+	}
+
+	apiToken.Scoped = false
+
+	writeToken(w, r, apiToken, nil)
+}
+
+func loadToken(w http.ResponseWriter, r *http.Request) (model.APIToken, bool) {
+	tokenId, err := strconv.ParseInt(chi.URLParam(r, "tokenId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Token Id"), http.StatusBadRequest)
+		return model.APIToken{}, false
+	}
+
+	apiToken, err := db.GetAPIToken(r.Context(), int32(tokenId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Token not found"), http.StatusNotFound)
+		return model.APIToken{}, false
+	}
+
+	return apiToken, true
+}
+
+func writeToken(w http.ResponseWriter, r *http.Request, apiToken model.APIToken, plainToken *string) {
+	tokenDetail, err := tokenResponse(r, apiToken)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to load token"), http.StatusInternalServerError)
+		return
+	}
+
+	tokenDetail.Token = plainToken
+
+	response := dto.Response[token.Response]{
+		Data:  &tokenDetail,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func tokenResponse(r *http.Request, apiToken model.APIToken) (token.Response, error) {
+	repos, err := auth.TokenRepos(r.Context(), *apiToken.ID)
+	if err != nil {
+		return token.Response{}, err
+	}
+
+	return token.Response{
+		ID:         apiToken.ID,
+		Name:       apiToken.Name,
+		Prefix:     apiToken.Prefix,
+		Role:       db.Role(apiToken.Role),
+		Scoped:     apiToken.Scoped,
+		Repos:      repos,
+		ExpiresAt:  apiToken.ExpiresAt,
+		LastUsedAt: apiToken.LastUsedAt,
+		CreatedAt:  apiToken.CreatedAt,
+	}, nil
+}
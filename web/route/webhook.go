@@ -0,0 +1,250 @@
+package route
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/internal/db/gen/model"
+	"github.com/jamius19/postbranch/internal/dto"
+	"github.com/jamius19/postbranch/internal/dto/webhook"
+	"github.com/jamius19/postbranch/internal/service/validation"
+	webhookSvc "github.com/jamius19/postbranch/internal/service/webhook"
+	"github.com/jamius19/postbranch/internal/util"
+	"github.com/jamius19/postbranch/web/responseerror"
+	"net/http"
+	"strconv"
+)
+
+const deliveryLogLimit = 100
+
+func ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := db.ListWebhooks(r.Context())
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list webhooks"), http.StatusInternalServerError)
+		return
+	}
+
+	webhookResponses := make([]webhook.Response, 0, len(hooks))
+	for _, hook := range hooks {
+		webhookResponses = append(webhookResponses, webhookResponse(hook, false))
+	}
+
+	response := dto.Response[[]webhook.Response]{
+		Data:   &webhookResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhookInit webhook.Init
+	if err := json.NewDecoder(r.Body).Decode(&webhookInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(webhookInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := webhookSvc.Create(r.Context(), webhookInit)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to create webhook"), http.StatusInternalServerError)
+		return
+	}
+
+	writeWebhook(w, r, webhookResponse(hook, true))
+}
+
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	writeWebhook(w, r, webhookResponse(hook, false))
+}
+
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhookInit webhook.Init
+	if err := json.NewDecoder(r.Body).Decode(&webhookInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := validation.Validate(webhookInit); err != nil {
+		util.WriteError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	hook, err := webhookSvc.Update(r.Context(), hook, webhookInit)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to update webhook"), http.StatusInternalServerError)
+		return
+	}
+
+	writeWebhook(w, r, webhookResponse(hook, false))
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.DeleteWebhook(r.Context(), *hook.ID); err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to delete webhook"), http.StatusInternalServerError)
+		return
+	}
+
+	writeWebhook(w, r, webhookResponse(hook, false))
+}
+
+func PingWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	delivery, err := webhookSvc.Ping(r.Context(), hook)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to ping webhook"), http.StatusInternalServerError)
+		return
+	}
+
+	writeDelivery(w, r, delivery)
+}
+
+func ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := db.ListWebhookDeliveries(r.Context(), *hook.ID, deliveryLogLimit)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to list webhook deliveries"), http.StatusInternalServerError)
+		return
+	}
+
+	deliveryResponses := make([]webhook.DeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryResponses = append(deliveryResponses, deliveryResponse(delivery))
+	}
+
+	response := dto.Response[[]webhook.DeliveryResponse]{
+		Data:   &deliveryResponses,
+		Error:  nil,
+		IsList: true,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func ReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	hook, ok := loadWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveryId, err := strconv.ParseInt(chi.URLParam(r, "deliveryId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Delivery Id"), http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := db.GetWebhookDelivery(r.Context(), *hook.ID, int32(deliveryId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Delivery not found"), http.StatusNotFound)
+		return
+	}
+
+	replayDelivery, err := webhookSvc.Replay(r.Context(), hook, delivery)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Failed to replay delivery"), http.StatusInternalServerError)
+		return
+	}
+
+	writeDelivery(w, r, replayDelivery)
+}
+
+func loadWebhook(w http.ResponseWriter, r *http.Request) (model.Webhook, bool) {
+	webhookId, err := strconv.ParseInt(chi.URLParam(r, "webhookId"), 10, 32)
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Invalid Webhook Id"), http.StatusBadRequest)
+		return model.Webhook{}, false
+	}
+
+	hook, err := db.GetWebhook(r.Context(), int32(webhookId))
+	if err != nil {
+		util.WriteError(w, r, responseerror.From("Webhook not found"), http.StatusNotFound)
+		return model.Webhook{}, false
+	}
+
+	return hook, true
+}
+
+func writeWebhook(w http.ResponseWriter, r *http.Request, webhookDetail webhook.Response) {
+	response := dto.Response[webhook.Response]{
+		Data:  &webhookDetail,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+func writeDelivery(w http.ResponseWriter, r *http.Request, delivery model.WebhookDelivery) {
+	deliveryDetail := deliveryResponse(delivery)
+
+	response := dto.Response[webhook.DeliveryResponse]{
+		Data:  &deliveryDetail,
+		Error: nil,
+	}
+
+	util.WriteResponse(w, r, response, http.StatusOK)
+}
+
+// webhookResponse only includes the secret right after the webhook is created
+func webhookResponse(hook model.Webhook, withSecret bool) webhook.Response {
+	response := webhook.Response{
+		ID:        hook.ID,
+		URL:       hook.URL,
+		Events:    webhookSvc.Events(hook),
+		Repo:      hook.Repo,
+		Enabled:   hook.Enabled,
+		CreatedAt: hook.CreatedAt,
+		UpdatedAt: hook.UpdatedAt,
+	}
+
+	if withSecret {
+		response.Secret = &hook.Secret
+	}
+
+	return response
+}
+
+func deliveryResponse(delivery model.WebhookDelivery) webhook.DeliveryResponse {
+	return webhook.DeliveryResponse{
+		ID:            delivery.ID,
+		WebhookID:     delivery.WebhookID,
+		Event:         delivery.Event,
+		Payload:       json.RawMessage(delivery.Payload),
+		Status:        db.WebhookDeliveryStatus(delivery.Status),
+		Attempts:      delivery.Attempts,
+		ResponseCode:  delivery.ResponseCode,
+		ResponseBody:  delivery.ResponseBody,
+		Error:         delivery.Error,
+		NextAttemptAt: delivery.NextAttemptAt,
+		DeliveredAt:   delivery.DeliveredAt,
+		ReplayOf:      delivery.ReplayOf,
+		CreatedAt:     delivery.CreatedAt,
+	}
+}
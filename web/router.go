@@ -2,30 +2,127 @@ package web
 
 import (
 	"github.com/go-chi/chi/v5"
+	"github.com/jamius19/postbranch/internal/db"
+	"github.com/jamius19/postbranch/web/middleware"
 	"github.com/jamius19/postbranch/web/route"
 )
 
-func routes(r *chi.Mux) {
+func routes(r *chi.Mux, h *route.Handler) {
 	r.Route("/api", func(r chi.Router) {
-		r.Route("/repos", func(r chi.Router) {
-			r.Get("/", route.ListRepos)
-			r.Get("/{repoName}", route.GetRepo)
-			r.Post("/{repoName}/branch", route.CreateBranch)
-			r.Post("/{repoName}/branch/close", route.CloseBranch)
-
-			// Adapters for different pg sources
-			r.Route("/postgres/validate", func(r chi.Router) {
-				r.Post("/host", route.ValidateHostPg)
+		// Pull request events are verified with the secret of the preview instead of a token
+		r.With(middleware.Audit).Post("/hooks/{provider}", h.ReceivePullRequest)
+
+		// Clients need the CA to verify the branches, it's public like any CA certificate
+		r.Get("/tls/ca", route.GetCACertificate)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Authenticate)
+			r.Use(middleware.Audit)
+
+			readOnly := middleware.RequireRepoRole(db.RoleReadOnly)
+			developer := middleware.RequireRepoRole(db.RoleDeveloper)
+			maintainer := middleware.RequireRepoRole(db.RoleMaintainer)
+			admin := middleware.RequireRole(db.RoleAdmin)
+
+			r.Get("/system/zfs", route.GetZfsVersion)
+
+			r.Get("/events", route.StreamEvents)
+
+			r.Route("/jobs", func(r chi.Router) {
+				r.Get("/", route.ListJobs)
+				r.Get("/{jobId}", route.GetJob)
 			})
 
-			// Adapters for different pg sources
-			r.Route("/import", func(r chi.Router) {
-				r.Post("/host", route.InitializeHostRepo)
-				r.Post("/{repoName}/host", route.ReInitializeHostPg)
+			r.Route("/tokens", func(r chi.Router) {
+				r.Get("/current", route.GetCurrentToken)
+
+				r.Group(func(r chi.Router) {
+					r.Use(admin)
+
+					r.Get("/", route.ListTokens)
+					r.Post("/", route.CreateToken)
+					r.Delete("/{tokenId}", route.DeleteToken)
+					r.Put("/{tokenId}/repos", route.SetTokenRepos)
+					r.Delete("/{tokenId}/repos", route.ClearTokenRepos)
+				})
 			})
 
-			r.Delete("/{repoName}", route.DeleteRepo)
-		})
+			r.With(admin).Get("/audit", route.ListAuditEvents)
+
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(admin)
+
+				r.Post("/reconcile", h.Reconcile)
+			})
 
+			r.Route("/webhooks", func(r chi.Router) {
+				r.Use(admin)
+
+				r.Get("/", route.ListWebhooks)
+				r.Post("/", route.CreateWebhook)
+				r.Get("/{webhookId}", route.GetWebhook)
+				r.Put("/{webhookId}", route.UpdateWebhook)
+				r.Delete("/{webhookId}", route.DeleteWebhook)
+				r.Post("/{webhookId}/ping", route.PingWebhook)
+				r.Get("/{webhookId}/deliveries", route.ListWebhookDeliveries)
+				r.Post("/{webhookId}/deliveries/{deliveryId}/replay", route.ReplayWebhookDelivery)
+			})
+
+			r.Route("/repos", func(r chi.Router) {
+				r.Get("/", route.ListRepos)
+				r.With(readOnly).Get("/{repoName}", h.GetRepo)
+				r.With(maintainer).Patch("/{repoName}", route.UpdateRepo)
+				r.With(readOnly).Get("/{repoName}/usage", h.GetRepoUsage)
+				r.With(readOnly).Get("/{repoName}/properties", h.GetDatasetProperties)
+				r.With(readOnly).Get("/{repoName}/health", h.GetPoolHealth)
+				r.With(maintainer).Post("/{repoName}/scrub", h.StartScrub)
+				r.With(admin).Patch("/{repoName}/pool", h.ResizePool)
+				r.With(maintainer).Patch("/{repoName}/quota", route.SetRepoDefaultQuota)
+				r.With(maintainer).Post("/{repoName}/unlock", h.UnlockRepo)
+				r.With(developer).Post("/{repoName}/branch", h.CreateBranch)
+				r.With(developer).Post("/{repoName}/branch/close", h.CloseBranch)
+
+				// Developers can only modify their own branches, that's checked by the routes
+				r.Route("/{repoName}/branches", func(r chi.Router) {
+					r.With(readOnly).Get("/", route.ListBranches)
+					r.With(developer).Post("/", h.CreateBranch)
+					r.With(readOnly).Get("/tree", h.GetBranchTree)
+					r.With(developer).Post("/import", h.ImportBranch)
+					r.With(developer).Post("/close", h.BulkCloseBranches)
+					r.With(developer).Patch("/{branchName}", route.UpdateBranch)
+					r.With(developer).Post("/{branchName}/close", h.CloseBranch)
+					r.With(developer).Post("/{branchName}/reopen", route.ReopenBranch)
+					r.With(developer).Post("/{branchName}/export", h.ExportBranch)
+					r.With(developer).Patch("/{branchName}/quota", h.SetBranchQuota)
+				})
+
+				r.Route("/{repoName}/previews", func(r chi.Router) {
+					r.With(readOnly).Get("/", route.ListPrPreviews)
+					r.With(maintainer).Post("/", route.CreatePrPreview)
+					r.With(maintainer).Delete("/{previewId}", route.DeletePrPreview)
+				})
+
+				r.Route("/{repoName}/replications", func(r chi.Router) {
+					r.With(readOnly).Get("/", route.ListReplicationTargets)
+					r.With(maintainer).Post("/", route.CreateReplicationTarget)
+					r.With(readOnly).Get("/{targetId}", route.GetReplicationTarget)
+					r.With(maintainer).Delete("/{targetId}", h.DeleteReplicationTarget)
+					r.With(maintainer).Post("/{targetId}/sync", h.SyncReplicationTarget)
+				})
+
+				// Adapters for different pg sources
+				r.Route("/postgres/validate", func(r chi.Router) {
+					r.With(admin).Post("/host", h.ValidateHostPg)
+				})
+
+				// Adapters for different pg sources
+				r.Route("/import", func(r chi.Router) {
+					r.With(admin).Post("/host", h.InitializeHostRepo)
+					r.With(admin).Post("/{repoName}/host", h.ReInitializeHostPg)
+				})
+
+				r.With(admin).Delete("/{repoName}", h.DeleteRepo)
+			})
+		})
 	})
 }
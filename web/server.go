@@ -7,9 +7,13 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/jamius19/postbranch/internal/logger"
 	"github.com/jamius19/postbranch/internal/opts"
-	"github.com/jamius19/postbranch/internal/service/zfs"
+	"github.com/jamius19/postbranch/internal/service/auth"
+	"github.com/jamius19/postbranch/internal/service/ca"
+	"github.com/jamius19/postbranch/internal/service/job"
+	"github.com/jamius19/postbranch/internal/service/webhook"
 	"github.com/jamius19/postbranch/internal/util"
 	"github.com/jamius19/postbranch/web/middleware"
+	"github.com/jamius19/postbranch/web/route"
 	"net/http"
 	"sync"
 	"time"
@@ -17,18 +21,28 @@ import (
 
 var log = logger.Logger
 
-func Initialize(rootCtx context.Context, webWg *sync.WaitGroup) {
+func Initialize(rootCtx context.Context, services route.Services, webWg *sync.WaitGroup) {
 	defer webWg.Done()
 
-	err := zfs.MountAll(rootCtx)
+	job.Initialize(rootCtx)
+
+	if err := auth.Bootstrap(rootCtx); err != nil {
+		log.Fatalf("Failed to create the admin API token. Error: %s", err)
+	}
+
+	if err := ca.Initialize(); err != nil {
+		log.Fatalf("Failed to load the CA of branch certificates. Error: %s", err)
+	}
+
+	err := services.Zfs.MountAll(rootCtx)
 	if err != nil {
-		log.Fatal("Failed to mount ZFS pool(s). Error: %s", err)
+		log.Fatalf("Failed to mount ZFS pool(s). Error: %s", err)
 	}
 
 	select {
 	case <-rootCtx.Done():
 		log.Info("Root context cancelled. Unmounting pools")
-		err := zfs.UnmountAll()
+		err := services.Zfs.UnmountAll(context.WithoutCancel(rootCtx))
 		if err != nil {
 			log.Errorf("Failed to unmount ZFS pool(s). error: %s", err)
 			return
@@ -37,11 +51,13 @@ func Initialize(rootCtx context.Context, webWg *sync.WaitGroup) {
 	default:
 	}
 
-	r := chi.NewRouter()
-	middleware.Middlewares(r, rootCtx)
-	routes(r)
+	r := NewRouter(rootCtx, services)
 
-	log.Infof("Starting server on port %d", opts.Config.Server.Port)
+	if opts.Config.Server.TLS.CertFile != "" {
+		log.Infof("Starting server on port %d with TLS", opts.Config.Server.Port)
+	} else {
+		log.Infof("Starting server on port %d", opts.Config.Server.Port)
+	}
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", opts.Config.Server.Port),
@@ -49,6 +65,12 @@ func Initialize(rootCtx context.Context, webWg *sync.WaitGroup) {
 	}
 
 	go start(srv)
+	go services.Reconciler.Report(rootCtx)
+	go services.Repos.StartPurge(rootCtx)
+	go services.Repos.StartStorageMonitor(rootCtx)
+	go services.Health.Start(rootCtx)
+	go services.Replication.Start(rootCtx)
+	go webhook.Start(rootCtx)
 	util.PrintReadyBanner()
 
 	// Wait for interrupt signal
@@ -57,7 +79,7 @@ func Initialize(rootCtx context.Context, webWg *sync.WaitGroup) {
 		log.Info("Server shutting down")
 	}
 
-	err = zfs.UnmountAll()
+	err = services.Zfs.UnmountAll(context.WithoutCancel(rootCtx))
 	if err != nil {
 		log.Errorf("Failed to unmount ZFS pool(s). error: %s", err)
 	}
@@ -70,8 +92,24 @@ func Initialize(rootCtx context.Context, webWg *sync.WaitGroup) {
 	}
 }
 
+// NewRouter serves the API on top of the given services
+func NewRouter(rootCtx context.Context, services route.Services) *chi.Mux {
+	r := chi.NewRouter()
+	middleware.Middlewares(r, rootCtx)
+	routes(r, route.NewHandler(services))
+
+	return r
+}
+
 func start(server *http.Server) {
-	err := server.ListenAndServe()
+	var err error
+
+	if tlsConfig := opts.Config.Server.TLS; tlsConfig.CertFile != "" {
+		err = server.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Logger.Fatal(err)
 	}